@@ -1,34 +1,397 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 type Config struct {
-	Port               string
+	Port               string // HTTPS (TLS) listener
+	HTTPPort           string // plaintext listener that only redirects to HTTPS
 	DatabasePath       string
 	JWTSecret          string
-	MaxUploadSize      int64
 	StoragePath        string
 	AllowedAudioTypes  []string
 	AllowedImageTypes  []string
 	TLS_KEY_FILE   string
 	TLS_CERT_FILE  string
+
+	// SQLite connection settings
+	DBJournalMode     string
+	DBBusyTimeout     time.Duration
+	DBForeignKeys     bool
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+
+	// CORS settings. An empty origin list means same-origin only.
+	CORSAllowOrigins     []string
+	CORSAllowMethods     string
+	CORSAllowHeaders     string
+	CORSAllowCredentials bool
+
+	// Rate limits per window: anonymous requests are keyed by IP,
+	// authenticated requests by user ID
+	RateLimitIPMax   int
+	RateLimitUserMax int
+	RateLimitWindow  time.Duration
+
+	// ShutdownTimeout bounds how long in-flight requests get to finish
+	ShutdownTimeout time.Duration
+
+	// RequestTimeout bounds how long a request may take before it is
+	// answered with 503. Streams and uploads are exempt; zero disables it
+	RequestTimeout time.Duration
+
+	// TrashRetention is how long a deleted song can still be restored
+	TrashRetention time.Duration
+	// TrashPath holds deleted songs' files until they are purged. It must
+	// be outside StoragePath
+	TrashPath string
+	// UploadTempPath holds chunked uploads until they are assembled. It
+	// must be outside StoragePath too
+	UploadTempPath string
+
+	// StorageAuditInterval is how often orphaned and missing media files
+	// are checked for and logged; zero disables the scheduled audit
+	StorageAuditInterval time.Duration
+
+	// CompressionLevel follows fiber's compress levels: -1 disables, 0 is
+	// the default, 1 favours speed and 2 size. Responses smaller than
+	// CompressionMinSize bytes are sent as is
+	CompressionLevel   int
+	CompressionMinSize int
+
+	// StorageCacheMaxAge is how long browsers may reuse media and images
+	// served from /storage before revalidating
+	StorageCacheMaxAge time.Duration
+
+	// Optional ffmpeg transcoding of user uploads into TranscodeFormat
+	// ("mp3" or "m4a") at TranscodeBitrate
+	TranscodeEnabled bool
+	FFmpegPath       string
+	TranscodeFormat  string
+	TranscodeBitrate string
+	TranscodeTimeout time.Duration
+
+	// CategoryCacheTTL is how long the category list is kept in memory;
+	// zero disables the cache
+	CategoryCacheTTL time.Duration
+
+	// ExplicitCategories names the categories whose songs safe mode hides.
+	// SafeModeDefault turns safe mode on for requests that don't choose
+	ExplicitCategories []string
+	SafeModeDefault    bool
+
+	// Search queries shorter than SearchMinQueryLength or longer than
+	// SearchMaxQueryLength characters are refused
+	SearchMinQueryLength int
+	SearchMaxQueryLength int
+
+	// MaxPlaylistSongs caps how many songs one playlist can hold
+	MaxPlaylistSongs int
+	// MaxPlaylistsPerUser caps how many playlists one user can own
+	MaxPlaylistsPerUser int
+
+	// IdempotencyTTL is how long a request's Idempotency-Key keeps
+	// replaying its first response
+	IdempotencyTTL time.Duration
+
+	// BackupPath is where admin-triggered database backups are written
+	BackupPath string
+
+	// AuditRetention is how long audit log entries are kept; zero keeps
+	// them forever
+	AuditRetention time.Duration
+
+	// Outgoing mail. SMTPTLSMode is "starttls" or "implicit"; left empty
+	// it is implicit on port 465 and STARTTLS otherwise
+	SMTPHost    string
+	SMTPPort    string
+	SMTPUser    string
+	SMTPPass    string
+	FromEmail   string
+	SMTPTLSMode string
+
+	// CAPTCHA on registration, and on forgot-password when
+	// CaptchaOnPasswordReset is set. CaptchaProvider is "hcaptcha" or
+	// "recaptcha"; left empty no CAPTCHA is required
+	CaptchaProvider        string
+	CaptchaSecret          string
+	CaptchaOnPasswordReset bool
+
+	// Google sign-in, enabled when GoogleClientID is set. GoogleRedirectURL
+	// must be registered with Google and defaults to the callback on
+	// AppBaseURL
+	GoogleClientID     string
+	GoogleClientSecret string
+	GoogleRedirectURL  string
+
+	// Stream URLs are signed with StreamTokenSecret (the JWT secret when
+	// unset) and stay valid for StreamTokenTTL
+	StreamTokenSecret string
+	StreamTokenTTL    time.Duration
+
+	// RequireAuthToStream refuses streams to anonymous listeners; stream
+	// URLs are then only issued to signed-in users
+	RequireAuthToStream bool
+
+	// MaintenanceMode starts the server read-only: writes outside the admin
+	// API get 503 with a Retry-After of MaintenanceRetryAfter
+	MaintenanceMode       bool
+	MaintenanceRetryAfter time.Duration
+
+	// NowPlayingTTL is how long after a user's last stream request they
+	// still show as playing that song
+	NowPlayingTTL time.Duration
+
+	// AppBaseURL is the public https origin that links in emails point at,
+	// e.g. "https://music.example.com"
+	AppBaseURL string
+
+	// ResetTokenTTL is how long a password reset link works; the reset
+	// email quotes it
+	ResetTokenTTL time.Duration
+
+	// Password policy applied at registration, reset and change
+	PasswordMinLength     int
+	PasswordRequireUpper  bool
+	PasswordRequireLower  bool
+	PasswordRequireDigit  bool
+	PasswordRequireSymbol bool
+	PasswordRejectCommon  bool
+
+	// BcryptCost is the work factor for password hashes; raise it on faster
+	// hosts. Lower-cost hashes are upgraded at login
+	BcryptCost int
+
+	// Metrics endpoint. It answers requests carrying MetricsToken as a
+	// bearer token or coming from MetricsAllowIPs
+	MetricsEnabled  bool
+	MetricsToken    string
+	MetricsAllowIPs []string
+
+	// LogLevel is INFO, WARNING, ERROR or DEBUG. At DEBUG, LogBodies also
+	// writes redacted JSON request and response bodies, cut at
+	// LogBodyMaxBytes, to the debug log
+	LogLevel        string
+	LogBodies       bool
+	LogBodyMaxBytes int
+
+	// ValidationAllowlist holds exact inputs the suspicious-pattern
+	// detector must let through (e.g. a real title that looks like SQL)
+	ValidationAllowlist []string
+
+	// Largest audio track and image accepted by uploads, in bytes. The
+	// request BodyLimit defaults to the larger of the two and must be at
+	// least MaxAudioUploadBytes
+	MaxAudioUploadBytes int64
+	MaxImageUploadBytes int64
+	BodyLimit           int64
+
+	// JSONBodyLimit caps request bodies on every route except uploads, which
+	// get the full BodyLimit
+	JSONBodyLimit int64
 }
 
 func LoadConfig() *Config {
-	return &Config{
+	cfg := &Config{
 		Port:              getEnv("PORT", "2701"),
+		HTTPPort:          getEnv("HTTP_PORT", "8080"),
 		DatabasePath:      getEnv("DATABASE_PATH", "./tunetudo.db"),
 		JWTSecret:         getEnv("JWT_SECRET", "sup3rdup3rs3cr3t"),
 		TLS_KEY_FILE:    getEnv("TLS_KEY_FILE", "./certs/server.key"),
 		TLS_CERT_FILE:   getEnv("TLS_CERT_FILE", "./certs/server.crt"),
-		MaxUploadSize:     50 * 1024 * 1024, // 50MB
 		StoragePath:       getEnv("STORAGE_PATH", "./storage"),
 		AllowedAudioTypes: []string{".mp4", ".wav", ".mp3"},
-		AllowedImageTypes: []string{".jpg", ".jpeg", ".png"},
+		AllowedImageTypes: []string{".jpg", ".jpeg", ".png", ".webp", ".avif"},
+
+		DBJournalMode:     getEnv("DB_JOURNAL_MODE", "WAL"),
+		DBBusyTimeout:     getEnvDuration("DB_BUSY_TIMEOUT", 5*time.Second),
+		DBForeignKeys:     getEnvBool("DB_FOREIGN_KEYS", true),
+		DBMaxOpenConns:    getEnvInt("DB_MAX_OPEN_CONNS", 10),
+		DBMaxIdleConns:    getEnvInt("DB_MAX_IDLE_CONNS", 5),
+		DBConnMaxLifetime: getEnvDuration("DB_CONN_MAX_LIFETIME", 0),
+
+		CORSAllowOrigins:     getEnvList("CORS_ALLOW_ORIGINS", nil),
+		CORSAllowMethods:     getEnv("CORS_ALLOW_METHODS", "GET,POST,PUT,PATCH,DELETE,OPTIONS"),
+		CORSAllowHeaders:     getEnv("CORS_ALLOW_HEADERS", "Origin,Content-Type,Accept,Authorization,Idempotency-Key"),
+		CORSAllowCredentials: getEnvBool("CORS_ALLOW_CREDENTIALS", false),
+
+		RateLimitIPMax:   getEnvInt("RATE_LIMIT_IP_MAX", 50),
+		RateLimitUserMax: getEnvInt("RATE_LIMIT_USER_MAX", 200),
+		RateLimitWindow:  getEnvDuration("RATE_LIMIT_WINDOW", 1*time.Minute),
+
+		ShutdownTimeout: getEnvDuration("SHUTDOWN_TIMEOUT", 10*time.Second),
+		RequestTimeout:  getEnvDuration("REQUEST_TIMEOUT", 30*time.Second),
+
+		TrashRetention: getEnvDuration("TRASH_RETENTION", 30*24*time.Hour),
+		TrashPath:      getEnv("TRASH_PATH", "./trash"),
+		UploadTempPath: getEnv("UPLOAD_TEMP_PATH", "./tmp/chunks"),
+
+		StorageAuditInterval: getEnvDuration("STORAGE_AUDIT_INTERVAL", 0),
+
+		CompressionLevel:   getEnvInt("COMPRESSION_LEVEL", 0),
+		CompressionMinSize: getEnvInt("COMPRESSION_MIN_SIZE", 1024),
+
+		StorageCacheMaxAge: getEnvDuration("STORAGE_CACHE_MAX_AGE", 24*time.Hour),
+
+		TranscodeEnabled: getEnvBool("TRANSCODE_ENABLED", false),
+		FFmpegPath:       getEnv("FFMPEG_PATH", "ffmpeg"),
+		TranscodeFormat:  getEnv("TRANSCODE_FORMAT", "mp3"),
+		TranscodeBitrate: getEnv("TRANSCODE_BITRATE", "192k"),
+		TranscodeTimeout: getEnvDuration("TRANSCODE_TIMEOUT", 5*time.Minute),
+
+		CategoryCacheTTL: getEnvDuration("CATEGORY_CACHE_TTL", 5*time.Minute),
+
+		ExplicitCategories: getEnvList("EXPLICIT_CATEGORIES", nil),
+		SafeModeDefault:    getEnvBool("SAFE_MODE_DEFAULT", false),
+
+		SearchMinQueryLength: getEnvInt("SEARCH_MIN_QUERY_LENGTH", 2),
+		SearchMaxQueryLength: getEnvInt("SEARCH_MAX_QUERY_LENGTH", 200),
+
+		MaxPlaylistSongs:    getEnvInt("MAX_PLAYLIST_SONGS", 1000),
+		MaxPlaylistsPerUser: getEnvInt("MAX_PLAYLISTS_PER_USER", 200),
+
+		IdempotencyTTL: getEnvDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+
+		BackupPath: getEnv("BACKUP_PATH", "./backups"),
+
+		AuditRetention: getEnvDuration("AUDIT_RETENTION", 90*24*time.Hour),
+
+		SMTPHost:    getEnv("SMTP_HOST", ""),
+		SMTPPort:    getEnv("SMTP_PORT", "587"),
+		SMTPUser:    getEnv("SMTP_USER", ""),
+		SMTPPass:    getEnv("SMTP_PASS", ""),
+		FromEmail:   getEnv("FROM_EMAIL", ""),
+		SMTPTLSMode: getEnv("SMTP_TLS_MODE", ""),
+
+		CaptchaProvider:        strings.ToLower(getEnv("CAPTCHA_PROVIDER", "")),
+		CaptchaSecret:          getEnv("CAPTCHA_SECRET", ""),
+		CaptchaOnPasswordReset: getEnvBool("CAPTCHA_ON_PASSWORD_RESET", false),
+
+		GoogleClientID:     getEnv("GOOGLE_CLIENT_ID", ""),
+		GoogleClientSecret: getEnv("GOOGLE_CLIENT_SECRET", ""),
+
+		StreamTokenSecret:   getEnv("STREAM_TOKEN_SECRET", ""),
+		StreamTokenTTL:      getEnvDuration("STREAM_TOKEN_TTL", 1*time.Hour),
+		RequireAuthToStream: getEnvBool("REQUIRE_AUTH_TO_STREAM", false),
+
+		MaintenanceMode:       getEnvBool("MAINTENANCE_MODE", false),
+		MaintenanceRetryAfter: getEnvDuration("MAINTENANCE_RETRY_AFTER", 5*time.Minute),
+
+		NowPlayingTTL: getEnvDuration("NOW_PLAYING_TTL", 5*time.Minute),
+
+		AppBaseURL: strings.TrimRight(getEnv("APP_BASE_URL", "https://localhost:2701"), "/"),
+
+		ResetTokenTTL: getEnvDuration("RESET_TOKEN_TTL", 15*time.Minute),
+
+		PasswordMinLength:     getEnvInt("PASSWORD_MIN_LENGTH", 8),
+		PasswordRequireUpper:  getEnvBool("PASSWORD_REQUIRE_UPPER", true),
+		PasswordRequireLower:  getEnvBool("PASSWORD_REQUIRE_LOWER", true),
+		PasswordRequireDigit:  getEnvBool("PASSWORD_REQUIRE_DIGIT", true),
+		PasswordRequireSymbol: getEnvBool("PASSWORD_REQUIRE_SYMBOL", false),
+		PasswordRejectCommon:  getEnvBool("PASSWORD_REJECT_COMMON", true),
+
+		BcryptCost: getEnvInt("BCRYPT_COST", bcrypt.DefaultCost),
+
+		MetricsEnabled:  getEnvBool("METRICS_ENABLED", true),
+		MetricsToken:    getEnv("METRICS_TOKEN", ""),
+		MetricsAllowIPs: getEnvList("METRICS_ALLOW_IPS", []string{"127.0.0.1", "::1"}),
+
+		LogLevel:        strings.ToUpper(getEnv("LOG_LEVEL", "INFO")),
+		LogBodies:       getEnvBool("LOG_BODIES", false),
+		LogBodyMaxBytes: getEnvInt("LOG_BODY_MAX_BYTES", 4096),
+
+		ValidationAllowlist: getEnvList("VALIDATION_ALLOWLIST", nil),
 	}
+
+	cfg.MaxAudioUploadBytes = getEnvInt64("MAX_AUDIO_UPLOAD_BYTES", 50*1024*1024) // 50MB
+	cfg.MaxImageUploadBytes = getEnvInt64("MAX_IMAGE_UPLOAD_BYTES", 5*1024*1024)  // 5MB
+	cfg.GoogleRedirectURL = getEnv("GOOGLE_REDIRECT_URL", cfg.AppBaseURL+"/api/auth/google/callback")
+	cfg.BodyLimit = getEnvInt64("BODY_LIMIT_BYTES", max(cfg.MaxAudioUploadBytes, cfg.MaxImageUploadBytes))
+	cfg.JSONBodyLimit = getEnvInt64("JSON_BODY_LIMIT_BYTES", 1024*1024) // 1MB
+	return cfg
+}
+
+// Validate reports settings that would leave the server misbehaving rather
+// than failing outright, so startup can refuse them
+func (c *Config) Validate() error {
+	base, err := url.Parse(c.AppBaseURL)
+	if err != nil || base.Scheme != "https" || base.Host == "" || base.RawQuery != "" || base.Fragment != "" {
+		return fmt.Errorf("APP_BASE_URL must be an absolute https URL, got %q", c.AppBaseURL)
+	}
+	if c.ResetTokenTTL < time.Minute || c.ResetTokenTTL > 24*time.Hour {
+		return fmt.Errorf("RESET_TOKEN_TTL must be between 1m and 24h, got %s", c.ResetTokenTTL)
+	}
+	if c.MaxAudioUploadBytes <= 0 || c.MaxImageUploadBytes <= 0 {
+		return errors.New("MAX_AUDIO_UPLOAD_BYTES and MAX_IMAGE_UPLOAD_BYTES must be positive")
+	}
+	if c.BodyLimit < c.MaxAudioUploadBytes || c.BodyLimit < c.MaxImageUploadBytes {
+		return fmt.Errorf("BODY_LIMIT_BYTES (%d) must be at least the largest upload size (%d)",
+			c.BodyLimit, max(c.MaxAudioUploadBytes, c.MaxImageUploadBytes))
+	}
+	if c.JSONBodyLimit <= 0 || c.JSONBodyLimit > c.BodyLimit {
+		return fmt.Errorf("JSON_BODY_LIMIT_BYTES must be between 1 and BODY_LIMIT_BYTES (%d), got %d",
+			c.BodyLimit, c.JSONBodyLimit)
+	}
+	if withinDir(c.TrashPath, c.StoragePath) {
+		return fmt.Errorf("TRASH_PATH (%s) must be outside STORAGE_PATH (%s)", c.TrashPath, c.StoragePath)
+	}
+	if withinDir(c.UploadTempPath, c.StoragePath) {
+		return fmt.Errorf("UPLOAD_TEMP_PATH (%s) must be outside STORAGE_PATH (%s)", c.UploadTempPath, c.StoragePath)
+	}
+	if c.AuditRetention != 0 && c.AuditRetention < time.Hour {
+		return fmt.Errorf("AUDIT_RETENTION must be 0 or at least 1h, got %s", c.AuditRetention)
+	}
+	if c.MaintenanceRetryAfter < time.Second {
+		return fmt.Errorf("MAINTENANCE_RETRY_AFTER must be at least 1s, got %s", c.MaintenanceRetryAfter)
+	}
+	// Longer queries never get past the input validation middleware
+	if c.SearchMinQueryLength < 1 || c.SearchMaxQueryLength < c.SearchMinQueryLength || c.SearchMaxQueryLength > 1000 {
+		return fmt.Errorf("SEARCH_MIN_QUERY_LENGTH (%d) and SEARCH_MAX_QUERY_LENGTH (%d) must satisfy 1 <= min <= max <= 1000",
+			c.SearchMinQueryLength, c.SearchMaxQueryLength)
+	}
+	switch c.CaptchaProvider {
+	case "":
+	case "hcaptcha", "recaptcha":
+		if c.CaptchaSecret == "" {
+			return errors.New("CAPTCHA_SECRET is required when CAPTCHA_PROVIDER is set")
+		}
+	default:
+		return fmt.Errorf("CAPTCHA_PROVIDER must be hcaptcha or recaptcha, got %q", c.CaptchaProvider)
+	}
+	if c.GoogleClientID != "" && c.GoogleClientSecret == "" {
+		return errors.New("GOOGLE_CLIENT_SECRET is required when GOOGLE_CLIENT_ID is set")
+	}
+	switch c.LogLevel {
+	case "INFO", "WARNING", "ERROR", "DEBUG":
+	default:
+		return fmt.Errorf("LOG_LEVEL must be INFO, WARNING, ERROR or DEBUG, got %q", c.LogLevel)
+	}
+	if c.BcryptCost < bcrypt.MinCost || c.BcryptCost > bcrypt.MaxCost {
+		return fmt.Errorf("BCRYPT_COST must be between %d and %d, got %d", bcrypt.MinCost, bcrypt.MaxCost, c.BcryptCost)
+	}
+	return nil
+}
+
+// withinDir reports whether path is dir or somewhere below it
+func withinDir(path, dir string) bool {
+	absPath, err1 := filepath.Abs(path)
+	absDir, err2 := filepath.Abs(dir)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
 }
 
 func getEnv(key, defaultValue string) string {
@@ -38,6 +401,65 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func getEnvInt64(key string, defaultValue int64) int64 {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+// getEnvDuration reads a Go duration string such as "30s" or "15m"
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+// getEnvList reads a comma-separated list, dropping empty entries
+func getEnvList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// BodyLoggingEnabled reports whether request and response bodies go to
+// the debug log; it takes both LOG_LEVEL=DEBUG and LOG_BODIES
+func (c *Config) BodyLoggingEnabled() bool {
+	return c.LogLevel == "DEBUG" && c.LogBodies
+}
+
 func (c *Config) IsAllowedAudioType(filename string) bool {
 	for _, ext := range c.AllowedAudioTypes {
 		if strings.HasSuffix(strings.ToLower(filename), ext) {
@@ -54,4 +476,4 @@ func (c *Config) IsAllowedImageType(filename string) bool {
 		}
 	}
 	return false
-}
\ No newline at end of file
+}
@@ -1,13 +1,31 @@
 package controllers
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"net/url"
+	"path/filepath"
 	"strconv"
+	apperrors "tunetudo/errors"
 	"tunetudo/logger"
+	"tunetudo/metrics"
 	"tunetudo/middleware"
 	"tunetudo/models"
+	"tunetudo/response"
 	"tunetudo/services"
 	"strings"
+	"time"
+	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
 )
 
 // AuthController handles authentication endpoints
@@ -34,18 +52,11 @@ func (ctrl *AuthController) Register(c *fiber.Ctx) error {
 	ip := c.IP()
 	user, err := ctrl.authService.RegisterUser(req, ip)
 	if err != nil {
-		// Error already logged in service layer
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   true,
-			"message": err.Error(), // Service returns safe messages
-		})
+		// Error already logged in service layer; its message is safe to return
+		return err
 	}
 
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"error":   false,
-		"message": "user registered successfully",
-		"data":    user,
-	})
+	return response.Created(c, "user registered successfully", user)
 }
 
 func (ctrl *AuthController) Login(c *fiber.Ctx) error {
@@ -60,25 +71,118 @@ func (ctrl *AuthController) Login(c *fiber.Ctx) error {
 	}
 
 	ip := c.IP()
+	req.UserAgent = c.Get(fiber.HeaderUserAgent)
 	token, user, err := ctrl.authService.LoginUser(req, ip)
 	if err != nil {
 		// Service returns "authorization failed" - not "no such user" or "password incorrect"
+		return err
+	}
+
+	return response.SuccessWithMessage(c, "login successful", fiber.Map{
+		"token": token,
+		"user":  user,
+	})
+}
+
+// oauthStateCookie carries the state of a sign-in in progress, tying the
+// provider's callback to the browser that started it
+const oauthStateCookie = "oauth_state"
+
+// GoogleLogin sends the browser to Google to sign in
+func (ctrl *AuthController) GoogleLogin(c *fiber.Ctx) error {
+	state, err := services.GenerateSecureToken()
+	if err != nil {
+		return apperrors.InternalError(err)
+	}
+	authURL, err := ctrl.authService.GoogleAuthURL(state)
+	if err != nil {
+		return err
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     oauthStateCookie,
+		Value:    state,
+		Path:     "/api/auth/google",
+		MaxAge:   int((10 * time.Minute).Seconds()),
+		Secure:   true,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+// GoogleCallback finishes a Google sign-in and responds like Login
+func (ctrl *AuthController) GoogleCallback(c *fiber.Ctx) error {
+	ip := c.IP()
+	expected := c.Cookies(oauthStateCookie)
+	c.ClearCookie(oauthStateCookie)
+
+	state := c.Query("state")
+	if expected == "" || subtle.ConstantTimeCompare([]byte(state), []byte(expected)) != 1 {
+		logger.Security("OAUTH_STATE_MISMATCH", "", logger.MaskIP(ip), "Google callback without a matching state")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "sign-in expired, please try again",
+		})
+	}
+	if c.Query("error") != "" || c.Query("code") == "" {
+		logger.AuthAttempt("oauth_user", ip, false, "Google sign-in cancelled or refused")
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error":   true,
-			"message": err.Error(),
+			"message": "authorization failed",
 		})
 	}
 
-	return c.JSON(fiber.Map{
-		"error":   false,
-		"message": "login successful",
-		"data": fiber.Map{
-			"token": token,
-			"user":  user,
-		},
+	token, user, err := ctrl.authService.LoginWithGoogle(c.Query("code"), ip, c.Get(fiber.HeaderUserAgent))
+	if err != nil {
+		return err
+	}
+
+	return response.SuccessWithMessage(c, "login successful", fiber.Map{
+		"token": token,
+		"user":  user,
 	})
 }
 
+// ListSessions shows where the user is signed in
+func (ctrl *AuthController) ListSessions(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := ctrl.authService.ListSessions(userID, middleware.SessionJTI(c))
+	if err != nil {
+		return err
+	}
+
+	return response.Success(c, sessions)
+}
+
+// RevokeSession signs the user out of one of their sessions
+func (ctrl *AuthController) RevokeSession(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+	sessionID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid session ID",
+		})
+	}
+
+	if err := ctrl.authService.RevokeSession(userID, sessionID); err != nil {
+		return err
+	}
+
+	username, _ := middleware.GetUsername(c)
+	logger.Security("SESSION_REVOKED", logger.HashIdentifier(username), logger.MaskIP(c.IP()), "User revoked a session")
+
+	return response.Message(c, "session revoked")
+}
+
 func (ctrl *AuthController) Logout(c *fiber.Ctx) error {
 	username := c.Locals("username")
 	ip := c.IP()
@@ -87,30 +191,97 @@ func (ctrl *AuthController) Logout(c *fiber.Ctx) error {
 		logger.Security("LOGOUT", logger.HashIdentifier(username.(string)), logger.MaskIP(ip), "User logged out")
 	}
 	
-	return c.JSON(fiber.Map{
-		"error":   false,
-		"message": "logout successful",
-	})
+	return response.Message(c, "logout successful")
 }
 
-func (ctrl *AuthController) GetProfile(c *fiber.Ctx) error {
+// DeleteAccount lets users delete their own account after confirming their
+// password; accounts that only sign in through a provider have none to confirm
+func (ctrl *AuthController) DeleteAccount(c *fiber.Ctx) error {
 	userID, err := middleware.GetUserID(c)
 	if err != nil {
 		return err
 	}
+	username, _ := middleware.GetUsername(c)
+	ip := c.IP()
 
-	user, err := ctrl.authService.GetUserByID(userID)
+	var req models.DeleteAccountRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "invalid request body",
+			})
+		}
+	}
+
+	if err := ctrl.authService.DeleteAccount(userID, req.Password); err != nil {
+		if isAuthError(err) {
+			logger.AuthAttempt(username, ip, false, "Account deletion with wrong password")
+		}
+		return err
+	}
+
+	logger.Security("ACCOUNT_DELETED", logger.HashIdentifier(username), logger.MaskIP(ip), "User deleted their account")
+
+	return response.Message(c, "account deleted")
+}
+
+func (ctrl *AuthController) ChangePassword(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+		return err
+	}
+	username, _ := middleware.GetUsername(c)
+	ip := c.IP()
+
+	var req models.ChangePasswordRequest
+	if err := c.BodyParser(&req); err != nil || req.NewPassword == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   true,
-			"message": "user not found",
+			"message": "new password required",
 		})
 	}
 
-	return c.JSON(fiber.Map{
-		"error": false,
-		"data":  user,
-	})
+	if err := ctrl.authService.ChangePassword(userID, req.CurrentPassword, req.NewPassword); err != nil {
+		if isAuthError(err) {
+			logger.AuthAttempt(username, ip, false, "Password change with wrong password")
+		}
+		return err
+	}
+
+	logger.Security("PASSWORD_CHANGED", logger.HashIdentifier(username), logger.MaskIP(ip), "User changed their password")
+
+	return response.Message(c, "password changed")
+}
+
+func (ctrl *AuthController) GetProfile(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	user, err := ctrl.authService.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+
+	return response.Success(c, user)
+}
+
+// GetPermissions tells the frontend what the signed-in user may do, from
+// their account as it is now rather than the claims in their token
+func (ctrl *AuthController) GetPermissions(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	permissions, err := ctrl.authService.GetPermissions(userID)
+	if err != nil {
+		return err
+	}
+
+	return response.Success(c, permissions)
 }
 
 // SearchController handles search endpoints
@@ -123,7 +294,7 @@ func NewSearchController(searchService *services.SearchService) *SearchControlle
 }
 
 func (ctrl *SearchController) Search(c *fiber.Ctx) error {
-	query := c.Query("q")
+	query := strings.TrimSpace(c.Query("q"))
 	if query == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   true,
@@ -131,7 +302,13 @@ func (ctrl *SearchController) Search(c *fiber.Ctx) error {
 		})
 	}
 
-	results, err := ctrl.searchService.FullTextSearch(query)
+	limit, offset := parsePagination(c, 50)
+	metrics.RecordSearch()
+
+	results, err := ctrl.searchService.FullTextSearch(query, limit, offset, c.Query("match"), middleware.SafeMode(c))
+	if apperrors.IsAppError(err) {
+		return err
+	}
 	if err != nil {
 		logger.Error(logger.CategoryAPI, "Search failed", err)
 		// Generic message to user
@@ -141,10 +318,7 @@ func (ctrl *SearchController) Search(c *fiber.Ctx) error {
 		})
 	}
 
-	return c.JSON(fiber.Map{
-		"error": false,
-		"data":  results,
-	})
+	return response.Success(c, results)
 }
 
 func (ctrl *SearchController) GetCategories(c *fiber.Ctx) error {
@@ -157,10 +331,7 @@ func (ctrl *SearchController) GetCategories(c *fiber.Ctx) error {
 		})
 	}
 
-	return c.JSON(fiber.Map{
-		"error": false,
-		"data":  categories,
-	})
+	return response.Success(c, categories)
 }
 
 func (ctrl *SearchController) GetSongsByCategory(c *fiber.Ctx) error {
@@ -172,7 +343,12 @@ func (ctrl *SearchController) GetSongsByCategory(c *fiber.Ctx) error {
 		})
 	}
 
-	songs, err := ctrl.searchService.GetSongsByCategory(categoryID)
+	limit, offset := parsePagination(c, 100)
+
+	songs, err := ctrl.searchService.GetSongsByCategory(categoryID, limit, offset, c.Query("sort"), middleware.SafeMode(c))
+	if apperrors.IsAppError(err) {
+		return err
+	}
 	if err != nil {
 		logger.Error(logger.CategoryDB, "Failed to fetch songs by category", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -181,18 +357,61 @@ func (ctrl *SearchController) GetSongsByCategory(c *fiber.Ctx) error {
 		})
 	}
 
-	if len(songs) == 0 {
-		return c.JSON(fiber.Map{
-			"error":   false,
-			"message": "no tracks available",
-			"data":    []models.Song{},
+	if songs.Meta.Total == 0 {
+		return response.SuccessWithMessage(c, "no tracks available", songs)
+	}
+
+	return response.Success(c, songs)
+}
+
+// ListArtists returns a page of catalog artists, alphabetically
+func (ctrl *SearchController) ListArtists(c *fiber.Ctx) error {
+	limit, offset := parsePagination(c, 50)
+
+	artists, err := ctrl.searchService.ListArtists(limit, offset)
+	if err != nil {
+		logger.Error(logger.CategoryDB, "Failed to list artists", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "failed to fetch artists",
 		})
 	}
 
-	return c.JSON(fiber.Map{
-		"error": false,
-		"data":  songs,
-	})
+	return response.Success(c, artists)
+}
+
+// ListAlbums returns a page of catalog albums, alphabetically
+func (ctrl *SearchController) ListAlbums(c *fiber.Ctx) error {
+	limit, offset := parsePagination(c, 50)
+
+	albums, err := ctrl.searchService.ListAlbums(limit, offset)
+	if err != nil {
+		logger.Error(logger.CategoryDB, "Failed to list albums", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "failed to fetch albums",
+		})
+	}
+
+	return response.Success(c, albums)
+}
+
+// GetAlbum returns an album with its songs in track order
+func (ctrl *SearchController) GetAlbum(c *fiber.Ctx) error {
+	albumID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid album ID",
+		})
+	}
+
+	album, err := ctrl.searchService.GetAlbum(albumID)
+	if err != nil {
+		return err
+	}
+
+	return response.Success(c, album)
 }
 
 // PlaylistController handles playlist endpoints
@@ -222,44 +441,86 @@ func (ctrl *PlaylistController) CreatePlaylist(c *fiber.Ctx) error {
 	}
 
 	playlist, err := ctrl.playlistService.CreatePlaylist(userID, req)
+	if err != nil {
+		return err
+	}
+
+	logger.Info(logger.CategoryPlaylist, "Playlist created: ID=%d by user_id=%d", playlist.ID, userID)
+
+	return response.Created(c, "playlist created successfully", playlist)
+}
+
+// ClonePlaylist copies an owned or public playlist into the caller's library
+func (ctrl *PlaylistController) ClonePlaylist(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	playlistID, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   true,
-			"message": err.Error(),
+			"message": "invalid playlist ID",
 		})
 	}
 
-	logger.Info(logger.CategoryPlaylist, "Playlist created: ID=%d by user_id=%d", playlist.ID, userID)
+	// The body is optional; without a name the source's name is reused
+	var req models.ClonePlaylistRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "invalid request data",
+			})
+		}
+	}
 
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"error":   false,
-		"message": "playlist created successfully",
-		"data":    playlist,
-	})
+	playlist, err := ctrl.playlistService.ClonePlaylist(playlistID, userID, strings.TrimSpace(req.Name))
+	if err != nil {
+		return err
+	}
+
+	logger.Info(logger.CategoryPlaylist, "Playlist cloned: source=%d new=%d by user_id=%d", playlistID, playlist.ID, userID)
+
+	return response.Created(c, "playlist cloned successfully", playlist)
 }
 
-func (ctrl *PlaylistController) GetUserPlaylists(c *fiber.Ctx) error {
+// AddCollaborator lets the playlist owner invite a user by username
+func (ctrl *PlaylistController) AddCollaborator(c *fiber.Ctx) error {
 	userID, err := middleware.GetUserID(c)
 	if err != nil {
 		return err
 	}
 
-	playlists, err := ctrl.playlistService.GetUserPlaylists(userID)
+	playlistID, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
-		logger.Error(logger.CategoryDB, "Failed to fetch playlists", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   true,
-			"message": "failed to fetch playlists",
+			"message": "invalid playlist ID",
 		})
 	}
 
-	return c.JSON(fiber.Map{
-		"error": false,
-		"data":  playlists,
-	})
+	var req models.AddCollaboratorRequest
+	if err := c.BodyParser(&req); err != nil || strings.TrimSpace(req.Username) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "username required",
+		})
+	}
+
+	collaborator, err := ctrl.playlistService.AddCollaborator(playlistID, userID, strings.TrimSpace(req.Username), req.Role)
+	if err != nil {
+		return err
+	}
+
+	logger.Info(logger.CategoryPlaylist, "Collaborator added: playlist_id=%d user_id=%d role=%s", playlistID, collaborator.UserID, collaborator.Role)
+
+	return response.Created(c, "collaborator added", collaborator)
 }
 
-func (ctrl *PlaylistController) GetPlaylistDetails(c *fiber.Ctx) error {
+// RemoveCollaborator removes a collaborator; collaborators may remove themselves
+func (ctrl *PlaylistController) RemoveCollaborator(c *fiber.Ctx) error {
 	userID, err := middleware.GetUserID(c)
 	if err != nil {
 		return err
@@ -273,26 +534,74 @@ func (ctrl *PlaylistController) GetPlaylistDetails(c *fiber.Ctx) error {
 		})
 	}
 
-	playlist, err := ctrl.playlistService.GetPlaylistByID(playlistID, userID)
+	collaboratorID, err := strconv.Atoi(c.Params("userId"))
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   true,
-			"message": err.Error(),
+			"message": "invalid user ID",
 		})
 	}
 
-	songs, _ := ctrl.playlistService.GetPlaylistSongs(playlistID)
+	if err := ctrl.playlistService.RemoveCollaborator(playlistID, userID, collaboratorID); err != nil {
+		return err
+	}
 
-	return c.JSON(fiber.Map{
-		"error": false,
-		"data": fiber.Map{
-			"playlist": playlist,
-			"songs":    songs,
-		},
-	})
+	return response.Message(c, "collaborator removed")
 }
 
-func (ctrl *PlaylistController) AddSongToPlaylist(c *fiber.Ctx) error {
+// NameAvailable lets a form check a playlist name before submitting it
+func (ctrl *PlaylistController) NameAvailable(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	available, err := ctrl.playlistService.NameAvailable(userID, c.Query("name"))
+	if err != nil {
+		return err
+	}
+
+	return response.Success(c, fiber.Map{"available": available})
+}
+
+func (ctrl *PlaylistController) GetUserPlaylists(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	limit, offset := parsePagination(c, 50)
+
+	playlists, err := ctrl.playlistService.GetUserPlaylists(userID, limit, offset)
+	if err != nil {
+		return err
+	}
+
+	return response.Success(c, playlists)
+}
+
+// GetFeaturedPlaylists lists the admin-curated playlists with their songs;
+// no login is needed
+func (ctrl *PlaylistController) GetFeaturedPlaylists(c *fiber.Ctx) error {
+	playlists, err := ctrl.playlistService.GetFeaturedPlaylists()
+	if err != nil {
+		return err
+	}
+
+	return response.Success(c, playlists)
+}
+
+// AuthorizeEvents vets a WebSocket upgrade to a playlist's event stream
+// before it happens, so refusals are still plain HTTP responses. Owners and
+// collaborators of either role may listen
+func (ctrl *PlaylistController) AuthorizeEvents(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return c.Status(fiber.StatusUpgradeRequired).JSON(fiber.Map{
+			"error":   true,
+			"message": "WebSocket upgrade required",
+		})
+	}
+
 	userID, err := middleware.GetUserID(c)
 	if err != nil {
 		return err
@@ -306,50 +615,1271 @@ func (ctrl *PlaylistController) AddSongToPlaylist(c *fiber.Ctx) error {
 		})
 	}
 
-	var req struct {
-		SongID int `json:"song_id"`
+	if _, err := ctrl.playlistService.GetPlaylistByID(playlistID, userID); err != nil {
+		return err
 	}
-	if err := c.BodyParser(&req); err != nil {
-		ip := c.IP()
-		username := c.Locals("username").(string)
-		logger.ValidationFailure(username, ip, "request_body", "Invalid JSON format")
+
+	c.Locals("playlist_id", playlistID)
+	return c.Next()
+}
+
+// StreamEvents pushes a playlist's events as JSON over an upgraded
+// connection until the client leaves, the playlist is deleted or the
+// listener is removed as a collaborator
+func (ctrl *PlaylistController) StreamEvents(conn *websocket.Conn) {
+	playlistID, _ := conn.Locals("playlist_id").(int)
+	userID, _ := conn.Locals("user_id").(int)
+
+	events, unsubscribe := ctrl.playlistService.SubscribeEvents(playlistID)
+	defer unsubscribe()
+
+	ready := models.PlaylistEvent{Type: models.PlaylistEventSubscribed, PlaylistID: playlistID, UserID: userID, At: time.Now().UTC()}
+	if err := conn.WriteJSON(ready); err != nil {
+		return
+	}
+
+	// Clients send nothing; reading only notices when they go away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case event := <-events:
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+			if event.Type == models.PlaylistEventDeleted ||
+				(event.Type == models.PlaylistEventCollaboratorRemoved && event.UserID == userID) {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+func (ctrl *PlaylistController) GetPlaylistDetails(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	playlistID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   true,
-			"message": "invalid request data",
+			"message": "invalid playlist ID",
+		})
+	}
+
+	playlist, err := ctrl.playlistService.GetPlaylistByID(playlistID, userID)
+	if err != nil {
+		return err
+	}
+
+	// A failed lookup must not look like an empty playlist
+	songs, err := ctrl.playlistService.GetPlaylistSongs(playlistID)
+	if err != nil {
+		logger.Warning(logger.CategoryPlaylist, "Failed to load songs for playlist_id=%d", playlistID)
+		return err
+	}
+
+	return response.Success(c, fiber.Map{
+		"playlist": playlist,
+		"songs":    songs,
+	})
+}
+
+// ExportM3U downloads the playlist as an M3U file of signed stream URLs
+func (ctrl *PlaylistController) ExportM3U(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	playlistID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid playlist ID",
+		})
+	}
+
+	playlist, err := ctrl.playlistService.GetPlaylistByID(playlistID, userID)
+	if err != nil {
+		return err
+	}
+	m3u, err := ctrl.playlistService.ExportM3U(playlistID, userID)
+	if err != nil {
+		return err
+	}
+
+	c.Attachment(m3uFilename(playlist.Name))
+	c.Set(fiber.HeaderContentType, "audio/x-mpegurl; charset=utf-8")
+	// The file carries stream tokens
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.SendString(m3u)
+}
+
+// m3uFilename turns a playlist name into a download filename that needs no
+// escaping in a header
+func m3uFilename(name string) string {
+	safe := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		case r == ' ':
+			return '-'
+		}
+		return -1
+	}, strings.TrimSpace(name))
+	if safe == "" {
+		safe = "playlist"
+	}
+	return safe + ".m3u"
+}
+
+// GetSongContext returns where a song sits in a playlist and its
+// neighbours, for opening a shared link to one song
+func (ctrl *PlaylistController) GetSongContext(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	playlistID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid playlist ID",
+		})
+	}
+	songID, err := strconv.Atoi(c.Params("songId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid song ID",
+		})
+	}
+
+	if _, err := ctrl.playlistService.GetPlaylistByID(playlistID, userID); err != nil {
+		return err
+	}
+
+	index, prev, next, err := ctrl.playlistService.GetSongContext(playlistID, songID)
+	if err != nil {
+		return err
+	}
+
+	return response.Success(c, fiber.Map{
+		"song_id":  songID,
+		"index":    index,
+		"previous": prev,
+		"next":     next,
+	})
+}
+
+// UpdatePlaylist renames a playlist or changes its description or
+// visibility. A stale version gets 409 so the client can refetch and retry
+func (ctrl *PlaylistController) UpdatePlaylist(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	playlistID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid playlist ID",
+		})
+	}
+
+	var req models.UpdatePlaylistRequest
+	if err := c.BodyParser(&req); err != nil {
+		ip := c.IP()
+		username := c.Locals("username").(string)
+		logger.ValidationFailure(username, ip, "request_body", "Invalid JSON format")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid request data",
+		})
+	}
+
+	playlist, err := ctrl.playlistService.UpdatePlaylist(playlistID, userID, req)
+	if err != nil {
+		return err
+	}
+
+	logger.Info(logger.CategoryPlaylist, "Playlist updated: playlist_id=%d version=%d", playlistID, playlist.Version)
+
+	return response.SuccessWithMessage(c, "playlist updated", playlist)
+}
+
+// ReorderSongs sets the order of a playlist's songs. A stale version gets
+// 409 so the client can refetch and retry
+func (ctrl *PlaylistController) ReorderSongs(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	playlistID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid playlist ID",
+		})
+	}
+
+	var req models.ReorderSongsRequest
+	if err := c.BodyParser(&req); err != nil {
+		ip := c.IP()
+		username := c.Locals("username").(string)
+		logger.ValidationFailure(username, ip, "request_body", "Invalid JSON format")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid request data",
+		})
+	}
+
+	version, err := ctrl.playlistService.ReorderSongs(playlistID, userID, req)
+	if err != nil {
+		return err
+	}
+
+	logger.Info(logger.CategoryPlaylist, "Playlist reordered: playlist_id=%d version=%d", playlistID, version)
+
+	return response.SuccessWithMessage(c, "playlist reordered", fiber.Map{"version": version})
+}
+
+func (ctrl *PlaylistController) AddSongToPlaylist(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	playlistID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid playlist ID",
+		})
+	}
+
+	var req struct {
+		SongID int `json:"song_id"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		ip := c.IP()
+		username := c.Locals("username").(string)
+		logger.ValidationFailure(username, ip, "request_body", "Invalid JSON format")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid request data",
+		})
+	}
+
+	err = ctrl.playlistService.AddSong(playlistID, req.SongID, userID)
+	if err != nil {
+		return err
+	}
+
+	logger.Info(logger.CategoryPlaylist, "Song added to playlist: playlist_id=%d song_id=%d", playlistID, req.SongID)
+
+	return response.Message(c, "song added to playlist")
+}
+
+// AddSongsToPlaylist appends several songs at once, reporting the ones
+// skipped because they were missing, duplicates or over the size limit
+func (ctrl *PlaylistController) AddSongsToPlaylist(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	playlistID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid playlist ID",
+		})
+	}
+
+	var req struct {
+		SongIDs []int `json:"song_ids"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid request data",
+		})
+	}
+
+	result, err := ctrl.playlistService.AddSongs(playlistID, req.SongIDs, userID)
+	if err != nil {
+		return err
+	}
+
+	logger.Info(logger.CategoryPlaylist, "Songs added to playlist: playlist_id=%d added=%d skipped=%d",
+		playlistID, len(result.Added), len(result.Skipped))
+
+	return response.SuccessWithMessage(c, "songs added to playlist", result)
+}
+
+func (ctrl *PlaylistController) RemoveSongFromPlaylist(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	playlistID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid playlist ID",
+		})
+	}
+
+	songID, err := strconv.Atoi(c.Params("songId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid song ID",
+		})
+	}
+
+	err = ctrl.playlistService.RemoveSong(playlistID, songID, userID)
+	if err != nil {
+		return err
+	}
+
+	logger.Info(logger.CategoryPlaylist, "Song removed from playlist: playlist_id=%d song_id=%d", playlistID, songID)
+
+	return response.Message(c, "song removed from playlist")
+}
+
+// MoveSong moves a song from this playlist to another the user owns
+func (ctrl *PlaylistController) MoveSong(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	playlistID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid playlist ID",
+		})
+	}
+
+	songID, err := strconv.Atoi(c.Params("songId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid song ID",
+		})
+	}
+
+	var req models.MoveSongRequest
+	if err := c.BodyParser(&req); err != nil || req.ToPlaylistID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "to_playlist_id required",
+		})
+	}
+
+	if err := ctrl.playlistService.MoveSong(songID, playlistID, req.ToPlaylistID, userID); err != nil {
+		return err
+	}
+
+	logger.Info(logger.CategoryPlaylist, "Song moved between playlists: from_playlist_id=%d to_playlist_id=%d song_id=%d",
+		playlistID, req.ToPlaylistID, songID)
+
+	return response.Message(c, "song moved")
+}
+
+// ClearPlaylist removes all songs from a playlist the user owns
+func (ctrl *PlaylistController) ClearPlaylist(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	playlistID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid playlist ID",
+		})
+	}
+
+	removed, err := ctrl.playlistService.ClearPlaylist(playlistID, userID)
+	if err != nil {
+		return err
+	}
+
+	logger.Info(logger.CategoryPlaylist, "Playlist cleared: playlist_id=%d removed=%d by user_id=%d", playlistID, removed, userID)
+
+	return response.SuccessWithMessage(c, "playlist cleared", fiber.Map{"removed": removed})
+}
+
+func (ctrl *PlaylistController) DeletePlaylist(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	playlistID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid playlist ID",
+		})
+	}
+
+	err = ctrl.playlistService.DeletePlaylist(playlistID, userID)
+	if err != nil {
+		return err
+	}
+
+	logger.Info(logger.CategoryPlaylist, "Playlist deleted: playlist_id=%d by user_id=%d", playlistID, userID)
+
+	return response.Message(c, "playlist deleted successfully")
+}
+
+// PlaybackController handles song playback endpoints
+type PlaybackController struct {
+	playbackService *services.PlaybackService
+	streamTokenTTL  time.Duration
+}
+
+func NewPlaybackController(playbackService *services.PlaybackService, streamTokenTTL time.Duration) *PlaybackController {
+	return &PlaybackController{playbackService: playbackService, streamTokenTTL: streamTokenTTL}
+}
+
+// GetSongs returns the songs listed in ?ids=1,2,3, in that order
+func (ctrl *PlaybackController) GetSongs(c *fiber.Ctx) error {
+	var ids []int
+	for _, field := range strings.Split(c.Query("ids"), ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		id, err := strconv.Atoi(field)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "invalid song ID",
+			})
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "ids required",
+		})
+	}
+
+	songs, err := ctrl.playbackService.GetSongsByIDs(ids)
+	if err != nil {
+		return err
+	}
+
+	return response.Success(c, songs)
+}
+
+func (ctrl *PlaybackController) GetSong(c *fiber.Ctx) error {
+	songID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid song ID",
+		})
+	}
+
+	song, err := ctrl.playbackService.GetSongByID(songID)
+	if err != nil {
+		return err
+	}
+
+	etag, err := recordETag(song)
+	if err != nil {
+		return apperrors.InternalError(err)
+	}
+	// Clients may keep the record but must revalidate before using it
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderLastModified, song.CreatedAt.UTC().Format(http.TimeFormat))
+	if middleware.NotModified(c, etag, song.CreatedAt) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	return response.Success(c, song)
+}
+
+// recordETag derives a strong ETag from a record's JSON form, so any
+// change to what the client would receive changes the tag
+func recordETag(record interface{}) (string, error) {
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(encoded)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+func (ctrl *PlaybackController) StreamSong(c *fiber.Ctx) error {
+	songID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid song ID",
+		})
+	}
+
+	// Signed-in listeners update their now playing presence
+	userID, _ := middleware.OptionalUserID(c)
+	filePath, err := ctrl.playbackService.AuthorizeStream(songID, c.Query("token"), userID)
+	if err != nil {
+		return err
+	}
+
+	return sendTrackedFile(c, filePath)
+}
+
+// GetStreamURL mints a short-lived signed URL for streaming a song
+func (ctrl *PlaybackController) GetStreamURL(c *fiber.Ctx) error {
+	songID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid song ID",
+		})
+	}
+
+	// Tokens carry the signed-in listener, since the player's requests for
+	// the stream itself can't send the Authorization header
+	userID, _ := middleware.OptionalUserID(c)
+	token, err := ctrl.playbackService.GenerateStreamToken(songID, userID, ctrl.streamTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	// Each call mints a new token, so the response must not be reused
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return response.Success(c, fiber.Map{
+		"url":        fmt.Sprintf("/api/songs/%d/stream?token=%s", songID, url.QueryEscape(token)),
+		"expires_at": time.Now().Add(ctrl.streamTokenTTL).UTC(),
+	})
+}
+
+// sendTrackedFile streams a file, honouring a single byte range, through
+// a reader that counts as an active stream until the server closes it.
+// c.SendFile hands the file to fasthttp after the handler returns, which
+// leaves no way to tell when the transfer ends
+func sendTrackedFile(c *fiber.Ctx, filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   true,
+			"message": "song file not found",
+		})
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return apperrors.InternalError(err)
+	}
+
+	size := info.Size()
+	start, length := int64(0), size
+	if byteRange := c.Get(fiber.HeaderRange); byteRange != "" {
+		first, last, err := fasthttp.ParseByteRange([]byte(byteRange), int(size))
+		if err != nil {
+			file.Close()
+			c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", size))
+			return c.SendStatus(fiber.StatusRequestedRangeNotSatisfiable)
+		}
+		start, length = int64(first), int64(last-first+1)
+		c.Status(fiber.StatusPartialContent)
+		c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", first, last, size))
+	}
+
+	c.Type(strings.TrimPrefix(filepath.Ext(filePath), "."))
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+	c.Set(fiber.HeaderLastModified, info.ModTime().UTC().Format(http.TimeFormat))
+
+	return c.SendStream(metrics.TrackStream(io.NewSectionReader(file, start, length), file), int(length))
+}
+
+func (ctrl *PlaybackController) GetRecentSongs(c *fiber.Ctx) error {
+	limit := 20
+	if l := c.Query("limit"); l != "" {
+		if parsedLimit, err := strconv.Atoi(l); err == nil {
+			limit = parsedLimit
+		}
+	}
+
+	songs, err := ctrl.playbackService.GetRecentSongs(limit, c.Query("sort"), middleware.SafeMode(c))
+	if err != nil {
+		return err
+	}
+
+	return response.Success(c, songs)
+}
+
+// GetQueue returns a playlist's playback queue, with the neighbours of
+// ?current=<song id> when given
+func (ctrl *PlaybackController) GetQueue(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	playlistID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid playlist ID",
+		})
+	}
+
+	songs, err := ctrl.playbackService.BuildQueue(playlistID, userID)
+	if err != nil {
+		return err
+	}
+
+	queue := models.PlaybackQueue{PlaylistID: playlistID, Songs: songs}
+
+	if current := c.Query("current"); current != "" {
+		currentID, err := strconv.Atoi(current)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "invalid song ID",
+			})
+		}
+
+		queue.Next, err = ctrl.playbackService.GetNextSong(playlistID, userID, currentID)
+		if err != nil {
+			return err
+		}
+		queue.Previous, _ = ctrl.playbackService.GetPreviousSong(playlistID, userID, currentID)
+	}
+
+	return response.Success(c, queue)
+}
+
+// SavePosition stores the caller's resume position for a song
+func (ctrl *PlaybackController) SavePosition(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	songID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid song ID",
+		})
+	}
+
+	var req models.SavePositionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid request body",
+		})
+	}
+
+	position, err := ctrl.playbackService.SavePosition(userID, songID, req.PositionSeconds)
+	if err != nil {
+		return err
+	}
+
+	return response.Success(c, position)
+}
+
+// GetPosition returns the caller's resume position for a song
+func (ctrl *PlaybackController) GetPosition(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	songID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid song ID",
+		})
+	}
+
+	position, err := ctrl.playbackService.GetPosition(userID, songID)
+	if err != nil {
+		return err
+	}
+
+	return response.Success(c, position)
+}
+
+// GetRelatedSongs returns "more like this" songs for a track
+func (ctrl *PlaybackController) GetRelatedSongs(c *fiber.Ctx) error {
+	songID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid song ID",
+		})
+	}
+
+	limit := 10
+	if l := c.Query("limit"); l != "" {
+		if parsedLimit, err := strconv.Atoi(l); err == nil {
+			limit = parsedLimit
+		}
+	}
+
+	songs, err := ctrl.playbackService.GetRelatedSongs(songID, limit)
+	if err != nil {
+		return err
+	}
+
+	return response.Success(c, songs)
+}
+
+// GetRecommendations returns the caller's "recommended for you" songs
+func (ctrl *PlaybackController) GetRecommendations(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	limit := 20
+	if l := c.Query("limit"); l != "" {
+		if parsedLimit, err := strconv.Atoi(l); err == nil {
+			limit = parsedLimit
+		}
+	}
+
+	songs, err := ctrl.playbackService.GetRecommendations(userID, limit, middleware.SafeMode(c))
+	if err != nil {
+		return err
+	}
+
+	return response.Success(c, songs)
+}
+
+// GetRecentArtists lists the artists the user played most recently.
+// Anonymous requests get an empty list
+func (ctrl *PlaybackController) GetRecentArtists(c *fiber.Ctx) error {
+	userID, ok := middleware.OptionalUserID(c)
+	if !ok {
+		return response.Success(c, []models.RecentArtist{})
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	artists, err := ctrl.playbackService.GetRecentlyPlayedArtists(userID, limit)
+	if err != nil {
+		return err
+	}
+
+	return response.Success(c, artists)
+}
+
+// GetRecentAlbums lists the albums the user played most recently.
+// Anonymous requests get an empty list
+func (ctrl *PlaybackController) GetRecentAlbums(c *fiber.Ctx) error {
+	userID, ok := middleware.OptionalUserID(c)
+	if !ok {
+		return response.Success(c, []models.RecentAlbum{})
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	albums, err := ctrl.playbackService.GetRecentlyPlayedAlbums(userID, limit)
+	if err != nil {
+		return err
+	}
+
+	return response.Success(c, albums)
+}
+
+// GetNowPlaying returns the song the user is streaming, or null
+func (ctrl *PlaybackController) GetNowPlaying(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	nowPlaying, err := ctrl.playbackService.GetNowPlaying(userID)
+	if err != nil {
+		return err
+	}
+
+	return response.Success(c, nowPlaying)
+}
+
+// GetUserNowPlaying returns the song another user is streaming, or null,
+// when that user shares it
+func (ctrl *PlaybackController) GetUserNowPlaying(c *fiber.Ctx) error {
+	viewerID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid user ID",
+		})
+	}
+
+	nowPlaying, err := ctrl.playbackService.GetUserNowPlaying(viewerID, userID)
+	if err != nil {
+		return err
+	}
+
+	return response.Success(c, nowPlaying)
+}
+
+// GetWaveform returns peak data for a song's waveform scrubber, with
+// ?buckets=<n> peaks (100 by default)
+func (ctrl *PlaybackController) GetWaveform(c *fiber.Ctx) error {
+	songID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid song ID",
+		})
+	}
+
+	buckets := 100
+	if b := c.Query("buckets"); b != "" {
+		if buckets, err = strconv.Atoi(b); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "invalid buckets",
+			})
+		}
+	}
+
+	peaks, err := ctrl.playbackService.GenerateWaveform(songID, buckets)
+	if err != nil {
+		return err
+	}
+
+	return response.Success(c, fiber.Map{
+		"song_id": songID,
+		"buckets": buckets,
+		"peaks":   peaks,
+	})
+}
+
+// UserController handles user-specific endpoints
+type UserController struct {
+	userService *services.UserService
+}
+
+func NewUserController(userService *services.UserService) *UserController {
+	return &UserController{userService: userService}
+}
+
+func (ctrl *UserController) UploadProfileImage(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "no file provided",
+		})
+	}
+
+	err = ctrl.userService.UploadProfileImage(userID, file)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+		})
+	}
+
+	return response.Message(c, "profile picture updated successfully")
+}
+
+func (ctrl *UserController) UpdateProfile(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var req models.UpdateProfileRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid request body",
+		})
+	}
+
+	user, err := ctrl.userService.UpdateProfile(userID, req)
+	if apperrors.GetAppError(err) != nil {
+		return err
+	}
+	if err != nil {
+		status := fiber.StatusBadRequest
+		switch err.Error() {
+		case "username already taken", "email already in use", "username or email already exists":
+			status = fiber.StatusConflict
+		case "user not found":
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+		})
+	}
+
+	return response.SuccessWithMessage(c, "profile updated successfully", user)
+}
+
+func (ctrl *UserController) UploadSong(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "no file provided",
+		})
+	}
+
+	categoryID := 0
+	if value := c.FormValue("category_id"); value != "" {
+		categoryID, err = strconv.Atoi(value)
+		if err != nil || categoryID < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "invalid category ID",
+			})
+		}
+	}
+
+	upload, err := ctrl.userService.UploadSong(userID, file, categoryID)
+	if err != nil {
+		return uploadFailed(c, err)
+	}
+
+	return response.Created(c, "track uploaded successfully", upload)
+}
+
+// uploadFailed reports a rejected user upload. A repeat of a file already
+// in the library gets 409 with the song it was uploaded as
+func uploadFailed(c *fiber.Ctx, err error) error {
+	var duplicate *services.DuplicateUploadError
+	if errors.As(err, &duplicate) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+			"song_id": duplicate.SongID,
+		})
+	}
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"error":   true,
+		"message": err.Error(),
+	})
+}
+
+func (ctrl *UserController) GetUserUploads(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	categoryID := 0
+	if value := c.Query("category_id"); value != "" {
+		categoryID, err = strconv.Atoi(value)
+		if err != nil || categoryID < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "invalid category ID",
+			})
+		}
+	}
+
+	songs, err := ctrl.userService.GetUserUploads(userID, categoryID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   true,
+			"message": "failed to fetch uploads",
+		})
+	}
+
+	return response.Success(c, songs)
+}
+
+// ExportData sends the user's data as a downloadable JSON file
+func (ctrl *UserController) ExportData(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	export, err := ctrl.userService.ExportUserData(userID)
+	if err != nil {
+		return err
+	}
+
+	c.Attachment(fmt.Sprintf("tunetudo-export-%s.json", export.ExportedAt.Format("20060102")))
+	return c.JSON(export)
+}
+
+// GetStats returns the user's listening summary
+func (ctrl *UserController) GetStats(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	stats, err := ctrl.userService.GetStats(userID)
+	if err != nil {
+		return err
+	}
+
+	return response.Success(c, stats)
+}
+
+// ChunkedUploadController handles resumable, chunked track uploads
+type ChunkedUploadController struct {
+	chunkedUploadService *services.ChunkedUploadService
+}
+
+func NewChunkedUploadController(chunkedUploadService *services.ChunkedUploadService) *ChunkedUploadController {
+	return &ChunkedUploadController{chunkedUploadService: chunkedUploadService}
+}
+
+func (ctrl *ChunkedUploadController) InitUpload(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var req models.InitUploadRequest
+	if err := c.BodyParser(&req); err != nil {
+		ip := c.IP()
+		username := c.Locals("username").(string)
+		logger.ValidationFailure(username, ip, "request_body", "Invalid JSON format")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid request data",
+		})
+	}
+
+	session, err := ctrl.chunkedUploadService.InitUpload(userID, req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+		})
+	}
+
+	return response.Created(c, "upload session created", session)
+}
+
+func (ctrl *ChunkedUploadController) UploadChunk(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	uploadID := c.FormValue("upload_id")
+	index, err := strconv.Atoi(c.FormValue("index"))
+	if uploadID == "" || err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "upload_id and index are required",
+		})
+	}
+
+	chunk, err := c.FormFile("chunk")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "no chunk provided",
+		})
+	}
+
+	src, err := chunk.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "failed to read chunk",
+		})
+	}
+	defer src.Close()
+
+	session, err := ctrl.chunkedUploadService.UploadChunk(userID, uploadID, index, src)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+		})
+	}
+
+	return response.SuccessWithMessage(c, "chunk received", session)
+}
+
+func (ctrl *ChunkedUploadController) CompleteUpload(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		UploadID string `json:"upload_id"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.UploadID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "upload_id is required",
+		})
+	}
+
+	upload, err := ctrl.chunkedUploadService.CompleteUpload(userID, req.UploadID)
+	if err != nil {
+		return uploadFailed(c, err)
+	}
+
+	return response.Created(c, "track uploaded successfully", upload)
+}
+
+// AdminController handles admin endpoints
+type AdminController struct {
+	adminService   *services.AdminService
+	trashRetention time.Duration
+	maintenance    *middleware.MaintenanceMode
+}
+
+func NewAdminController(adminService *services.AdminService, trashRetention time.Duration, maintenance *middleware.MaintenanceMode) *AdminController {
+	return &AdminController{adminService: adminService, trashRetention: trashRetention, maintenance: maintenance}
+}
+
+// GetMaintenance reports whether the API is in read-only maintenance mode
+func (ctrl *AdminController) GetMaintenance(c *fiber.Ctx) error {
+	return response.Success(c, fiber.Map{"enabled": ctrl.maintenance.Enabled()})
+}
+
+// SetMaintenance switches read-only maintenance mode on or off until the
+// next restart
+func (ctrl *AdminController) SetMaintenance(c *fiber.Ctx) error {
+	adminUsername, _ := middleware.GetUsername(c)
+
+	var req models.SetMaintenanceRequest
+	if err := c.BodyParser(&req); err != nil || req.Enabled == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "enabled required",
+		})
+	}
+
+	ctrl.maintenance.SetEnabled(*req.Enabled)
+	action := "MAINTENANCE_OFF"
+	if *req.Enabled {
+		action = "MAINTENANCE_ON"
+	}
+	logger.AdminAction(adminUsername, c.IP(), action, "")
+
+	return response.Success(c, fiber.Map{"enabled": *req.Enabled})
+}
+
+func (ctrl *AdminController) UploadSong(c *fiber.Ctx) error {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "no file provided",
+		})
+	}
+
+	title := c.FormValue("title")
+	artistName := c.FormValue("artist")
+	albumTitle := c.FormValue("album")
+	categoryID, _ := strconv.Atoi(c.FormValue("category_id"))
+	durationSeconds, _ := strconv.Atoi(c.FormValue("duration"))
+	trackNumber, _ := strconv.Atoi(c.FormValue("track_number"))
+	discNumber, _ := strconv.Atoi(c.FormValue("disc_number"))
+
+	song, err := ctrl.adminService.UploadSong(file, title, artistName, albumTitle,
+		categoryID, durationSeconds, trackNumber, discNumber)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+		})
+	}
+
+	return response.Created(c, "song uploaded successfully", song)
+}
+
+// BulkUpload adds every audio file in an uploaded zip archive to the
+// catalog. Files failing validation are reported alongside the ones added
+func (ctrl *AdminController) BulkUpload(c *fiber.Ctx) error {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "no file provided",
 		})
 	}
-
-	err = ctrl.playlistService.AddSong(playlistID, req.SongID, userID)
-	if err != nil {
+	if !strings.EqualFold(filepath.Ext(file.Filename), ".zip") {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   true,
-			"message": err.Error(),
+			"message": "file must be a zip archive",
 		})
 	}
 
-	logger.Info(logger.CategoryPlaylist, "Song added to playlist: playlist_id=%d song_id=%d", playlistID, req.SongID)
-
-	return c.JSON(fiber.Map{
-		"error":   false,
-		"message": "song added to playlist",
-	})
-}
+	categoryID, _ := strconv.Atoi(c.FormValue("category_id"))
 
-func (ctrl *PlaylistController) RemoveSongFromPlaylist(c *fiber.Ctx) error {
-	userID, err := middleware.GetUserID(c)
+	results, err := ctrl.adminService.BulkUpload(file, categoryID)
 	if err != nil {
 		return err
 	}
 
-	playlistID, err := strconv.Atoi(c.Params("id"))
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   true,
-			"message": "invalid playlist ID",
-		})
+	succeeded := 0
+	for _, result := range results {
+		if result.Success {
+			succeeded++
+		}
 	}
 
-	songID, err := strconv.Atoi(c.Params("songId"))
+	adminUsername, _ := middleware.GetUsername(c)
+	logger.AdminAction(adminUsername, c.IP(), "BULK_UPLOAD_SONGS",
+		fmt.Sprintf("succeeded=%d failed=%d", succeeded, len(results)-succeeded))
+
+	return response.SuccessWithMessage(c, "bulk upload processed", fiber.Map{
+		"results":   results,
+		"succeeded": succeeded,
+		"failed":    len(results) - succeeded,
+	})
+}
+
+func (ctrl *AdminController) DeleteSong(c *fiber.Ctx) error {
+	songID, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   true,
@@ -357,62 +1887,43 @@ func (ctrl *PlaylistController) RemoveSongFromPlaylist(c *fiber.Ctx) error {
 		})
 	}
 
-	err = ctrl.playlistService.RemoveSong(playlistID, songID, userID)
+	err = ctrl.adminService.DeleteSong(songID)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error":   true,
 			"message": err.Error(),
 		})
 	}
 
-	logger.Info(logger.CategoryPlaylist, "Song removed from playlist: playlist_id=%d song_id=%d", playlistID, songID)
-
-	return c.JSON(fiber.Map{
-		"error":   false,
-		"message": "song removed from playlist",
-	})
+	return response.Message(c, "song deleted successfully")
 }
 
-func (ctrl *PlaylistController) DeletePlaylist(c *fiber.Ctx) error {
-	userID, err := middleware.GetUserID(c)
-	if err != nil {
-		return err
-	}
+// DeleteSongs moves several songs to the trash, reporting which ids
+// weren't found
+func (ctrl *AdminController) DeleteSongs(c *fiber.Ctx) error {
+	adminUsername, _ := middleware.GetUsername(c)
 
-	playlistID, err := strconv.Atoi(c.Params("id"))
-	if err != nil {
+	var req models.BulkDeleteRequest
+	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   true,
-			"message": "invalid playlist ID",
+			"message": "invalid request data",
 		})
 	}
 
-	err = ctrl.playlistService.DeletePlaylist(playlistID, userID)
+	deleted, failed, err := ctrl.adminService.DeleteSongs(req.IDs)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error":   true,
-			"message": err.Error(),
-		})
+		return err
 	}
 
-	logger.Info(logger.CategoryPlaylist, "Playlist deleted: playlist_id=%d by user_id=%d", playlistID, userID)
-
-	return c.JSON(fiber.Map{
-		"error":   false,
-		"message": "playlist deleted successfully",
-	})
-}
-
-// PlaybackController handles song playback endpoints
-type PlaybackController struct {
-	playbackService *services.PlaybackService
-}
+	logger.AdminAction(adminUsername, c.IP(), "BULK_DELETE_SONGS",
+		fmt.Sprintf("deleted=%d failed=%d", len(deleted), len(failed)))
 
-func NewPlaybackController(playbackService *services.PlaybackService) *PlaybackController {
-	return &PlaybackController{playbackService: playbackService}
+	return response.Success(c, fiber.Map{"deleted": deleted, "failed": failed})
 }
 
-func (ctrl *PlaybackController) GetSong(c *fiber.Ctx) error {
+// UpdateSong edits a catalog song's track and disc numbers
+func (ctrl *AdminController) UpdateSong(c *fiber.Ctx) error {
 	songID, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -421,21 +1932,25 @@ func (ctrl *PlaybackController) GetSong(c *fiber.Ctx) error {
 		})
 	}
 
-	song, err := ctrl.playbackService.GetSongByID(songID)
-	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+	var req models.UpdateSongRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   true,
-			"message": err.Error(),
+			"message": "invalid request body",
 		})
 	}
 
-	return c.JSON(fiber.Map{
-		"error": false,
-		"data":  song,
-	})
+	if err := ctrl.adminService.UpdateSong(songID, req); err != nil {
+		return err
+	}
+
+	adminUsername, _ := middleware.GetUsername(c)
+	logger.AdminAction(adminUsername, c.IP(), "UPDATE_SONG", fmt.Sprintf("song_id=%d", songID))
+
+	return response.Message(c, "song updated successfully")
 }
 
-func (ctrl *PlaybackController) StreamSong(c *fiber.Ctx) error {
+func (ctrl *AdminController) RestoreSong(c *fiber.Ctx) error {
 	songID, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -444,7 +1959,7 @@ func (ctrl *PlaybackController) StreamSong(c *fiber.Ctx) error {
 		})
 	}
 
-	filePath, err := ctrl.playbackService.AuthorizeStream(songID)
+	err = ctrl.adminService.RestoreSong(songID)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error":   true,
@@ -452,216 +1967,349 @@ func (ctrl *PlaybackController) StreamSong(c *fiber.Ctx) error {
 		})
 	}
 
-	return c.SendFile(filePath)
+	return response.Message(c, "song restored successfully")
 }
 
-func (ctrl *PlaybackController) GetRecentSongs(c *fiber.Ctx) error {
-	limit := 20
-	if l := c.Query("limit"); l != "" {
-		if parsedLimit, err := strconv.Atoi(l); err == nil {
-			limit = parsedLimit
-		}
-	}
-
-	songs, err := ctrl.playbackService.GetRecentSongs(limit)
+// PurgeTrash permanently removes songs deleted longer ago than the retention window
+func (ctrl *AdminController) PurgeTrash(c *fiber.Ctx) error {
+	purged, err := ctrl.adminService.PurgeDeleted(ctrl.trashRetention)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
-			"message": "failed to fetch songs",
+			"message": "failed to purge deleted songs",
 		})
 	}
 
-	return c.JSON(fiber.Map{
-		"error": false,
-		"data":  songs,
-	})
-}
-
-// UserController handles user-specific endpoints
-type UserController struct {
-	userService *services.UserService
+	return response.SuccessWithMessage(c, "trash purged successfully", fiber.Map{"purged": purged})
 }
 
-func NewUserController(userService *services.UserService) *UserController {
-	return &UserController{userService: userService}
-}
+// BackupDatabase writes a timestamped snapshot of the database into the
+// backups directory, optionally labelled with a client-supplied name
+func (ctrl *AdminController) BackupDatabase(c *fiber.Ctx) error {
+	var req models.BackupRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "invalid request body",
+			})
+		}
+	}
 
-func (ctrl *UserController) UploadProfileImage(c *fiber.Ctx) error {
-	userID, err := middleware.GetUserID(c)
+	path, err := ctrl.adminService.CreateBackup(req.Name)
 	if err != nil {
 		return err
 	}
 
-	file, err := c.FormFile("file")
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   true,
-			"message": "no file provided",
-		})
+	adminUsername, _ := middleware.GetUsername(c)
+	logger.AdminAction(adminUsername, c.IP(), "BACKUP_DATABASE", "path="+path)
+
+	return response.Created(c, "backup created successfully", fiber.Map{"path": path})
+}
+
+// defaultAnalyticsDays is the range analytics cover when no from is given
+const defaultAnalyticsDays = 30
+
+// GetAnalytics reports site activity for ?from=YYYY-MM-DD through
+// ?to=YYYY-MM-DD (UTC, both inclusive). to defaults to today and from to
+// 30 days before it
+func (ctrl *AdminController) GetAnalytics(c *fiber.Ctx) error {
+	const layout = "2006-01-02"
+
+	now := time.Now().UTC()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if value := c.Query("to"); value != "" {
+		parsed, err := time.Parse(layout, value)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "to must be a date like 2024-01-31",
+			})
+		}
+		to = parsed
 	}
 
-	err = ctrl.userService.UploadProfileImage(userID, file)
+	from := to.AddDate(0, 0, -(defaultAnalyticsDays - 1))
+	if value := c.Query("from"); value != "" {
+		parsed, err := time.Parse(layout, value)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "from must be a date like 2024-01-01",
+			})
+		}
+		from = parsed
+	}
+
+	analytics, err := ctrl.adminService.GetAnalytics(from, to.AddDate(0, 0, 1))
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   true,
-			"message": err.Error(),
-		})
+		return err
 	}
 
-	return c.JSON(fiber.Map{
-		"error":   false,
-		"message": "profile picture updated successfully",
-	})
+	return response.Success(c, analytics)
 }
 
-func (ctrl *UserController) UploadSong(c *fiber.Ctx) error {
-	userID, err := middleware.GetUserID(c)
+// AuditStorage reports files no record refers to and songs whose file is gone
+func (ctrl *AdminController) AuditStorage(c *fiber.Ctx) error {
+	orphans, missing, err := ctrl.adminService.AuditStorage()
 	if err != nil {
 		return err
 	}
 
-	file, err := c.FormFile("file")
-	if err != nil {
+	return response.Success(c, fiber.Map{
+		"orphan_files":  orphans,
+		"missing_files": missing,
+	})
+}
+
+// CleanupStorage deletes orphaned files the admin has confirmed from an audit
+func (ctrl *AdminController) CleanupStorage(c *fiber.Ctx) error {
+	var req models.StorageCleanupRequest
+	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   true,
-			"message": "no file provided",
+			"message": "invalid request body",
 		})
 	}
 
-	upload, err := ctrl.userService.UploadSong(userID, file)
+	removed, err := ctrl.adminService.RemoveOrphanFiles(req.Files)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   true,
-			"message": err.Error(),
-		})
+		return err
 	}
 
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"error":   false,
-		"message": "track uploaded successfully",
-		"data":    upload,
-	})
+	adminUsername, _ := middleware.GetUsername(c)
+	logger.AdminAction(adminUsername, c.IP(), "CLEANUP_STORAGE", fmt.Sprintf("removed=%d", len(removed)))
+
+	return response.SuccessWithMessage(c, "orphaned files removed", fiber.Map{"removed": removed})
 }
 
-func (ctrl *UserController) GetUserUploads(c *fiber.Ctx) error {
-	userID, err := middleware.GetUserID(c)
+// RebuildSearchIndex repopulates the song search index from the catalog
+func (ctrl *AdminController) RebuildSearchIndex(c *fiber.Ctx) error {
+	indexed, err := ctrl.adminService.RebuildSearchIndex()
 	if err != nil {
 		return err
 	}
 
-	songs, err := ctrl.userService.GetUserUploads(userID)
+	adminUsername, _ := middleware.GetUsername(c)
+	logger.AdminAction(adminUsername, c.IP(), "REBUILD_SEARCH_INDEX", fmt.Sprintf("indexed=%d", indexed))
+
+	return response.SuccessWithMessage(c, "search index rebuilt", fiber.Map{"indexed": indexed})
+}
+
+func (ctrl *AdminController) GetAllUsers(c *fiber.Ctx) error {
+	limit, offset := parsePagination(c, 50)
+
+	users, err := ctrl.adminService.GetAllUsers(limit, offset, c.Query("search"), c.Query("filter"))
+	if apperrors.IsAppError(err) {
+		return err
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
-			"message": "failed to fetch uploads",
+			"message": "failed to fetch users",
 		})
 	}
 
-	return c.JSON(fiber.Map{
-		"error": false,
-		"data":  songs,
-	})
-}
-
-// AdminController handles admin endpoints
-type AdminController struct {
-	adminService *services.AdminService
+	return response.Success(c, users)
 }
 
-func NewAdminController(adminService *services.AdminService) *AdminController {
-	return &AdminController{adminService: adminService}
-}
+// UpdateUser promotes/demotes a user or suspends/reinstates their account
+func (ctrl *AdminController) UpdateUser(c *fiber.Ctx) error {
+	adminID, err := middleware.GetUserID(c)
+	if err != nil {
+		return err
+	}
+	adminUsername, _ := middleware.GetUsername(c)
 
-func (ctrl *AdminController) UploadSong(c *fiber.Ctx) error {
-	file, err := c.FormFile("file")
+	targetUserID, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   true,
-			"message": "no file provided",
+			"message": "invalid user ID",
 		})
 	}
 
-	title := c.FormValue("title")
-	artistName := c.FormValue("artist")
-	albumTitle := c.FormValue("album")
-	categoryID, _ := strconv.Atoi(c.FormValue("category_id"))
-	durationSeconds, _ := strconv.Atoi(c.FormValue("duration"))
+	var req models.UpdateUserRequest
+	if err := c.BodyParser(&req); err != nil || (req.IsAdmin == nil && req.Suspended == nil) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "is_admin or suspended required",
+		})
+	}
 
-	song, err := ctrl.adminService.UploadSong(file, title, artistName, albumTitle, categoryID, durationSeconds)
-	if err != nil {
+	// Guard against an admin locking themselves out
+	if targetUserID == adminID {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   true,
-			"message": err.Error(),
+			"message": "cannot change your own account status",
 		})
 	}
 
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"error":   false,
-		"message": "song uploaded successfully",
-		"data":    song,
-	})
+	if req.IsAdmin != nil {
+		if err := ctrl.adminService.SetAdmin(targetUserID, *req.IsAdmin); err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":   true,
+				"message": err.Error(),
+			})
+		}
+		action := "DEMOTE_USER"
+		if *req.IsAdmin {
+			action = "PROMOTE_USER"
+		}
+		logger.AdminAction(adminUsername, c.IP(), action, fmt.Sprintf("target_user_id=%d", targetUserID))
+	}
+
+	if req.Suspended != nil {
+		if err := ctrl.adminService.SetSuspended(targetUserID, *req.Suspended); err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":   true,
+				"message": err.Error(),
+			})
+		}
+		action := "REINSTATE_USER"
+		if *req.Suspended {
+			action = "SUSPEND_USER"
+		}
+		logger.AdminAction(adminUsername, c.IP(), action, fmt.Sprintf("target_user_id=%d", targetUserID))
+	}
+
+	return response.Message(c, "user updated successfully")
 }
 
-func (ctrl *AdminController) DeleteSong(c *fiber.Ctx) error {
-	songID, err := strconv.Atoi(c.Params("id"))
+// SetFeatured features or unfeatures a playlist owned by an admin
+func (ctrl *AdminController) SetFeatured(c *fiber.Ctx) error {
+	adminUsername, _ := middleware.GetUsername(c)
+
+	playlistID, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   true,
-			"message": "invalid song ID",
+			"message": "invalid playlist ID",
 		})
 	}
 
-	err = ctrl.adminService.DeleteSong(songID)
-	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+	var req models.SetFeaturedRequest
+	if err := c.BodyParser(&req); err != nil || req.Featured == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   true,
-			"message": err.Error(),
+			"message": "featured required",
 		})
 	}
 
-	return c.JSON(fiber.Map{
-		"error":   false,
-		"message": "song deleted successfully",
-	})
+	if err := ctrl.adminService.SetFeatured(playlistID, *req.Featured); err != nil {
+		return err
+	}
+
+	action := "UNFEATURE_PLAYLIST"
+	if *req.Featured {
+		action = "FEATURE_PLAYLIST"
+	}
+	logger.AdminAction(adminUsername, c.IP(), action, fmt.Sprintf("playlist_id=%d", playlistID))
+
+	return response.Message(c, "playlist updated successfully")
 }
 
-func (ctrl *AdminController) GetAllUsers(c *fiber.Ctx) error {
-	users, err := ctrl.adminService.GetAllUsers()
+func (ctrl *AdminController) GetAllSongs(c *fiber.Ctx) error {
+	limit, offset := parsePagination(c, 50)
+
+	songs, err := ctrl.adminService.GetAllSongs(limit, offset, c.Query("sort"))
+	if apperrors.IsAppError(err) {
+		return err
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
-			"message": "failed to fetch users",
+			"message": "failed to fetch songs",
 		})
 	}
 
-	return c.JSON(fiber.Map{
-		"error": false,
-		"data":  users,
-	})
+	return response.Success(c, songs)
 }
 
-func (ctrl *AdminController) GetAllSongs(c *fiber.Ctx) error {
-	limit, _ := strconv.Atoi(c.Query("limit", "50"))
-	offset, _ := strconv.Atoi(c.Query("offset", "0"))
+// MetricsController serves the in-memory metrics for Prometheus to scrape
+type MetricsController struct {
+	registry *metrics.Registry
+}
+
+func NewMetricsController(registry *metrics.Registry) *MetricsController {
+	return &MetricsController{registry: registry}
+}
+
+func (ctrl *MetricsController) GetMetrics(c *fiber.Ctx) error {
+	var buf bytes.Buffer
+	if err := ctrl.registry.WritePrometheus(&buf); err != nil {
+		return apperrors.InternalError(err)
+	}
+
+	c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	return c.Send(buf.Bytes())
+}
+
+// AuditController handles the admin audit log
+type AuditController struct {
+	auditService *services.AuditService
+}
+
+func NewAuditController(auditService *services.AuditService) *AuditController {
+	return &AuditController{auditService: auditService}
+}
+
+// GetAuditLog lists audit entries filtered by event_type and a from/to range
+func (ctrl *AuditController) GetAuditLog(c *fiber.Ctx) error {
+	from, err := parseAuditTime(c.Query("from"), false)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid from date",
+		})
+	}
+	to, err := parseAuditTime(c.Query("to"), true)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   true,
+			"message": "invalid to date",
+		})
+	}
 
-	songs, err := ctrl.adminService.GetAllSongs(limit, offset)
+	limit, offset := parsePagination(c, 50)
+
+	// Events are written in the background; include everything logged so far
+	logger.FlushAudit()
+	entries, err := ctrl.auditService.QueryAuditLog(strings.ToUpper(c.Query("event_type")), from, to, limit, offset)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
-			"message": "failed to fetch songs",
+			"message": "failed to fetch audit log",
 		})
 	}
 
-	return c.JSON(fiber.Map{
-		"error": false,
-		"data":  songs,
-	})
+	return response.Success(c, entries)
+}
+
+// Helper function to parse an RFC 3339 time or a plain date. A plain date
+// used as an upper bound covers the whole day
+func parseAuditTime(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Second)
+	}
+	return t, nil
 }
 
 // ForgotPassword handles password reset request
 func (ctrl *AuthController) ForgotPassword(c *fiber.Ctx) error {
 	var req struct {
-		Email string `json:"email"`
+		Email        string `json:"email"`
+		CaptchaToken string `json:"captcha_token"`
 	}
 
 	if err := c.BodyParser(&req); err != nil {
@@ -671,8 +2319,13 @@ func (ctrl *AuthController) ForgotPassword(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := ctrl.authService.VerifyPasswordResetCaptcha(req.CaptchaToken, c.IP()); err != nil {
+		return err
+	}
+
 	// Validate email format
-	if req.Email == "" || !isValidEmail(req.Email) {
+	email, err := services.NormalizeEmail(req.Email)
+	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   true,
 			"message": "Valid email address is required",
@@ -680,16 +2333,13 @@ func (ctrl *AuthController) ForgotPassword(c *fiber.Ctx) error {
 	}
 
 	// Process password reset (always return success to prevent email enumeration)
-	err := ctrl.authService.RequestPasswordReset(req.Email)
+	err = ctrl.authService.RequestPasswordReset(email, c.IP())
 	if err != nil {
 		logger.Error(logger.CategoryAuth, "Password reset request failed", err)
 	}
 
 	// Always return success message (security best practice)
-	return c.JSON(fiber.Map{
-		"error":   false,
-		"message": "If your email is registered, you will receive a password reset link shortly.",
-	})
+	return response.Message(c, "If your email is registered, you will receive a password reset link shortly.")
 }
 
 // ValidateResetToken validates reset token
@@ -711,10 +2361,7 @@ func (ctrl *AuthController) ValidateResetToken(c *fiber.Ctx) error {
 		})
 	}
 
-	return c.JSON(fiber.Map{
-		"error": false,
-		"email": email,
-	})
+	return response.Success(c, fiber.Map{"email": email})
 }
 
 // ResetPassword handles password reset with token
@@ -748,34 +2395,38 @@ func (ctrl *AuthController) ResetPassword(c *fiber.Ctx) error {
 		})
 	}
 
-	// Validate password strength
-	if len(req.NewPassword) < 8 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   true,
-			"message": "Password must be at least 8 characters long",
-		})
-	}
-
-	// Reset password
+	// Reset password (the service enforces the password policy)
 	err := ctrl.authService.ResetPassword(req.Token, req.NewPassword)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   true,
-			"message": err.Error(),
-		})
+		return err
 	}
 
-	return c.JSON(fiber.Map{
-		"error":   false,
-		"message": "Password reset successful. Please login with your new password.",
-	})
+	return response.Message(c, "Password reset successful. Please login with your new password.")
+}
+
+// Helper function to tell credential failures apart from other service errors
+func isAuthError(err error) bool {
+	appErr := apperrors.GetAppError(err)
+	return appErr != nil && appErr.Code == apperrors.ErrCodeAuth
 }
 
-// Helper function to validate email format
-func isValidEmail(email string) bool {
-	// Basic email validation
-	return len(email) > 3 && 
-		   len(email) < 255 && 
-		   strings.Contains(email, "@") && 
-		   strings.Contains(email, ".")
-}
\ No newline at end of file
+// maxPageSize caps the limit a client can request for list endpoints
+const maxPageSize = 100
+
+// Helper function to read limit/offset query parameters, clamped to sane values
+func parsePagination(c *fiber.Ctx, defaultLimit int) (int, int) {
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultLimit
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	offset, err := strconv.Atoi(c.Query("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	return limit, offset
+}
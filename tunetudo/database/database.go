@@ -3,121 +3,92 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"net/url"
+	"strings"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// Options controls how the SQLite database is opened
+type Options struct {
+	// JournalMode is the SQLite journal mode; WAL lets readers run
+	// alongside a writer
+	JournalMode string
+	// BusyTimeout is how long a connection waits on a lock before
+	// failing with "database is locked"
+	BusyTimeout time.Duration
+	// ForeignKeys turns on foreign key enforcement, which SQLite leaves
+	// off unless it is requested on every connection
+	ForeignKeys bool
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// DefaultOptions returns the settings InitDB uses
+func DefaultOptions() Options {
+	return Options{
+		JournalMode:  "WAL",
+		BusyTimeout:  5 * time.Second,
+		ForeignKeys:  true,
+		MaxOpenConns: 10,
+		MaxIdleConns: 5,
+	}
+}
+
 func InitDB(dbPath string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+	return InitDBWithOptions(dbPath, DefaultOptions())
+}
+
+// InitDBWithOptions opens the database with the given pragmas and pool limits
+func InitDBWithOptions(dbPath string, opts Options) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", buildDSN(dbPath, opts))
 	if err != nil {
 		return nil, err
 	}
 
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	db.SetMaxIdleConns(opts.MaxIdleConns)
+	db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, err
 	}
 
 	return db, nil
 }
 
-func RunMigrations(db *sql.DB) error {
-	migrations := []string{
-		`CREATE TABLE IF NOT EXISTS users (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			username TEXT UNIQUE NOT NULL,
-			email TEXT UNIQUE NOT NULL,
-			password_hash TEXT NOT NULL,
-			is_admin INTEGER DEFAULT 0,
-			profile_image_path TEXT,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			last_login DATETIME
-		)`,
-		
-		`CREATE TABLE IF NOT EXISTS artists (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name TEXT NOT NULL,
-			description TEXT,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		)`,
-		
-		`CREATE TABLE IF NOT EXISTS albums (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			title TEXT NOT NULL,
-			artist_id INTEGER,
-			cover_image_path TEXT,
-			release_date DATE,
-			FOREIGN KEY(artist_id) REFERENCES artists(id) ON DELETE CASCADE
-		)`,
-		
-		`CREATE TABLE IF NOT EXISTS categories (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name TEXT NOT NULL UNIQUE,
-			description TEXT
-		)`,
-		
-		`CREATE TABLE IF NOT EXISTS songs (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			title TEXT NOT NULL,
-			artist_id INTEGER,
-			album_id INTEGER,
-			category_id INTEGER,
-			duration_seconds INTEGER,
-			file_path TEXT NOT NULL,
-			format TEXT NOT NULL,
-			uploaded_by_user_id INTEGER,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			FOREIGN KEY(artist_id) REFERENCES artists(id) ON DELETE CASCADE,
-			FOREIGN KEY(album_id) REFERENCES albums(id) ON DELETE SET NULL,
-			FOREIGN KEY(category_id) REFERENCES categories(id) ON DELETE SET NULL,
-			FOREIGN KEY(uploaded_by_user_id) REFERENCES users(id) ON DELETE CASCADE
-		)`,
-		
-		`CREATE TABLE IF NOT EXISTS playlists (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			user_id INTEGER NOT NULL,
-			name TEXT NOT NULL,
-			description TEXT,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			UNIQUE(user_id, name),
-			FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
-		)`,
-		
-		`CREATE TABLE IF NOT EXISTS playlist_songs (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			playlist_id INTEGER NOT NULL,
-			song_id INTEGER NOT NULL,
-			queue_number INTEGER DEFAULT 0,
-			added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			FOREIGN KEY(playlist_id) REFERENCES playlists(id) ON DELETE CASCADE,
-			FOREIGN KEY(song_id) REFERENCES songs(id) ON DELETE CASCADE,
-			UNIQUE(playlist_id, song_id)
-		)`,
-		
-		`CREATE TABLE IF NOT EXISTS uploads (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			user_id INTEGER NOT NULL,
-			original_filename TEXT,
-			stored_path TEXT,
-			file_size_bytes INTEGER,
-			error_message TEXT,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
-		)`,
-		
-		// FTS5 Virtual Table for search
-		// Indexes
-		`CREATE INDEX IF NOT EXISTS idx_songs_artist ON songs(artist_id)`,
-		`CREATE INDEX IF NOT EXISTS idx_songs_album ON songs(album_id)`,
-		`CREATE INDEX IF NOT EXISTS idx_songs_category ON songs(category_id)`,
-		`CREATE INDEX IF NOT EXISTS idx_playlists_user ON playlists(user_id)`,
-		`CREATE INDEX IF NOT EXISTS idx_playlist_songs_playlist ON playlist_songs(playlist_id)`,
-		`CREATE INDEX IF NOT EXISTS idx_uploads_user ON uploads(user_id)`,
+// buildDSN passes the pragmas as driver DSN parameters so they apply to
+// every pooled connection, not just the first one
+func buildDSN(dbPath string, opts Options) string {
+	params := url.Values{}
+	if opts.JournalMode != "" {
+		params.Set("_journal_mode", opts.JournalMode)
+	}
+	if opts.BusyTimeout > 0 {
+		params.Set("_busy_timeout", fmt.Sprint(opts.BusyTimeout.Milliseconds()))
+	}
+	if opts.ForeignKeys {
+		params.Set("_foreign_keys", "on")
 	}
+	// Take the write lock at BEGIN so concurrent transactions wait on the
+	// busy timeout instead of failing when they first write
+	params.Set("_txlock", "immediate")
 
-	for _, migration := range migrations {
-		if _, err := db.Exec(migration); err != nil {
-			return fmt.Errorf("migration failed: %v", err)
-		}
+	separator := "?"
+	if strings.Contains(dbPath, "?") {
+		separator = "&"
+	}
+	return dbPath + separator + params.Encode()
+}
+
+// RunMigrations brings the schema up to date and seeds default data
+func RunMigrations(db *sql.DB) error {
+	if _, err := Migrate(db, schemaMigrations); err != nil {
+		return err
 	}
 
 	return seedDefaultData(db)
@@ -0,0 +1,281 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitDBPragmas(t *testing.T) {
+	db, err := InitDB(filepath.Join(t.TempDir(), "pragmas.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	var journalMode string
+	require.NoError(t, db.QueryRow(`PRAGMA journal_mode`).Scan(&journalMode))
+	assert.Equal(t, "wal", journalMode)
+
+	var busyTimeout int
+	require.NoError(t, db.QueryRow(`PRAGMA busy_timeout`).Scan(&busyTimeout))
+	assert.Equal(t, 5000, busyTimeout)
+
+	var foreignKeys int
+	require.NoError(t, db.QueryRow(`PRAGMA foreign_keys`).Scan(&foreignKeys))
+	assert.Equal(t, 1, foreignKeys)
+
+	assert.Equal(t, 10, db.Stats().MaxOpenConnections)
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	db, err := InitDB(filepath.Join(t.TempDir(), "concurrent.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, RunMigrations(db))
+
+	const writers = 20
+	const perWriter = 10
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*perWriter)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				name := fmt.Sprintf("user_%d_%d", w, i)
+
+				tx, err := db.Begin()
+				if err != nil {
+					errs <- err
+					return
+				}
+				result, err := tx.Exec(`INSERT INTO users (username, email, password_hash) VALUES (?, ?, ?)`,
+					name, name+"@example.com", "hash")
+				if err != nil {
+					tx.Rollback()
+					errs <- err
+					return
+				}
+				userID, _ := result.LastInsertId()
+				if _, err := tx.Exec(`INSERT INTO playlists (user_id, name) VALUES (?, ?)`, userID, "Favourites"); err != nil {
+					tx.Rollback()
+					errs <- err
+					return
+				}
+				if err := tx.Commit(); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	var users, playlists int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&users))
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM playlists`).Scan(&playlists))
+	assert.Equal(t, writers*perWriter, users)
+	assert.Equal(t, writers*perWriter, playlists)
+
+	t.Run("Cascade deletes fire", func(t *testing.T) {
+		var userID int
+		require.NoError(t, db.QueryRow(`SELECT id FROM users WHERE username = ?`, "user_0_0").Scan(&userID))
+
+		_, err := db.Exec(`DELETE FROM users WHERE id = ?`, userID)
+		require.NoError(t, err)
+
+		var remaining int
+		require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM playlists WHERE user_id = ?`, userID).Scan(&remaining))
+		assert.Equal(t, 0, remaining)
+	})
+}
+
+func TestUserDeleteCascades(t *testing.T) {
+	db, err := InitDB(filepath.Join(t.TempDir(), "cascade.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, RunMigrations(db))
+
+	exec := func(query string, args ...interface{}) int64 {
+		result, err := db.Exec(query, args...)
+		require.NoError(t, err)
+		id, _ := result.LastInsertId()
+		return id
+	}
+	count := func(query string, args ...interface{}) int {
+		var n int
+		require.NoError(t, db.QueryRow(query, args...).Scan(&n))
+		return n
+	}
+
+	ownerID := exec(`INSERT INTO users (username, email, password_hash) VALUES ('owner', 'owner@example.com', 'hash')`)
+	otherID := exec(`INSERT INTO users (username, email, password_hash) VALUES ('other', 'other@example.com', 'hash')`)
+
+	uploadedID := exec(`INSERT INTO songs (title, file_path, format, uploaded_by_user_id) VALUES ('Mine', 'media/uploads/mine.mp3', 'mp3', ?)`, ownerID)
+	exec(`INSERT INTO uploads (user_id, original_filename, stored_path) VALUES (?, 'mine.mp3', 'media/uploads/mine.mp3')`, ownerID)
+	ownPlaylistID := exec(`INSERT INTO playlists (user_id, name) VALUES (?, 'Own')`, ownerID)
+	exec(`INSERT INTO playlist_songs (playlist_id, song_id) VALUES (?, ?)`, ownPlaylistID, uploadedID)
+
+	// Another user's playlist holding the uploaded song keeps the playlist
+	// but loses the entry
+	otherPlaylistID := exec(`INSERT INTO playlists (user_id, name) VALUES (?, 'Theirs')`, otherID)
+	exec(`INSERT INTO playlist_songs (playlist_id, song_id) VALUES (?, ?)`, otherPlaylistID, uploadedID)
+	exec(`INSERT INTO playlist_collaborators (playlist_id, user_id) VALUES (?, ?)`, otherPlaylistID, ownerID)
+	exec(`INSERT INTO playback_positions (user_id, song_id, position_seconds) VALUES (?, ?, 30)`, otherID, uploadedID)
+
+	exec(`DELETE FROM users WHERE id = ?`, ownerID)
+
+	assert.Equal(t, 0, count(`SELECT COUNT(*) FROM playlists WHERE user_id = ?`, ownerID))
+	assert.Equal(t, 0, count(`SELECT COUNT(*) FROM songs WHERE uploaded_by_user_id = ?`, ownerID))
+	assert.Equal(t, 0, count(`SELECT COUNT(*) FROM uploads WHERE user_id = ?`, ownerID))
+	assert.Equal(t, 0, count(`SELECT COUNT(*) FROM playlist_songs`))
+	assert.Equal(t, 0, count(`SELECT COUNT(*) FROM playlist_collaborators`))
+	assert.Equal(t, 0, count(`SELECT COUNT(*) FROM playback_positions`))
+	assert.Equal(t, 1, count(`SELECT COUNT(*) FROM playlists WHERE id = ?`, otherPlaylistID))
+}
+
+func openMigrationTestDB(t *testing.T) *sql.DB {
+	db, err := InitDB(filepath.Join(t.TempDir(), "migrations.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestMigrateTwiceIsNoOp(t *testing.T) {
+	db := openMigrationTestDB(t)
+
+	applied, err := Migrate(db, schemaMigrations)
+	require.NoError(t, err)
+	assert.Equal(t, len(schemaMigrations), applied)
+
+	applied, err = Migrate(db, schemaMigrations)
+	require.NoError(t, err)
+	assert.Equal(t, 0, applied)
+
+	var recorded int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&recorded))
+	assert.Equal(t, len(schemaMigrations), recorded)
+
+	require.NoError(t, RunMigrations(db))
+	require.NoError(t, RunMigrations(db))
+}
+
+func TestNewMigrationAppliesOnce(t *testing.T) {
+	db := openMigrationTestDB(t)
+	_, err := Migrate(db, schemaMigrations)
+	require.NoError(t, err)
+
+	runs := 0
+	list := append(append([]Migration(nil), schemaMigrations...), Migration{
+		Version: len(schemaMigrations) + 1,
+		Name:    "songs_play_count",
+		Up: func(tx *sql.Tx) error {
+			runs++
+			return addColumn("songs", "play_count", "INTEGER DEFAULT 0")(tx)
+		},
+		Down: dropColumn("songs", "play_count"),
+	})
+
+	applied, err := Migrate(db, list)
+	require.NoError(t, err)
+	assert.Equal(t, 1, applied)
+
+	applied, err = Migrate(db, list)
+	require.NoError(t, err)
+	assert.Equal(t, 0, applied)
+	assert.Equal(t, 1, runs)
+
+	_, err = db.Exec(`UPDATE songs SET play_count = play_count + 1`)
+	assert.NoError(t, err)
+
+	t.Run("Rollback reverts it", func(t *testing.T) {
+		reverted, err := Rollback(db, list, 1)
+		require.NoError(t, err)
+		assert.Equal(t, 1, reverted)
+
+		_, err = db.Exec(`UPDATE songs SET play_count = 0`)
+		assert.Error(t, err)
+
+		applied, err := Migrate(db, list)
+		require.NoError(t, err)
+		assert.Equal(t, 1, applied)
+	})
+}
+
+func TestFailedMigrationIsNotRecorded(t *testing.T) {
+	db := openMigrationTestDB(t)
+
+	list := []Migration{
+		{Version: 1, Name: "create_things", Up: execStatements(`CREATE TABLE things (id INTEGER PRIMARY KEY)`)},
+		{Version: 2, Name: "broken", Up: execStatements(
+			`ALTER TABLE things ADD COLUMN label TEXT`,
+			`ALTER TABLE missing ADD COLUMN label TEXT`,
+		)},
+	}
+
+	applied, err := Migrate(db, list)
+	assert.Error(t, err)
+	assert.Equal(t, 1, applied)
+
+	var version int
+	require.NoError(t, db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version))
+	assert.Equal(t, 1, version)
+
+	// The partial ALTER TABLE was rolled back with the rest of the migration
+	_, err = db.Exec(`INSERT INTO things (label) VALUES ('x')`)
+	assert.Error(t, err)
+}
+
+func TestMigrateUnversionedDatabase(t *testing.T) {
+	db := openMigrationTestDB(t)
+	_, err := Migrate(db, schemaMigrations)
+	require.NoError(t, err)
+
+	// Databases created before versioning already have every table and
+	// column but no schema_migrations rows
+	_, err = db.Exec(`DROP TABLE schema_migrations`)
+	require.NoError(t, err)
+
+	applied, err := Migrate(db, schemaMigrations)
+	require.NoError(t, err)
+	assert.Equal(t, len(schemaMigrations), applied)
+}
+
+func TestArtistNameKeyBackfill(t *testing.T) {
+	db := openMigrationTestDB(t)
+	var before []Migration
+	for _, m := range schemaMigrations {
+		if m.Name != "artists_name_key" {
+			before = append(before, m)
+		}
+	}
+	_, err := Migrate(db, before)
+	require.NoError(t, err)
+
+	_, err = db.Exec(`INSERT INTO artists (name) VALUES ('The Beatles'), ('Beatles, The'), ('Nina Simone')`)
+	require.NoError(t, err)
+
+	_, err = Migrate(db, schemaMigrations)
+	require.NoError(t, err)
+
+	var keys []string
+	rows, err := db.Query(`SELECT name_key FROM artists ORDER BY id`)
+	require.NoError(t, err)
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		require.NoError(t, rows.Scan(&key))
+		keys = append(keys, key)
+	}
+	assert.Equal(t, []string{"beatles", "beatles", "nina simone"}, keys)
+}
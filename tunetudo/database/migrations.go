@@ -0,0 +1,589 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"tunetudo/models"
+)
+
+// Migration is one numbered schema change. Up and Down run inside a
+// transaction together with the schema_migrations bookkeeping, so a
+// migration is either fully applied and recorded or not at all
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *sql.Tx) error
+	Down    func(tx *sql.Tx) error
+}
+
+// schemaMigrations is the ordered history of the schema. Append new
+// migrations with the next version number; never edit or reorder ones
+// that have shipped
+var schemaMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial_schema",
+		Up: execStatements(
+			`CREATE TABLE IF NOT EXISTS users (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				username TEXT UNIQUE NOT NULL,
+				email TEXT UNIQUE NOT NULL,
+				password_hash TEXT NOT NULL,
+				is_admin INTEGER DEFAULT 0,
+				profile_image_path TEXT,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				last_login DATETIME
+			)`,
+			`CREATE TABLE IF NOT EXISTS artists (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL,
+				description TEXT,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE TABLE IF NOT EXISTS albums (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				title TEXT NOT NULL,
+				artist_id INTEGER,
+				cover_image_path TEXT,
+				release_date DATE,
+				FOREIGN KEY(artist_id) REFERENCES artists(id) ON DELETE CASCADE
+			)`,
+			`CREATE TABLE IF NOT EXISTS categories (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL UNIQUE,
+				description TEXT
+			)`,
+			`CREATE TABLE IF NOT EXISTS songs (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				title TEXT NOT NULL,
+				artist_id INTEGER,
+				album_id INTEGER,
+				category_id INTEGER,
+				duration_seconds INTEGER,
+				file_path TEXT NOT NULL,
+				format TEXT NOT NULL,
+				uploaded_by_user_id INTEGER,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY(artist_id) REFERENCES artists(id) ON DELETE CASCADE,
+				FOREIGN KEY(album_id) REFERENCES albums(id) ON DELETE SET NULL,
+				FOREIGN KEY(category_id) REFERENCES categories(id) ON DELETE SET NULL,
+				FOREIGN KEY(uploaded_by_user_id) REFERENCES users(id) ON DELETE CASCADE
+			)`,
+			`CREATE TABLE IF NOT EXISTS playlists (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				name TEXT NOT NULL,
+				description TEXT,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE(user_id, name),
+				FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+			)`,
+			`CREATE TABLE IF NOT EXISTS playlist_songs (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				playlist_id INTEGER NOT NULL,
+				song_id INTEGER NOT NULL,
+				queue_number INTEGER DEFAULT 0,
+				added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY(playlist_id) REFERENCES playlists(id) ON DELETE CASCADE,
+				FOREIGN KEY(song_id) REFERENCES songs(id) ON DELETE CASCADE,
+				UNIQUE(playlist_id, song_id)
+			)`,
+			`CREATE TABLE IF NOT EXISTS playlist_collaborators (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				playlist_id INTEGER NOT NULL,
+				user_id INTEGER NOT NULL,
+				role TEXT NOT NULL DEFAULT 'editor',
+				added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE(playlist_id, user_id),
+				FOREIGN KEY(playlist_id) REFERENCES playlists(id) ON DELETE CASCADE,
+				FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+			)`,
+			`CREATE TABLE IF NOT EXISTS uploads (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				original_filename TEXT,
+				stored_path TEXT,
+				file_size_bytes INTEGER,
+				error_message TEXT,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+			)`,
+			`CREATE TABLE IF NOT EXISTS playback_positions (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				song_id INTEGER NOT NULL,
+				position_seconds INTEGER NOT NULL DEFAULT 0,
+				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE(user_id, song_id),
+				FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+				FOREIGN KEY(song_id) REFERENCES songs(id) ON DELETE CASCADE
+			)`,
+			`CREATE TABLE IF NOT EXISTS audit_log (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				event_type TEXT NOT NULL,
+				user_hash TEXT NOT NULL,
+				masked_ip TEXT,
+				details TEXT,
+				created_at DATETIME NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_songs_artist ON songs(artist_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_songs_album ON songs(album_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_songs_category ON songs(category_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_playlists_user ON playlists(user_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_playlist_songs_playlist ON playlist_songs(playlist_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_uploads_user ON uploads(user_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_audit_log_event ON audit_log(event_type, created_at)`,
+			`CREATE INDEX IF NOT EXISTS idx_audit_log_created ON audit_log(created_at)`,
+		),
+		Down: execStatements(
+			`DROP TABLE IF EXISTS audit_log`,
+			`DROP TABLE IF EXISTS playback_positions`,
+			`DROP TABLE IF EXISTS uploads`,
+			`DROP TABLE IF EXISTS playlist_collaborators`,
+			`DROP TABLE IF EXISTS playlist_songs`,
+			`DROP TABLE IF EXISTS playlists`,
+			`DROP TABLE IF EXISTS songs`,
+			`DROP TABLE IF EXISTS categories`,
+			`DROP TABLE IF EXISTS albums`,
+			`DROP TABLE IF EXISTS artists`,
+			`DROP TABLE IF EXISTS users`,
+		),
+	},
+	{
+		Version: 2,
+		Name:    "songs_deleted_at",
+		Up:      addColumn("songs", "deleted_at", "DATETIME"),
+		Down:    dropColumn("songs", "deleted_at"),
+	},
+	{
+		Version: 3,
+		Name:    "users_suspended",
+		Up:      addColumn("users", "suspended", "INTEGER DEFAULT 0"),
+		Down:    dropColumn("users", "suspended"),
+	},
+	{
+		Version: 4,
+		Name:    "playlists_is_public",
+		Up:      addColumn("playlists", "is_public", "INTEGER DEFAULT 0"),
+		Down:    dropColumn("playlists", "is_public"),
+	},
+	{
+		Version: 5,
+		Name:    "uploads_transcode_status",
+		Up:      addColumn("uploads", "transcode_status", "TEXT"),
+		Down:    dropColumn("uploads", "transcode_status"),
+	},
+	{
+		Version: 6,
+		Name:    "waveforms",
+		Up: execStatements(
+			`CREATE TABLE IF NOT EXISTS waveforms (
+				song_id INTEGER NOT NULL,
+				buckets INTEGER NOT NULL,
+				file_path TEXT NOT NULL,
+				peaks TEXT NOT NULL,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY(song_id, buckets),
+				FOREIGN KEY(song_id) REFERENCES songs(id) ON DELETE CASCADE
+			)`,
+		),
+		Down: execStatements(`DROP TABLE IF EXISTS waveforms`),
+	},
+	{
+		Version: 7,
+		Name:    "idempotency_keys",
+		Up: execStatements(
+			`CREATE TABLE IF NOT EXISTS idempotency_keys (
+				user_id INTEGER NOT NULL,
+				idempotency_key TEXT NOT NULL,
+				method TEXT NOT NULL,
+				path TEXT NOT NULL,
+				status INTEGER,
+				content_type TEXT,
+				body BLOB,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY(user_id, idempotency_key),
+				FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created ON idempotency_keys(created_at)`,
+		),
+		Down: execStatements(`DROP TABLE IF EXISTS idempotency_keys`),
+	},
+	{
+		Version: 8,
+		Name:    "artists_name_key",
+		Up: func(tx *sql.Tx) error {
+			if err := addColumn("artists", "name_key", "TEXT")(tx); err != nil {
+				return err
+			}
+			if err := backfillArtistNameKeys(tx); err != nil {
+				return err
+			}
+			return execStatements(`CREATE INDEX IF NOT EXISTS idx_artists_name_key ON artists(name_key)`)(tx)
+		},
+		Down: execStatements(
+			`DROP INDEX IF EXISTS idx_artists_name_key`,
+			`ALTER TABLE artists DROP COLUMN name_key`,
+		),
+	},
+	{
+		Version: 9,
+		Name:    "songs_track_numbers",
+		Up: func(tx *sql.Tx) error {
+			if err := addColumn("songs", "track_number", "INTEGER")(tx); err != nil {
+				return err
+			}
+			return addColumn("songs", "disc_number", "INTEGER")(tx)
+		},
+		Down: func(tx *sql.Tx) error {
+			if err := dropColumn("songs", "disc_number")(tx); err != nil {
+				return err
+			}
+			return dropColumn("songs", "track_number")(tx)
+		},
+	},
+	{
+		Version: 10,
+		Name:    "users_share_now_playing",
+		Up:      addColumn("users", "share_now_playing", "INTEGER DEFAULT 0"),
+		Down:    dropColumn("users", "share_now_playing"),
+	},
+	{
+		Version: 11,
+		Name:    "plays",
+		Up: execStatements(
+			`CREATE TABLE IF NOT EXISTS plays (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				song_id INTEGER NOT NULL,
+				played_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+				FOREIGN KEY(song_id) REFERENCES songs(id) ON DELETE CASCADE
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_plays_user ON plays(user_id, played_at)`,
+		),
+		Down: execStatements(`DROP TABLE IF EXISTS plays`),
+	},
+	{
+		Version: 12,
+		Name:    "explicit_content",
+		Up: inOrder(
+			addColumn("songs", "explicit", "INTEGER NOT NULL DEFAULT 0"),
+			addColumn("categories", "explicit", "INTEGER NOT NULL DEFAULT 0"),
+			addColumn("users", "safe_mode", "INTEGER NOT NULL DEFAULT 0"),
+		),
+		Down: inOrder(
+			dropColumn("users", "safe_mode"),
+			dropColumn("categories", "explicit"),
+			dropColumn("songs", "explicit"),
+		),
+	},
+	{
+		Version: 13,
+		Name:    "users_oauth_provider",
+		Up: inOrder(
+			addColumn("users", "provider", "TEXT"),
+			addColumn("users", "provider_id", "TEXT"),
+			execStatements(`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_provider ON users(provider, provider_id)`),
+		),
+		Down: inOrder(
+			execStatements(`DROP INDEX IF EXISTS idx_users_provider`),
+			dropColumn("users", "provider_id"),
+			dropColumn("users", "provider"),
+		),
+	},
+	{
+		Version: 14,
+		Name:    "sessions",
+		Up: execStatements(
+			`CREATE TABLE IF NOT EXISTS sessions (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				jti TEXT NOT NULL UNIQUE,
+				ip_masked TEXT,
+				user_agent TEXT,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				last_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+				expires_at DATETIME NOT NULL,
+				FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id)`,
+		),
+		Down: execStatements(`DROP TABLE IF EXISTS sessions`),
+	},
+	{
+		// Uploads have always written to songs_fts, but nothing created it
+		Version: 15,
+		Name:    "songs_fts",
+		Up: execStatements(
+			`CREATE VIRTUAL TABLE IF NOT EXISTS songs_fts USING fts4(
+				song_id, title, artist_name, album_title, category_name,
+				notindexed=song_id
+			)`,
+			`DELETE FROM songs_fts`,
+			`INSERT INTO songs_fts (song_id, title, artist_name, album_title, category_name)
+			SELECT s.id, s.title, COALESCE(a.name, ''), COALESCE(al.title, ''), COALESCE(c.name, '')
+			FROM songs s
+			LEFT JOIN artists a ON s.artist_id = a.id
+			LEFT JOIN albums al ON s.album_id = al.id
+			LEFT JOIN categories c ON s.category_id = c.id
+			WHERE s.uploaded_by_user_id IS NULL AND s.deleted_at IS NULL`,
+		),
+		Down: execStatements(`DROP TABLE IF EXISTS songs_fts`),
+	},
+	{
+		Version: 16,
+		Name:    "playlists_version",
+		Up:      addColumn("playlists", "version", "INTEGER NOT NULL DEFAULT 0"),
+		Down:    dropColumn("playlists", "version"),
+	},
+	{
+		Version: 17,
+		Name:    "profile_image_sizes",
+		Up: inOrder(
+			addColumn("users", "profile_image_medium_path", "TEXT"),
+			addColumn("users", "profile_image_thumb_path", "TEXT"),
+		),
+		Down: inOrder(
+			dropColumn("users", "profile_image_thumb_path"),
+			dropColumn("users", "profile_image_medium_path"),
+		),
+	},
+	{
+		Version: 18,
+		Name:    "uploads_content_hash",
+		Up: inOrder(
+			addColumn("uploads", "content_hash", "TEXT"),
+			addColumn("uploads", "song_id", "INTEGER"),
+			execStatements(`CREATE INDEX IF NOT EXISTS idx_uploads_user_hash ON uploads(user_id, content_hash)`),
+		),
+		Down: inOrder(
+			execStatements(`DROP INDEX IF EXISTS idx_uploads_user_hash`),
+			dropColumn("uploads", "song_id"),
+			dropColumn("uploads", "content_hash"),
+		),
+	},
+	{
+		Version: 19,
+		Name:    "playlists_is_featured",
+		Up:      addColumn("playlists", "is_featured", "INTEGER NOT NULL DEFAULT 0"),
+		Down:    dropColumn("playlists", "is_featured"),
+	},
+	{
+		// Set once a sign-in provider confirms the address; there is no
+		// email verification of our own
+		Version: 20,
+		Name:    "users_email_verified",
+		Up:      addColumn("users", "email_verified", "INTEGER NOT NULL DEFAULT 0"),
+		Down:    dropColumn("users", "email_verified"),
+	},
+}
+
+// Migrate applies every migration in list whose version has not been
+// recorded yet, in version order, and returns how many were applied
+func Migrate(db *sql.DB, list []Migration) (int, error) {
+	if err := ensureMigrationsTable(db); err != nil {
+		return 0, err
+	}
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return 0, err
+	}
+
+	pending := sortedMigrations(list)
+	count := 0
+	for _, m := range pending {
+		if applied[m.Version] {
+			continue
+		}
+		err := inTx(db, func(tx *sql.Tx) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, m.Version, m.Name)
+			return err
+		})
+		if err != nil {
+			return count, fmt.Errorf("migration %d (%s) failed: %v", m.Version, m.Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Rollback reverts the most recently applied migrations in list, newest
+// first, until steps have been undone or none remain. Migrations without
+// a Down step cannot be rolled back
+func Rollback(db *sql.DB, list []Migration, steps int) (int, error) {
+	if err := ensureMigrationsTable(db); err != nil {
+		return 0, err
+	}
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return 0, err
+	}
+
+	ordered := sortedMigrations(list)
+	count := 0
+	for i := len(ordered) - 1; i >= 0 && count < steps; i-- {
+		m := ordered[i]
+		if !applied[m.Version] {
+			continue
+		}
+		if m.Down == nil {
+			return count, fmt.Errorf("migration %d (%s) cannot be rolled back", m.Version, m.Name)
+		}
+		err := inTx(db, func(tx *sql.Tx) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, m.Version)
+			return err
+		})
+		if err != nil {
+			return count, fmt.Errorf("rollback of migration %d (%s) failed: %v", m.Version, m.Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+func ensureMigrationsTable(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	return err
+}
+
+func appliedVersions(db *sql.DB) (map[int]bool, error) {
+	rows, err := db.Query(`SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+func sortedMigrations(list []Migration) []Migration {
+	sorted := append([]Migration(nil), list...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	return sorted
+}
+
+func inTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// backfillArtistNameKeys computes the matching key for artists created
+// before artists had one. Existing duplicates are left for an admin to merge
+func backfillArtistNameKeys(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT id, name FROM artists WHERE name_key IS NULL`)
+	if err != nil {
+		return err
+	}
+	keys := map[int]string{}
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return err
+		}
+		keys[id] = models.ArtistNameKey(name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, key := range keys {
+		if _, err := tx.Exec(`UPDATE artists SET name_key = ? WHERE id = ?`, key, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// execStatements builds a migration step that runs each statement in order
+func execStatements(statements ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, stmt := range statements {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// addColumn builds an ALTER TABLE step that is skipped when the column
+// already exists, which is the case for databases created before
+// migrations were versioned
+func addColumn(table, column, definition string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		exists, err := columnExists(tx, table, column)
+		if err != nil || exists {
+			return err
+		}
+		_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+		return err
+	}
+}
+
+// inOrder runs steps one after another, stopping at the first failure
+func inOrder(steps ...func(tx *sql.Tx) error) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, step := range steps {
+			if err := step(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func dropColumn(table, column string) func(tx *sql.Tx) error {
+	return execStatements(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, column))
+}
+
+func columnExists(tx *sql.Tx, table, column string) (bool, error) {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
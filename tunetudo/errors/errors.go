@@ -11,6 +11,8 @@ type AppError struct {
 	Message    string // Safe message for end user (no sensitive info)
 	StatusCode int    // HTTP status code
 	Internal   error  // Internal error (not exposed to client, logged separately)
+	// Fields maps each invalid input to its message; sent as data.fields
+	Fields map[string]string
 }
 
 func (e *AppError) Error() string {
@@ -51,6 +53,34 @@ func ValidationError(message string, internal error) *AppError {
 	return NewAppError(ErrCodeValidation, message, 400, internal)
 }
 
+// ValidationErrors collects a message per invalid field so a form can show
+// every problem at once instead of one per submission
+type ValidationErrors map[string]string
+
+// Add records message for field, keeping the first one reported
+func (v ValidationErrors) Add(field, message string) {
+	if _, exists := v[field]; !exists {
+		v[field] = message
+	}
+}
+
+// Err returns nil when nothing failed, or a validation error listing the
+// fields. A single failure keeps its own message as the top-level one
+func (v ValidationErrors) Err() error {
+	if len(v) == 0 {
+		return nil
+	}
+	message := "some fields are invalid"
+	if len(v) == 1 {
+		for _, fieldMessage := range v {
+			message = fieldMessage
+		}
+	}
+	err := ValidationError(message, nil)
+	err.Fields = v
+	return err
+}
+
 func AuthError(message string, internal error) *AppError {
 	// Log authentication errors without exposing details
 	if internal != nil {
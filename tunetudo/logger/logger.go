@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -27,10 +28,96 @@ type Logger struct {
 	errorLogger    *log.Logger
 	securityLogger *log.Logger
 	debugLogger    *log.Logger
+	files          []*os.File
 }
 
 var defaultLogger *Logger
 
+// AuditSink persists security events so they can be reviewed through the API
+type AuditSink interface {
+	RecordAuditEvent(eventType, userHash, maskedIP, details string, at time.Time) error
+}
+
+// auditQueueSize bounds how many events can wait for the sink. Past it new
+// events are dropped from the audit log; the security log still has them
+const auditQueueSize = 1024
+
+type auditEvent struct {
+	eventType, userHash, maskedIP, details string
+	at                                     time.Time
+	flushed                                chan struct{} // set on FlushAudit markers
+}
+
+var (
+	auditMu    sync.RWMutex
+	auditQueue chan auditEvent
+	auditDone  chan struct{}
+)
+
+// SetAuditSink registers where audited events are stored; nil disables it.
+// Events are handed to a background worker, so logging one never waits on
+// the sink. Replacing the sink first writes out what the old one had queued
+func SetAuditSink(sink AuditSink) {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	if auditQueue != nil {
+		close(auditQueue)
+		<-auditDone
+		auditQueue, auditDone = nil, nil
+	}
+	if sink == nil {
+		return
+	}
+
+	queue := make(chan auditEvent, auditQueueSize)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for event := range queue {
+			if event.flushed != nil {
+				close(event.flushed)
+				continue
+			}
+			if err := sink.RecordAuditEvent(event.eventType, event.userHash, event.maskedIP, event.details, event.at); err != nil {
+				log.Printf("[WARNING] %s Failed to record audit event: %v", CategoryAdmin, err)
+			}
+		}
+	}()
+	auditQueue, auditDone = queue, done
+}
+
+// FlushAudit waits until every event queued so far has reached the sink
+func FlushAudit() {
+	auditMu.RLock()
+	if auditQueue == nil {
+		auditMu.RUnlock()
+		return
+	}
+	flushed := make(chan struct{})
+	auditQueue <- auditEvent{flushed: flushed}
+	auditMu.RUnlock()
+	<-flushed
+}
+
+// audit queues an event that was already logged for the audit sink.
+// Only hashed users and masked IPs reach it.
+func audit(eventType, userHash, maskedIP, details string) {
+	auditMu.RLock()
+	defer auditMu.RUnlock()
+	if auditQueue == nil {
+		return
+	}
+
+	event := auditEvent{eventType: eventType, userHash: userHash, maskedIP: maskedIP,
+		details: RemoveCarriageReturns(details), at: time.Now()}
+	select {
+	case auditQueue <- event:
+	default:
+		log.Printf("[WARNING] %s Audit queue full; %s event not recorded", CategoryAdmin, eventType)
+	}
+}
+
 // Category constants for filtering logs
 const (
 	CategoryAuth       = "[AUTH]"
@@ -75,11 +162,28 @@ func InitLogger(logPath string) error {
 		errorLogger:    log.New(logFile, "[ERROR] ", log.Ldate|log.Ltime|log.Lshortfile),
 		securityLogger: log.New(securityFile, "[SECURITY] ", log.Ldate|log.Ltime|log.Lshortfile),
 		debugLogger:    log.New(debugFile, "[DEBUG] ", log.Ldate|log.Ltime|log.Lshortfile),
+		files:          []*os.File{logFile, securityFile, debugFile},
 	}
 
 	return nil
 }
 
+// Close flushes and closes the log files. Later log calls still reach stdout.
+func Close() error {
+	if defaultLogger == nil {
+		return nil
+	}
+
+	var firstErr error
+	for _, f := range defaultLogger.files {
+		if err := f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	defaultLogger = nil
+	return firstErr
+}
+
 // HashIdentifier creates a hash of sensitive identifiers (username, email, etc.)
 func HashIdentifier(identifier string) string {
 	if identifier == "" || identifier == "anonymous" {
@@ -175,7 +279,9 @@ func AuthAttempt(username, ipAddress string, success bool, reason string) {
 	maskedIP := MaskIP(ipAddress)
 	sanitizedReason := RemoveCarriageReturns(reason)
 
-	Security(fmt.Sprintf("AUTH_%s", status), userHash, maskedIP, sanitizedReason)
+	eventType := fmt.Sprintf("AUTH_%s", status)
+	Security(eventType, userHash, maskedIP, sanitizedReason)
+	audit(eventType, userHash, maskedIP, sanitizedReason)
 }
 
 // AccessDenied logs unauthorized access attempts
@@ -188,6 +294,7 @@ func AccessDenied(username, ipAddress, resource, reason string) {
 
 	details := fmt.Sprintf("Resource: %s | Reason: %s", sanitizedResource, sanitizedReason)
 	Security("ACCESS_DENIED", userHash, maskedIP, details)
+	audit("ACCESS_DENIED", userHash, maskedIP, details)
 }
 
 // AdminAction logs administrative actions
@@ -198,7 +305,9 @@ func AdminAction(username, ipAddress, action, details string) {
 	sanitizedAction := RemoveCarriageReturns(action)
 	sanitizedDetails := RemoveCarriageReturns(details)
 
-	Security("ADMIN_ACTION", userHash, maskedIP, fmt.Sprintf("Action: %s | Details: %s", sanitizedAction, sanitizedDetails))
+	details = fmt.Sprintf("Action: %s | Details: %s", sanitizedAction, sanitizedDetails)
+	Security("ADMIN_ACTION", userHash, maskedIP, details)
+	audit("ADMIN_ACTION", userHash, maskedIP, details)
 }
 
 // ValidationFailure logs input validation failures without exposing input values
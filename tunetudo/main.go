@@ -1,31 +1,43 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"log"
+	"net"
 	"net/http"
 	"path/filepath"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 	"tunetudo/config"
 	"tunetudo/database"
 	"tunetudo/logger"
+	"tunetudo/metrics"
 	"tunetudo/middleware"
 	"fmt"
 	"github.com/joho/godotenv"
 	"tunetudo/routes"
+	"tunetudo/services"
 	"github.com/gofiber/fiber/v2/middleware/helmet"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/compress"
+	"github.com/gofiber/fiber/v2/middleware/cors"
 	fiberlogger "github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
-	"github.com/gofiber/fiber/v2/middleware/limiter"
 )
 
 func main() {
-	// Load configuration
-	cfg := config.LoadConfig()
+	// Load configuration (after .env so its values are picked up)
 	if err := godotenv.Load(); err != nil {
 		log.Println("Warning: No .env file found or error loading it:", err)
 	}
+	cfg := config.LoadConfig()
+	if err := cfg.Validate(); err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
 
 	// Initialize logger
 	// "Centralize all logging/debugging, use consistently"
@@ -37,12 +49,18 @@ func main() {
 
 	// Initialize database
 	absPath, _ := filepath.Abs("./tunetudo.db")
-	db, err := database.InitDB(absPath)
+	db, err := database.InitDBWithOptions(absPath, database.Options{
+		JournalMode:     cfg.DBJournalMode,
+		BusyTimeout:     cfg.DBBusyTimeout,
+		ForeignKeys:     cfg.DBForeignKeys,
+		MaxOpenConns:    cfg.DBMaxOpenConns,
+		MaxIdleConns:    cfg.DBMaxIdleConns,
+		ConnMaxLifetime: cfg.DBConnMaxLifetime,
+	})
 	if err != nil {
 		logger.Error(logger.CategoryDB, "Failed to initialize database", err)
 		log.Fatal("Failed to initialize database:", err)
 	}
-	defer db.Close()
 	logger.Info(logger.CategoryDB, "Database initialized successfully")
 
 	// Run migrations
@@ -52,9 +70,110 @@ func main() {
 	}
 	logger.Info(logger.CategoryDB, "Database migrations completed")
 
+	app := newApp(cfg, db)
+
+	// Start server
+	// "Categorize messages so operators can configure what gets logged"
+	logger.Info(logger.CategoryAPI, "🎵 TuneTudo Server starting")
+
+	
+	// TLS configuration
+	certicateFile := os.Getenv("TLS_CERT_FILE")
+	keyFile := os.Getenv("TLS_KEY_FILE")
+	log.Printf("Using TLS cert: %s and key: %s", certicateFile, keyFile)
+	if certicateFile == "" || keyFile == "" {
+		logger.Error(logger.CategoryAPI, "TLS certificate or key file not specified in environment variables", nil)
+		log.Fatal("TLS certificate or key file not specified in environment variables")
+	}
+
+	redirectServer := &http.Server{
+		Addr:    ":" + cfg.HTTPPort,
+		Handler: httpsRedirectHandler(cfg.Port),
+	}
+
+	go func() {
+		if err := redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fmt.Printf("HTTP redirect server stopped due to: %v\n", err)
+		}
+	}()
+
+	// Stop on Ctrl+C or a deploy's SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- app.ListenTLS(":" + cfg.Port, certicateFile, keyFile)
+	}()
+
+	select {
+	case err := <-serverErr:
+		if err != nil {
+			logger.Error(logger.CategoryAPI, "Server failed to start", err)
+			log.Fatalf("Failed to start the TLS server: %v", err)
+		}
+	case <-ctx.Done():
+		logger.Info(logger.CategoryAPI, "Shutdown signal received, draining connections")
+	}
+
+	if err := shutdown(app, redirectServer, db, cfg.ShutdownTimeout); err != nil {
+		log.Printf("Shutdown finished with errors: %v", err)
+	}
+}
+
+// shutdown stops accepting requests, waits up to timeout for in-flight
+// requests to finish, then releases the database and log files
+func shutdown(app *fiber.App, redirectServer *http.Server, db *sql.DB, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var firstErr error
+	record := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if redirectServer != nil {
+		record(redirectServer.Shutdown(ctx))
+	}
+	record(app.ShutdownWithContext(ctx))
+
+	// Write out queued audit events while the database is still open
+	logger.SetAuditSink(nil)
+	if err := db.Close(); err != nil {
+		logger.Error(logger.CategoryDB, "Failed to close database", err)
+		record(err)
+	}
+
+	logger.Info(logger.CategoryAPI, "graceful shutdown complete")
+	record(logger.Close())
+
+	return firstErr
+}
+
+// httpsRedirectHandler permanently redirects plaintext requests to the same
+// host and path on the HTTPS listener
+func httpsRedirectHandler(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if httpsPort != "" && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	})
+}
+
+// newApp builds the Fiber application with global middleware and routes
+func newApp(cfg *config.Config, db *sql.DB) *fiber.App {
 	// Initialize Fiber app with custom error handler
 	app := fiber.New(fiber.Config{
-		BodyLimit:     50 * 1024 * 1024, // 50MB for file uploads
+		BodyLimit:     int(cfg.BodyLimit), // large enough for the biggest upload
 		Prefork:       false,
 		StrictRouting: false,
 		CaseSensitive: false,
@@ -63,25 +182,31 @@ func main() {
 		AppName:       "TuneTudo v1.0",
 	})
 
+	// Persist audited security events so admins can query them
+	logger.SetAuditSink(services.NewAuditService(db))
+
+	// Count requests first so panics and rate-limited requests are included
+	if cfg.MetricsEnabled {
+		app.Use(middleware.RequestMetrics(metrics.Default))
+	}
+
 	// Security Middleware - Applied globally
 	app.Use(recover.New(recover.Config{
 		EnableStackTrace: false, // Don't expose stack traces
 	}))
 
+	// CORS must run before rate limiting and auth so preflight
+	// OPTIONS requests are answered without credentials
+	app.Use(cors.New(corsConfig(cfg)))
+
 	app.Use(helmet.New())
 	// Rate limiting to prevent abuse
-	app.Use(limiter.New(limiter.Config{
-		Max:        50,             // 50 requests
-		Expiration: 1 * time.Minute, // per minute
-		LimitReached: func(c *fiber.Ctx) error {
-			ip := c.IP()
-			logger.Security("RATE_LIMIT_EXCEEDED", "anonymous", logger.MaskIP(ip), "Rate limit exceeded")
-			return c.Status(429).JSON(fiber.Map{
-				"error":   true,
-				"message": "Too many requests. Please try again later.",
-			})
-		},
-	}))
+	// Anonymous requests share a per-IP quota; authenticated requests get
+	// a larger per-user quota so users behind one NAT don't starve each other
+	authService := services.NewAuthService(db, cfg.JWTSecret)
+	app.Use(middleware.IdentifyRequester(authService))
+	app.Use(middleware.IPRateLimiter(cfg.RateLimitIPMax, cfg.RateLimitWindow))
+	app.Use(middleware.UserRateLimiter(cfg.RateLimitUserMax, cfg.RateLimitWindow))
 
 	// Request logging
 	app.Use(fiberlogger.New(fiberlogger.Config{
@@ -95,42 +220,44 @@ func main() {
 
 	// Request validator middleware
 	// Appropriately filter or quote CRLF sequences in user-controlled input
-	app.Use(middleware.RequestValidator())
+	app.Use(middleware.RequestValidator(cfg.JSONBodyLimit, cfg.BodyLimit, cfg.ValidationAllowlist...))
+
+	// Reject request bodies that aren't JSON (or multipart on upload routes)
+	app.Use(middleware.ContentTypeValidator())
+
+	// Compress large JSON responses; song streams are never compressed
+	app.Use(middleware.Compress(compress.Level(cfg.CompressionLevel), cfg.CompressionMinSize))
+
+	// Debug builds can log sanitized bodies; this sits inside compression
+	// so responses are logged before they are encoded
+	app.Use(middleware.BodyLogger(cfg.BodyLoggingEnabled(), cfg.LogBodyMaxBytes))
 
 	// Setup routes
 	routes.SetupRoutes(app, db)
 
-	// Start server
-	// "Categorize messages so operators can configure what gets logged"
-	logger.Info(logger.CategoryAPI, "🎵 TuneTudo Server starting")
+	// Refuse oversized bodies from their headers, before they are read
+	app.Server().HeaderReceived = middleware.RequestBodyLimit(cfg.JSONBodyLimit, cfg.BodyLimit)
 
-	
-	// TLS configuration
-	certicateFile := os.Getenv("TLS_CERT_FILE")
-	keyFile := os.Getenv("TLS_KEY_FILE")
-	log.Printf("Using TLS cert: %s and key: %s", certicateFile, keyFile)
-	if certicateFile == "" || keyFile == "" {
-		logger.Error(logger.CategoryAPI, "TLS certificate or key file not specified in environment variables", nil)
-		log.Fatal("TLS certificate or key file not specified in environment variables")
-	}
+	// Answer hung requests with 503 instead of holding the connection
+	app.Server().Handler = middleware.RequestTimeout(app.Handler(), cfg.RequestTimeout)
 
-	go func() {
-		http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-			target := "https://" + r.Host + r.URL.RequestURI()
-			// redirect to HTTPS
-			if r.Host == "localhost:2701" {
-				target = "https://localhost:2701" + r.URL.RequestURI()
-			}
-			http.Redirect(w, r, target, http.StatusMovedPermanently)
-		})
-		if err := http.ListenAndServe(":" + cfg.Port, nil); err != nil {
-			fmt.Printf("HTTP redirect server stopped due to: %v\n", err)
-		}
-	}()
+	return app
+}
+
+// corsConfig maps the configured CORS settings onto the fiber middleware.
+// With no allowed origins configured only same-origin requests succeed.
+func corsConfig(cfg *config.Config) cors.Config {
+	corsCfg := cors.Config{
+		AllowMethods:     cfg.CORSAllowMethods,
+		AllowHeaders:     cfg.CORSAllowHeaders,
+		AllowCredentials: cfg.CORSAllowCredentials,
+	}
 
-	if err := app.ListenTLS(":" + cfg.Port, certicateFile, keyFile); err != nil {
-		logger.Error(logger.CategoryAPI, "Server failed to start", err)
-		log.Fatalf("Failed to start the TLS server: %v", err)
+	if len(cfg.CORSAllowOrigins) == 0 {
+		corsCfg.AllowOriginsFunc = func(origin string) bool { return false }
+		return corsCfg
 	}
 
-}
\ No newline at end of file
+	corsCfg.AllowOrigins = strings.Join(cfg.CORSAllowOrigins, ",")
+	return corsCfg
+}
@@ -1,16 +1,32 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"database/sql"
 	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 	"fmt"
+	"tunetudo/config"
 	"tunetudo/database"
+	"tunetudo/logger"
+	"tunetudo/middleware"
+	"tunetudo/models"
 	"tunetudo/routes"
+	"tunetudo/services"
 
+	"github.com/fasthttp/websocket"
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -29,12 +45,7 @@ func setupTestApp(t *testing.T) (*fiber.App, func()) {
 	
 	// Create test app
 	app := fiber.New(fiber.Config{
-		ErrorHandler: func(c *fiber.Ctx, err error) error {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error":   true,
-				"message": err.Error(),
-			})
-		},
+		ErrorHandler: middleware.ErrorHandler,
 	})
 	
 	routes.SetupRoutes(app, db)
@@ -56,7 +67,7 @@ func TestAuthFlow(t *testing.T) {
 		body := map[string]string{
 			"username": "testuser",
 			"email":    "test@example.com",
-			"password": "password123",
+			"password": "Passw0rd-123",
 		}
 		jsonBody, _ := json.Marshal(body)
 
@@ -78,7 +89,7 @@ func TestAuthFlow(t *testing.T) {
 	t.Run("Login", func(t *testing.T) {
 		body := map[string]string{
 			"username": "testuser",
-			"password": "password123",
+			"password": "Passw0rd-123",
 		}
 		jsonBody, _ := json.Marshal(body)
 
@@ -126,7 +137,7 @@ func TestPlaylistFlow(t *testing.T) {
 	registerBody := map[string]string{
 		"username": "playlistuser",
 		"email":    "playlist@example.com",
-		"password": "password123",
+		"password": "Passw0rd-123",
 	}
 	jsonBody, _ := json.Marshal(registerBody)
 	req := httptest.NewRequest("POST", "/api/auth/register", bytes.NewReader(jsonBody))
@@ -135,7 +146,7 @@ func TestPlaylistFlow(t *testing.T) {
 
 	loginBody := map[string]string{
 		"username": "playlistuser",
-		"password": "password123",
+		"password": "Passw0rd-123",
 	}
 	jsonBody, _ = json.Marshal(loginBody)
 	req = httptest.NewRequest("POST", "/api/auth/login", bytes.NewReader(jsonBody))
@@ -186,8 +197,11 @@ func TestPlaylistFlow(t *testing.T) {
 		json.NewDecoder(resp.Body).Decode(&result)
 		assert.False(t, result["error"].(bool))
 		
-		playlists := result["data"].([]interface{})
+		data := result["data"].(map[string]interface{})
+		playlists := data["items"].([]interface{})
 		assert.Len(t, playlists, 1)
+		meta := data["meta"].(map[string]interface{})
+		assert.Equal(t, float64(1), meta["total"])
 	})
 
 	// Delete playlist
@@ -281,3 +295,1370 @@ func TestInvalidRoutes(t *testing.T) {
 		})
 	}
 }
+
+func setupFullTestApp(t *testing.T, cfg *config.Config) (*fiber.App, *sql.DB, func()) {
+	dbPath := "./test_full_" + strings.ReplaceAll(t.Name(), "/", "_") + ".db"
+	os.Remove(dbPath)
+
+	db, err := database.InitDB(dbPath)
+	require.NoError(t, err)
+
+	err = database.RunMigrations(db)
+	require.NoError(t, err)
+
+	app := newApp(cfg, db)
+
+	cleanup := func() {
+		logger.SetAuditSink(nil)
+		db.Close()
+		os.Remove(dbPath)
+	}
+
+	return app, db, cleanup
+}
+
+func TestCORS(t *testing.T) {
+	cfg := config.LoadConfig()
+	cfg.CORSAllowOrigins = []string{"http://localhost:5173"}
+
+	app, _, cleanup := setupFullTestApp(t, cfg)
+	defer cleanup()
+
+	t.Run("Allowed origin", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/health", nil)
+		req.Header.Set("Origin", "http://localhost:5173")
+
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, "http://localhost:5173", resp.Header.Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("Disallowed origin", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/health", nil)
+		req.Header.Set("Origin", "http://evil.example.com")
+
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("Preflight bypasses auth", func(t *testing.T) {
+		req := httptest.NewRequest("OPTIONS", "/api/playlists", nil)
+		req.Header.Set("Origin", "http://localhost:5173")
+		req.Header.Set("Access-Control-Request-Method", "POST")
+
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		assert.Equal(t, "http://localhost:5173", resp.Header.Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("Same-origin only by default", func(t *testing.T) {
+		defaultApp, _, defaultCleanup := setupFullTestApp(t, config.LoadConfig())
+		defer defaultCleanup()
+
+		req := httptest.NewRequest("GET", "/health", nil)
+		req.Header.Set("Origin", "http://localhost:5173")
+
+		resp, err := defaultApp.Test(req)
+		require.NoError(t, err)
+		assert.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"))
+	})
+}
+
+// streamPath asks the API for a signed stream URL for a song
+func streamPath(t *testing.T, app *fiber.App, songID int64) string {
+	resp, err := app.Test(httptest.NewRequest("GET", fmt.Sprintf("/api/songs/%d/stream-url", songID), nil))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var result struct {
+		Data struct {
+			URL string `json:"url"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	return result.Data.URL
+}
+
+// registerAndLogin creates a user through the API and returns its JWT
+func registerAndLogin(t *testing.T, app *fiber.App, username, email string) string {
+	registerBody := map[string]string{
+		"username": username,
+		"email":    email,
+		"password": "Passw0rd-123",
+	}
+	jsonBody, _ := json.Marshal(registerBody)
+	req := httptest.NewRequest("POST", "/api/auth/register", bytes.NewReader(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	loginBody := map[string]string{
+		"username": username,
+		"password": "Passw0rd-123",
+	}
+	jsonBody, _ = json.Marshal(loginBody)
+	req = httptest.NewRequest("POST", "/api/auth/login", bytes.NewReader(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var loginResult map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&loginResult)
+	return loginResult["data"].(map[string]interface{})["token"].(string)
+}
+
+func TestPerUserRateLimit(t *testing.T) {
+	cfg := config.LoadConfig()
+	cfg.RateLimitIPMax = 10
+	cfg.RateLimitUserMax = 3
+
+	app, _, cleanup := setupFullTestApp(t, cfg)
+	defer cleanup()
+
+	// Both users share the same client IP in app.Test
+	tokenA := registerAndLogin(t, app, "ratelimita", "ratea@example.com")
+	tokenB := registerAndLogin(t, app, "ratelimitb", "rateb@example.com")
+
+	getProfile := func(token string) *http.Response {
+		req := httptest.NewRequest("GET", "/api/profile", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	for i := 0; i < cfg.RateLimitUserMax; i++ {
+		assert.Equal(t, http.StatusOK, getProfile(tokenA).StatusCode)
+	}
+
+	t.Run("User over limit is rejected", func(t *testing.T) {
+		resp := getProfile(tokenA)
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+		var result map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&result)
+		assert.True(t, result["error"].(bool))
+		assert.Equal(t, "Too many requests. Please try again later.", result["message"])
+	})
+
+	t.Run("Other user on same IP is not blocked", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, getProfile(tokenB).StatusCode)
+	})
+
+	t.Run("Anonymous requests keep their own IP quota", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/health", nil)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	app, _, cleanup := setupFullTestApp(t, config.LoadConfig())
+	defer cleanup()
+
+	db, err := database.InitDB("./test_shutdown.db")
+	require.NoError(t, err)
+	defer os.Remove("./test_shutdown.db")
+
+	redirectServer := &http.Server{Addr: "127.0.0.1:0", Handler: http.NewServeMux()}
+
+	timeout := 2 * time.Second
+	start := time.Now()
+	err = shutdown(app, redirectServer, db, timeout)
+	require.NoError(t, err)
+
+	assert.Less(t, time.Since(start), timeout)
+	assert.Error(t, db.Ping(), "database handle should be closed")
+}
+
+func TestHTTPSRedirect(t *testing.T) {
+	tests := []struct {
+		name      string
+		httpsPort string
+		host      string
+		path      string
+		expected  string
+	}{
+		{"Custom HTTPS port", "2701", "localhost:8080", "/playlists.html?x=1", "https://localhost:2701/playlists.html?x=1"},
+		{"Default HTTPS port", "443", "music.example.com", "/", "https://music.example.com/"},
+		{"Host without port", "2701", "music.example.com", "/api/search?q=jazz", "https://music.example.com:2701/api/search?q=jazz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://"+tt.host+tt.path, nil)
+			rec := httptest.NewRecorder()
+
+			httpsRedirectHandler(tt.httpsPort).ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+			assert.Equal(t, tt.expected, rec.Header().Get("Location"))
+		})
+	}
+}
+
+func TestConfigValidatesAppBaseURL(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		valid   bool
+	}{
+		{"https://music.example.com", true},
+		{"https://music.example.com:8443/app/", true},
+		{"http://music.example.com", false},
+		{"music.example.com", false},
+		{"/reset", false},
+		{"https://music.example.com/?next=evil", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.baseURL, func(t *testing.T) {
+			t.Setenv("APP_BASE_URL", tt.baseURL)
+			err := config.LoadConfig().Validate()
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+
+	assert.NoError(t, config.LoadConfig().Validate(), "the default must be valid")
+}
+
+func TestConfigUploadLimits(t *testing.T) {
+	t.Setenv("MAX_AUDIO_UPLOAD_BYTES", "1048576")
+	t.Setenv("MAX_IMAGE_UPLOAD_BYTES", "2097152")
+	cfg := config.LoadConfig()
+	require.NoError(t, cfg.Validate())
+	assert.Equal(t, int64(2097152), cfg.BodyLimit, "the body limit defaults to the larger upload size")
+
+	t.Setenv("BODY_LIMIT_BYTES", "1048576")
+	assert.Error(t, config.LoadConfig().Validate(), "the body limit cannot be below an upload limit")
+
+	t.Setenv("BODY_LIMIT_BYTES", "")
+	assert.Equal(t, int64(1024*1024), config.LoadConfig().JSONBodyLimit)
+	t.Setenv("JSON_BODY_LIMIT_BYTES", "4194304")
+	assert.Error(t, config.LoadConfig().Validate(), "JSON bodies cannot be allowed more than uploads")
+	t.Setenv("JSON_BODY_LIMIT_BYTES", "0")
+	assert.Error(t, config.LoadConfig().Validate())
+
+	t.Setenv("JSON_BODY_LIMIT_BYTES", "")
+	t.Setenv("MAX_AUDIO_UPLOAD_BYTES", "0")
+	assert.Error(t, config.LoadConfig().Validate())
+}
+
+func TestConfigBcryptCost(t *testing.T) {
+	t.Setenv("BCRYPT_COST", "12")
+	cfg := config.LoadConfig()
+	require.NoError(t, cfg.Validate())
+	assert.Equal(t, 12, cfg.BcryptCost)
+
+	for _, cost := range []string{"3", "32"} {
+		t.Setenv("BCRYPT_COST", cost)
+		assert.Error(t, config.LoadConfig().Validate(), cost)
+	}
+}
+
+func TestConfigResetTokenTTL(t *testing.T) {
+	t.Setenv("RESET_TOKEN_TTL", "30m")
+	cfg := config.LoadConfig()
+	require.NoError(t, cfg.Validate())
+	assert.Equal(t, 30*time.Minute, cfg.ResetTokenTTL)
+
+	for _, ttl := range []string{"-5m", "10s", "48h"} {
+		t.Setenv("RESET_TOKEN_TTL", ttl)
+		assert.Error(t, config.LoadConfig().Validate(), ttl)
+	}
+}
+
+func TestConfigSearchQueryLengths(t *testing.T) {
+	t.Setenv("SEARCH_MIN_QUERY_LENGTH", "3")
+	cfg := config.LoadConfig()
+	require.NoError(t, cfg.Validate())
+	assert.Equal(t, 3, cfg.SearchMinQueryLength)
+	assert.Equal(t, 200, cfg.SearchMaxQueryLength)
+
+	for _, lengths := range [][2]string{{"0", "200"}, {"50", "20"}, {"2", "5000"}} {
+		t.Setenv("SEARCH_MIN_QUERY_LENGTH", lengths[0])
+		t.Setenv("SEARCH_MAX_QUERY_LENGTH", lengths[1])
+		assert.Error(t, config.LoadConfig().Validate(), lengths)
+	}
+}
+
+func TestConfigPathsOutsideStorage(t *testing.T) {
+	t.Setenv("STORAGE_PATH", "./storage")
+	require.NoError(t, config.LoadConfig().Validate())
+
+	for _, path := range []string{"./storage", "./storage/trash", "storage/media/../trash"} {
+		t.Setenv("TRASH_PATH", path)
+		assert.Error(t, config.LoadConfig().Validate(), path)
+	}
+	t.Setenv("TRASH_PATH", "./storage-trash")
+	assert.NoError(t, config.LoadConfig().Validate())
+
+	t.Setenv("UPLOAD_TEMP_PATH", "./storage/tmp/chunks")
+	assert.Error(t, config.LoadConfig().Validate())
+}
+
+func TestProfilePermissions(t *testing.T) {
+	app, db, cleanup := setupFullTestApp(t, config.LoadConfig())
+	defer cleanup()
+
+	userToken := registerAndLogin(t, app, "listener", "listener@example.com")
+	registerAndLogin(t, app, "curator", "curator@example.com")
+	_, err := db.Exec(`UPDATE users SET is_admin = 1 WHERE username = ?`, "curator")
+	require.NoError(t, err)
+
+	// Log in again so the token itself claims admin
+	loginBody, _ := json.Marshal(map[string]string{"username": "curator", "password": "Passw0rd-123"})
+	req := httptest.NewRequest("POST", "/api/auth/login", bytes.NewReader(loginBody))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var login struct {
+		Data struct {
+			Token string `json:"token"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&login))
+	adminToken := login.Data.Token
+
+	permissions := func(token string) models.Permissions {
+		req := httptest.NewRequest("GET", "/api/profile/permissions", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var result struct {
+			Data models.Permissions `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		return result.Data
+	}
+
+	listener := permissions(userToken)
+	assert.False(t, listener.IsAdmin)
+	assert.False(t, listener.Suspended)
+	assert.NotContains(t, listener.Features, services.FeatureAdmin)
+	assert.Contains(t, listener.Features, services.FeatureUpload)
+
+	curator := permissions(adminToken)
+	assert.True(t, curator.IsAdmin)
+	assert.Contains(t, curator.Features, services.FeatureAdmin)
+
+	// A demotion shows up even though the token still claims admin
+	_, err = db.Exec(`UPDATE users SET is_admin = 0 WHERE username = ?`, "curator")
+	require.NoError(t, err)
+	curator = permissions(adminToken)
+	assert.False(t, curator.IsAdmin)
+	assert.NotContains(t, curator.Features, services.FeatureAdmin)
+}
+
+func TestMaintenanceModeSwitch(t *testing.T) {
+	app, db, cleanup := setupFullTestApp(t, config.LoadConfig())
+	defer cleanup()
+
+	adminToken := registerAndLogin(t, app, "operator", "operator@example.com")
+	userToken := registerAndLogin(t, app, "listener", "listener@example.com")
+	_, err := db.Exec(`UPDATE users SET is_admin = 1 WHERE username = ?`, "operator")
+	require.NoError(t, err)
+
+	request := func(method, path, token string, body interface{}) *http.Response {
+		jsonBody, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(jsonBody))
+		if body == nil {
+			req = httptest.NewRequest(method, path, nil)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp := request("PUT", "/api/admin/maintenance", userToken, map[string]bool{"enabled": true})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "only admins switch maintenance mode")
+
+	resp = request("PUT", "/api/admin/maintenance", adminToken, map[string]bool{"enabled": true})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = request("POST", "/api/playlists", userToken, map[string]string{"name": "Blocked"})
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, request("GET", "/api/playlists", userToken, nil).StatusCode)
+	assert.Equal(t, http.StatusOK, request("GET", "/api/categories", userToken, nil).StatusCode)
+
+	resp = request("GET", "/api/admin/maintenance", adminToken, nil)
+	var status struct {
+		Data struct {
+			Enabled bool `json:"enabled"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+	assert.True(t, status.Data.Enabled)
+
+	resp = request("PUT", "/api/admin/maintenance", adminToken, map[string]bool{"enabled": false})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = request("POST", "/api/playlists", userToken, map[string]string{"name": "Allowed"})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+}
+
+func TestMaintenanceModeFromEnv(t *testing.T) {
+	t.Setenv("MAINTENANCE_MODE", "true")
+	t.Setenv("MAINTENANCE_RETRY_AFTER", "90s")
+	cfg := config.LoadConfig()
+	require.NoError(t, cfg.Validate())
+	app, _, cleanup := setupFullTestApp(t, cfg)
+	defer cleanup()
+
+	body, _ := json.Marshal(map[string]string{
+		"username": "latecomer",
+		"email":    "latecomer@example.com",
+		"password": "Passw0rd-123",
+	})
+	req := httptest.NewRequest("POST", "/api/auth/register", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "90", resp.Header.Get("Retry-After"))
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/api/categories", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	t.Setenv("MAINTENANCE_RETRY_AFTER", "0s")
+	assert.Error(t, config.LoadConfig().Validate())
+}
+
+func TestAdminUserManagement(t *testing.T) {
+	app, db, cleanup := setupFullTestApp(t, config.LoadConfig())
+	defer cleanup()
+
+	adminToken := registerAndLogin(t, app, "rootadmin", "root@example.com")
+	userToken := registerAndLogin(t, app, "regular", "regular@example.com")
+
+	// The first admin still has to be created directly in the database
+	_, err := db.Exec(`UPDATE users SET is_admin = 1 WHERE username = ?`, "rootadmin")
+	require.NoError(t, err)
+
+	var userID int
+	require.NoError(t, db.QueryRow(`SELECT id FROM users WHERE username = ?`, "regular").Scan(&userID))
+
+	request := func(method, path, token string, body interface{}) *http.Response {
+		var reader *bytes.Reader
+		if body != nil {
+			jsonBody, _ := json.Marshal(body)
+			reader = bytes.NewReader(jsonBody)
+		} else {
+			reader = bytes.NewReader(nil)
+		}
+		req := httptest.NewRequest(method, path, reader)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp
+	}
+	userPath := "/api/admin/users/" + fmt.Sprint(userID)
+
+	t.Run("Regular user is not an admin", func(t *testing.T) {
+		resp := request("GET", "/api/admin/users", userToken, nil)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("Promoted user passes admin middleware", func(t *testing.T) {
+		resp := request("PATCH", userPath, adminToken, map[string]bool{"is_admin": true})
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		// The existing token picks up the new role
+		resp = request("GET", "/api/admin/users", userToken, nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("Suspended user is rejected", func(t *testing.T) {
+		resp := request("PATCH", userPath, adminToken, map[string]bool{"suspended": true})
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		resp = request("GET", "/api/profile", userToken, nil)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+		loginBody, _ := json.Marshal(map[string]string{"username": "regular", "password": "Passw0rd-123"})
+		req := httptest.NewRequest("POST", "/api/auth/login", bytes.NewReader(loginBody))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("Admin cannot change own status", func(t *testing.T) {
+		var adminID int
+		require.NoError(t, db.QueryRow(`SELECT id FROM users WHERE username = ?`, "rootadmin").Scan(&adminID))
+
+		resp := request("PATCH", "/api/admin/users/"+fmt.Sprint(adminID), adminToken, map[string]bool{"is_admin": false})
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Unknown user", func(t *testing.T) {
+		resp := request("PATCH", "/api/admin/users/99999", adminToken, map[string]bool{"suspended": true})
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("Changes appear in the audit log", func(t *testing.T) {
+		today := time.Now().UTC().Format("2006-01-02")
+		resp := request("GET", "/api/admin/audit?event_type=ADMIN_ACTION&from="+today+"&to="+today, adminToken, nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var result map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&result)
+		data := result["data"].(map[string]interface{})
+		items := data["items"].([]interface{})
+		require.NotEmpty(t, items)
+
+		var details []string
+		for _, item := range items {
+			entry := item.(map[string]interface{})
+			assert.Equal(t, "ADMIN_ACTION", entry["event_type"])
+			assert.NotEqual(t, "rootadmin", entry["user_hash"])
+			details = append(details, entry["details"].(string))
+		}
+		assert.Contains(t, strings.Join(details, "\n"), "SUSPEND_USER")
+		assert.NotContains(t, strings.Join(details, "\n"), "Action: GET ", "admin reads aren't audited")
+	})
+
+	t.Run("Invalid audit date", func(t *testing.T) {
+		resp := request("GET", "/api/admin/audit?from=yesterday", adminToken, nil)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestAdminBackup(t *testing.T) {
+	backupDir := t.TempDir()
+	t.Setenv("BACKUP_PATH", backupDir)
+
+	app, db, cleanup := setupFullTestApp(t, config.LoadConfig())
+	defer cleanup()
+
+	adminToken := registerAndLogin(t, app, "backupadmin", "backupadmin@example.com")
+	userToken := registerAndLogin(t, app, "backupuser", "backupuser@example.com")
+	_, err := db.Exec(`UPDATE users SET is_admin = 1 WHERE username = ?`, "backupadmin")
+	require.NoError(t, err)
+
+	backup := func(token, body string) *http.Response {
+		req := httptest.NewRequest("POST", "/api/admin/backup", strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	t.Run("Admin only", func(t *testing.T) {
+		resp := backup(userToken, "")
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("Writes a backup and returns its path", func(t *testing.T) {
+		resp := backup(adminToken, `{"name":"pre-upgrade"}`)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		var result map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&result)
+		path := result["data"].(map[string]interface{})["path"].(string)
+		assert.True(t, strings.HasPrefix(path, backupDir))
+
+		backupDB, err := sql.Open("sqlite3", path)
+		require.NoError(t, err)
+		defer backupDB.Close()
+
+		var users int
+		require.NoError(t, backupDB.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&users))
+		assert.Equal(t, 2, users)
+	})
+
+	t.Run("Rejects a traversal name", func(t *testing.T) {
+		resp := backup(adminToken, `{"name":"../../outside"}`)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+// scrapeMetric returns the value of one series from /metrics, or 0 when
+// it hasn't been recorded yet
+func scrapeMetric(t *testing.T, app *fiber.App, token, series string) float64 {
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	for _, line := range strings.Split(string(body), "\n") {
+		if value, ok := strings.CutPrefix(line, series+" "); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			require.NoError(t, err)
+			return parsed
+		}
+	}
+	return 0
+}
+
+func TestMetrics(t *testing.T) {
+	storageDir := t.TempDir()
+	t.Setenv("STORAGE_PATH", storageDir)
+	// Test requests come from 0.0.0.0, outside the default loopback allowlist
+	t.Setenv("METRICS_TOKEN", "scrape-token")
+
+	app, db, cleanup := setupFullTestApp(t, config.LoadConfig())
+	defer cleanup()
+
+	get := func(path string, headers ...string) *http.Response {
+		req := httptest.NewRequest("GET", path, nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	t.Run("Requires the token", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, get("/metrics").StatusCode)
+		assert.Equal(t, http.StatusForbidden, get("/metrics", "Authorization", "Bearer wrong").StatusCode)
+	})
+
+	t.Run("Counts requests by route and status", func(t *testing.T) {
+		health := `tunetudo_http_requests_total{method="GET",route="/health",status="200"}`
+		song := `tunetudo_http_requests_total{method="GET",route="/api/songs/:id",status="404"}`
+		unmatched := `tunetudo_http_requests_total{method="GET",route="unmatched",status="404"}`
+		searches := "tunetudo_search_queries_total"
+
+		before := map[string]float64{}
+		for _, series := range []string{health, song, unmatched, searches} {
+			before[series] = scrapeMetric(t, app, "scrape-token", series)
+		}
+
+		for i := 0; i < 3; i++ {
+			get("/health")
+		}
+		get("/api/songs/99999")
+		get("/no-such-page")
+		get("/api/search?q=anything")
+
+		assert.Equal(t, before[health]+3, scrapeMetric(t, app, "scrape-token", health))
+		assert.Equal(t, before[song]+1, scrapeMetric(t, app, "scrape-token", song))
+		assert.Equal(t, before[unmatched]+1, scrapeMetric(t, app, "scrape-token", unmatched))
+		assert.Equal(t, before[searches]+1, scrapeMetric(t, app, "scrape-token", searches))
+		assert.Greater(t, scrapeMetric(t, app, "scrape-token",
+			`tunetudo_http_request_duration_seconds_count{method="GET",route="/health"}`), 2.0)
+	})
+
+	t.Run("Streams are tracked until sent", func(t *testing.T) {
+		require.NoError(t, os.MkdirAll(filepath.Join(storageDir, "media"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(storageDir, "media", "track.mp3"), []byte("0123456789"), 0644))
+		result, err := db.Exec(`INSERT INTO songs (title, file_path, format) VALUES ('Track', 'media/track.mp3', 'mp3')`)
+		require.NoError(t, err)
+		songID, _ := result.LastInsertId()
+
+		active := scrapeMetric(t, app, "scrape-token", "tunetudo_active_streams")
+
+		resp := get(streamPath(t, app, songID), "Range", "bytes=2-5")
+		require.Equal(t, http.StatusPartialContent, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, "2345", string(body))
+		assert.Equal(t, "bytes 2-5/10", resp.Header.Get("Content-Range"))
+
+		resp = get(streamPath(t, app, songID))
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		body, _ = io.ReadAll(resp.Body)
+		assert.Equal(t, "0123456789", string(body))
+		assert.Equal(t, "audio/mpeg", resp.Header.Get("Content-Type"))
+
+		resp = get(streamPath(t, app, songID), "Range", "bytes=20-30")
+		assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, resp.StatusCode)
+
+		resp = get(fmt.Sprintf("/api/songs/%d/stream", songID))
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, "streams need a signed URL")
+
+		assert.Equal(t, active, scrapeMetric(t, app, "scrape-token", "tunetudo_active_streams"))
+	})
+}
+
+func TestRequireAuthToStream(t *testing.T) {
+	for _, required := range []bool{false, true} {
+		t.Run(fmt.Sprintf("required=%t", required), func(t *testing.T) {
+			storageDir := t.TempDir()
+			t.Setenv("STORAGE_PATH", storageDir)
+			t.Setenv("REQUIRE_AUTH_TO_STREAM", strconv.FormatBool(required))
+
+			app, db, cleanup := setupFullTestApp(t, config.LoadConfig())
+			defer cleanup()
+
+			require.NoError(t, os.MkdirAll(filepath.Join(storageDir, "media"), 0755))
+			require.NoError(t, os.WriteFile(filepath.Join(storageDir, "media", "track.mp3"), []byte("0123456789"), 0644))
+			result, err := db.Exec(`INSERT INTO songs (title, file_path, format) VALUES ('Track', 'media/track.mp3', 'mp3')`)
+			require.NoError(t, err)
+			songID, _ := result.LastInsertId()
+
+			get := func(path, token string) *http.Response {
+				req := httptest.NewRequest("GET", path, nil)
+				if token != "" {
+					req.Header.Set("Authorization", "Bearer "+token)
+				}
+				resp, err := app.Test(req)
+				require.NoError(t, err)
+				return resp
+			}
+			streamURLPath := fmt.Sprintf("/api/songs/%d/stream-url", songID)
+
+			resp := get(streamURLPath, "")
+			if required {
+				assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "anonymous visitors get no stream URL")
+				resp = get(fmt.Sprintf("/api/songs/%d/stream", songID), "")
+				assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+				resp = get("/storage/media/track.mp3", "")
+				assert.Equal(t, http.StatusNotFound, resp.StatusCode, "the file isn't reachable around the stream route")
+			} else {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+				resp = get(streamPath(t, app, songID), "")
+				assert.Equal(t, http.StatusOK, resp.StatusCode, "anonymous streaming stays open")
+			}
+
+			// A signed-in user's URL works from a player that sends no
+			// Authorization header, and the play is recorded for them
+			token := registerAndLogin(t, app, "streamer", "streamer@example.com")
+			resp = get(streamURLPath, token)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			var minted struct {
+				Data struct {
+					URL string `json:"url"`
+				} `json:"data"`
+			}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&minted))
+
+			resp = get(minted.Data.URL, "")
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			body, _ := io.ReadAll(resp.Body)
+			assert.Equal(t, "0123456789", string(body))
+
+			var plays int
+			require.NoError(t, db.QueryRow(`
+				SELECT COUNT(*) FROM plays p JOIN users u ON u.id = p.user_id WHERE u.username = 'streamer'
+			`).Scan(&plays))
+			assert.Equal(t, 1, plays)
+		})
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	storageDir := t.TempDir()
+	t.Setenv("STORAGE_PATH", storageDir)
+
+	app, db, cleanup := setupFullTestApp(t, config.LoadConfig())
+	defer cleanup()
+
+	get := func(path string, headers ...string) *http.Response {
+		req := httptest.NewRequest("GET", path, nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	result, err := db.Exec(`INSERT INTO artists (name) VALUES ('Cache Artist')`)
+	require.NoError(t, err)
+	artistID, _ := result.LastInsertId()
+	result, err = db.Exec(`INSERT INTO songs (title, artist_id, duration_seconds, file_path, format) VALUES ('Cached', ?, 180, 'media/cached.mp3', 'mp3')`, artistID)
+	require.NoError(t, err)
+	songID, _ := result.LastInsertId()
+	songPath := fmt.Sprintf("/api/songs/%d", songID)
+
+	t.Run("Song metadata", func(t *testing.T) {
+		resp := get(songPath)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		etag := resp.Header.Get("ETag")
+		lastModified := resp.Header.Get("Last-Modified")
+		require.NotEmpty(t, etag)
+		require.NotEmpty(t, lastModified)
+
+		resp = get(songPath, "If-None-Match", etag)
+		assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Empty(t, body)
+
+		resp = get(songPath, "If-Modified-Since", lastModified)
+		assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+		resp = get(songPath, "If-None-Match", `"stale"`, "If-Modified-Since", lastModified)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "a mismatched ETag wins over the date")
+
+		_, err := db.Exec(`UPDATE songs SET title = 'Renamed' WHERE id = ?`, songID)
+		require.NoError(t, err)
+		resp = get(songPath, "If-None-Match", etag)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NotEqual(t, etag, resp.Header.Get("ETag"))
+	})
+
+	t.Run("Cover art under storage", func(t *testing.T) {
+		coverDir := filepath.Join(storageDir, "images", "covers")
+		require.NoError(t, os.MkdirAll(coverDir, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(coverDir, "album.png"), []byte("fake png"), 0644))
+
+		resp := get("/storage/images/covers/album.png")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		etag := resp.Header.Get("ETag")
+		require.NotEmpty(t, etag)
+		assert.Contains(t, resp.Header.Get("Cache-Control"), "max-age=")
+
+		resp = get("/storage/images/covers/album.png", "If-None-Match", etag)
+		assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+		resp = get("/storage/images/covers/album.png", "If-None-Match", `"other"`)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
+
+func TestStorageServesNoAudio(t *testing.T) {
+	storageDir := t.TempDir()
+	t.Setenv("STORAGE_PATH", storageDir)
+
+	app, db, cleanup := setupFullTestApp(t, config.LoadConfig())
+	defer cleanup()
+
+	songDir := filepath.Join(storageDir, "media", "songs")
+	require.NoError(t, os.MkdirAll(songDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(songDir, "hidden.mp3"), []byte("audio"), 0644))
+	result, err := db.Exec(`INSERT INTO artists (name) VALUES ('Hidden Artist')`)
+	require.NoError(t, err)
+	artistID, _ := result.LastInsertId()
+	result, err = db.Exec(`INSERT INTO songs (title, artist_id, duration_seconds, file_path, format) VALUES ('Hidden', ?, 60, 'media/songs/hidden.mp3', 'mp3')`, artistID)
+	require.NoError(t, err)
+	songID, _ := result.LastInsertId()
+
+	resp, err := app.Test(httptest.NewRequest("GET", fmt.Sprintf("/api/songs/%d", songID), nil))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.NotContains(t, string(body), "file_path")
+	assert.NotContains(t, string(body), "hidden.mp3")
+
+	for _, path := range []string{
+		"/storage/media/songs/hidden.mp3",
+		"/storage/images/../media/songs/hidden.mp3",
+	} {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, path)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	storageDir := t.TempDir()
+	t.Setenv("STORAGE_PATH", storageDir)
+
+	cfg := config.LoadConfig()
+	cfg.CompressionMinSize = 256
+
+	app, db, cleanup := setupFullTestApp(t, cfg)
+	defer cleanup()
+
+	get := func(path string, headers ...string) *http.Response {
+		req := httptest.NewRequest("GET", path, nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	t.Run("JSON honours Accept-Encoding", func(t *testing.T) {
+		resp := get("/api/categories", "Accept-Encoding", "gzip")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+
+		reader, err := gzip.NewReader(resp.Body)
+		require.NoError(t, err)
+		var result map[string]interface{}
+		require.NoError(t, json.NewDecoder(reader).Decode(&result))
+		assert.NotEmpty(t, result["data"])
+	})
+
+	t.Run("Uncompressed without Accept-Encoding", func(t *testing.T) {
+		resp := get("/api/categories")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("Content-Encoding"))
+	})
+
+	t.Run("Small responses are sent as is", func(t *testing.T) {
+		resp := get("/health", "Accept-Encoding", "gzip")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("Content-Encoding"))
+	})
+
+	t.Run("Streams are not compressed", func(t *testing.T) {
+		audio := bytes.Repeat([]byte("a"), 8192)
+		require.NoError(t, os.MkdirAll(filepath.Join(storageDir, "media"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(storageDir, "media", "loud.mp3"), audio, 0644))
+		result, err := db.Exec(`INSERT INTO songs (title, file_path, format) VALUES ('Loud', 'media/loud.mp3', 'mp3')`)
+		require.NoError(t, err)
+		songID, _ := result.LastInsertId()
+
+		resp := get(streamPath(t, app, songID), "Accept-Encoding", "gzip, br")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("Content-Encoding"))
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, audio, body)
+
+		resp = get(streamPath(t, app, songID), "Accept-Encoding", "gzip", "Range", "bytes=100-199")
+		require.Equal(t, http.StatusPartialContent, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("Content-Encoding"))
+		body, _ = io.ReadAll(resp.Body)
+		assert.Len(t, body, 100)
+	})
+}
+
+func TestContentTypeValidation(t *testing.T) {
+	app, _, cleanup := setupFullTestApp(t, config.LoadConfig())
+	defer cleanup()
+
+	body := `{"username":"ctuser","email":"ct@example.com","password":"Passw0rd-123"}`
+
+	t.Run("JSON route rejects text/plain", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/auth/register", strings.NewReader(body))
+		req.Header.Set("Content-Type", "text/plain")
+
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+	})
+
+	t.Run("JSON route accepts application/json with charset", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/auth/register", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	})
+
+	t.Run("Upload route rejects JSON", func(t *testing.T) {
+		token := registerAndLogin(t, app, "ctuploader", "ctup@example.com")
+		req := httptest.NewRequest("POST", "/api/upload", strings.NewReader(`{"file":"x"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+	})
+
+	t.Run("Bodyless POST passes", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/auth/logout", nil)
+
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.NotEqual(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+	})
+}
+
+func TestRequestBodyValidation(t *testing.T) {
+	app, _, cleanup := setupFullTestApp(t, config.LoadConfig())
+	defer cleanup()
+
+	token := registerAndLogin(t, app, "bodyscan", "bodyscan@example.com")
+
+	createPlaylist := func(payload map[string]interface{}) *http.Response {
+		jsonBody, _ := json.Marshal(payload)
+		req := httptest.NewRequest("POST", "/api/playlists", bytes.NewReader(jsonBody))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	t.Run("Malicious playlist name is rejected", func(t *testing.T) {
+		resp := createPlaylist(map[string]interface{}{"name": "<script>alert(1)</script>"})
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Malicious nested field is rejected", func(t *testing.T) {
+		resp := createPlaylist(map[string]interface{}{
+			"name": "Road Trip",
+			"tags": []interface{}{"rock", "x' UNION SELECT password_hash FROM users"},
+		})
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Overlong field is rejected", func(t *testing.T) {
+		resp := createPlaylist(map[string]interface{}{"name": strings.Repeat("a", 1001)})
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Legitimate names pass", func(t *testing.T) {
+		resp := createPlaylist(map[string]interface{}{"name": "AC/DC & Guns N' Roses"})
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	})
+
+	t.Run("Passwords are not scanned", func(t *testing.T) {
+		body := `{"username":"oddpass","email":"oddpass@example.com","password":"Pa55<script>word"}`
+		req := httptest.NewRequest("POST", "/api/auth/register", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	})
+}
+
+func TestOversizedBodyRefusedFromHeaders(t *testing.T) {
+	app, _, cleanup := setupFullTestApp(t, config.LoadConfig())
+	defer cleanup()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go app.Listener(ln)
+	defer app.Shutdown()
+
+	// Only the headers are sent; the answer must come without the body
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+	_, err = fmt.Fprintf(conn, "POST /api/auth/login HTTP/1.1\r\nHost: localhost\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n", 49<<20)
+	require.NoError(t, err)
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err, "the server answers before any of the body arrives")
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+}
+
+func TestServiceErrorMapping(t *testing.T) {
+	app, _, cleanup := setupFullTestApp(t, config.LoadConfig())
+	defer cleanup()
+
+	token := registerAndLogin(t, app, "errormap", "errormap@example.com")
+
+	decode := func(resp *http.Response) map[string]interface{} {
+		var result map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		return result
+	}
+
+	t.Run("Conflict yields 409", func(t *testing.T) {
+		body := `{"username":"errormap","email":"other@example.com","password":"Passw0rd-123"}`
+		req := httptest.NewRequest("POST", "/api/auth/register", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+		result := decode(resp)
+		assert.Equal(t, true, result["error"])
+		assert.Equal(t, "CONFLICT", result["code"])
+		assert.Equal(t, "username or email already exists", result["message"])
+	})
+
+	t.Run("Not found yields 404", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/playlists/9999", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		result := decode(resp)
+		assert.Equal(t, "NOT_FOUND", result["code"])
+		assert.Equal(t, "no playlist found", result["message"])
+	})
+
+	t.Run("Bad credentials yield 401", func(t *testing.T) {
+		body := `{"username":"errormap","password":"Wrong-Passw0rd"}`
+		req := httptest.NewRequest("POST", "/api/auth/login", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+		result := decode(resp)
+		assert.Equal(t, "AUTH_ERROR", result["code"])
+		assert.Equal(t, "authorization failed", result["message"])
+	})
+}
+
+func TestPlaylistDetailsSongFailure(t *testing.T) {
+	app, db, cleanup := setupFullTestApp(t, config.LoadConfig())
+	defer cleanup()
+
+	token := registerAndLogin(t, app, "detailsuser", "details@example.com")
+
+	req := httptest.NewRequest("POST", "/api/playlists", strings.NewReader(`{"name":"Empty"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var created map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&created)
+	playlistPath := fmt.Sprintf("/api/playlists/%v", created["data"].(map[string]interface{})["id"])
+
+	getDetails := func() (*http.Response, map[string]interface{}) {
+		req := httptest.NewRequest("GET", playlistPath, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		var result map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp, result
+	}
+
+	t.Run("Empty playlist returns an empty list", func(t *testing.T) {
+		resp, result := getDetails()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		songs := result["data"].(map[string]interface{})["songs"]
+		assert.Equal(t, []interface{}{}, songs)
+		playlist := result["data"].(map[string]interface{})["playlist"].(map[string]interface{})
+		assert.Equal(t, float64(0), playlist["song_count"])
+		assert.Equal(t, float64(0), playlist["total_duration_seconds"])
+	})
+
+	t.Run("Details include song totals", func(t *testing.T) {
+		playlistID := created["data"].(map[string]interface{})["id"]
+		inserted, err := db.Exec(`INSERT INTO artists (name) VALUES ('Timed Artist')`)
+		require.NoError(t, err)
+		artistID, _ := inserted.LastInsertId()
+		for _, duration := range []int{200, 95} {
+			inserted, err := db.Exec(`INSERT INTO songs (title, artist_id, duration_seconds, file_path, format)
+				VALUES ('Timed', ?, ?, 'timed.mp3', 'mp3')`, artistID, duration)
+			require.NoError(t, err)
+			songID, _ := inserted.LastInsertId()
+			_, err = db.Exec(`INSERT INTO playlist_songs (playlist_id, song_id, queue_number) VALUES (?, ?, ?)`,
+				playlistID, songID, duration)
+			require.NoError(t, err)
+		}
+
+		resp, result := getDetails()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		playlist := result["data"].(map[string]interface{})["playlist"].(map[string]interface{})
+		assert.Equal(t, float64(2), playlist["song_count"])
+		assert.Equal(t, float64(295), playlist["total_duration_seconds"])
+	})
+
+	t.Run("Song query failure returns 500", func(t *testing.T) {
+		_, err := db.Exec(`ALTER TABLE playlist_songs RENAME TO playlist_songs_broken`)
+		require.NoError(t, err)
+
+		resp, result := getDetails()
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		assert.Equal(t, true, result["error"])
+		assert.NotContains(t, result, "data")
+	})
+}
+
+func TestPlaylistWebSocket(t *testing.T) {
+	app, db, cleanup := setupFullTestApp(t, config.LoadConfig())
+	defer cleanup()
+
+	token := registerAndLogin(t, app, "wsowner", "wsowner@example.com")
+	outsider := registerAndLogin(t, app, "wsoutsider", "wsoutsider@example.com")
+
+	req := httptest.NewRequest("POST", "/api/playlists", strings.NewReader(`{"name":"Live Mix"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var created struct {
+		Data struct {
+			ID int `json:"id"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	playlistID := created.Data.ID
+
+	result, err := db.Exec(`INSERT INTO songs (title, file_path, format) VALUES ('Live Song', 'media/live.mp3', 'mp3')`)
+	require.NoError(t, err)
+	songID, _ := result.LastInsertId()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go app.Listener(ln)
+	defer app.Shutdown()
+
+	wsURL := fmt.Sprintf("ws://%s/api/playlists/%d/ws", ln.Addr(), playlistID)
+
+	t.Run("Rejects unauthenticated upgrades", func(t *testing.T) {
+		_, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+		require.Error(t, err)
+		require.NotNil(t, resp)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("Rejects users without access", func(t *testing.T) {
+		_, resp, err := websocket.DefaultDialer.Dial(wsURL+"?token="+outsider, nil)
+		require.Error(t, err)
+		require.NotNil(t, resp)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("Pushes song additions", func(t *testing.T) {
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL+"?token="+token, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+		var event map[string]interface{}
+		require.NoError(t, conn.ReadJSON(&event))
+		assert.Equal(t, "subscribed", event["type"])
+
+		req := httptest.NewRequest("POST", fmt.Sprintf("/api/playlists/%d/songs", playlistID),
+			strings.NewReader(fmt.Sprintf(`{"song_id":%d}`, songID)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		require.NoError(t, conn.ReadJSON(&event))
+		assert.Equal(t, "song_added", event["type"])
+		assert.Equal(t, float64(playlistID), event["playlist_id"])
+		assert.Equal(t, float64(songID), event["song_id"])
+	})
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	cfg := config.LoadConfig()
+	cfg.StoragePath = t.TempDir()
+	t.Setenv("STORAGE_PATH", cfg.StoragePath)
+
+	app, db, cleanup := setupFullTestApp(t, cfg)
+	defer cleanup()
+
+	token := registerAndLogin(t, app, "idemuser", "idem@example.com")
+	otherToken := registerAndLogin(t, app, "idemother", "idemother@example.com")
+
+	send := func(token, key string, newRequest func() *http.Request) (int, string, *http.Response) {
+		req := newRequest()
+		req.Header.Set("Authorization", "Bearer "+token)
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body), resp
+	}
+	namedPlaylist := func(name string) func() *http.Request {
+		return func() *http.Request {
+			req := httptest.NewRequest("POST", "/api/playlists", strings.NewReader(`{"name":"`+name+`"}`))
+			req.Header.Set("Content-Type", "application/json")
+			return req
+		}
+	}
+	createPlaylist := namedPlaylist("Road Trip")
+	uploadSong := func() *http.Request {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("file", "Demo.mp3")
+		require.NoError(t, err)
+		part.Write([]byte("fake mp3 data"))
+		require.NoError(t, writer.Close())
+
+		req := httptest.NewRequest("POST", "/api/upload", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		return req
+	}
+	count := func(table string) int {
+		var n int
+		require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM "+table).Scan(&n))
+		return n
+	}
+
+	t.Run("Playlist creation is replayed", func(t *testing.T) {
+		status, first, _ := send(token, "playlist-1", createPlaylist)
+		require.Equal(t, http.StatusCreated, status)
+
+		status, second, resp := send(token, "playlist-1", createPlaylist)
+		assert.Equal(t, http.StatusCreated, status)
+		assert.Equal(t, first, second)
+		assert.Equal(t, "true", resp.Header.Get("Idempotent-Replayed"))
+		assert.Equal(t, 1, count("playlists"))
+	})
+
+	t.Run("Upload is replayed", func(t *testing.T) {
+		status, first, _ := send(token, "upload-1", uploadSong)
+		require.Equal(t, http.StatusCreated, status, first)
+
+		status, second, _ := send(token, "upload-1", uploadSong)
+		assert.Equal(t, http.StatusCreated, status)
+		assert.Equal(t, first, second)
+		assert.Equal(t, 1, count("uploads"))
+	})
+
+	t.Run("Keys are scoped to user and request", func(t *testing.T) {
+		status, _, _ := send(otherToken, "playlist-1", createPlaylist)
+		assert.Equal(t, http.StatusCreated, status)
+		assert.Equal(t, 2, count("playlists"))
+
+		status, _, _ = send(token, "playlist-1", uploadSong)
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Equal(t, 1, count("uploads"))
+	})
+
+	t.Run("Requests without a key run every time", func(t *testing.T) {
+		status, _, _ := send(token, "", namedPlaylist("Commute"))
+		assert.Equal(t, http.StatusCreated, status)
+		status, _, _ = send(token, "", namedPlaylist("Commute"))
+		assert.Equal(t, http.StatusConflict, status, "the handler ran again")
+		assert.Equal(t, 3, count("playlists"))
+	})
+}
+
+func TestPlayHistoryEndpoints(t *testing.T) {
+	app, _, cleanup := setupFullTestApp(t, config.LoadConfig())
+	defer cleanup()
+
+	token := registerAndLogin(t, app, "historyuser", "history@example.com")
+
+	for _, path := range []string{"/api/history/artists", "/api/history/albums"} {
+		t.Run(path, func(t *testing.T) {
+			for _, auth := range []string{"", "Bearer " + token} {
+				req := httptest.NewRequest("GET", path, nil)
+				if auth != "" {
+					req.Header.Set("Authorization", auth)
+				}
+				resp, err := app.Test(req)
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, resp.StatusCode)
+
+				var result struct {
+					Data []interface{} `json:"data"`
+				}
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+				assert.NotNil(t, result.Data, "no history is an empty list, not null")
+				assert.Empty(t, result.Data)
+			}
+
+			req := httptest.NewRequest("GET", path, nil)
+			req.Header.Set("Authorization", "Bearer not-a-token")
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the request
+// duration histogram
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type requestKey struct {
+	method string
+	route  string
+	status int
+}
+
+type routeKey struct {
+	method string
+	route  string
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// Registry holds the in-memory counters rendered by /metrics
+type Registry struct {
+	mu        sync.Mutex
+	requests  map[requestKey]uint64
+	latencies map[routeKey]*histogram
+
+	uploads       atomic.Uint64
+	uploadBytes   atomic.Uint64
+	searches      atomic.Uint64
+	activeStreams atomic.Int64
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		requests:  make(map[requestKey]uint64),
+		latencies: make(map[routeKey]*histogram),
+	}
+}
+
+// Default is the registry the app records into and serves
+var Default = NewRegistry()
+
+// ObserveRequest counts a finished request. route should be the matched
+// route pattern (e.g. "/api/songs/:id"), not the raw path, so the number
+// of series stays bounded
+func (r *Registry) ObserveRequest(method, route string, status int, duration time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.requests[requestKey{method, route, status}]++
+
+	key := routeKey{method, route}
+	h := r.latencies[key]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		r.latencies[key] = h
+	}
+	seconds := duration.Seconds()
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// RecordUpload counts a stored upload of size bytes
+func (r *Registry) RecordUpload(size int64) {
+	r.uploads.Add(1)
+	if size > 0 {
+		r.uploadBytes.Add(uint64(size))
+	}
+}
+
+// RecordSearch counts a search query
+func (r *Registry) RecordSearch() {
+	r.searches.Add(1)
+}
+
+// TrackStream counts body as an active stream until it is closed. Closing
+// the returned reader also closes closer
+func (r *Registry) TrackStream(body io.Reader, closer io.Closer) io.ReadCloser {
+	r.activeStreams.Add(1)
+	return &trackedStream{Reader: body, closer: closer, registry: r}
+}
+
+type trackedStream struct {
+	io.Reader
+	closer   io.Closer
+	registry *Registry
+	once     sync.Once
+}
+
+func (s *trackedStream) Close() error {
+	var err error
+	s.once.Do(func() {
+		s.registry.activeStreams.Add(-1)
+		if s.closer != nil {
+			err = s.closer.Close()
+		}
+	})
+	return err
+}
+
+// RecordUpload counts an upload in the default registry
+func RecordUpload(size int64) { Default.RecordUpload(size) }
+
+// RecordSearch counts a search in the default registry
+func RecordSearch() { Default.RecordSearch() }
+
+// TrackStream tracks a stream in the default registry
+func TrackStream(body io.Reader, closer io.Closer) io.ReadCloser {
+	return Default.TrackStream(body, closer)
+}
+
+// WritePrometheus renders every metric in the Prometheus text format
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	r.mu.Lock()
+	requestKeys := make([]requestKey, 0, len(r.requests))
+	for key := range r.requests {
+		requestKeys = append(requestKeys, key)
+	}
+	sort.Slice(requestKeys, func(i, j int) bool {
+		a, b := requestKeys[i], requestKeys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+
+	writeHeader(bw, "tunetudo_http_requests_total", "counter", "HTTP requests handled, by method, route and status.")
+	for _, key := range requestKeys {
+		fmt.Fprintf(bw, "tunetudo_http_requests_total{method=%q,route=%q,status=\"%d\"} %d\n",
+			escapeLabel(key.method), escapeLabel(key.route), key.status, r.requests[key])
+	}
+
+	routeKeys := make([]routeKey, 0, len(r.latencies))
+	for key := range r.latencies {
+		routeKeys = append(routeKeys, key)
+	}
+	sort.Slice(routeKeys, func(i, j int) bool {
+		if routeKeys[i].route != routeKeys[j].route {
+			return routeKeys[i].route < routeKeys[j].route
+		}
+		return routeKeys[i].method < routeKeys[j].method
+	})
+
+	writeHeader(bw, "tunetudo_http_request_duration_seconds", "histogram", "HTTP request latency, by method and route.")
+	for _, key := range routeKeys {
+		h := r.latencies[key]
+		labels := fmt.Sprintf("method=%q,route=%q", escapeLabel(key.method), escapeLabel(key.route))
+		var cumulative uint64
+		for i, bound := range latencyBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(bw, "tunetudo_http_request_duration_seconds_bucket{%s,le=\"%g\"} %d\n", labels, bound, cumulative)
+		}
+		fmt.Fprintf(bw, "tunetudo_http_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(bw, "tunetudo_http_request_duration_seconds_sum{%s} %g\n", labels, h.sum)
+		fmt.Fprintf(bw, "tunetudo_http_request_duration_seconds_count{%s} %d\n", labels, h.count)
+	}
+	r.mu.Unlock()
+
+	writeHeader(bw, "tunetudo_uploads_total", "counter", "Uploaded songs stored.")
+	fmt.Fprintf(bw, "tunetudo_uploads_total %d\n", r.uploads.Load())
+	writeHeader(bw, "tunetudo_upload_bytes_total", "counter", "Bytes of uploaded songs stored.")
+	fmt.Fprintf(bw, "tunetudo_upload_bytes_total %d\n", r.uploadBytes.Load())
+	writeHeader(bw, "tunetudo_search_queries_total", "counter", "Search queries received.")
+	fmt.Fprintf(bw, "tunetudo_search_queries_total %d\n", r.searches.Load())
+	writeHeader(bw, "tunetudo_active_streams", "gauge", "Song streams currently being sent.")
+	fmt.Fprintf(bw, "tunetudo_active_streams %d\n", r.activeStreams.Load())
+
+	return bw.Flush()
+}
+
+func writeHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// escapeLabel leaves only characters %q renders the way Prometheus expects;
+// anything outside printable ASCII is replaced
+func escapeLabel(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e {
+			return '_'
+		}
+		return r
+	}, value)
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	registry := NewRegistry()
+	registry.ObserveRequest("GET", "/api/songs/:id", 200, 20*time.Millisecond)
+	registry.ObserveRequest("GET", "/api/songs/:id", 200, 2*time.Second)
+	registry.ObserveRequest("GET", "/api/songs/:id", 404, time.Millisecond)
+	registry.RecordUpload(1024)
+	registry.RecordUpload(2048)
+	registry.RecordSearch()
+
+	var buf bytes.Buffer
+	require.NoError(t, registry.WritePrometheus(&buf))
+	out := buf.String()
+
+	for _, line := range []string{
+		`# TYPE tunetudo_http_requests_total counter`,
+		`tunetudo_http_requests_total{method="GET",route="/api/songs/:id",status="200"} 2`,
+		`tunetudo_http_requests_total{method="GET",route="/api/songs/:id",status="404"} 1`,
+		`tunetudo_http_request_duration_seconds_bucket{method="GET",route="/api/songs/:id",le="0.005"} 1`,
+		`tunetudo_http_request_duration_seconds_bucket{method="GET",route="/api/songs/:id",le="0.025"} 2`,
+		`tunetudo_http_request_duration_seconds_bucket{method="GET",route="/api/songs/:id",le="+Inf"} 3`,
+		`tunetudo_http_request_duration_seconds_count{method="GET",route="/api/songs/:id"} 3`,
+		`tunetudo_uploads_total 2`,
+		`tunetudo_upload_bytes_total 3072`,
+		`tunetudo_search_queries_total 1`,
+		`tunetudo_active_streams 0`,
+	} {
+		assert.Contains(t, out, line+"\n")
+	}
+}
+
+func TestTrackStream(t *testing.T) {
+	registry := NewRegistry()
+
+	first := registry.TrackStream(strings.NewReader("a"), nil)
+	second := registry.TrackStream(strings.NewReader("b"), nil)
+	assert.Equal(t, int64(2), registry.activeStreams.Load())
+
+	require.NoError(t, first.Close())
+	require.NoError(t, first.Close())
+	assert.Equal(t, int64(1), registry.activeStreams.Load(), "closing twice only counts once")
+
+	require.NoError(t, second.Close())
+	assert.Equal(t, int64(0), registry.activeStreams.Load())
+}
+
+func TestLabelEscaping(t *testing.T) {
+	registry := NewRegistry()
+	registry.ObserveRequest("GET", "/a\"b\\c\nd", 200, 0)
+
+	var buf bytes.Buffer
+	require.NoError(t, registry.WritePrometheus(&buf))
+	assert.Contains(t, buf.String(), `route="/a\"b\\c_d"`)
+}
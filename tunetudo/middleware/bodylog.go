@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"tunetudo/logger"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const redactedValue = "[REDACTED]"
+
+// sensitiveKeyParts mark JSON keys whose values never reach the debug log,
+// e.g. password, new_password, token, refresh_token, captcha_token, secret
+var sensitiveKeyParts = []string{"password", "token", "secret", "authorization"}
+
+// BodyLogger writes JSON request and response bodies to the debug log with
+// sensitive fields redacted and anything past maxBytes cut off. Other
+// bodies (uploads, streams, forms) are only described. When enabled is
+// false it does nothing, and it never writes to the info or security logs
+func BodyLogger(enabled bool, maxBytes int) fiber.Handler {
+	if !enabled {
+		return func(c *fiber.Ctx) error {
+			return c.Next()
+		}
+	}
+
+	return func(c *fiber.Ctx) error {
+		if hasRequestBody(c) {
+			logger.Debug(logger.CategoryAPI, "Request body: method=%s path=%s body=%s",
+				c.Method(), c.Path(), loggableRequestBody(c, maxBytes))
+		}
+
+		err := c.Next()
+		if err != nil {
+			// The error handler writes the response after this returns
+			logger.Debug(logger.CategoryAPI, "Response body: method=%s path=%s handled as an error",
+				c.Method(), c.Path())
+			return err
+		}
+
+		resp := c.Response()
+		if resp.IsBodyStream() {
+			logger.Debug(logger.CategoryAPI, "Response body: method=%s path=%s status=%d streamed",
+				c.Method(), c.Path(), resp.StatusCode())
+			return nil
+		}
+		if body := resp.Body(); len(body) > 0 {
+			logger.Debug(logger.CategoryAPI, "Response body: method=%s path=%s status=%d body=%s",
+				c.Method(), c.Path(), resp.StatusCode(),
+				loggableBody(string(resp.Header.ContentType()), body, maxBytes))
+		}
+		return nil
+	}
+}
+
+// loggableRequestBody is loggableBody for the request. Only JSON bodies are
+// read; anything else is described from its headers, since c.Body() on a
+// multipart upload re-serializes every file in it into memory
+func loggableRequestBody(c *fiber.Ctx, maxBytes int) string {
+	contentType := c.Get(fiber.HeaderContentType)
+	if isJSON(contentType) {
+		return loggableBody(contentType, c.Body(), maxBytes)
+	}
+	if length := c.Request().Header.ContentLength(); length >= 0 {
+		return describeBody(contentType, length)
+	}
+	return fmt.Sprintf("<chunked body of %q>", contentType)
+}
+
+// loggableBody returns a redacted, truncated copy of a JSON body, or a
+// description of any other body
+func loggableBody(contentType string, body []byte, maxBytes int) string {
+	if !isJSON(contentType) {
+		return describeBody(contentType, len(body))
+	}
+
+	var parsed interface{}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return fmt.Sprintf("<%d bytes of malformed JSON>", len(body))
+	}
+	redacted, err := json.Marshal(redactJSON(parsed))
+	if err != nil {
+		return fmt.Sprintf("<%d bytes of JSON>", len(body))
+	}
+
+	if maxBytes > 0 && len(redacted) > maxBytes {
+		return fmt.Sprintf("%s...(truncated, %d bytes)", redacted[:maxBytes], len(redacted))
+	}
+	return string(redacted)
+}
+
+func isJSON(contentType string) bool {
+	return strings.HasPrefix(strings.ToLower(contentType), fiber.MIMEApplicationJSON)
+}
+
+func describeBody(contentType string, length int) string {
+	return fmt.Sprintf("<%d bytes of %q>", length, contentType)
+}
+
+// redactJSON replaces the values of sensitive keys throughout a decoded
+// JSON document
+func redactJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if isSensitiveKey(key) {
+				v[key] = redactedValue
+			} else {
+				v[key] = redactJSON(field)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactJSON(item)
+		}
+	}
+	return value
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, part := range sensitiveKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
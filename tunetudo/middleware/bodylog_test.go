@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"tunetudo/logger"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+// logBodies sends a login through a BodyLogger app and returns what each
+// log file received
+func logBodies(t *testing.T, enabled bool, maxBytes int) (debugLog, appLog, securityLog string) {
+	dir := t.TempDir()
+	require.NoError(t, logger.InitLogger(filepath.Join(dir, "app.log")))
+	t.Cleanup(func() { logger.Close() })
+
+	app := fiber.New()
+	app.Use(BodyLogger(enabled, maxBytes))
+	app.Post("/api/auth/login", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"error": false, "token": "issued-jwt", "data": fiber.Map{"username": "listener"}})
+	})
+
+	req := httptest.NewRequest("POST", "/api/auth/login",
+		strings.NewReader(`{"username":"listener","Password":"hunter2","extra":[{"captcha_token":"solved"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	_, err := app.Test(req)
+	require.NoError(t, err)
+	require.NoError(t, logger.Close())
+
+	read := func(name string) string {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		return string(content)
+	}
+	return read("debug.log"), read("app.log"), read("security.log")
+}
+
+func TestBodyLoggerRedactsSecrets(t *testing.T) {
+	debugLog, appLog, securityLog := logBodies(t, true, 4096)
+
+	assert.Contains(t, debugLog, `"username":"listener"`)
+	assert.Contains(t, debugLog, `"Password":"[REDACTED]"`)
+	assert.Contains(t, debugLog, `"captcha_token":"[REDACTED]"`)
+	assert.Contains(t, debugLog, `"token":"[REDACTED]"`)
+	for _, secret := range []string{"hunter2", "solved", "issued-jwt"} {
+		assert.NotContains(t, debugLog, secret)
+	}
+	assert.Empty(t, appLog, "bodies only go to the debug log")
+	assert.Empty(t, securityLog)
+}
+
+func TestBodyLoggerTruncates(t *testing.T) {
+	debugLog, _, _ := logBodies(t, true, 16)
+	assert.Contains(t, debugLog, "...(truncated,")
+	assert.NotContains(t, debugLog, "listener")
+}
+
+func TestBodyLoggerDisabled(t *testing.T) {
+	debugLog, appLog, securityLog := logBodies(t, false, 4096)
+	assert.Empty(t, debugLog)
+	assert.Empty(t, appLog)
+	assert.Empty(t, securityLog)
+}
+
+func TestLoggableBodyDescribesOtherContent(t *testing.T) {
+	assert.Equal(t, `<11 bytes of "application/x-www-form-urlencoded">`,
+		loggableBody("application/x-www-form-urlencoded", []byte("password=pw"), 4096))
+	assert.Equal(t, "<9 bytes of malformed JSON>",
+		loggableBody("application/json", []byte(`{"passwor`), 4096))
+}
+
+func TestBodyLoggerDescribesUploads(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, logger.InitLogger(filepath.Join(dir, "app.log")))
+	t.Cleanup(func() { logger.Close() })
+
+	app := fiber.New()
+	app.Use(BodyLogger(true, 4096))
+	app.Post("/api/upload", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusCreated)
+	})
+
+	const fileSize = 8 << 20
+	handler := app.Handler()
+	var ctx fasthttp.RequestCtx
+	readUpload(t, &ctx, uploadRequest(t, "Clean Title", fileSize))
+	length := ctx.Request.Header.ContentLength()
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	handler(&ctx)
+	runtime.ReadMemStats(&after)
+
+	require.Equal(t, fiber.StatusCreated, ctx.Response.StatusCode())
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(fileSize/4),
+		"logging an upload must not copy the file into memory")
+	require.NoError(t, logger.Close())
+
+	debugLog, err := os.ReadFile(filepath.Join(dir, "debug.log"))
+	require.NoError(t, err)
+	assert.Contains(t, string(debugLog), fmt.Sprintf(`body=<%d bytes of "multipart/form-data`, length))
+	assert.NotContains(t, string(debugLog), "Clean Title", "upload fields aren't logged")
+}
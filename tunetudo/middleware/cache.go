@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// NotModified reports whether the request's validators show the client
+// already has this version. If-None-Match wins over If-Modified-Since when
+// both are sent, as RFC 9110 requires
+func NotModified(c *fiber.Ctx, etag string, lastModified time.Time) bool {
+	if header := c.Get(fiber.HeaderIfNoneMatch); header != "" {
+		return etagMatches(header, etag)
+	}
+
+	if header := c.Get(fiber.HeaderIfModifiedSince); header != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(header)
+		// HTTP dates have second precision
+		return err == nil && !lastModified.Truncate(time.Second).After(since)
+	}
+	return false
+}
+
+// etagMatches compares an If-None-Match list against etag using the weak
+// comparison conditional GETs call for
+func etagMatches(header, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// FileETag adds an ETag built from modification time and size to files
+// served from root under prefix, and answers matching conditional requests
+// with 304 before the static handler opens the file
+func FileETag(prefix, root string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Method() != fiber.MethodGet && c.Method() != fiber.MethodHead {
+			return c.Next()
+		}
+
+		// Cleaning an absolute path can't climb above root
+		rel := path.Clean("/" + strings.TrimPrefix(c.Path(), prefix))
+		info, err := os.Stat(filepath.Join(root, filepath.FromSlash(rel)))
+		if err != nil || info.IsDir() {
+			return c.Next()
+		}
+
+		etag := fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+		c.Set(fiber.HeaderETag, etag)
+		if NotModified(c, etag, info.ModTime()) {
+			c.Set(fiber.HeaderLastModified, info.ModTime().UTC().Format(http.TimeFormat))
+			return c.SendStatus(fiber.StatusNotModified)
+		}
+		return c.Next()
+	}
+}
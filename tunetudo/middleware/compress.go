@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/compress"
+	"github.com/valyala/fasthttp"
+)
+
+// Compress brotli-, gzip- or deflate-encodes buffered responses of at least
+// minSize bytes for clients that accept it. Streamed bodies (song streams,
+// static files) are left alone: audio is already compressed, and encoding
+// a ranged response would break the byte offsets clients asked for
+func Compress(level compress.Level, minSize int) fiber.Handler {
+	var compressor fasthttp.RequestHandler
+	noop := func(*fasthttp.RequestCtx) {}
+
+	switch level {
+	case compress.LevelDefault:
+		compressor = fasthttp.CompressHandlerBrotliLevel(noop, fasthttp.CompressBrotliDefaultCompression, fasthttp.CompressDefaultCompression)
+	case compress.LevelBestSpeed:
+		compressor = fasthttp.CompressHandlerBrotliLevel(noop, fasthttp.CompressBrotliBestSpeed, fasthttp.CompressBestSpeed)
+	case compress.LevelBestCompression:
+		compressor = fasthttp.CompressHandlerBrotliLevel(noop, fasthttp.CompressBrotliBestCompression, fasthttp.CompressBestCompression)
+	default:
+		return func(c *fiber.Ctx) error {
+			return c.Next()
+		}
+	}
+
+	return func(c *fiber.Ctx) error {
+		if err := c.Next(); err != nil {
+			return err
+		}
+
+		resp := c.Response()
+		if resp.IsBodyStream() || len(resp.Body()) < minSize || isStreamRoute(c.Path()) {
+			return nil
+		}
+
+		compressor(c.Context())
+		return nil
+	}
+}
+
+// isStreamRoute matches /api/songs/:id/stream
+func isStreamRoute(path string) bool {
+	return strings.HasPrefix(path, "/api/songs/") && strings.HasSuffix(path, "/stream")
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"tunetudo/logger"
+	"tunetudo/models"
+	"tunetudo/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxIdempotencyKeyLength bounds the keys clients can make us store
+const maxIdempotencyKeyLength = 255
+
+// Idempotency replays the stored response when an authenticated user
+// repeats a request with the same Idempotency-Key header, rather than
+// running the handler again. Requests without the header pass through.
+// Responses of 500 and above are not stored, so those can be retried.
+// Must run after AuthMiddleware
+func Idempotency(service *services.IdempotencyService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get("Idempotency-Key")
+		if key == "" {
+			return c.Next()
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   true,
+				"message": "Idempotency-Key is too long",
+			})
+		}
+
+		userID, err := GetUserID(c)
+		if err != nil {
+			return err
+		}
+
+		stored, err := service.Begin(userID, key, c.Method(), c.Path())
+		if err != nil {
+			return err
+		}
+		if stored != nil {
+			c.Set("Idempotent-Replayed", "true")
+			c.Set(fiber.HeaderContentType, stored.ContentType)
+			return c.Status(stored.Status).Send(stored.Body)
+		}
+
+		err = c.Next()
+		status := c.Response().StatusCode()
+		if err != nil || status >= fiber.StatusInternalServerError {
+			if releaseErr := service.Release(userID, key); releaseErr != nil {
+				logger.Error(logger.CategoryDB, "Failed to release idempotency key", releaseErr)
+			}
+			return err
+		}
+
+		response := models.IdempotentResponse{
+			Status:      status,
+			ContentType: string(c.Response().Header.ContentType()),
+			Body:        append([]byte(nil), c.Response().Body()...),
+		}
+		if err := service.Complete(userID, key, response); err != nil {
+			logger.Error(logger.CategoryDB, "Failed to store idempotent response", err)
+			service.Release(userID, key)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const maintenanceMessage = "TuneTudo is in read-only maintenance mode; changes are disabled for now"
+
+// MaintenanceMode makes the API read-only while operators work on the
+// server. It starts from MAINTENANCE_MODE and admins can switch it at
+// runtime; a switch lasts until the next restart
+type MaintenanceMode struct {
+	enabled    atomic.Bool
+	retryAfter time.Duration
+}
+
+// NewMaintenanceMode returns the switch, on if enabled. Blocked clients are
+// told to retry after retryAfter
+func NewMaintenanceMode(enabled bool, retryAfter time.Duration) *MaintenanceMode {
+	m := &MaintenanceMode{retryAfter: retryAfter}
+	m.enabled.Store(enabled)
+	return m
+}
+
+// Enabled reports whether writes are currently blocked
+func (m *MaintenanceMode) Enabled() bool {
+	return m.enabled.Load()
+}
+
+// SetEnabled turns maintenance mode on or off
+func (m *MaintenanceMode) SetEnabled(enabled bool) {
+	m.enabled.Store(enabled)
+}
+
+// Handler answers writes with 503 and a Retry-After header while maintenance
+// mode is on. Reads and streams pass, as do the admin API, so the mode can
+// be switched off again, and signing in, so admins can reach it
+func (m *MaintenanceMode) Handler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !m.Enabled() || !isWrite(c.Method()) || maintenanceExempt(c.Path()) {
+			return c.Next()
+		}
+
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(m.retryAfter.Seconds())))
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error":   true,
+			"code":    "MAINTENANCE",
+			"message": maintenanceMessage,
+		})
+	}
+}
+
+func isWrite(method string) bool {
+	switch method {
+	case fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch, fiber.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// maintenanceExempt matches the admin API and login; routing ignores case
+// and trailing slashes, so the check does too
+func maintenanceExempt(path string) bool {
+	path = strings.TrimSuffix(strings.ToLower(path), "/")
+	return path == "/api/admin" || strings.HasPrefix(path, "/api/admin/") || path == "/api/auth/login"
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	maintenance := NewMaintenanceMode(true, 2*time.Minute)
+	app := fiber.New()
+	api := app.Group("/api", maintenance.Handler())
+	ok := func(c *fiber.Ctx) error { return c.SendString("ok") }
+	api.Get("/songs/:id/stream", ok)
+	api.Get("/playlists", ok)
+	api.Post("/playlists", ok)
+	api.Put("/profile", ok)
+	api.Delete("/playlists/:id", ok)
+	api.Post("/auth/login", ok)
+	api.Patch("/admin/users/:id", ok)
+
+	status := func(method, path string) int {
+		resp, err := app.Test(httptest.NewRequest(method, path, nil))
+		require.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/api/playlists", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "120", resp.Header.Get(fiber.HeaderRetryAfter))
+	var body map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, maintenanceMessage, body["message"])
+
+	assert.Equal(t, fiber.StatusServiceUnavailable, status("PUT", "/api/profile"))
+	assert.Equal(t, fiber.StatusServiceUnavailable, status("DELETE", "/api/playlists/3"))
+
+	// Reads, streams, login and the admin API keep working
+	assert.Equal(t, fiber.StatusOK, status("GET", "/api/playlists"))
+	assert.Equal(t, fiber.StatusOK, status("GET", "/api/songs/1/stream"))
+	assert.Equal(t, fiber.StatusOK, status("POST", "/api/auth/login"))
+	assert.Equal(t, fiber.StatusOK, status("PATCH", "/api/Admin/users/2"))
+
+	maintenance.SetEnabled(false)
+	assert.Equal(t, fiber.StatusOK, status("POST", "/api/playlists"))
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"strings"
+	"time"
+	"tunetudo/metrics"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// unmatchedRoute labels requests that no route handled, so probes for
+// random paths don't each create their own series
+const unmatchedRoute = "unmatched"
+
+// RequestMetrics counts every request by method, route and final status
+// and records its latency. It runs the error handler itself so the status
+// of a failed request is known when it is counted
+func RequestMetrics(registry *metrics.Registry) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+
+		if err := c.Next(); err != nil {
+			if handlerErr := c.App().ErrorHandler(c, err); handlerErr != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		status := c.Response().StatusCode()
+		registry.ObserveRequest(c.Method(), routeLabel(c, status), status, time.Since(start))
+		return nil
+	}
+}
+
+// routeLabel is the matched route pattern. A 404 that only passed through
+// prefix middleware (whose plain pattern differs from the path) had no
+// route, and is labelled unmatchedRoute
+func routeLabel(c *fiber.Ctx, status int) string {
+	pattern := c.Route().Path
+	if status == fiber.StatusNotFound && !strings.ContainsAny(pattern, ":*+") &&
+		!strings.EqualFold(strings.TrimSuffix(pattern, "/"), strings.TrimSuffix(c.Path(), "/")) {
+		return unmatchedRoute
+	}
+	return pattern
+}
+
+// MetricsAccess guards the metrics endpoint. A request gets through with
+// the configured bearer token or from an allowlisted IP; with neither
+// configured the endpoint is closed
+func MetricsAccess(token string, allowedIPs []string) fiber.Handler {
+	allowed := make(map[string]bool, len(allowedIPs))
+	for _, ip := range allowedIPs {
+		allowed[ip] = true
+	}
+
+	return func(c *fiber.Ctx) error {
+		if token != "" {
+			provided := c.Get(fiber.HeaderAuthorization)
+			if subtle.ConstantTimeCompare([]byte(provided), []byte("Bearer "+token)) == 1 {
+				return c.Next()
+			}
+		}
+		if allowed[c.IP()] {
+			return c.Next()
+		}
+
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":   true,
+			"message": "Access denied",
+		})
+	}
+}
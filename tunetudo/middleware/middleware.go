@@ -2,10 +2,13 @@ package middleware
 
 import (
 	"errors"
+	"strconv"
 	"strings"
+	apperrors "tunetudo/errors"
 	"tunetudo/logger"
 	"tunetudo/services"
 
+	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -59,13 +62,96 @@ func AuthMiddleware(authService *services.AuthService) fiber.Handler {
 		}
 
 		username, _ := claims["username"].(string)
-		isAdmin, _ := claims["is_admin"].(bool)
+
+		// Use the stored role rather than the token claim so promotions,
+		// demotions and suspensions apply without waiting for a new login
+		isAdmin, suspended, err := authService.GetAccountStatus(int(userID))
+		if err != nil {
+			ip := c.IP()
+			logger.AccessDenied(username, ip, c.Path(), "Account not found")
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":   true,
+				"message": "Invalid token",
+			})
+		}
+		if suspended {
+			ip := c.IP()
+			logger.AccessDenied(username, ip, c.Path(), "Account suspended")
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":   true,
+				"message": "Account suspended",
+			})
+		}
 
 		// Store user info in context
 		c.Locals("user_id", int(userID))
 		c.Locals("username", username)
 		c.Locals("is_admin", isAdmin)
+		if jti, ok := claims["jti"].(string); ok {
+			c.Locals("session_jti", jti)
+		}
+
+		return c.Next()
+	}
+}
+
+// OptionalAuth authenticates requests carrying a token exactly as
+// AuthMiddleware does, and lets requests without one through anonymously.
+// Handlers check for a user with OptionalUserID
+func OptionalAuth(authService *services.AuthService) fiber.Handler {
+	auth := AuthMiddleware(authService)
+	return func(c *fiber.Ctx) error {
+		if c.Get("Authorization") == "" {
+			return c.Next()
+		}
+		return auth(c)
+	}
+}
 
+// ContentFilter decides whether a listing hides explicit content, for
+// handlers to read with SafeMode. An explicit ?safe=true/false wins, then
+// the signed-in user's safe mode setting, then defaultSafe. It belongs
+// after AuthMiddleware or OptionalAuth
+func ContentFilter(authService *services.AuthService, defaultSafe bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		safe := defaultSafe
+		if value := c.Query("safe"); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error":   true,
+					"message": "safe must be true or false",
+				})
+			}
+			safe = parsed
+		} else if userID, ok := OptionalUserID(c); ok {
+			userSafe, err := authService.GetSafeMode(userID)
+			if err != nil {
+				return err
+			}
+			safe = safe || userSafe
+		}
+
+		c.Locals("safe_mode", safe)
+		return c.Next()
+	}
+}
+
+// SafeMode reports whether ContentFilter asked for explicit content to be hidden
+func SafeMode(c *fiber.Ctx) bool {
+	safe, _ := c.Locals("safe_mode").(bool)
+	return safe
+}
+
+// WebSocketToken lets browsers, which cannot set headers on a WebSocket
+// handshake, pass their JWT as ?token= for AuthMiddleware to pick up. It
+// only applies to upgrade requests and never overrides a header
+func WebSocketToken() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := c.Query("token")
+		if token != "" && c.Get(fiber.HeaderAuthorization) == "" && websocket.IsWebSocketUpgrade(c) {
+			c.Request().Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+		}
 		return c.Next()
 	}
 }
@@ -89,8 +175,9 @@ func AdminMiddleware() fiber.Handler {
 			})
 		}
 
-		// Log admin action
-		if username != nil {
+		// Log admin changes. Reads aren't audited, or browsing the audit
+		// log would keep filling it
+		if username != nil && isWrite(c.Method()) {
 			logger.AdminAction(username.(string), ip, c.Method()+" "+c.Path(), "Admin endpoint accessed")
 		}
 
@@ -98,16 +185,24 @@ func AdminMiddleware() fiber.Handler {
 	}
 }
 
+// ErrUnauthenticated is returned by GetUserID when the request carries no
+// authenticated user. Handlers return it as-is and ErrorHandler writes the 401
+var ErrUnauthenticated = apperrors.NewAppError(apperrors.ErrCodeUnauthorized, "Authentication required", fiber.StatusUnauthorized, nil)
+
+// OptionalUserID returns the authenticated user on routes behind
+// OptionalAuth, without treating an anonymous request as an error
+func OptionalUserID(c *fiber.Ctx) (int, bool) {
+	userID, ok := c.Locals("user_id").(int)
+	return userID, ok
+}
+
 // GetUserID extracts user ID from context
 func GetUserID(c *fiber.Ctx) (int, error) {
 	userID, ok := c.Locals("user_id").(int)
 	if !ok {
 		ip := c.IP()
 		logger.AccessDenied("anonymous", ip, c.Path(), "User ID not found in context")
-		return 0, c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error":   true,
-			"message": "Authentication required",
-		})
+		return 0, ErrUnauthenticated
 	}
 	return userID, nil
 }
@@ -121,6 +216,13 @@ func GetUsername(c *fiber.Ctx) (string, error) {
 	return username, nil
 }
 
+// SessionJTI returns the session id of the request's token, or "" for
+// tokens not tied to a session
+func SessionJTI(c *fiber.Ctx) string {
+	jti, _ := c.Locals("session_jti").(string)
+	return jti
+}
+
 // IsAdmin checks if the current user is an admin
 func IsAdmin(c *fiber.Ctx) bool {
 	isAdmin, ok := c.Locals("is_admin").(bool)
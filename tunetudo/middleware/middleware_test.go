@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	apperrors "tunetudo/errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetUserIDWithoutAuthentication(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+
+	reachedHandlerBody := false
+	app.Get("/me", func(c *fiber.Ctx) error {
+		userID, err := GetUserID(c)
+		if err != nil {
+			assert.ErrorIs(t, err, ErrUnauthenticated)
+			return err
+		}
+		reachedHandlerBody = true
+		return c.JSON(fiber.Map{"user_id": userID})
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/me", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.False(t, reachedHandlerBody)
+
+	// The body must be exactly one JSON object, written once
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	var result map[string]interface{}
+	require.NoError(t, json.Unmarshal(body, &result))
+	assert.Equal(t, true, result["error"])
+	assert.Equal(t, "UNAUTHORIZED", result["code"])
+	assert.Equal(t, "Authentication required", result["message"])
+}
+
+func TestGetUserIDWithAuthentication(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/me", func(c *fiber.Ctx) error {
+		c.Locals("user_id", 42)
+		userID, err := GetUserID(c)
+		if err != nil {
+			return err
+		}
+		return c.JSON(fiber.Map{"user_id": userID})
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/me", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestErrorHandlerListsInvalidFields(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Post("/form", func(c *fiber.Ctx) error {
+		return apperrors.ValidationErrors{
+			"email":    "invalid email address",
+			"password": "password must be at least 8 characters",
+		}.Err()
+	})
+	app.Post("/single", func(c *fiber.Ctx) error {
+		return apperrors.ValidationError("enter valid playlist name", nil)
+	})
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/form", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	var result struct {
+		Message string `json:"message"`
+		Data    struct {
+			Fields map[string]string `json:"fields"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.Equal(t, "some fields are invalid", result.Message)
+	assert.Equal(t, map[string]string{
+		"email":    "invalid email address",
+		"password": "password must be at least 8 characters",
+	}, result.Data.Fields)
+
+	// Errors without fields keep their old shape
+	resp, err = app.Test(httptest.NewRequest("POST", "/single", nil))
+	require.NoError(t, err)
+	var plain map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&plain))
+	assert.NotContains(t, plain, "data")
+	assert.Equal(t, "enter valid playlist name", plain["message"])
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"tunetudo/logger"
+	"tunetudo/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+)
+
+// Locals keys set by IdentifyRequester. These are kept separate from the
+// keys set by AuthMiddleware so public routes never look authenticated.
+const (
+	rateLimitUserIDKey   = "rate_limit_user_id"
+	rateLimitUsernameKey = "rate_limit_username"
+)
+
+// IdentifyRequester records who is making the request for rate limiting.
+// It never rejects a request - a missing or invalid token simply leaves the
+// request keyed by IP, and AuthMiddleware still enforces access.
+func IdentifyRequester(authService *services.AuthService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		tokenParts := strings.Split(c.Get("Authorization"), " ")
+		if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
+			return c.Next()
+		}
+
+		claims, err := authService.ValidateToken(tokenParts[1])
+		if err != nil {
+			return c.Next()
+		}
+
+		if userID, ok := claims["user_id"].(float64); ok {
+			username, _ := claims["username"].(string)
+			c.Locals(rateLimitUserIDKey, int(userID))
+			c.Locals(rateLimitUsernameKey, username)
+		}
+
+		return c.Next()
+	}
+}
+
+// IPRateLimiter limits anonymous requests per client IP
+func IPRateLimiter(max int, expiration time.Duration) fiber.Handler {
+	return limiter.New(limiter.Config{
+		Max:        max,
+		Expiration: expiration,
+		Next: func(c *fiber.Ctx) bool {
+			_, ok := c.Locals(rateLimitUserIDKey).(int)
+			return ok
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return rateLimitReached(c, "anonymous")
+		},
+	})
+}
+
+// UserRateLimiter limits authenticated requests per user ID, so users
+// sharing an IP don't exhaust each other's quota
+func UserRateLimiter(max int, expiration time.Duration) fiber.Handler {
+	return limiter.New(limiter.Config{
+		Max:        max,
+		Expiration: expiration,
+		Next: func(c *fiber.Ctx) bool {
+			_, ok := c.Locals(rateLimitUserIDKey).(int)
+			return !ok
+		},
+		KeyGenerator: func(c *fiber.Ctx) string {
+			userID, _ := c.Locals(rateLimitUserIDKey).(int)
+			return "user:" + strconv.Itoa(userID)
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			username, _ := c.Locals(rateLimitUsernameKey).(string)
+			return rateLimitReached(c, logger.HashIdentifier(username))
+		},
+	})
+}
+
+func rateLimitReached(c *fiber.Ctx, userHash string) error {
+	logger.Security("RATE_LIMIT_EXCEEDED", userHash, logger.MaskIP(c.IP()), "Rate limit exceeded")
+	return c.Status(429).JSON(fiber.Map{
+		"error":   true,
+		"message": "Too many requests. Please try again later.",
+	})
+}
@@ -1,10 +1,14 @@
 package middleware
 
 import (
+	"encoding/json"
+	"regexp"
 	"strings"
+	apperrors "tunetudo/errors"
 	"tunetudo/logger"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
 )
 
 // SecurityLogger logs security-relevant events with PII protection
@@ -86,6 +90,25 @@ func ErrorHandler(c *fiber.Ctx, err error) error {
 	message := "An internal error occurred"
 	errorCode := "INTERNAL_ERROR"
 	
+	// Service errors carry their own safe message, code and status
+	if appErr := apperrors.GetAppError(err); appErr != nil {
+		if appErr.StatusCode >= 500 && appErr.Internal != nil {
+			logger.Error(logger.CategoryAPI, "Request failed", appErr.Internal)
+		}
+		logger.Debug(logger.CategoryAPI, "Error details: method=%s path=%s ip=%s status=%d code=%s",
+			c.Method(), sanitizeResourcePath(c.Path()), logger.MaskIP(c.IP()), appErr.StatusCode, appErr.Code)
+
+		body := fiber.Map{
+			"error":   true,
+			"code":    appErr.Code,
+			"message": appErr.Message,
+		}
+		if len(appErr.Fields) > 0 {
+			body["data"] = fiber.Map{"fields": appErr.Fields}
+		}
+		return c.Status(appErr.StatusCode).JSON(body)
+	}
+
 	// Extract fiber error
 	if e, ok := err.(*fiber.Error); ok {
 		code = e.Code
@@ -147,7 +170,15 @@ func sanitizeResourcePath(resource string) string {
 
 // RequestValidator validates common request parameters
 // "Appropriately filter or quote CRLF sequences in user-controlled input"
-func RequestValidator() fiber.Handler {
+// Values in allowlist (compared case-insensitively as whole inputs) are never
+// flagged, for legitimate titles that happen to look like a payload. Bodies
+// may be up to uploadBodyLimit bytes on upload routes and jsonBodyLimit
+// everywhere else, and larger ones get 413. The server refuses those
+// before reading them through RequestBodyLimit; this check covers handlers
+// run without that hook
+func RequestValidator(jsonBodyLimit, uploadBodyLimit int64, allowlist ...string) fiber.Handler {
+	isSuspicious := newPatternDetector(allowlist)
+
 	return func(c *fiber.Ctx) error {
 		username := c.Locals("username")
 		userStr := "anonymous"
@@ -155,12 +186,20 @@ func RequestValidator() fiber.Handler {
 			userStr = username.(string)
 		}
 		
+		if bodyTooLarge(c, jsonBodyLimit, uploadBodyLimit) {
+			logger.ValidationFailure(userStr, c.IP(), "body", "Request body too large")
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+				"error":   true,
+				"message": "Request body too large",
+			})
+		}
+
 		// Check for suspicious patterns in query parameters
 		queries := c.Queries()
 		for _, value := range queries {
 			// Remove CRLF to prevent log injection
 			cleanValue := logger.RemoveCarriageReturns(value)
-			if containsSuspiciousPattern(cleanValue) {
+			if isSuspicious(cleanValue) {
 				// Log without exposing the actual suspicious value
 				logger.ValidationFailure(userStr, c.IP(), cleanValue, "Suspicious pattern detected")
 				return c.Status(400).JSON(fiber.Map{
@@ -179,45 +218,242 @@ func RequestValidator() fiber.Handler {
 			}
 		}
 		
-		// Validate body size is reasonable
-		if len(c.Body()) > 50*1024*1024 { 
-			if !strings.Contains(c.Path(), "/upload") {
-				logger.ValidationFailure(userStr, c.IP(), "body", "Request body too large")
-				return c.Status(413).JSON(fiber.Map{
-					"error":   true,
-					"message": "Request body too large",
-				})
+		// Apply the same checks to string fields in the request body
+		if field, reason := inspectBody(c, isSuspicious); reason != "" {
+			// Log the field name only - the value may be the payload itself
+			logger.ValidationFailure(userStr, c.IP(), field, reason)
+			message := "Invalid input detected"
+			if reason == bodyReasonTooLong {
+				message = "Input exceeds maximum length"
 			}
+			return c.Status(400).JSON(fiber.Map{
+				"error":   true,
+				"message": message,
+			})
 		}
-		
+
+		return c.Next()
+	}
+}
+
+// bodyTooLarge checks the body against the limit for the request's route.
+// Uploads go by the declared length so the file is never buffered here
+// (Fiber's BodyLimit still bounds chunked ones); other chunked requests
+// declare no length, so their already-read body is measured
+func bodyTooLarge(c *fiber.Ctx, jsonBodyLimit, uploadBodyLimit int64) bool {
+	length := int64(c.Request().Header.ContentLength())
+	if multipartRoutes[strings.ToLower(strings.TrimSuffix(c.Path(), "/"))] {
+		return length > uploadBodyLimit
+	}
+	if length < 0 {
+		length = int64(len(c.Request().Body()))
+	}
+	return length > jsonBodyLimit
+}
+
+// RequestBodyLimit is a fasthttp HeaderReceived hook applying the same
+// per-route limits as RequestValidator while the headers are all that has
+// been read. A body declaring a larger Content-Length is refused with 413
+// without reading any of it, and a chunked one once it passes the limit
+func RequestBodyLimit(jsonBodyLimit, uploadBodyLimit int64) func(*fasthttp.RequestHeader) fasthttp.RequestConfig {
+	return func(header *fasthttp.RequestHeader) fasthttp.RequestConfig {
+		// Parse the URI like the router does, so encoded or dotted paths
+		// can't pick up the upload limit
+		uri := fasthttp.AcquireURI()
+		defer fasthttp.ReleaseURI(uri)
+		limit := jsonBodyLimit
+		if uri.Parse(nil, header.RequestURI()) == nil &&
+			multipartRoutes[strings.ToLower(strings.TrimSuffix(string(uri.Path()), "/"))] {
+			limit = uploadBodyLimit
+		}
+		return fasthttp.RequestConfig{MaxRequestBodySize: int(limit)}
+	}
+}
+
+// multipartRoutes are the upload endpoints that take multipart/form-data
+// instead of JSON. Lookups use the lowercased path since routing is case-insensitive
+var multipartRoutes = map[string]bool{
+	"/api/upload":           true,
+	"/api/upload/chunk":     true,
+	"/api/profile/picture":  true,
+	"/api/admin/songs":      true,
+	"/api/admin/songs/bulk": true,
+}
+
+// ContentTypeValidator rejects POST/PUT/PATCH API requests whose body is not
+// sent as application/json (or multipart/form-data on upload routes) with 415,
+// instead of letting BodyParser fail with a vague "invalid request data".
+// Requests without a body are left to the handler
+func ContentTypeValidator() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		switch c.Method() {
+		case fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch:
+		default:
+			return c.Next()
+		}
+
+		path := strings.ToLower(strings.TrimSuffix(c.Path(), "/"))
+		if !strings.HasPrefix(path, "/api/") || !hasRequestBody(c) {
+			return c.Next()
+		}
+
+		expected := fiber.MIMEApplicationJSON
+		if multipartRoutes[path] {
+			expected = fiber.MIMEMultipartForm
+		}
+
+		mediaType := strings.ToLower(strings.TrimSpace(strings.Split(c.Get(fiber.HeaderContentType), ";")[0]))
+		if mediaType != expected {
+			userStr := "anonymous"
+			if username, ok := c.Locals("username").(string); ok {
+				userStr = username
+			}
+			logger.ValidationFailure(userStr, c.IP(), "content_type", "Unsupported content type")
+			return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{
+				"error":   true,
+				"message": "Content-Type must be " + expected,
+			})
+		}
+
 		return c.Next()
 	}
 }
 
+const (
+	maxBodyFieldLength   = 1000
+	bodyReasonSuspicious = "Suspicious pattern detected"
+	bodyReasonTooLong    = "Input too long"
+)
+
+// inspectBody checks the string fields of a JSON or multipart body and
+// returns the offending field name and reason, or an empty reason if the body
+// is clean. Secrets are skipped: they are hashed or compared, never echoed
+// back into pages or queries, and users must be free to pick any characters.
+// Multipart bodies are read through the parsed form only: calling c.Body()
+// on one re-serializes every uploaded file into memory
+func inspectBody(c *fiber.Ctx, isSuspicious func(string) bool) (string, string) {
+	if !hasRequestBody(c) {
+		return "", ""
+	}
+
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(c.Get(fiber.HeaderContentType), ";")[0]))
+	switch mediaType {
+	case fiber.MIMEApplicationJSON:
+		var parsed interface{}
+		if err := json.Unmarshal(c.Body(), &parsed); err != nil {
+			// Malformed JSON is reported by the handler's BodyParser
+			return "", ""
+		}
+		return inspectBodyValue("body", parsed, isSuspicious)
+	case fiber.MIMEMultipartForm:
+		form, err := c.MultipartForm()
+		if err != nil {
+			return "", ""
+		}
+		for name, values := range form.Value {
+			for _, value := range values {
+				if field, reason := inspectBodyValue(name, value, isSuspicious); reason != "" {
+					return field, reason
+				}
+			}
+		}
+	}
+	return "", ""
+}
+
+// hasRequestBody reports whether the request declares a body, from the method
+// and Content-Length header rather than by reading it. Chunked bodies (-1)
+// count as present
+func hasRequestBody(c *fiber.Ctx) bool {
+	switch c.Method() {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		return false
+	}
+	return c.Request().Header.ContentLength() != 0
+}
+
+// inspectBodyValue walks a decoded JSON value, checking every string in it
+func inspectBodyValue(field string, value interface{}, isSuspicious func(string) bool) (string, string) {
+	switch v := value.(type) {
+	case string:
+		if isSecretField(field) {
+			return "", ""
+		}
+		cleanValue := logger.RemoveCarriageReturns(v)
+		if len(cleanValue) > maxBodyFieldLength {
+			return field, bodyReasonTooLong
+		}
+		if isSuspicious(cleanValue) {
+			return field, bodyReasonSuspicious
+		}
+	case map[string]interface{}:
+		for key, nested := range v {
+			if name, reason := inspectBodyValue(key, nested, isSuspicious); reason != "" {
+				return name, reason
+			}
+		}
+	case []interface{}:
+		for _, nested := range v {
+			if name, reason := inspectBodyValue(field, nested, isSuspicious); reason != "" {
+				return name, reason
+			}
+		}
+	}
+	return "", ""
+}
+
+// isSecretField reports whether a body field carries a password or token
+func isSecretField(field string) bool {
+	field = strings.ToLower(field)
+	return strings.Contains(field, "password") || field == "token"
+}
+
+// suspiciousPatterns match injection payloads rather than keywords, so a band
+// called "Update" or a song "Union Selection" passes. Queries are
+// parameterized, so this layer favours precision over blanket blocking
+var suspiciousPatterns = []*regexp.Regexp{
+	// SQL: statement shapes, not bare keywords
+	regexp.MustCompile(`(?i)\bunion\s+(all\s+)?select\b`),
+	regexp.MustCompile(`(?i)\bdrop\s+(table|database|index|view)\b`),
+	regexp.MustCompile(`(?i)\bdelete\s+from\s+\w+\s*(where\b|;|$)`),
+	regexp.MustCompile(`(?i)\binsert\s+into\s+\w+\s*(\(|values\b|select\b)`),
+	regexp.MustCompile(`(?i)\bupdate\s+\w+\s+set\b`),
+	regexp.MustCompile(`(?i);\s*(select|drop|delete|insert|update|alter|create)\b`),
+	regexp.MustCompile(`(?i)\b(or|and)\s+('[^']*'|"[^"]*"|\d+)\s*=\s*('[^']*|"[^"]*|\d+)`),
+	regexp.MustCompile(`['"]\s*;?\s*(--|/\*)`),
+
+	// XSS: markup and script contexts, not words like "javascript"
+	regexp.MustCompile(`(?i)<\s*/?\s*(script|iframe|object|embed)\b`),
+	regexp.MustCompile(`(?i)<[^>]*\bon[a-z]+\s*=`),
+	regexp.MustCompile(`(?i)(^|["'=(])\s*(javascript|vbscript)\s*:`),
+
+	// Path traversal
+	regexp.MustCompile(`\.\.[/\\]`),
+}
+
+// newPatternDetector returns a check that flags suspicious input unless the
+// whole value is on the allowlist
+func newPatternDetector(allowlist []string) func(string) bool {
+	allowed := make(map[string]bool, len(allowlist))
+	for _, value := range allowlist {
+		allowed[strings.ToLower(strings.TrimSpace(value))] = true
+	}
+
+	return func(input string) bool {
+		if allowed[strings.ToLower(strings.TrimSpace(input))] {
+			return false
+		}
+		return containsSuspiciousPattern(input)
+	}
+}
+
 // containsSuspiciousPattern checks for common injection patterns
 // Does NOT log the actual input value - only the pattern type
 func containsSuspiciousPattern(input string) bool {
-	suspicious := []string{
-		"<script",
-		"javascript:",
-		"onerror=",
-		"onclick=",
-		"../",
-		"..\\",
-		"DROP TABLE",
-		"DELETE FROM",
-		"INSERT INTO",
-		"UPDATE ",
-		"UNION SELECT",
-		"'; --",
-		"OR 1=1",
-	}
-	
-	lowerInput := strings.ToLower(input)
-	for _, pattern := range suspicious {
-		if strings.Contains(lowerInput, strings.ToLower(pattern)) {
+	for _, pattern := range suspiciousPatterns {
+		if pattern.MatchString(input) {
 			return true
 		}
 	}
 	return false
-}
\ No newline at end of file
+}
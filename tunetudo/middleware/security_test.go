@@ -0,0 +1,202 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestContainsSuspiciousPattern(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		suspicious bool
+	}{
+		// Legitimate music queries
+		{"band named Update", "Update", false},
+		{"update in a sentence", "Update your playlist", false},
+		{"song Union Selection", "Union Selection", false},
+		{"select in a title", "Select Your Favourite", false},
+		{"drop in a title", "Drop the Beat", false},
+		{"delete in a title", "Delete From Memory Lane", false},
+		{"slash in band name", "AC/DC", false},
+		{"apostrophe", "Guns N' Roses", false},
+		{"ampersand and dash", "Simon & Garfunkel - Live", false},
+		{"or in a title", "Now or Never", false},
+		{"javascript as a word", "Learn javascript: the album", false},
+		{"less-than in text", "<3 love songs", false},
+		{"ellipsis", "Wait... What", false},
+
+		// Real payloads
+		{"union select", "x' UNION SELECT password_hash FROM users", true},
+		{"union all select", "1 union all select null", true},
+		{"drop table", "'; DROP TABLE users; --", true},
+		{"stacked query", "abc; delete from songs", true},
+		{"delete where", "delete from songs where 1", true},
+		{"insert into", "INSERT INTO users VALUES (1)", true},
+		{"update set", "update users set is_admin = 1", true},
+		{"numeric tautology", "x OR 1=1", true},
+		{"string tautology", "x' or 'a'='a", true},
+		{"quote comment", "admin'--", true},
+		{"script tag", "<script>alert(1)</script>", true},
+		{"script tag with spaces", "< SCRIPT src=x>", true},
+		{"event handler", `<img src=x onerror=alert(1)>`, true},
+		{"javascript url", "javascript:alert(1)", true},
+		{"javascript in attribute", `href="javascript:alert(1)"`, true},
+		{"iframe", "<iframe src=evil>", true},
+		{"path traversal", "../../etc/passwd", true},
+		{"windows path traversal", `..\windows\system32`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.suspicious, containsSuspiciousPattern(tt.input))
+		})
+	}
+}
+
+func TestPatternDetectorAllowlist(t *testing.T) {
+	isSuspicious := newPatternDetector([]string{"  Drop Table Blues  "})
+
+	assert.False(t, isSuspicious("drop table blues"), "allowlisted value passes")
+	assert.True(t, isSuspicious("drop table users"), "other payloads are still caught")
+	assert.True(t, isSuspicious("Drop Table Blues; delete from songs"), "allowlist matches whole values only")
+}
+
+// uploadRequest builds a raw multipart upload of size bytes with a title field
+func uploadRequest(t testing.TB, title string, size int) []byte {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	require.NoError(t, writer.WriteField("title", title))
+	part, err := writer.CreateFormFile("file", "song.mp3")
+	require.NoError(t, err)
+	_, err = part.Write(bytes.Repeat([]byte{0xAB}, size))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	header := fmt.Sprintf("POST /api/upload HTTP/1.1\r\nHost: localhost\r\nContent-Type: %s\r\nContent-Length: %d\r\n\r\n",
+		writer.FormDataContentType(), body.Len())
+	return append([]byte(header), body.Bytes()...)
+}
+
+// readUpload parses raw into ctx the way the server does, leaving the
+// multipart form pre-parsed and the raw body unset
+func readUpload(t testing.TB, ctx *fasthttp.RequestCtx, raw []byte) {
+	ctx.Request.Reset()
+	require.NoError(t, ctx.Request.Read(bufio.NewReader(bytes.NewReader(raw))))
+}
+
+func newValidatedUploadApp() *fiber.App {
+	app := fiber.New()
+	app.Use(RequestValidator(1024*1024, 50*1024*1024), ContentTypeValidator())
+	app.Post("/api/upload", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusCreated)
+	})
+	return app
+}
+
+func TestRequestValidatorDoesNotBufferUploads(t *testing.T) {
+	const fileSize = 8 << 20
+	handler := newValidatedUploadApp().Handler()
+
+	var ctx fasthttp.RequestCtx
+	readUpload(t, &ctx, uploadRequest(t, "Clean Title", fileSize))
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	handler(&ctx)
+	runtime.ReadMemStats(&after)
+
+	assert.Equal(t, fiber.StatusCreated, ctx.Response.StatusCode())
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(fileSize/4),
+		"validating an upload must not copy the file into memory")
+
+	t.Run("form fields are still inspected", func(t *testing.T) {
+		readUpload(t, &ctx, uploadRequest(t, "<script>alert(1)</script>", 1024))
+		handler(&ctx)
+		assert.Equal(t, fiber.StatusBadRequest, ctx.Response.StatusCode())
+	})
+}
+
+func BenchmarkRequestValidatorUpload(b *testing.B) {
+	handler := newValidatedUploadApp().Handler()
+	raw := uploadRequest(b, "Clean Title", 4<<20)
+	var ctx fasthttp.RequestCtx
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		readUpload(b, &ctx, raw)
+		b.StartTimer()
+		handler(&ctx)
+	}
+}
+
+func TestRequestValidatorBodyLimits(t *testing.T) {
+	handled := false
+	app := fiber.New()
+	app.Use(RequestValidator(1024, 64*1024))
+	app.Post("/api/auth/login", func(c *fiber.Ctx) error {
+		handled = true
+		return c.SendStatus(fiber.StatusOK)
+	})
+	app.Post("/api/upload", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusCreated)
+	})
+
+	send := func(raw []byte) int {
+		var ctx fasthttp.RequestCtx
+		readUpload(t, &ctx, raw)
+		app.Handler()(&ctx)
+		return ctx.Response.StatusCode()
+	}
+	login := func(body string) []byte {
+		return []byte(fmt.Sprintf("POST /api/auth/login HTTP/1.1\r\nHost: localhost\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n%s",
+			len(body), body))
+	}
+
+	padded := `{"username":"listener","password":"` + strings.Repeat("x", 2048) + `"}`
+	assert.Equal(t, fiber.StatusRequestEntityTooLarge, send(login(padded)))
+	assert.False(t, handled, "an oversized body never reaches the handler")
+
+	assert.Equal(t, fiber.StatusOK, send(login(`{"username":"listener","password":"Passw0rd-123"}`)))
+	assert.True(t, handled)
+
+	t.Run("chunked bodies are measured", func(t *testing.T) {
+		handled = false
+		raw := "POST /api/auth/login HTTP/1.1\r\nHost: localhost\r\nContent-Type: application/json\r\nTransfer-Encoding: chunked\r\n\r\n" +
+			fmt.Sprintf("%x\r\n%s\r\n0\r\n\r\n", len(padded), padded)
+		assert.Equal(t, fiber.StatusRequestEntityTooLarge, send([]byte(raw)))
+		assert.False(t, handled)
+	})
+
+	t.Run("uploads get the larger limit", func(t *testing.T) {
+		assert.Equal(t, fiber.StatusCreated, send(uploadRequest(t, "Clean Title", 32*1024)))
+		assert.Equal(t, fiber.StatusRequestEntityTooLarge, send(uploadRequest(t, "Clean Title", 128*1024)))
+	})
+}
+
+func TestRequestBodyLimit(t *testing.T) {
+	limit := RequestBodyLimit(1024, 64*1024)
+	bodyLimit := func(uri string) int {
+		var header fasthttp.RequestHeader
+		header.SetMethod(fiber.MethodPost)
+		header.SetRequestURI(uri)
+		return limit(&header).MaxRequestBodySize
+	}
+
+	assert.Equal(t, 1024, bodyLimit("/api/auth/login"))
+	assert.Equal(t, 64*1024, bodyLimit("/api/upload"))
+	assert.Equal(t, 64*1024, bodyLimit("/API/Upload/?draft=1"), "routing ignores case and trailing slashes")
+	assert.Equal(t, 1024, bodyLimit("/api/upload/../auth/login"), "the path is cleaned like the router's")
+}
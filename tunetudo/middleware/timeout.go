@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// longRunningRoutes are exempt from the request timeout because they move
+// whole files: uploads, upload assembly and database backups
+var longRunningRoutes = map[string]bool{
+	"/api/upload/complete": true,
+	"/api/admin/backup":    true,
+}
+
+// longRunningPattern matches song streams and playlist WebSocket upgrades
+var longRunningPattern = regexp.MustCompile(`^/api/(songs/[^/]+/stream|playlists/[^/]+/ws)$`)
+
+const requestTimeoutBody = `{"error":true,"message":"request timed out"}`
+
+// RequestTimeout wraps the server's handler so a request still unanswered
+// after timeout gets a 503 and frees its connection. The handler keeps
+// running in the background; fasthttp leaves its context alone until it
+// returns. Streams, media under /storage and upload routes are exempt.
+// A zero timeout leaves the handler unwrapped
+func RequestTimeout(handler fasthttp.RequestHandler, timeout time.Duration) fasthttp.RequestHandler {
+	if timeout <= 0 {
+		return handler
+	}
+
+	return func(ctx *fasthttp.RequestCtx) {
+		if isLongRunning(string(ctx.Path())) {
+			handler(ctx)
+			return
+		}
+
+		done := make(chan struct{})
+		go func() {
+			handler(ctx)
+			close(done)
+		}()
+
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-done:
+		case <-timer.C:
+			var resp fasthttp.Response
+			resp.SetStatusCode(fiber.StatusServiceUnavailable)
+			resp.Header.SetContentType(fiber.MIMEApplicationJSON)
+			resp.SetBodyString(requestTimeoutBody)
+			ctx.TimeoutErrorWithResponse(&resp)
+		}
+	}
+}
+
+func isLongRunning(path string) bool {
+	// Routing is case-insensitive and ignores a trailing slash
+	path = strings.ToLower(strings.TrimSuffix(path, "/"))
+	return multipartRoutes[path] || longRunningRoutes[path] ||
+		strings.HasPrefix(path, "/storage/") || longRunningPattern.MatchString(path)
+}
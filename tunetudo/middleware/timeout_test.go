@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTimeoutApp(timeout, handlerDelay time.Duration) *fiber.App {
+	app := fiber.New()
+	slow := func(c *fiber.Ctx) error {
+		time.Sleep(handlerDelay)
+		return c.SendString("finished")
+	}
+	app.Get("/api/slow", slow)
+	app.Get("/api/songs/:id/stream", slow)
+	app.Post("/api/upload", slow)
+
+	app.Server().Handler = RequestTimeout(app.Handler(), timeout)
+	return app
+}
+
+func TestRequestTimeout(t *testing.T) {
+	app := newTimeoutApp(50*time.Millisecond, 300*time.Millisecond)
+
+	start := time.Now()
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/slow", nil), -1)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, fiber.MIMEApplicationJSON, resp.Header.Get("Content-Type"))
+	body, _ := io.ReadAll(resp.Body)
+	assert.JSONEq(t, `{"error":true,"message":"request timed out"}`, string(body))
+	assert.Less(t, time.Since(start), 250*time.Millisecond, "the client isn't kept waiting for the handler")
+
+	// Routes that legitimately run long are left alone
+	for _, req := range []struct{ method, path string }{
+		{"GET", "/api/songs/7/stream"},
+		{"GET", "/API/Songs/7/Stream/"},
+		{"POST", "/api/upload"},
+	} {
+		resp, err := app.Test(httptest.NewRequest(req.method, req.path, nil), -1)
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusOK, resp.StatusCode, req.path)
+	}
+}
+
+func TestRequestTimeoutPassesFastRequests(t *testing.T) {
+	app := newTimeoutApp(time.Second, 0)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/slow", nil), -1)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "finished", string(body))
+}
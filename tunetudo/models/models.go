@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 )
 
@@ -11,7 +12,13 @@ type User struct {
 	Email            string    `json:"email"`
 	PasswordHash     string    `json:"-"`
 	IsAdmin          bool      `json:"is_admin"`
+	Suspended        bool      `json:"suspended"`
 	ProfileImagePath *string   `json:"profile_image_path"`
+	// Square copies for smaller avatars; the original when there are none
+	ProfileImageMediumPath *string `json:"profile_image_medium_path,omitempty"`
+	ProfileImageThumbPath  *string `json:"profile_image_thumb_path,omitempty"`
+	ShareNowPlaying  bool      `json:"share_now_playing"` // lets other users see what they stream
+	SafeMode         bool      `json:"safe_mode"`         // hides explicit content from listings
 	CreatedAt        time.Time `json:"created_at"`
 	LastLogin        *time.Time `json:"last_login"`
 }
@@ -22,6 +29,26 @@ type Artist struct {
 	Name        string    `json:"name"`
 	Description *string   `json:"description"`
 	CreatedAt   time.Time `json:"created_at"`
+	SongCount   int       `json:"song_count,omitempty"` // catalog songs, set when browsing
+}
+
+// NormalizeArtistName trims an artist name and collapses runs of
+// whitespace, giving the form stored for display
+func NormalizeArtistName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// ArtistNameKey is the form artist names are matched on, so "The Beatles",
+// "the  beatles " and "Beatles, The" all resolve to the same artist
+func ArtistNameKey(name string) string {
+	key := strings.ToLower(NormalizeArtistName(name))
+	if trimmed := strings.TrimSuffix(key, ", the"); trimmed != key && trimmed != "" {
+		return trimmed
+	}
+	if trimmed := strings.TrimPrefix(key, "the "); trimmed != "" {
+		return trimmed
+	}
+	return key
 }
 
 // Album represents a music album
@@ -32,6 +59,8 @@ type Album struct {
 	CoverImagePath *string   `json:"cover_image_path"`
 	ReleaseDate    *string   `json:"release_date"`
 	Artist         *Artist   `json:"artist,omitempty"`
+	SongCount      int       `json:"song_count,omitempty"` // catalog songs, set when browsing
+	Songs          []Song    `json:"songs,omitempty"`      // set on album detail, in track order
 }
 
 // Category represents a genre/category
@@ -39,6 +68,7 @@ type Category struct {
 	ID          int     `json:"id"`
 	Name        string  `json:"name"`
 	Description *string `json:"description"`
+	Explicit    bool    `json:"explicit"` // hidden, with its songs, in safe mode
 }
 
 // Song represents a music track
@@ -49,7 +79,9 @@ type Song struct {
 	AlbumID          *int      `json:"album_id"`
 	CategoryID       *int      `json:"category_id"`
 	DurationSeconds  int       `json:"duration_seconds"`
-	FilePath         string    `json:"file_path"`
+	TrackNumber      *int      `json:"track_number,omitempty"`
+	DiscNumber       *int      `json:"disc_number,omitempty"`
+	FilePath         string    `json:"-"` // served only through signed stream URLs
 	Format           string    `json:"format"`
 	UploadedByUserID *int      `json:"uploaded_by_user_id"`
 	CreatedAt        time.Time `json:"created_at"`
@@ -64,11 +96,69 @@ type Playlist struct {
 	UserID      int       `json:"user_id"`
 	Name        string    `json:"name"`
 	Description *string   `json:"description"`
+	IsPublic    bool      `json:"is_public"`
 	CreatedAt   time.Time `json:"created_at"`
-	SongCount   int       `json:"song_count,omitempty"`
+	// Version goes up with every change to the playlist or its songs
+	Version   int `json:"version"`
+	SongCount int `json:"song_count"`
+	// TotalDurationSeconds sums the known durations of the playlist's songs
+	TotalDurationSeconds int `json:"total_duration_seconds"`
+}
+
+// Collaborator roles on a playlist
+const (
+	CollaboratorRoleEditor = "editor"
+	CollaboratorRoleViewer = "viewer"
+)
+
+// PlaylistCollaborator is a user who was invited to a playlist
+type PlaylistCollaborator struct {
+	PlaylistID int       `json:"playlist_id"`
+	UserID     int       `json:"user_id"`
+	Username   string    `json:"username"`
+	Role       string    `json:"role"`
+	AddedAt    time.Time `json:"added_at"`
+}
+
+// Playlist event types pushed to subscribers of a playlist. "subscribed"
+// is sent once when a listener is attached, so clients know to refetch the
+// playlist and then apply later events on top
+const (
+	PlaylistEventSubscribed          = "subscribed"
+	PlaylistEventSongAdded           = "song_added"
+	PlaylistEventSongRemoved         = "song_removed"
+	PlaylistEventSongsReordered      = "songs_reordered"
+	PlaylistEventCleared             = "playlist_cleared"
+	PlaylistEventUpdated             = "playlist_updated"
+	PlaylistEventCollaboratorRemoved = "collaborator_removed"
+	PlaylistEventDeleted             = "playlist_deleted"
+)
+
+// PlaylistEvent describes a change to a playlist. SongID is set for song
+// events, UserID is the user who made the change or, for
+// collaborator_removed, the collaborator who lost access
+type PlaylistEvent struct {
+	Type       string    `json:"type"`
+	PlaylistID int       `json:"playlist_id"`
+	SongID     int       `json:"song_id,omitempty"`
+	UserID     int       `json:"user_id"`
+	At         time.Time `json:"at"`
+}
+
+// AddCollaboratorRequest invites a user to a playlist by username
+type AddCollaboratorRequest struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
 }
 
 // PlaylistSong represents a song in a playlist
+// FeaturedPlaylist is an admin-curated playlist shown to everyone, with
+// its songs in queue order
+type FeaturedPlaylist struct {
+	Playlist
+	Songs []PlaylistSong `json:"songs"`
+}
+
 type PlaylistSong struct {
 	ID          int       `json:"id"`
 	PlaylistID  int       `json:"playlist_id"`
@@ -78,42 +168,340 @@ type PlaylistSong struct {
 	Song        *Song     `json:"song,omitempty"`
 }
 
+// BatchAddResult reports which songs a batch add put in the playlist and
+// why the others were left out
+type BatchAddResult struct {
+	Added   []int         `json:"added"`
+	Skipped []SkippedSong `json:"skipped"`
+}
+
+// SkippedSong is a song a batch add did not add
+type SkippedSong struct {
+	SongID int    `json:"song_id"`
+	Reason string `json:"reason"`
+}
+
+// PlaybackQueue is the ordered, playable contents of a playlist. Next and
+// Previous are only set when the client says which song is playing
+type PlaybackQueue struct {
+	PlaylistID int    `json:"playlist_id"`
+	Songs      []Song `json:"songs"`
+	Next       *Song  `json:"next,omitempty"`
+	Previous   *Song  `json:"previous,omitempty"`
+}
+
+// PlaybackPosition is where a user last stopped in a song
+type PlaybackPosition struct {
+	SongID          int        `json:"song_id"`
+	PositionSeconds int        `json:"position_seconds"`
+	UpdatedAt       *time.Time `json:"updated_at"`
+}
+
+// UserStats summarises a user's listening and library. The top artist and
+// category go by play count and are null until the user has played a song
+type UserStats struct {
+	TotalPlays            int       `json:"total_plays"`
+	TotalListeningSeconds int       `json:"total_listening_seconds"`
+	TopArtist             *Artist   `json:"top_artist"`
+	TopArtistPlays        int       `json:"top_artist_plays"`
+	TopCategory           *Category `json:"top_category"`
+	TopCategoryPlays      int       `json:"top_category_plays"`
+	PlaylistCount         int       `json:"playlist_count"`
+	UploadCount           int       `json:"upload_count"`
+}
+
+// Analytics summarises site activity over a date range for admins
+type Analytics struct {
+	From             time.Time    `json:"from"`
+	To               time.Time    `json:"to"`
+	TopSongs         []SongPlays  `json:"top_songs"`
+	DailyActiveUsers []DailyCount `json:"daily_active_users"`
+	Registrations    []DailyCount `json:"registrations"`
+	Uploads          []DailyCount `json:"uploads"`
+}
+
+// SongPlays is a song with how often it was played
+type SongPlays struct {
+	Song  Song `json:"song"`
+	Plays int  `json:"plays"`
+}
+
+// DailyCount is a count for one UTC day, formatted YYYY-MM-DD
+type DailyCount struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+// RecentArtist is an artist from a user's play history
+type RecentArtist struct {
+	Artist
+	LastPlayedAt time.Time `json:"last_played_at"`
+}
+
+// RecentAlbum is an album from a user's play history
+type RecentAlbum struct {
+	Album
+	LastPlayedAt time.Time `json:"last_played_at"`
+}
+
+// NowPlaying is the song a user is currently streaming
+type NowPlaying struct {
+	Song      *Song     `json:"song"`
+	UpdatedAt time.Time `json:"updated_at"` // last stream request for the song
+}
+
+// Session is a signed-in device. Its token stops working once it is revoked
+type Session struct {
+	ID        int       `json:"id"`
+	IPAddress string    `json:"ip_address"` // masked when recorded
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	Current   bool      `json:"current"` // the session making the request
+}
+
+// SavePositionRequest represents a resume position update
+type SavePositionRequest struct {
+	PositionSeconds int `json:"position_seconds"`
+}
+
 // Upload represents a user file upload
 type Upload struct {
 	ID               int       `json:"id"`
 	UserID           int       `json:"user_id"`
+	SongID           int       `json:"song_id,omitempty"` // song created for this upload
 	OriginalFilename string    `json:"original_filename"`
 	StoredPath       string    `json:"stored_path"`
 	FileSizeBytes    int64     `json:"file_size_bytes"`
 	ErrorMessage     *string   `json:"error_message"`
+	TranscodeStatus  *string   `json:"transcode_status,omitempty"` // nil when no conversion was needed
 	CreatedAt        time.Time `json:"created_at"`
 }
 
+// BulkSongMetadata is the optional sidecar "<name>.json" describing an
+// audio file in a bulk upload archive
+type BulkSongMetadata struct {
+	Title       string `json:"title"`
+	Artist      string `json:"artist"`
+	Album       string `json:"album"`
+	CategoryID  int    `json:"category_id"`
+	Duration    int    `json:"duration"`
+	TrackNumber int    `json:"track_number"`
+	DiscNumber  int    `json:"disc_number"`
+}
+
+// BulkResult reports what happened to one file of a bulk upload
+type BulkResult struct {
+	File    string `json:"file"`
+	Success bool   `json:"success"`
+	SongID  int    `json:"song_id,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// IdempotentResponse is the response replayed for a repeated Idempotency-Key
+type IdempotentResponse struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// UserExport is everything a user can take with them: their profile, the
+// playlists they own with their songs, their uploads and resume positions
+type UserExport struct {
+	ExportedAt        time.Time          `json:"exported_at"`
+	Profile           User               `json:"profile"`
+	Playlists         []ExportedPlaylist `json:"playlists"`
+	Uploads           []Upload           `json:"uploads"`
+	PlaybackPositions []PlaybackPosition `json:"playback_positions"`
+}
+
+// ExportedPlaylist is an owned playlist with its songs in queue order
+type ExportedPlaylist struct {
+	Playlist
+	Songs []PlaylistSong `json:"songs"`
+}
+
+// UploadSession tracks an in-progress chunked upload
+type UploadSession struct {
+	ID             string    `json:"upload_id"`
+	Filename       string    `json:"filename"`
+	TotalSize      int64     `json:"total_size"`
+	TotalChunks    int       `json:"total_chunks"`
+	ChunksReceived int       `json:"chunks_received"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+// AuditEntry represents a recorded security event. Users appear only as hashes
+type AuditEntry struct {
+	ID        int       `json:"id"`
+	EventType string    `json:"event_type"`
+	UserHash  string    `json:"user_hash"`
+	MaskedIP  string    `json:"masked_ip"`
+	Details   string    `json:"details"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PageMeta describes where a page sits in the full result set
+type PageMeta struct {
+	Total   int  `json:"total"`
+	Limit   int  `json:"limit"`
+	Offset  int  `json:"offset"`
+	HasMore bool `json:"has_more"`
+}
+
+// Paginated represents one page of a list response
+type Paginated[T any] struct {
+	Items []T      `json:"items"`
+	Meta  PageMeta `json:"meta"`
+}
+
+// NewPaginated wraps a page of items with its metadata
+func NewPaginated[T any](items []T, total, limit, offset int) *Paginated[T] {
+	if items == nil {
+		items = []T{}
+	}
+	return &Paginated[T]{
+		Items: items,
+		Meta: PageMeta{
+			Total:   total,
+			Limit:   limit,
+			Offset:  offset,
+			HasMore: offset+len(items) < total,
+		},
+	}
+}
+
 // SearchResult represents combined search results
 type SearchResult struct {
-	Songs     []Song     `json:"songs"`
-	Artists   []Artist   `json:"artists"`
-	Albums    []Album    `json:"albums"`
-	Playlists []Playlist `json:"playlists"`
+	Songs     *Paginated[Song] `json:"songs"`
+	Artists   []Artist         `json:"artists"`
+	Albums    []Album          `json:"albums"`
+	Playlists []Playlist       `json:"playlists"`
 }
 
 // LoginRequest represents login credentials
 type LoginRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	UserAgent string `json:"-"` // recorded on the session, taken from the request headers
 }
 
 // RegisterRequest represents registration data
 type RegisterRequest struct {
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Username     string `json:"username"`
+	Email        string `json:"email"`
+	Password     string `json:"password"`
+	CaptchaToken string `json:"captcha_token"` // required when a CAPTCHA is configured
 }
 
 // CreatePlaylistRequest represents playlist creation data
 type CreatePlaylistRequest struct {
 	Name        string  `json:"name"`
 	Description *string `json:"description"`
+	IsPublic    bool    `json:"is_public"`
+}
+
+// UpdatePlaylistRequest changes the fields that are set. Version is the
+// playlist version the client last read; the update is refused with 409 if
+// the playlist has changed since
+type UpdatePlaylistRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	IsPublic    *bool   `json:"is_public"`
+	Version     int     `json:"version"`
+}
+
+// ReorderSongsRequest lists every song in the playlist in its new order,
+// with the playlist version the order was based on
+type ReorderSongsRequest struct {
+	SongIDs []int `json:"song_ids"`
+	Version int   `json:"version"`
+}
+
+// MoveSongRequest names the playlist a song is moved to
+type MoveSongRequest struct {
+	ToPlaylistID int `json:"to_playlist_id"`
+}
+
+// ClonePlaylistRequest names the copy; empty means derive it from the source
+type ClonePlaylistRequest struct {
+	Name string `json:"name"`
+}
+
+// Permissions is what the signed-in user may do, read from their account
+// rather than their token so role changes show up straight away
+type Permissions struct {
+	IsAdmin       bool     `json:"is_admin"`
+	EmailVerified bool     `json:"email_verified"`
+	Suspended     bool     `json:"suspended"`
+	Features      []string `json:"features"`
+}
+
+// UpdateUserRequest changes a user's role or suspension; omitted fields are left alone
+type UpdateUserRequest struct {
+	IsAdmin   *bool `json:"is_admin"`
+	Suspended *bool `json:"suspended"`
+}
+
+// BulkDeleteRequest lists the songs an admin is deleting at once
+type BulkDeleteRequest struct {
+	IDs []int `json:"ids"`
+}
+
+// SetMaintenanceRequest turns read-only maintenance mode on or off
+type SetMaintenanceRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// SetFeaturedRequest features or unfeatures a playlist
+type SetFeaturedRequest struct {
+	Featured *bool `json:"featured"`
+}
+
+// UpdateSongRequest moves a catalog song on its album or changes whether it
+// is explicit; omitted fields are left alone and 0 clears a number
+type UpdateSongRequest struct {
+	TrackNumber *int  `json:"track_number"`
+	DiscNumber  *int  `json:"disc_number"`
+	Explicit    *bool `json:"explicit"`
+}
+
+// BackupRequest optionally labels a database backup
+type BackupRequest struct {
+	Name string `json:"name"`
+}
+
+// StorageCleanupRequest lists orphaned files, as reported by the storage
+// audit, to delete
+type StorageCleanupRequest struct {
+	Files []string `json:"files"`
+}
+
+// InitUploadRequest starts a chunked upload
+type InitUploadRequest struct {
+	Filename    string `json:"filename"`
+	TotalSize   int64  `json:"total_size"`
+	TotalChunks int    `json:"total_chunks"`
+}
+
+// UpdateProfileRequest changes a user's username, email, now playing
+// visibility and/or safe mode; omitted fields are left alone
+type UpdateProfileRequest struct {
+	Username        *string `json:"username"`
+	Email           *string `json:"email"`
+	ShareNowPlaying *bool   `json:"share_now_playing"`
+	SafeMode        *bool   `json:"safe_mode"`
+}
+
+// DeleteAccountRequest confirms account deletion with the current password
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+// ChangePasswordRequest sets a new password for the logged-in user
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
 }
 
 // PasswordResetRequest represents password reset request
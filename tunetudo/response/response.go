@@ -0,0 +1,42 @@
+// Package response writes the envelope every successful API response uses:
+//
+//	{"error": false, "message": "...", "data": ...}
+//
+// message is present when the helper is given one and data when there is
+// something to return. Failures are returned as errors and written by
+// middleware.ErrorHandler with "error": true instead
+package response
+
+import "github.com/gofiber/fiber/v2"
+
+// Success responds 200 with data
+func Success(c *fiber.Ctx, data interface{}) error {
+	return write(c, fiber.StatusOK, "", data)
+}
+
+// SuccessWithMessage responds 200 with a message describing what was done
+// and data
+func SuccessWithMessage(c *fiber.Ctx, message string, data interface{}) error {
+	return write(c, fiber.StatusOK, message, data)
+}
+
+// Created responds 201 with a message and the created resource
+func Created(c *fiber.Ctx, message string, data interface{}) error {
+	return write(c, fiber.StatusCreated, message, data)
+}
+
+// Message responds 200 with only a message
+func Message(c *fiber.Ctx, message string) error {
+	return write(c, fiber.StatusOK, message, nil)
+}
+
+func write(c *fiber.Ctx, status int, message string, data interface{}) error {
+	body := fiber.Map{"error": false}
+	if message != "" {
+		body["message"] = message
+	}
+	if data != nil {
+		body["data"] = data
+	}
+	return c.Status(status).JSON(body)
+}
@@ -0,0 +1,66 @@
+package response
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// respond runs handler in a test app and returns the status and the raw
+// JSON fields of the body
+func respond(t *testing.T, handler fiber.Handler) (int, map[string]json.RawMessage) {
+	app := fiber.New()
+	app.Get("/", handler)
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	body := map[string]json.RawMessage{}
+	require.NoError(t, json.Unmarshal(raw, &body))
+	return resp.StatusCode, body
+}
+
+func TestSuccessEnvelope(t *testing.T) {
+	status, body := respond(t, func(c *fiber.Ctx) error {
+		return Success(c, []int{})
+	})
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.JSONEq(t, `false`, string(body["error"]))
+	assert.JSONEq(t, `[]`, string(body["data"]), "empty lists stay lists")
+	assert.NotContains(t, body, "message")
+}
+
+func TestSuccessWithMessageEnvelope(t *testing.T) {
+	status, body := respond(t, func(c *fiber.Ctx) error {
+		return SuccessWithMessage(c, "Playlist updated", fiber.Map{"id": 7})
+	})
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.JSONEq(t, `"Playlist updated"`, string(body["message"]))
+	assert.JSONEq(t, `{"id": 7}`, string(body["data"]))
+}
+
+func TestCreatedEnvelope(t *testing.T) {
+	status, body := respond(t, func(c *fiber.Ctx) error {
+		return Created(c, "Playlist created", fiber.Map{"id": 8})
+	})
+	assert.Equal(t, fiber.StatusCreated, status)
+	assert.JSONEq(t, `false`, string(body["error"]))
+	assert.JSONEq(t, `"Playlist created"`, string(body["message"]))
+	assert.JSONEq(t, `{"id": 8}`, string(body["data"]))
+}
+
+func TestMessageEnvelope(t *testing.T) {
+	status, body := respond(t, func(c *fiber.Ctx) error {
+		return Message(c, "Logged out")
+	})
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.JSONEq(t, `"Logged out"`, string(body["message"]))
+	assert.NotContains(t, body, "data")
+}
@@ -2,11 +2,15 @@ package routes
 
 import (
 	"database/sql"
+	"path/filepath"
 	"tunetudo/config"
 	"tunetudo/controllers"
+	"tunetudo/logger"
+	"tunetudo/metrics"
 	"tunetudo/middleware"
 	"tunetudo/services"
 
+	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -15,19 +19,97 @@ func SetupRoutes(app *fiber.App, db *sql.DB) {
 
 	// Initialize services
 	authService := services.NewAuthService(db, cfg.JWTSecret)
+	authService.SetStoragePath(cfg.StoragePath)
+	authService.SetAppBaseURL(cfg.AppBaseURL)
+	authService.SetResetTokenTTL(cfg.ResetTokenTTL)
+	if cfg.SMTPHost != "" {
+		sender, err := services.NewSMTPSender(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUser, cfg.SMTPPass, cfg.FromEmail, cfg.SMTPTLSMode)
+		if err != nil {
+			logger.Error(logger.CategoryAuth, "Password reset emails disabled", err)
+		} else {
+			authService.SetEmailSender(sender)
+		}
+	}
+	authService.SetPasswordPolicy(services.PasswordPolicy{
+		MinLength:     cfg.PasswordMinLength,
+		RequireUpper:  cfg.PasswordRequireUpper,
+		RequireLower:  cfg.PasswordRequireLower,
+		RequireDigit:  cfg.PasswordRequireDigit,
+		RequireSymbol: cfg.PasswordRequireSymbol,
+		RejectCommon:  cfg.PasswordRejectCommon,
+	})
+	authService.SetBcryptCost(cfg.BcryptCost)
+	if cfg.GoogleClientID != "" {
+		google, err := services.NewGoogleOAuth(cfg.GoogleClientID, cfg.GoogleClientSecret, cfg.GoogleRedirectURL)
+		if err != nil {
+			logger.Error(logger.CategoryAuth, "Google sign-in disabled", err)
+		} else {
+			authService.SetGoogleOAuth(google)
+		}
+	}
+	if cfg.CaptchaProvider != "" {
+		verifier, err := services.NewCaptchaVerifier(cfg.CaptchaProvider, cfg.CaptchaSecret)
+		if err != nil {
+			logger.Error(logger.CategoryAuth, "CAPTCHA verification disabled", err)
+		} else {
+			authService.SetCaptchaVerifier(verifier, cfg.CaptchaOnPasswordReset)
+		}
+	}
 	searchService := services.NewSearchService(db)
+	searchService.SetCategoryCacheTTL(cfg.CategoryCacheTTL)
+	searchService.SetQueryLengths(cfg.SearchMinQueryLength, cfg.SearchMaxQueryLength)
+	if err := searchService.SetExplicitCategories(cfg.ExplicitCategories); err != nil {
+		logger.Error(logger.CategoryDB, "Explicit categories not applied", err)
+	}
 	playlistService := services.NewPlaylistService(db)
+	playlistService.SetMaxSongs(cfg.MaxPlaylistSongs)
+	playlistService.SetMaxPlaylists(cfg.MaxPlaylistsPerUser)
 	playbackService := services.NewPlaybackService(db, cfg.StoragePath)
+	playbackService.SetNowPlayingTTL(cfg.NowPlayingTTL)
+	playbackService.SetRequireAuthToStream(cfg.RequireAuthToStream)
+	if cfg.StreamTokenSecret != "" {
+		playbackService.SetStreamSecret(cfg.StreamTokenSecret)
+	} else {
+		playbackService.SetStreamSecret(cfg.JWTSecret)
+	}
+	playlistService.SetStreamExport(playbackService, cfg.AppBaseURL, cfg.StreamTokenTTL)
 	userService := services.NewUserService(db, cfg.StoragePath)
+	userService.SetUploadLimits(cfg.MaxAudioUploadBytes, cfg.MaxImageUploadBytes)
+	if cfg.TranscodeEnabled {
+		transcoder, err := services.NewFFmpegTranscoder(cfg.FFmpegPath, cfg.TranscodeFormat, cfg.TranscodeBitrate, cfg.TranscodeTimeout)
+		if err != nil {
+			logger.Error(logger.CategoryUpload, "Transcoding disabled", err)
+		} else {
+			userService.SetTranscoder(transcoder)
+		}
+	}
 	adminService := services.NewAdminService(db, cfg.StoragePath)
+	adminService.SetBackupPath(cfg.BackupPath)
+	adminService.SetTrashPath(cfg.TrashPath)
+	adminService.SetMaxAudioUploadBytes(cfg.MaxAudioUploadBytes)
+	if cfg.StorageAuditInterval > 0 {
+		adminService.ScheduleStorageAudits(cfg.StorageAuditInterval)
+	}
+	auditService := services.NewAuditService(db)
+	if cfg.AuditRetention > 0 {
+		auditService.ScheduleAuditPurge(cfg.AuditRetention)
+	}
+	idempotencyService := services.NewIdempotencyService(db)
+	idempotencyService.SetTTL(cfg.IdempotencyTTL)
+	chunkedUploadService := services.NewChunkedUploadService(userService, cfg.UploadTempPath)
+	chunkedUploadService.ScheduleCleanup()
 
 	// Initialize controllers
 	authCtrl := controllers.NewAuthController(authService)
 	searchCtrl := controllers.NewSearchController(searchService)
 	playlistCtrl := controllers.NewPlaylistController(playlistService)
-	playbackCtrl := controllers.NewPlaybackController(playbackService)
+	playbackCtrl := controllers.NewPlaybackController(playbackService, cfg.StreamTokenTTL)
 	userCtrl := controllers.NewUserController(userService)
-	adminCtrl := controllers.NewAdminController(adminService)
+	maintenance := middleware.NewMaintenanceMode(cfg.MaintenanceMode, cfg.MaintenanceRetryAfter)
+	adminCtrl := controllers.NewAdminController(adminService, cfg.TrashRetention, maintenance)
+	chunkedUploadCtrl := controllers.NewChunkedUploadController(chunkedUploadService)
+	auditCtrl := controllers.NewAuditController(auditService)
+	metricsCtrl := controllers.NewMetricsController(metrics.Default)
 
 	// Health check - should be first
 	app.Get("/health", func(c *fiber.Ctx) error {
@@ -37,56 +119,149 @@ func SetupRoutes(app *fiber.App, db *sql.DB) {
 		})
 	})
 
+	// Prometheus metrics, only for the configured token or IPs
+	if cfg.MetricsEnabled {
+		app.Get("/metrics", middleware.MetricsAccess(cfg.MetricsToken, cfg.MetricsAllowIPs), metricsCtrl.GetMetrics)
+	}
+
 	// Serve static files - IMPORTANT: This must come before HTML routes
 	app.Static("/static", "./static")
-	app.Static("/storage", "./storage")
+	// Only images are public; audio goes out through signed stream URLs
+	imageDir := filepath.Join(cfg.StoragePath, "images")
+	app.Use("/storage/images", middleware.FileETag("/storage/images", imageDir))
+	app.Static("/storage/images", imageDir, fiber.Static{
+		MaxAge: int(cfg.StorageCacheMaxAge.Seconds()),
+	})
 
-	// API routes
-	api := app.Group("/api")
+	// API routes; maintenance mode blocks writes to all but the admin API
+	api := app.Group("/api", maintenance.Handler())
 
 	// Public routes - Authentication
 	auth := api.Group("/auth")
 	auth.Post("/register", authCtrl.Register)
 	auth.Post("/login", authCtrl.Login)
 	auth.Post("/logout", authCtrl.Logout)
+	auth.Get("/google", authCtrl.GoogleLogin)
+	auth.Get("/google/callback", authCtrl.GoogleCallback)
 	// In the auth group section, add:
 	auth.Post("/forgot-password", authCtrl.ForgotPassword)
 	auth.Get("/validate-reset-token", authCtrl.ValidateResetToken)
 	auth.Post("/reset-password", authCtrl.ResetPassword)
 
 	// Public routes - Search and Browse
-	api.Get("/search", searchCtrl.Search)
+	// Listings that safe mode filters; see middleware.ContentFilter
+	contentFilter := middleware.ContentFilter(authService, cfg.SafeModeDefault)
+	api.Get("/search", middleware.OptionalAuth(authService), contentFilter, searchCtrl.Search)
 	api.Get("/categories", searchCtrl.GetCategories)
-	api.Get("/categories/:id/songs", searchCtrl.GetSongsByCategory)
-	api.Get("/songs/recent", playbackCtrl.GetRecentSongs)
+	api.Get("/categories/:id/songs", middleware.OptionalAuth(authService), contentFilter, searchCtrl.GetSongsByCategory)
+	api.Get("/artists", searchCtrl.ListArtists)
+	api.Get("/albums", searchCtrl.ListAlbums)
+	api.Get("/albums/:id", searchCtrl.GetAlbum)
+	api.Get("/songs", playbackCtrl.GetSongs)
+	api.Get("/songs/recent", middleware.OptionalAuth(authService), contentFilter, playbackCtrl.GetRecentSongs)
 	api.Get("/songs/:id", playbackCtrl.GetSong)
-	api.Get("/songs/:id/stream", playbackCtrl.StreamSong)
+	api.Get("/songs/:id/stream", middleware.OptionalAuth(authService), playbackCtrl.StreamSong)
+	// Minting a stream URL needs a login when anonymous streaming is off
+	streamAuth := middleware.OptionalAuth(authService)
+	if cfg.RequireAuthToStream {
+		streamAuth = middleware.AuthMiddleware(authService)
+	}
+	api.Get("/songs/:id/stream-url", streamAuth, playbackCtrl.GetStreamURL)
+	api.Get("/songs/:id/waveform", playbackCtrl.GetWaveform)
+	api.Get("/songs/:id/related", playbackCtrl.GetRelatedSongs)
+
+	// Recently played summaries; empty for anonymous visitors
+	api.Get("/history/artists", middleware.OptionalAuth(authService), playbackCtrl.GetRecentArtists)
+	api.Get("/history/albums", middleware.OptionalAuth(authService), playbackCtrl.GetRecentAlbums)
+
+	// Featured playlists are public whatever their own visibility
+	api.Get("/playlists/featured", playlistCtrl.GetFeaturedPlaylists)
+
+	// Live playlist events. Registered ahead of the protected group because
+	// browsers can only authenticate the upgrade with ?token=
+	api.Get("/playlists/:id/ws",
+		middleware.WebSocketToken(),
+		middleware.AuthMiddleware(authService),
+		playlistCtrl.AuthorizeEvents,
+		websocket.New(playlistCtrl.StreamEvents),
+	)
 
 	// Protected routes - require authentication
 	protected := api.Group("", middleware.AuthMiddleware(authService))
 
 	// User profile routes
 	protected.Get("/profile", authCtrl.GetProfile)
+	protected.Get("/profile/permissions", authCtrl.GetPermissions)
+	protected.Put("/profile", userCtrl.UpdateProfile)
+	protected.Delete("/profile", authCtrl.DeleteAccount)
 	protected.Put("/profile/picture", userCtrl.UploadProfileImage)
+	protected.Put("/profile/password", authCtrl.ChangePassword)
+	protected.Get("/profile/export", userCtrl.ExportData)
+	protected.Get("/profile/stats", userCtrl.GetStats)
+	protected.Get("/profile/sessions", authCtrl.ListSessions)
+	protected.Delete("/profile/sessions/:id", authCtrl.RevokeSession)
+
+	// Recommendations from play history
+	protected.Get("/recommendations", contentFilter, playbackCtrl.GetRecommendations)
+
+	// Now playing presence
+	protected.Get("/now-playing", playbackCtrl.GetNowPlaying)
+	protected.Get("/users/:id/now-playing", playbackCtrl.GetUserNowPlaying)
+
+	// Resume positions
+	protected.Get("/songs/:id/position", playbackCtrl.GetPosition)
+	protected.Put("/songs/:id/position", playbackCtrl.SavePosition)
 
 	// Playlist routes
 	protected.Get("/playlists", playlistCtrl.GetUserPlaylists)
-	protected.Post("/playlists", playlistCtrl.CreatePlaylist)
+	protected.Post("/playlists", middleware.Idempotency(idempotencyService), playlistCtrl.CreatePlaylist)
+	protected.Get("/playlists/name-available", playlistCtrl.NameAvailable)
 	protected.Get("/playlists/:id", playlistCtrl.GetPlaylistDetails)
+	protected.Put("/playlists/:id", playlistCtrl.UpdatePlaylist)
+	protected.Get("/playlists/:id/queue", playbackCtrl.GetQueue)
+	protected.Get("/playlists/:id/export.m3u", playlistCtrl.ExportM3U)
+	protected.Post("/playlists/:id/clone", playlistCtrl.ClonePlaylist)
+	protected.Post("/playlists/:id/collaborators", playlistCtrl.AddCollaborator)
+	protected.Delete("/playlists/:id/collaborators/:userId", playlistCtrl.RemoveCollaborator)
 	protected.Post("/playlists/:id/songs", playlistCtrl.AddSongToPlaylist)
+	protected.Post("/playlists/:id/songs/batch", playlistCtrl.AddSongsToPlaylist)
+	protected.Delete("/playlists/:id/songs", playlistCtrl.ClearPlaylist)
+	protected.Put("/playlists/:id/songs/order", playlistCtrl.ReorderSongs)
+	protected.Get("/playlists/:id/songs/:songId/context", playlistCtrl.GetSongContext)
+	protected.Post("/playlists/:id/songs/:songId/move", playlistCtrl.MoveSong)
 	protected.Delete("/playlists/:id/songs/:songId", playlistCtrl.RemoveSongFromPlaylist)
 	protected.Delete("/playlists/:id", playlistCtrl.DeletePlaylist)
 
 	// User upload routes
-	protected.Post("/upload", userCtrl.UploadSong)
+	protected.Post("/upload", middleware.Idempotency(idempotencyService), userCtrl.UploadSong)
 	protected.Get("/uploads", userCtrl.GetUserUploads)
 
+	// Chunked (resumable) upload routes
+	protected.Post("/upload/init", chunkedUploadCtrl.InitUpload)
+	protected.Post("/upload/chunk", chunkedUploadCtrl.UploadChunk)
+	protected.Post("/upload/complete", chunkedUploadCtrl.CompleteUpload)
+
 	// Admin routes - require admin privileges
 	admin := api.Group("/admin", middleware.AuthMiddleware(authService), middleware.AdminMiddleware())
 	admin.Post("/songs", adminCtrl.UploadSong)
+	admin.Post("/songs/bulk", adminCtrl.BulkUpload)
+	admin.Delete("/songs", adminCtrl.DeleteSongs)
+	admin.Delete("/songs/trash", adminCtrl.PurgeTrash)
+	admin.Patch("/songs/:id", adminCtrl.UpdateSong)
 	admin.Delete("/songs/:id", adminCtrl.DeleteSong)
+	admin.Post("/songs/:id/restore", adminCtrl.RestoreSong)
 	admin.Get("/songs", adminCtrl.GetAllSongs)
 	admin.Get("/users", adminCtrl.GetAllUsers)
+	admin.Patch("/users/:id", adminCtrl.UpdateUser)
+	admin.Put("/playlists/:id/featured", adminCtrl.SetFeatured)
+	admin.Get("/audit", auditCtrl.GetAuditLog)
+	admin.Post("/backup", adminCtrl.BackupDatabase)
+	admin.Get("/analytics", adminCtrl.GetAnalytics)
+	admin.Get("/storage/audit", adminCtrl.AuditStorage)
+	admin.Post("/storage/cleanup", adminCtrl.CleanupStorage)
+	admin.Post("/search/reindex", adminCtrl.RebuildSearchIndex)
+	admin.Get("/maintenance", adminCtrl.GetMaintenance)
+	admin.Put("/maintenance", adminCtrl.SetMaintenance)
 
 	// Serve HTML pages - MUST BE LAST (after all /api routes)
 	app.Get("/", func(c *fiber.Ctx) error {
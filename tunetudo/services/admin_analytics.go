@@ -0,0 +1,130 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+	apperrors "tunetudo/errors"
+	"tunetudo/logger"
+	"tunetudo/models"
+)
+
+const (
+	// maxAnalyticsSpan bounds how many days one analytics request covers
+	maxAnalyticsSpan = 366 * 24 * time.Hour
+	// analyticsTopSongs is how many of the most played songs are listed
+	analyticsTopSongs = 10
+
+	analyticsDateLayout = "2006-01-02"
+	sqliteTimeLayout    = "2006-01-02 15:04:05"
+)
+
+// GetAnalytics reports activity from from up to (not including) to: the
+// most played songs, and per UTC day the users who played something, new
+// registrations and uploads. Days without activity are included as zeros
+func (s *AdminService) GetAnalytics(from, to time.Time) (models.Analytics, error) {
+	from, to = from.UTC(), to.UTC()
+	if !from.Before(to) {
+		return models.Analytics{}, apperrors.ValidationError("from must be before to", nil)
+	}
+	if to.Sub(from) > maxAnalyticsSpan {
+		return models.Analytics{}, apperrors.ValidationError(
+			fmt.Sprintf("date range cannot exceed %d days", int(maxAnalyticsSpan.Hours()/24)), nil)
+	}
+
+	analytics := models.Analytics{From: from, To: to}
+	start, end := from.Format(sqliteTimeLayout), to.Format(sqliteTimeLayout)
+
+	topSongs, err := s.analyticsTopSongs(start, end)
+	if err != nil {
+		return models.Analytics{}, internalError("failed to fetch analytics", err)
+	}
+	analytics.TopSongs = topSongs
+
+	series := []struct {
+		dest  *[]models.DailyCount
+		query string
+	}{
+		{&analytics.DailyActiveUsers, `SELECT date(played_at), COUNT(DISTINCT user_id) FROM plays
+			WHERE played_at >= ? AND played_at < ? GROUP BY date(played_at)`},
+		{&analytics.Registrations, `SELECT date(created_at), COUNT(*) FROM users
+			WHERE created_at >= ? AND created_at < ? GROUP BY date(created_at)`},
+		{&analytics.Uploads, `SELECT date(created_at), COUNT(*) FROM uploads
+			WHERE created_at >= ? AND created_at < ? GROUP BY date(created_at)`},
+	}
+	for _, sr := range series {
+		daily, err := s.analyticsDailyCounts(sr.query, start, end, from, to)
+		if err != nil {
+			return models.Analytics{}, internalError("failed to fetch analytics", err)
+		}
+		*sr.dest = daily
+	}
+
+	return analytics, nil
+}
+
+func (s *AdminService) analyticsTopSongs(start, end string) ([]models.SongPlays, error) {
+	rows, err := s.db.Query(`
+		SELECT s.id, s.title, s.artist_id, a.name, COUNT(*) AS play_count
+		FROM plays p
+		JOIN songs s ON s.id = p.song_id
+		LEFT JOIN artists a ON a.id = s.artist_id
+		WHERE p.played_at >= ? AND p.played_at < ?
+		GROUP BY s.id
+		ORDER BY play_count DESC, s.id
+		LIMIT ?
+	`, start, end, analyticsTopSongs)
+	if err != nil {
+		logger.Error(logger.CategoryDB, "Failed to query top songs", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	topSongs := []models.SongPlays{}
+	for rows.Next() {
+		var entry models.SongPlays
+		var artistName sql.NullString
+		if err := rows.Scan(&entry.Song.ID, &entry.Song.Title, &entry.Song.ArtistID, &artistName, &entry.Plays); err != nil {
+			logger.Error(logger.CategoryDB, "Failed to scan top song", err)
+			return nil, err
+		}
+		if artistName.Valid {
+			entry.Song.Artist = &models.Artist{ID: entry.Song.ArtistID, Name: artistName.String}
+		}
+		topSongs = append(topSongs, entry)
+	}
+	return topSongs, rows.Err()
+}
+
+// analyticsDailyCounts runs a query yielding (date, count) rows and spreads
+// them over every day from from to to
+func (s *AdminService) analyticsDailyCounts(query, start, end string, from, to time.Time) ([]models.DailyCount, error) {
+	rows, err := s.db.Query(query, start, end)
+	if err != nil {
+		logger.Error(logger.CategoryDB, "Failed to query daily counts", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var day string
+		var count int
+		if err := rows.Scan(&day, &count); err != nil {
+			logger.Error(logger.CategoryDB, "Failed to scan daily count", err)
+			return nil, err
+		}
+		counts[day] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	daily := []models.DailyCount{}
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format(analyticsDateLayout)
+		daily = append(daily, models.DailyCount{Date: date, Count: counts[date]})
+	}
+	return daily, nil
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"testing"
+	"time"
+	apperrors "tunetudo/errors"
+	"tunetudo/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAnalytics(t *testing.T) {
+	service, _, cleanup := setupTestAdminService(t)
+	defer cleanup()
+	seedTestData(t, service.db)
+	db := service.db
+
+	exec := func(query string, args ...interface{}) int {
+		result, err := db.Exec(query, args...)
+		require.NoError(t, err)
+		id, _ := result.LastInsertId()
+		return int(id)
+	}
+
+	alice := exec(`INSERT INTO users (username, email, password_hash, created_at) VALUES ('alice', 'a@test.com', 'h', '2024-03-01 09:00:00')`)
+	bob := exec(`INSERT INTO users (username, email, password_hash, created_at) VALUES ('bob', 'b@test.com', 'h', '2024-03-03 23:59:59')`)
+	exec(`INSERT INTO users (username, email, password_hash, created_at) VALUES ('carol', 'c@test.com', 'h', '2024-03-05 00:00:00')`)
+
+	exec(`INSERT INTO uploads (user_id, original_filename, created_at) VALUES (?, 'a.mp3', '2024-03-01 10:00:00')`, alice)
+	exec(`INSERT INTO uploads (user_id, original_filename, created_at) VALUES (?, 'b.mp3', '2024-03-01 11:00:00')`, alice)
+
+	play := func(userID, songID int, at string) {
+		exec(`INSERT INTO plays (user_id, song_id, played_at) VALUES (?, ?, ?)`, userID, songID, at)
+	}
+	play(alice, 2, "2024-03-01 12:00:00")
+	play(alice, 2, "2024-03-01 13:00:00")
+	play(bob, 2, "2024-03-01 14:00:00")
+	play(bob, 1, "2024-03-03 08:00:00")
+	play(alice, 3, "2024-03-03 09:00:00")
+	play(alice, 3, "2024-02-28 09:00:00") // before the range
+
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	analytics, err := service.GetAnalytics(from, to)
+	require.NoError(t, err)
+
+	require.Len(t, analytics.TopSongs, 3)
+	assert.Equal(t, 2, analytics.TopSongs[0].Song.ID)
+	assert.Equal(t, 3, analytics.TopSongs[0].Plays)
+	require.NotNil(t, analytics.TopSongs[0].Song.Artist)
+	assert.Equal(t, "Test Artist", analytics.TopSongs[0].Song.Artist.Name)
+	assert.Equal(t, []int{1, 3}, []int{analytics.TopSongs[1].Song.ID, analytics.TopSongs[2].Song.ID},
+		"ties are broken by song ID")
+
+	assert.Equal(t, []models.DailyCount{
+		{Date: "2024-03-01", Count: 2},
+		{Date: "2024-03-02", Count: 0},
+		{Date: "2024-03-03", Count: 2},
+	}, analytics.DailyActiveUsers)
+	assert.Equal(t, []models.DailyCount{
+		{Date: "2024-03-01", Count: 1},
+		{Date: "2024-03-02", Count: 0},
+		{Date: "2024-03-03", Count: 1},
+	}, analytics.Registrations, "carol registered after the range")
+	assert.Equal(t, []models.DailyCount{
+		{Date: "2024-03-01", Count: 2},
+		{Date: "2024-03-02", Count: 0},
+		{Date: "2024-03-03", Count: 0},
+	}, analytics.Uploads)
+
+	t.Run("Empty range has no top songs", func(t *testing.T) {
+		analytics, err := service.GetAnalytics(from.AddDate(1, 0, 0), to.AddDate(1, 0, 0))
+		require.NoError(t, err)
+		assert.NotNil(t, analytics.TopSongs)
+		assert.Empty(t, analytics.TopSongs)
+		assert.Len(t, analytics.Uploads, 3)
+	})
+}
+
+func TestGetAnalyticsValidatesRange(t *testing.T) {
+	service, _, cleanup := setupTestAdminService(t)
+	defer cleanup()
+
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		from, to time.Time
+	}{
+		{"Reversed", day, day.AddDate(0, 0, -1)},
+		{"Empty", day, day},
+		{"Too long", day, day.AddDate(0, 0, 367)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.GetAnalytics(tt.from, tt.to)
+			require.Error(t, err)
+			if appErr := apperrors.GetAppError(err); assert.NotNil(t, appErr) {
+				assert.Equal(t, apperrors.ErrCodeValidation, appErr.Code)
+			}
+		})
+	}
+
+	_, err := service.GetAnalytics(day, day.AddDate(0, 0, 366))
+	assert.NoError(t, err, "a full leap year is allowed")
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"path"
+	"strings"
+	apperrors "tunetudo/errors"
+	"tunetudo/logger"
+	"tunetudo/models"
+)
+
+const (
+	// maxBulkEntries caps how many files one archive may hold
+	maxBulkEntries = 500
+	// maxBulkSidecarSize bounds a metadata JSON file
+	maxBulkSidecarSize = 64 * 1024
+)
+
+var bulkAudioExtensions = map[string]bool{".mp3": true, ".mp4": true, ".wav": true}
+
+// BulkUpload adds every audio file in a zip archive to the catalog and
+// reports the outcome per file. Titles come from the file name ("Artist -
+// Title.mp3" also sets the artist) unless a sidecar "<name>.json" with
+// models.BulkSongMetadata fields sits next to it. Entries are never
+// extracted under their archive names, and names that try to escape the
+// archive are rejected outright
+func (s *AdminService) BulkUpload(zipFile *multipart.FileHeader, defaultCategoryID int) ([]models.BulkResult, error) {
+	src, err := zipFile.Open()
+	if err != nil {
+		logger.Error(logger.CategoryFile, "Failed to open uploaded archive", err)
+		return nil, internalError("failed to read archive", err)
+	}
+	defer src.Close()
+
+	archive, err := zip.NewReader(src, zipFile.Size)
+	if err != nil {
+		return nil, apperrors.ValidationError("file is not a valid zip archive", err)
+	}
+	if len(archive.File) > maxBulkEntries {
+		return nil, apperrors.ValidationError("archive has too many files", nil)
+	}
+
+	sidecars := make(map[string]*zip.File)
+	for _, entry := range archive.File {
+		if strings.EqualFold(path.Ext(entry.Name), ".json") {
+			sidecars[strings.ToLower(strings.TrimSuffix(entry.Name, path.Ext(entry.Name)))] = entry
+		}
+	}
+
+	results := []models.BulkResult{}
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() || isArchiveJunk(entry.Name) || sidecars[strings.ToLower(strings.TrimSuffix(entry.Name, path.Ext(entry.Name)))] == entry {
+			continue
+		}
+
+		result := models.BulkResult{File: entry.Name}
+		song, err := s.addBulkEntry(entry, sidecars, defaultCategoryID)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Success = true
+			result.SongID = song.ID
+		}
+		results = append(results, result)
+	}
+
+	logger.Info(logger.CategoryFile, "Bulk upload processed %d files", len(results))
+	return results, nil
+}
+
+func (s *AdminService) addBulkEntry(entry *zip.File, sidecars map[string]*zip.File, defaultCategoryID int) (*models.Song, error) {
+	if !isSafeArchivePath(entry.Name) {
+		logger.Warning(logger.CategoryFile, "Bulk upload rejected unsafe entry path")
+		return nil, apperrors.ValidationError("unsafe file path", nil)
+	}
+
+	ext := strings.ToLower(path.Ext(entry.Name))
+	if !bulkAudioExtensions[ext] {
+		return nil, apperrors.ValidationError("invalid format. Only MP4, WAV, and MP3 allowed", nil)
+	}
+
+	base := strings.TrimSuffix(path.Base(entry.Name), path.Ext(entry.Name))
+	meta := models.BulkSongMetadata{Title: base, Artist: "Unknown Artist", CategoryID: defaultCategoryID}
+	if artist, title, ok := strings.Cut(base, " - "); ok {
+		meta.Artist, meta.Title = strings.TrimSpace(artist), strings.TrimSpace(title)
+	}
+
+	if sidecar := sidecars[strings.ToLower(strings.TrimSuffix(entry.Name, path.Ext(entry.Name)))]; sidecar != nil {
+		if err := readBulkSidecar(sidecar, &meta); err != nil {
+			return nil, err
+		}
+	}
+
+	rc, err := entry.Open()
+	if err != nil {
+		return nil, apperrors.ValidationError("file could not be read from the archive", err)
+	}
+	defer rc.Close()
+
+	// Reading at most one byte past the limit lets addCatalogSong see a
+	// file whose header understates its size
+	limited := io.LimitReader(rc, s.maxAudioBytes+1)
+	return s.addCatalogSong(limited, entry.Name, int64(entry.UncompressedSize64),
+		meta.Title, meta.Artist, meta.Album, meta.CategoryID, meta.Duration, meta.TrackNumber, meta.DiscNumber)
+}
+
+// readBulkSidecar overlays the fields set in a metadata JSON file on meta
+func readBulkSidecar(sidecar *zip.File, meta *models.BulkSongMetadata) error {
+	if sidecar.UncompressedSize64 > maxBulkSidecarSize {
+		return apperrors.ValidationError("metadata file too large", nil)
+	}
+	rc, err := sidecar.Open()
+	if err != nil {
+		return apperrors.ValidationError("metadata file could not be read", err)
+	}
+	defer rc.Close()
+
+	var override models.BulkSongMetadata
+	if err := json.NewDecoder(io.LimitReader(rc, maxBulkSidecarSize)).Decode(&override); err != nil {
+		return apperrors.ValidationError("invalid metadata file", err)
+	}
+
+	if override.Title != "" {
+		meta.Title = override.Title
+	}
+	if override.Artist != "" {
+		meta.Artist = override.Artist
+	}
+	if override.Album != "" {
+		meta.Album = override.Album
+	}
+	if override.CategoryID > 0 {
+		meta.CategoryID = override.CategoryID
+	}
+	if override.Duration > 0 {
+		meta.Duration = override.Duration
+	}
+	if override.TrackNumber > 0 {
+		meta.TrackNumber = override.TrackNumber
+	}
+	if override.DiscNumber > 0 {
+		meta.DiscNumber = override.DiscNumber
+	}
+	return nil
+}
+
+// isSafeArchivePath rejects absolute names, Windows separators and any
+// ".." segment, the shapes a zip-slip entry takes
+func isSafeArchivePath(name string) bool {
+	if name == "" || strings.HasPrefix(name, "/") || strings.Contains(name, "\\") || strings.Contains(name, ":") {
+		return false
+	}
+	for _, segment := range strings.Split(name, "/") {
+		if segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// isArchiveJunk matches metadata that archivers add, such as macOS
+// resource forks and dotfiles
+func isArchiveJunk(name string) bool {
+	return strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), ".")
+}
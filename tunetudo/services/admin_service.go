@@ -8,49 +8,121 @@ import (
 	"mime/multipart"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	apperrors "tunetudo/errors"
 	"tunetudo/logger"
+	"tunetudo/metrics"
 	"tunetudo/models"
 
 	"github.com/google/uuid"
 )
 
+// maxBulkDeleteSongs caps how many songs one DeleteSongs call can remove
+const maxBulkDeleteSongs = 500
+
 type AdminService struct {
-	db          *sql.DB
-	storagePath string
+	db            *sql.DB
+	storagePath   string
+	trashDir      string
+	backupPath    string
+	maxAudioBytes int64
 }
 
 func NewAdminService(db *sql.DB, storagePath string) *AdminService {
 	return &AdminService{
-		db:          db,
-		storagePath: storagePath,
+		db:            db,
+		storagePath:   storagePath,
+		trashDir:      filepath.Join(filepath.Dir(filepath.Clean(storagePath)), "trash"),
+		maxAudioBytes: defaultMaxAudioUploadBytes,
 	}
 }
 
+// SetTrashPath sets the directory deleted songs' files wait in until they
+// are purged. It defaults to "trash" next to the storage directory and
+// must not be anywhere the storage is served from
+func (s *AdminService) SetTrashPath(path string) {
+	s.trashDir = path
+}
+
+// SetBackupPath sets the directory CreateBackup writes snapshots into
+func (s *AdminService) SetBackupPath(path string) {
+	s.backupPath = path
+}
+
 // UploadSong uploads a new song to the catalog (admin only)
 func (s *AdminService) UploadSong(
 	file *multipart.FileHeader,
 	title, artistName, albumTitle string,
-	categoryID, durationSeconds int,
+	categoryID, durationSeconds, trackNumber, discNumber int,
 ) (*models.Song, error) {
 	logger.Info(logger.CategoryFile, "Admin song upload initiated: title=%s, artist=%s", title, artistName)
 
+	src, err := file.Open()
+	if err != nil {
+		logger.Error(logger.CategoryFile, "Failed to open uploaded file", err)
+		return nil, err
+	}
+	defer src.Close()
+
+	return s.addCatalogSong(src, file.Filename, file.Size, title, artistName, albumTitle,
+		categoryID, durationSeconds, trackNumber, discNumber)
+}
+
+// checkCategory accepts zero (uncategorized) or the ID of an existing
+// category
+func checkCategory(db *sql.DB, categoryID int) error {
+	if categoryID == 0 {
+		return nil
+	}
+	var exists int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM categories WHERE id = ?`, categoryID).Scan(&exists); err != nil {
+		logger.Error(logger.CategoryDB, "Failed to look up category", err)
+		return err
+	}
+	if exists == 0 {
+		logger.Warning(logger.CategoryFile, "Song upload failed: unknown category_id=%d", categoryID)
+		return errors.New("invalid category")
+	}
+	return nil
+}
+
+// addCatalogSong validates and stores one catalog song read from src,
+// creating its artist and album as needed. Shared by single and bulk uploads.
+// A zero track or disc number is stored as unknown
+func (s *AdminService) addCatalogSong(
+	src io.Reader, filename string, size int64,
+	title, artistName, albumTitle string,
+	categoryID, durationSeconds, trackNumber, discNumber int,
+) (*models.Song, error) {
+	artistName = models.NormalizeArtistName(artistName)
+
 	// Validate required fields
 	if title == "" || artistName == "" {
 		logger.Warning(logger.CategoryFile, "Song upload failed: missing required metadata")
 		return nil, errors.New("missing metadata. Title and artist are required")
 	}
+	if trackNumber < 0 || discNumber < 0 {
+		return nil, errors.New("track and disc numbers cannot be negative")
+	}
 
 	// Validate file type
-	ext := filepath.Ext(file.Filename)
+	ext := filepath.Ext(filename)
 	if ext != ".mp4" && ext != ".wav" && ext != ".mp3" {
 		logger.Warning(logger.CategoryFile, "Song upload failed: invalid file format %s", ext)
 		return nil, errors.New("invalid format. Only MP4, WAV, and MP3 allowed")
 	}
 
-	// Validate file size (50MB)
-	if file.Size > 50*1024*1024 {
-		logger.Warning(logger.CategoryFile, "Song upload failed: file too large (%d bytes)", file.Size)
-		return nil, errors.New("file too large. Maximum size is 50MB")
+	// Validate file size
+	if size > s.maxAudioBytes {
+		logger.Warning(logger.CategoryFile, "Song upload failed: file too large (%d bytes)", size)
+		return nil, fileTooLarge(s.maxAudioBytes)
+	}
+
+	// Zero means uncategorized; anything else must name a real category
+	if err := checkCategory(s.db, categoryID); err != nil {
+		return nil, err
 	}
 
 	// Check for duplicate song
@@ -58,32 +130,14 @@ func (s *AdminService) UploadSong(
 	err := s.db.QueryRow(`
 		SELECT s.id FROM songs s
 		JOIN artists a ON s.artist_id = a.id
-		WHERE LOWER(s.title) = LOWER(?) AND LOWER(a.name) = LOWER(?)
-	`, title, artistName).Scan(&existingID)
+		WHERE LOWER(s.title) = LOWER(?) AND a.name_key = ? AND s.deleted_at IS NULL
+	`, title, models.ArtistNameKey(artistName)).Scan(&existingID)
 
 	if err == nil {
 		logger.Warning(logger.CategoryDB, "Duplicate song detected: song_id=%d, title=%s", existingID, title)
 		return nil, fmt.Errorf("duplicate song detected. Song ID %d already exists with this title and artist", existingID)
 	}
 
-	// Get or create artist
-	artistID, err := s.getOrCreateArtist(artistName)
-	if err != nil {
-		logger.Error(logger.CategoryDB, "Failed to get or create artist", err)
-		return nil, err
-	}
-
-	// Get or create album if provided
-	var albumID *int
-	if albumTitle != "" {
-		aid, err := s.getOrCreateAlbum(albumTitle, artistID)
-		if err == nil {
-			albumID = &aid
-		} else {
-			logger.Warning(logger.CategoryDB, "Failed to create album: %s", albumTitle)
-		}
-	}
-
 	// Create storage directory
 	songDir := filepath.Join(s.storagePath, "media", "songs")
 	if err := os.MkdirAll(songDir, 0755); err != nil {
@@ -92,55 +146,90 @@ func (s *AdminService) UploadSong(
 	}
 
 	// Generate unique filename
-	filename := fmt.Sprintf("%s%s", uuid.New().String(), ext)
-	filePath := filepath.Join(songDir, filename)
+	storedName := fmt.Sprintf("%s%s", uuid.New().String(), ext)
+	filePath := filepath.Join(songDir, storedName)
 
 	// Save file
-	src, err := file.Open()
+	bytesWritten, err := saveFileAtomically(src, filePath)
 	if err != nil {
-		logger.Error(logger.CategoryFile, "Failed to open uploaded file", err)
+		logger.Error(logger.CategoryFile, "Failed to write file to disk", err)
 		return nil, err
 	}
-	defer src.Close()
 
-	dst, err := os.Create(filePath)
+	// The declared size can understate what a stream (e.g. a zip entry) holds
+	if bytesWritten > s.maxAudioBytes {
+		os.Remove(filePath)
+		logger.Warning(logger.CategoryFile, "Song upload failed: file too large (%d bytes)", bytesWritten)
+		return nil, fileTooLarge(s.maxAudioBytes)
+	}
+
+	logger.Info(logger.CategoryFile, "File saved successfully: %d bytes written to %s", bytesWritten, storedName)
+
+	// All rows are written in one transaction so a failure part-way
+	// doesn't leave orphan artists/albums behind
+	committed := false
+	defer func() {
+		if !committed {
+			// Clean up uploaded file
+			os.Remove(filePath)
+		}
+	}()
+
+	tx, err := s.db.Begin()
 	if err != nil {
-		logger.Error(logger.CategoryFile, "Failed to create destination file", err)
+		logger.Error(logger.CategoryDB, "Failed to begin upload transaction", err)
 		return nil, err
 	}
-	defer dst.Close()
+	defer tx.Rollback()
 
-	bytesWritten, err := io.Copy(dst, src)
+	// Get or create artist
+	artistID, err := s.getOrCreateArtist(tx, artistName)
 	if err != nil {
-		logger.Error(logger.CategoryFile, "Failed to write file to disk", err)
+		logger.Error(logger.CategoryDB, "Failed to get or create artist", err)
 		return nil, err
 	}
 
-	logger.Info(logger.CategoryFile, "File saved successfully: %d bytes written to %s", bytesWritten, filename)
+	// Get or create album if provided
+	var albumID *int
+	if albumTitle != "" {
+		aid, err := s.getOrCreateAlbum(tx, albumTitle, artistID)
+		if err != nil {
+			logger.Error(logger.CategoryDB, "Failed to get or create album", err)
+			return nil, err
+		}
+		albumID = &aid
+	}
 
 	// Store song record
-	relativePath := filepath.Join("media", "songs", filename)
+	relativePath := filepath.Join("media", "songs", storedName)
 	var catID *int
 	if categoryID > 0 {
 		catID = &categoryID
 	}
 
-	result, err := s.db.Exec(`
-		INSERT INTO songs (title, artist_id, album_id, category_id, duration_seconds, file_path, format)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`, title, artistID, albumID, catID, durationSeconds, relativePath, ext[1:])
+	track, disc := optionalPositive(trackNumber), optionalPositive(discNumber)
+
+	result, err := tx.Exec(`
+		INSERT INTO songs (title, artist_id, album_id, category_id, duration_seconds, track_number, disc_number, file_path, format)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, title, artistID, albumID, catID, durationSeconds, track, disc, relativePath, ext[1:])
 
 	if err != nil {
 		logger.Error(logger.CategoryDB, "Failed to insert song record", err)
-		// Clean up uploaded file
-		os.Remove(filePath)
 		return nil, err
 	}
 
 	songID, _ := result.LastInsertId()
 
 	// Update FTS index
-	s.updateFTSIndex(int(songID), title, artistName, albumTitle, categoryID)
+	s.updateFTSIndex(tx, int(songID), title, artistName, albumTitle, categoryID)
+
+	if err := tx.Commit(); err != nil {
+		logger.Error(logger.CategoryDB, "Failed to commit song upload", err)
+		return nil, err
+	}
+	committed = true
+	metrics.RecordUpload(size)
 
 	song := &models.Song{
 		ID:              int(songID),
@@ -149,6 +238,8 @@ func (s *AdminService) UploadSong(
 		AlbumID:         albumID,
 		CategoryID:      catID,
 		DurationSeconds: durationSeconds,
+		TrackNumber:     track,
+		DiscNumber:      disc,
 		FilePath:        relativePath,
 		Format:          ext[1:],
 	}
@@ -157,15 +248,74 @@ func (s *AdminService) UploadSong(
 	return song, nil
 }
 
-func (s *AdminService) getOrCreateArtist(name string) (int, error) {
+// optionalPositive maps the zero value of an optional number to NULL
+func optionalPositive(n int) *int {
+	if n <= 0 {
+		return nil
+	}
+	return &n
+}
+
+// UpdateSong changes where a catalog song sits on its album and whether it
+// is explicit. Nil fields are left alone and zero clears a number back to
+// unknown
+func (s *AdminService) UpdateSong(songID int, req models.UpdateSongRequest) error {
+	var sets []string
+	var args []interface{}
+	for _, field := range []struct {
+		column string
+		value  *int
+	}{
+		{"track_number", req.TrackNumber},
+		{"disc_number", req.DiscNumber},
+	} {
+		if field.value == nil {
+			continue
+		}
+		if *field.value < 0 {
+			return apperrors.ValidationError("track and disc numbers cannot be negative", nil)
+		}
+		sets = append(sets, field.column+" = ?")
+		args = append(args, optionalPositive(*field.value))
+	}
+	if req.Explicit != nil {
+		sets = append(sets, "explicit = ?")
+		args = append(args, *req.Explicit)
+	}
+	if len(sets) == 0 {
+		return apperrors.ValidationError("track_number, disc_number or explicit required", nil)
+	}
+
+	args = append(args, songID)
+	result, err := s.db.Exec(`
+		UPDATE songs SET `+strings.Join(sets, ", ")+`
+		WHERE id = ? AND uploaded_by_user_id IS NULL AND deleted_at IS NULL
+	`, args...)
+	if err != nil {
+		return apperrors.InternalError(err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return apperrors.NotFoundError("song not found")
+	}
+
+	logger.Info(logger.CategoryDB, "Song updated: song_id=%d", songID)
+	return nil
+}
+
+// getOrCreateArtist matches artists on their normalized key, keeping the
+// display name of whichever spelling was uploaded first
+func (s *AdminService) getOrCreateArtist(tx *sql.Tx, name string) (int, error) {
+	name = models.NormalizeArtistName(name)
+	key := models.ArtistNameKey(name)
+
 	var artistID int
-	err := s.db.QueryRow(`SELECT id FROM artists WHERE LOWER(name) = LOWER(?)`, name).Scan(&artistID)
+	err := tx.QueryRow(`SELECT id FROM artists WHERE name_key = ? ORDER BY id LIMIT 1`, key).Scan(&artistID)
 	if err == nil {
 		logger.Info(logger.CategoryDB, "Found existing artist: %s (id=%d)", name, artistID)
 		return artistID, nil
 	}
 
-	result, err := s.db.Exec(`INSERT INTO artists (name) VALUES (?)`, name)
+	result, err := tx.Exec(`INSERT INTO artists (name, name_key) VALUES (?, ?)`, name, key)
 	if err != nil {
 		logger.Error(logger.CategoryDB, "Failed to create artist", err)
 		return 0, err
@@ -176,9 +326,9 @@ func (s *AdminService) getOrCreateArtist(name string) (int, error) {
 	return int(id), nil
 }
 
-func (s *AdminService) getOrCreateAlbum(title string, artistID int) (int, error) {
+func (s *AdminService) getOrCreateAlbum(tx *sql.Tx, title string, artistID int) (int, error) {
 	var albumID int
-	err := s.db.QueryRow(`
+	err := tx.QueryRow(`
 		SELECT id FROM albums WHERE LOWER(title) = LOWER(?) AND artist_id = ?
 	`, title, artistID).Scan(&albumID)
 	if err == nil {
@@ -186,7 +336,7 @@ func (s *AdminService) getOrCreateAlbum(title string, artistID int) (int, error)
 		return albumID, nil
 	}
 
-	result, err := s.db.Exec(`INSERT INTO albums (title, artist_id) VALUES (?, ?)`, title, artistID)
+	result, err := tx.Exec(`INSERT INTO albums (title, artist_id) VALUES (?, ?)`, title, artistID)
 	if err != nil {
 		logger.Error(logger.CategoryDB, "Failed to create album", err)
 		return 0, err
@@ -197,16 +347,16 @@ func (s *AdminService) getOrCreateAlbum(title string, artistID int) (int, error)
 	return int(id), nil
 }
 
-func (s *AdminService) updateFTSIndex(songID int, title, artistName, albumTitle string, categoryID int) {
+func (s *AdminService) updateFTSIndex(tx *sql.Tx, songID int, title, artistName, albumTitle string, categoryID int) {
 	var categoryName string
 	if categoryID > 0 {
-		err := s.db.QueryRow(`SELECT name FROM categories WHERE id = ?`, categoryID).Scan(&categoryName)
+		err := tx.QueryRow(`SELECT name FROM categories WHERE id = ?`, categoryID).Scan(&categoryName)
 		if err != nil {
 			logger.Warning(logger.CategoryDB, "Failed to get category name for FTS index")
 		}
 	}
 
-	_, err := s.db.Exec(`
+	_, err := tx.Exec(`
 		INSERT INTO songs_fts (song_id, title, artist_name, album_title, category_name)
 		VALUES (?, ?, ?, ?, ?)
 	`, songID, title, artistName, albumTitle, categoryName)
@@ -218,13 +368,14 @@ func (s *AdminService) updateFTSIndex(songID int, title, artistName, albumTitle
 	}
 }
 
-// DeleteSong removes a song from the catalog
+// DeleteSong moves a song to the trash. It disappears from every listing
+// but can be brought back with RestoreSong until PurgeDeleted removes it
 func (s *AdminService) DeleteSong(songID int) error {
 	logger.Info(logger.CategoryDB, "Attempting to delete song: song_id=%d", songID)
 
 	// Get file path and title before deleting
 	var filePath, title string
-	err := s.db.QueryRow(`SELECT file_path, title FROM songs WHERE id = ?`, songID).Scan(&filePath, &title)
+	err := s.db.QueryRow(`SELECT file_path, title FROM songs WHERE id = ? AND deleted_at IS NULL`, songID).Scan(&filePath, &title)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			logger.Warning(logger.CategoryDB, "Delete failed: song not found (song_id=%d)", songID)
@@ -234,41 +385,238 @@ func (s *AdminService) DeleteSong(songID int) error {
 		return errors.New("song not found")
 	}
 
-	// Delete from database (cascades to playlist_songs)
-	_, err = s.db.Exec(`DELETE FROM songs WHERE id = ?`, songID)
+	_, err = s.db.Exec(`UPDATE songs SET deleted_at = CURRENT_TIMESTAMP WHERE id = ?`, songID)
 	if err != nil {
-		logger.Error(logger.CategoryDB, "Failed to delete song from database", err)
+		logger.Error(logger.CategoryDB, "Failed to mark song as deleted", err)
 		return err
 	}
 
-	// Delete file
-	fullPath := filepath.Join(s.storagePath, filePath)
-	err = os.Remove(fullPath)
+	s.moveToTrash(filePath)
+
+	logger.Info(logger.CategoryDB, "Song moved to trash: song_id=%d, title=%s", songID, title)
+	return nil
+}
+
+// DeleteSongs moves several songs to the trash at once, like DeleteSong.
+// The rows are marked in one transaction; ids that are missing or already
+// in the trash are reported in failed rather than stopping the batch
+func (s *AdminService) DeleteSongs(ids []int) (deleted []int, failed []int, err error) {
+	if len(ids) == 0 {
+		return nil, nil, apperrors.ValidationError("ids required", nil)
+	}
+	if len(ids) > maxBulkDeleteSongs {
+		return nil, nil, apperrors.ValidationError(
+			fmt.Sprintf("at most %d songs can be deleted at once", maxBulkDeleteSongs), nil)
+	}
+
+	tx, err := s.db.Begin()
 	if err != nil {
-		logger.Warning(logger.CategoryFile, "Failed to delete song file: %s", fullPath)
+		logger.Error(logger.CategoryDB, "Failed to begin bulk delete", err)
+		return nil, nil, apperrors.InternalError(err)
+	}
+	defer tx.Rollback()
+
+	deleted, failed = []int{}, []int{}
+	var filePaths []string
+	seen := map[int]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		var filePath string
+		err := tx.QueryRow(`SELECT file_path FROM songs WHERE id = ? AND deleted_at IS NULL`, id).Scan(&filePath)
+		if err == sql.ErrNoRows {
+			failed = append(failed, id)
+			continue
+		}
+		if err != nil {
+			logger.Error(logger.CategoryDB, "Database error during bulk delete", err)
+			return nil, nil, apperrors.InternalError(err)
+		}
+		if _, err := tx.Exec(`UPDATE songs SET deleted_at = CURRENT_TIMESTAMP WHERE id = ?`, id); err != nil {
+			logger.Error(logger.CategoryDB, "Failed to mark song as deleted", err)
+			return nil, nil, apperrors.InternalError(err)
+		}
+		deleted = append(deleted, id)
+		filePaths = append(filePaths, filePath)
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Error(logger.CategoryDB, "Failed to commit bulk delete", err)
+		return nil, nil, apperrors.InternalError(err)
+	}
+
+	for _, filePath := range filePaths {
+		s.moveToTrash(filePath)
+	}
+
+	logger.Info(logger.CategoryDB, "Bulk delete moved %d songs to trash, %d not found", len(deleted), len(failed))
+	return deleted, failed, nil
+}
+
+// moveToTrash moves a deleted song's file out of storage. A failure only
+// warns: the song is already hidden and the file can be cleaned up later
+func (s *AdminService) moveToTrash(filePath string) {
+	fullPath := filepath.Join(s.storagePath, filePath)
+	trashPath := s.trashPath(filePath)
+	if err := os.MkdirAll(filepath.Dir(trashPath), 0755); err != nil {
+		logger.Warning(logger.CategoryFile, "Failed to create trash directory: %v", err)
+	} else if err := os.Rename(fullPath, trashPath); err != nil {
+		logger.Warning(logger.CategoryFile, "Failed to move song file to trash: %s", fullPath)
 	} else {
-		logger.Info(logger.CategoryFile, "Song file deleted: %s", fullPath)
+		logger.Info(logger.CategoryFile, "Song file moved to trash: %s", trashPath)
+	}
+}
+
+// RestoreSong takes a song back out of the trash. A song whose file is gone
+// from the trash stays deleted, since it could no longer be streamed. If
+// moving it to the trash failed the file is still in storage, which is fine
+func (s *AdminService) RestoreSong(songID int) error {
+	logger.Info(logger.CategoryDB, "Attempting to restore song: song_id=%d", songID)
+
+	var filePath string
+	err := s.db.QueryRow(`SELECT file_path FROM songs WHERE id = ? AND deleted_at IS NOT NULL`, songID).Scan(&filePath)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.Error(logger.CategoryDB, "Database error during song restore", err)
+		}
+		return errors.New("song not found in trash")
+	}
+
+	fullPath := filepath.Join(s.storagePath, filePath)
+	err = os.Rename(s.trashPath(filePath), fullPath)
+	if os.IsNotExist(err) {
+		err = os.Rename(s.legacyTrashPath(filePath), fullPath)
+	}
+	if os.IsNotExist(err) {
+		if _, statErr := os.Stat(fullPath); statErr != nil {
+			logger.Warning(logger.CategoryFile, "Song file missing from trash: song_id=%d", songID)
+			return fmt.Errorf("song file %s not found in trash", filePath)
+		}
+		err = nil
+	}
+	if err != nil {
+		logger.Error(logger.CategoryFile, "Failed to move song file out of trash", err)
+		return err
 	}
 
-	// Delete from FTS
-	_, err = s.db.Exec(`DELETE FROM songs_fts WHERE song_id = ?`, songID)
+	_, err = s.db.Exec(`UPDATE songs SET deleted_at = NULL WHERE id = ?`, songID)
 	if err != nil {
-		logger.Warning(logger.CategoryDB, "Failed to delete from FTS index")
+		logger.Error(logger.CategoryDB, "Failed to restore song", err)
+		return err
 	}
 
-	logger.Info(logger.CategoryDB, "Song deleted successfully: song_id=%d, title=%s", songID, title)
+	logger.Info(logger.CategoryDB, "Song restored: song_id=%d", songID)
 	return nil
 }
 
-// GetAllUsers retrieves all users (admin view)
-func (s *AdminService) GetAllUsers() ([]models.User, error) {
-	logger.Info(logger.CategoryDB, "Retrieving all users (admin view)")
+// PurgeDeleted permanently removes songs that have been in the trash
+// for longer than olderThan, returning how many were removed
+func (s *AdminService) PurgeDeleted(olderThan time.Duration) (int, error) {
+	cutoff := time.Now().Add(-olderThan).UTC().Format("2006-01-02 15:04:05")
+
+	rows, err := s.db.Query(`SELECT id, file_path FROM songs WHERE deleted_at IS NOT NULL AND deleted_at <= ?`, cutoff)
+	if err != nil {
+		logger.Error(logger.CategoryDB, "Failed to list trashed songs", err)
+		return 0, err
+	}
+
+	type trashedSong struct {
+		id       int
+		filePath string
+	}
+	var trashed []trashedSong
+	for rows.Next() {
+		var t trashedSong
+		if err := rows.Scan(&t.id, &t.filePath); err != nil {
+			logger.Warning(logger.CategoryDB, "Failed to scan trashed song row")
+			continue
+		}
+		trashed = append(trashed, t)
+	}
+	rows.Close()
+
+	purged := 0
+	for _, t := range trashed {
+		// Playlist entries and playback positions go via ON DELETE CASCADE
+		if _, err := s.db.Exec(`DELETE FROM songs WHERE id = ?`, t.id); err != nil {
+			logger.Error(logger.CategoryDB, "Failed to purge song", err)
+			return purged, err
+		}
+
+		for _, path := range []string{s.trashPath(t.filePath), s.legacyTrashPath(t.filePath)} {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				logger.Warning(logger.CategoryFile, "Failed to delete trashed song file: song_id=%d", t.id)
+			}
+		}
+
+		// Delete from FTS
+		_, err = s.db.Exec(`DELETE FROM songs_fts WHERE song_id = ?`, t.id)
+		if err != nil {
+			logger.Warning(logger.CategoryDB, "Failed to delete from FTS index")
+		}
+		purged++
+	}
+
+	logger.Info(logger.CategoryDB, "Purged %d trashed songs", purged)
+	return purged, nil
+}
+
+// trashPath is where a song's file is kept while it is soft-deleted
+func (s *AdminService) trashPath(filePath string) string {
+	return filepath.Join(s.trashDir, filepath.Base(filePath))
+}
+
+// legacyTrashPath is where songs deleted before the trash moved out of
+// storage still keep their file
+func (s *AdminService) legacyTrashPath(filePath string) string {
+	return filepath.Join(s.storagePath, "trash", filepath.Base(filePath))
+}
+
+// Filters for the admin users list
+const (
+	UserFilterAdmins    = "admins"
+	UserFilterSuspended = "suspended"
+)
+
+// GetAllUsers retrieves a page of users (admin view). search keeps users
+// whose username or email starts with it; filter narrows the list to
+// UserFilterAdmins or UserFilterSuspended, and empty means everyone
+func (s *AdminService) GetAllUsers(limit, offset int, search, filter string) (*models.Paginated[models.User], error) {
+	logger.Info(logger.CategoryDB, "Retrieving all users (admin view): limit=%d, offset=%d, filter=%s", limit, offset, filter)
+
+	where := "1 = 1"
+	var args []interface{}
+	switch filter {
+	case "":
+	case UserFilterAdmins:
+		where += " AND is_admin = 1"
+	case UserFilterSuspended:
+		where += " AND suspended = 1"
+	default:
+		return nil, apperrors.ValidationError("filter must be one of admins, suspended", nil)
+	}
+	if search = strings.TrimSpace(search); search != "" {
+		prefix := likePrefix(search)
+		where += ` AND (username LIKE ? ESCAPE '\' OR email LIKE ? ESCAPE '\')`
+		args = append(args, prefix, prefix)
+	}
+
+	var total int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM users WHERE `+where, args...).Scan(&total); err != nil {
+		logger.Error(logger.CategoryDB, "Failed to count users", err)
+		return nil, err
+	}
 
 	rows, err := s.db.Query(`
-		SELECT id, username, email, is_admin, profile_image_path, created_at, last_login
+		SELECT id, username, email, is_admin, suspended, profile_image_path, created_at, last_login
 		FROM users
-		ORDER BY created_at DESC
-	`)
+		WHERE `+where+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
 	if err != nil {
 		logger.Error(logger.CategoryDB, "Failed to retrieve users", err)
 		return nil, err
@@ -279,7 +627,7 @@ func (s *AdminService) GetAllUsers() ([]models.User, error) {
 	for rows.Next() {
 		var user models.User
 		err := rows.Scan(
-			&user.ID, &user.Username, &user.Email, &user.IsAdmin,
+			&user.ID, &user.Username, &user.Email, &user.IsAdmin, &user.Suspended,
 			&user.ProfileImagePath, &user.CreatedAt, &user.LastLogin,
 		)
 		if err != nil {
@@ -289,14 +637,90 @@ func (s *AdminService) GetAllUsers() ([]models.User, error) {
 		users = append(users, user)
 	}
 
-	logger.Info(logger.CategoryDB, "Retrieved %d users", len(users))
-	return users, nil
+	logger.Info(logger.CategoryDB, "Retrieved %d of %d users", len(users), total)
+	return models.NewPaginated(users, total, limit, offset), nil
+}
+
+// likePrefix builds a LIKE pattern matching values that start with prefix,
+// escaping the wildcards so they match themselves
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix) + "%"
 }
 
-// GetAllSongs retrieves all songs (admin view)
-func (s *AdminService) GetAllSongs(limit, offset int) ([]models.Song, error) {
+// SetAdmin grants or revokes admin privileges for a user
+func (s *AdminService) SetAdmin(targetUserID int, admin bool) error {
+	if err := s.updateUserFlag(targetUserID, "is_admin", admin); err != nil {
+		return err
+	}
+	logger.Info(logger.CategoryDB, "Admin flag updated: user_id=%d, is_admin=%t", targetUserID, admin)
+	return nil
+}
+
+// SetSuspended suspends or reinstates a user account
+func (s *AdminService) SetSuspended(targetUserID int, suspended bool) error {
+	if err := s.updateUserFlag(targetUserID, "suspended", suspended); err != nil {
+		return err
+	}
+	logger.Info(logger.CategoryDB, "Suspension updated: user_id=%d, suspended=%t", targetUserID, suspended)
+	return nil
+}
+
+// SetFeatured features or unfeatures a playlist. Only playlists owned by an
+// admin can be featured, since they are shown to every visitor
+func (s *AdminService) SetFeatured(playlistID int, featured bool) error {
+	var ownerIsAdmin bool
+	err := s.db.QueryRow(`
+		SELECT u.is_admin FROM playlists p JOIN users u ON p.user_id = u.id WHERE p.id = ?
+	`, playlistID).Scan(&ownerIsAdmin)
+	if err == sql.ErrNoRows {
+		return apperrors.NotFoundError("playlist not found")
+	}
+	if err != nil {
+		logger.Error(logger.CategoryDB, "Failed to look up playlist", err)
+		return apperrors.InternalError(err)
+	}
+	if featured && !ownerIsAdmin {
+		return apperrors.ValidationError("only playlists owned by an admin can be featured", nil)
+	}
+
+	if _, err := s.db.Exec(`UPDATE playlists SET is_featured = ? WHERE id = ?`, featured, playlistID); err != nil {
+		logger.Error(logger.CategoryDB, "Failed to update playlist", err)
+		return apperrors.InternalError(err)
+	}
+	logger.Info(logger.CategoryDB, "Featured flag updated: playlist_id=%d, is_featured=%t", playlistID, featured)
+	return nil
+}
+
+// updateUserFlag sets a boolean column on a user; column is always a constant
+func (s *AdminService) updateUserFlag(targetUserID int, column string, value bool) error {
+	result, err := s.db.Exec(`UPDATE users SET `+column+` = ? WHERE id = ?`, value, targetUserID)
+	if err != nil {
+		logger.Error(logger.CategoryDB, "Failed to update user", err)
+		return err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return errors.New("user not found")
+	}
+	return nil
+}
+
+// GetAllSongs retrieves a page of songs (admin view) in the given sort
+// order, newest first by default
+func (s *AdminService) GetAllSongs(limit, offset int, sort string) (*models.Paginated[models.Song], error) {
 	logger.Info(logger.CategoryDB, "Retrieving all songs (admin view): limit=%d, offset=%d", limit, offset)
 
+	order, err := songOrderBy(sort)
+	if err != nil {
+		return nil, err
+	}
+
+	var total int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM songs WHERE deleted_at IS NULL`).Scan(&total); err != nil {
+		logger.Error(logger.CategoryDB, "Failed to count songs", err)
+		return nil, err
+	}
+
 	rows, err := s.db.Query(`
 		SELECT s.id, s.title, s.artist_id, s.album_id, s.category_id,
 			   s.duration_seconds, s.file_path, s.format, s.uploaded_by_user_id,
@@ -305,7 +729,8 @@ func (s *AdminService) GetAllSongs(limit, offset int) ([]models.Song, error) {
 		LEFT JOIN artists a ON s.artist_id = a.id
 		LEFT JOIN albums al ON s.album_id = al.id
 		LEFT JOIN categories c ON s.category_id = c.id
-		ORDER BY s.created_at DESC
+		WHERE s.deleted_at IS NULL
+		ORDER BY `+order+`
 		LIMIT ? OFFSET ?
 	`, limit, offset)
 
@@ -343,5 +768,53 @@ func (s *AdminService) GetAllSongs(limit, offset int) ([]models.Song, error) {
 		songs = append(songs, song)
 	}
 
-	return songs, nil
-}
\ No newline at end of file
+	return models.NewPaginated(songs, total, limit, offset), nil
+}
+
+// backupLabelPattern keeps client-supplied labels to a plain file name
+// fragment so they can't point outside the backups directory
+var backupLabelPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// BackupDatabase writes a consistent copy of the live database to destPath
+// with VACUUM INTO, which is safe while other connections keep writing.
+// destPath must not already exist
+func (s *AdminService) BackupDatabase(destPath string) error {
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		logger.Error(logger.CategoryFile, "Failed to create backup directory", err)
+		return err
+	}
+
+	if _, err := s.db.Exec(`VACUUM INTO ?`, destPath); err != nil {
+		logger.Error(logger.CategoryDB, "Database backup failed", err)
+		return err
+	}
+
+	logger.Info(logger.CategoryDB, "Database backed up to %s", destPath)
+	return nil
+}
+
+// CreateBackup snapshots the database into the backups directory under a
+// timestamped name, with an optional label appended, and returns its path
+func (s *AdminService) CreateBackup(label string) (string, error) {
+	if s.backupPath == "" {
+		return "", internalError("backups are not configured", nil)
+	}
+
+	name := "tunetudo-" + time.Now().UTC().Format("20060102-150405")
+	if label != "" {
+		if !backupLabelPattern.MatchString(label) {
+			return "", apperrors.ValidationError("invalid backup name", nil)
+		}
+		name += "-" + label
+	}
+
+	destPath := filepath.Join(s.backupPath, name+".db")
+	if _, err := os.Stat(destPath); err == nil {
+		return "", apperrors.ConflictError("backup already exists")
+	}
+
+	if err := s.BackupDatabase(destPath); err != nil {
+		return "", internalError("failed to back up database", err)
+	}
+	return destPath, nil
+}
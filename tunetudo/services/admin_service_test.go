@@ -0,0 +1,519 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"fmt"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	"tunetudo/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupTestAdminService(t *testing.T) (*AdminService, string, func()) {
+	db := setupTestDB(t)
+
+	storageDir := "./test_storage_" + t.Name()
+	os.MkdirAll(storageDir, 0755)
+
+	service := NewAdminService(db, storageDir)
+	service.SetTrashPath(storageDir + "_trash")
+
+	cleanup := func() {
+		db.Close()
+		os.RemoveAll(storageDir)
+		os.RemoveAll(storageDir + "_trash")
+	}
+
+	return service, storageDir, cleanup
+}
+
+func TestAdminUploadSong(t *testing.T) {
+	service, _, cleanup := setupTestAdminService(t)
+	defer cleanup()
+
+	file := newTestFileHeader(t, "track.mp3", []byte("fake mp3 data"))
+
+	song, err := service.UploadSong(file, "New Song", "New Artist", "New Album", 1, 200, 0, 0)
+	require.NoError(t, err)
+	assert.Greater(t, song.ID, 0)
+	require.NotNil(t, song.AlbumID)
+
+	assert.Equal(t, 1, countRows(t, service.db, "artists"))
+	assert.Equal(t, 1, countRows(t, service.db, "albums"))
+	assert.Equal(t, 1, countRows(t, service.db, "songs"))
+}
+
+func TestAdminUploadSongMergesArtistVariants(t *testing.T) {
+	service, _, cleanup := setupTestAdminService(t)
+	defer cleanup()
+
+	variants := []string{"The  Beatles", "the beatles ", "Beatles, The", "BEATLES"}
+	for i, artist := range variants {
+		file := newTestFileHeader(t, "track.mp3", []byte("fake mp3 data"))
+		_, err := service.UploadSong(file, fmt.Sprintf("Song %d", i), artist, "", 1, 200, 0, 0)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, 1, countRows(t, service.db, "artists"))
+	var name, key string
+	require.NoError(t, service.db.QueryRow(`SELECT name, name_key FROM artists`).Scan(&name, &key))
+	assert.Equal(t, "The Beatles", name, "the first spelling is kept for display")
+	assert.Equal(t, "beatles", key)
+
+	file := newTestFileHeader(t, "track.mp3", []byte("fake mp3 data"))
+	_, err := service.UploadSong(file, "Song 0", "Beatles, The", "", 1, 200, 0, 0)
+	assert.Error(t, err, "a song is a duplicate under any spelling of its artist")
+
+	file = newTestFileHeader(t, "track.mp3", []byte("fake mp3 data"))
+	_, err = service.UploadSong(file, "Other Song", "The Beatles Tribute", "", 1, 200, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, countRows(t, service.db, "artists"))
+}
+
+func TestAdminSongTrackNumbers(t *testing.T) {
+	service, _, cleanup := setupTestAdminService(t)
+	defer cleanup()
+
+	file := newTestFileHeader(t, "track.mp3", []byte("fake mp3 data"))
+	song, err := service.UploadSong(file, "Opener", "Some Artist", "Some Album", 1, 200, 1, 2)
+	require.NoError(t, err)
+	require.NotNil(t, song.TrackNumber)
+	require.NotNil(t, song.DiscNumber)
+	assert.Equal(t, 1, *song.TrackNumber)
+	assert.Equal(t, 2, *song.DiscNumber)
+
+	position := func() (sql.NullInt64, sql.NullInt64) {
+		var track, disc sql.NullInt64
+		require.NoError(t, service.db.QueryRow(`SELECT track_number, disc_number FROM songs WHERE id = ?`, song.ID).
+			Scan(&track, &disc))
+		return track, disc
+	}
+
+	// Only the fields sent change, and zero clears a number
+	track := 5
+	require.NoError(t, service.UpdateSong(song.ID, models.UpdateSongRequest{TrackNumber: &track}))
+	gotTrack, gotDisc := position()
+	assert.Equal(t, int64(5), gotTrack.Int64)
+	assert.Equal(t, int64(2), gotDisc.Int64)
+
+	zero := 0
+	require.NoError(t, service.UpdateSong(song.ID, models.UpdateSongRequest{DiscNumber: &zero}))
+	_, gotDisc = position()
+	assert.False(t, gotDisc.Valid)
+
+	negative := -1
+	assert.Error(t, service.UpdateSong(song.ID, models.UpdateSongRequest{TrackNumber: &negative}))
+	assert.Error(t, service.UpdateSong(song.ID, models.UpdateSongRequest{}))
+	assert.Error(t, service.UpdateSong(99999, models.UpdateSongRequest{TrackNumber: &track}))
+}
+
+func TestAdminUploadSongValidatesCategory(t *testing.T) {
+	service, storageDir, cleanup := setupTestAdminService(t)
+	defer cleanup()
+
+	tests := []struct {
+		name       string
+		categoryID int
+		wantErr    bool
+	}{
+		{"Existing category", 2, false},
+		{"No category", 0, false},
+		{"Unknown category", 99, true},
+		{"Negative category", -1, true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := newTestFileHeader(t, "track.mp3", []byte("fake mp3 data"))
+			song, err := service.UploadSong(file, fmt.Sprintf("Song %d", i), "Some Artist", "", tt.categoryID, 200, 0, 0)
+			if tt.wantErr {
+				require.Error(t, err)
+				assert.Equal(t, "invalid category", err.Error())
+				return
+			}
+			require.NoError(t, err)
+			if tt.categoryID == 0 {
+				assert.Nil(t, song.CategoryID)
+			} else if assert.NotNil(t, song.CategoryID) {
+				assert.Equal(t, tt.categoryID, *song.CategoryID)
+			}
+		})
+	}
+
+	assert.Equal(t, 2, countRows(t, service.db, "songs"))
+	assert.Len(t, listStoredFiles(t, storageDir), 2, "rejected uploads leave no file behind")
+}
+
+func TestAdminUploadSongRollsBackOnFailure(t *testing.T) {
+	service, storageDir, cleanup := setupTestAdminService(t)
+	defer cleanup()
+
+	failSongInserts(t, service.db)
+
+	file := newTestFileHeader(t, "track.mp3", []byte("fake mp3 data"))
+
+	song, err := service.UploadSong(file, "New Song", "Brand New Artist", "Brand New Album", 1, 200, 0, 0)
+	assert.Error(t, err)
+	assert.Nil(t, song)
+
+	// The artist and album created earlier in the upload must not leak
+	assert.Equal(t, 0, countRows(t, service.db, "artists"))
+	assert.Equal(t, 0, countRows(t, service.db, "albums"))
+
+	// The copied file must not be left behind
+	assert.Empty(t, listStoredFiles(t, storageDir))
+}
+
+func TestSoftDeleteSong(t *testing.T) {
+	service, storageDir, cleanup := setupTestAdminService(t)
+	defer cleanup()
+
+	file := newTestFileHeader(t, "track.mp3", []byte("fake mp3 data"))
+	song, err := service.UploadSong(file, "Trashed Song", "Some Artist", "", 1, 200, 0, 0)
+	require.NoError(t, err)
+
+	search := NewSearchService(service.db)
+	playback := NewPlaybackService(service.db, storageDir)
+
+	require.NoError(t, service.DeleteSong(song.ID))
+
+	t.Run("Hidden from listings", func(t *testing.T) {
+		songs, err := service.GetAllSongs(50, 0, "")
+		require.NoError(t, err)
+		assert.Empty(t, songs.Items)
+		assert.Equal(t, 0, songs.Meta.Total)
+
+		recent, err := playback.GetRecentSongs(20, "", false)
+		require.NoError(t, err)
+		assert.Empty(t, recent)
+
+		byCategory, err := search.GetSongsByCategory(1, 100, 0, "", false)
+		require.NoError(t, err)
+		assert.Empty(t, byCategory.Items)
+
+		result, err := search.FullTextSearch("Trashed", 50, 0, "", false)
+		require.NoError(t, err)
+		assert.Empty(t, result.Songs.Items)
+
+		_, err = playback.GetSongByID(song.ID)
+		assert.Error(t, err)
+	})
+
+	t.Run("File moved to trash", func(t *testing.T) {
+		assert.NoFileExists(t, filepath.Join(storageDir, song.FilePath))
+		assert.FileExists(t, service.trashPath(song.FilePath))
+		assert.NoDirExists(t, filepath.Join(storageDir, "trash"), "the trash is kept out of storage")
+	})
+
+	t.Run("Restore before purge", func(t *testing.T) {
+		purged, err := service.PurgeDeleted(time.Hour)
+		require.NoError(t, err)
+		assert.Equal(t, 0, purged)
+
+		require.NoError(t, service.RestoreSong(song.ID))
+
+		songs, err := service.GetAllSongs(50, 0, "")
+		require.NoError(t, err)
+		require.Len(t, songs.Items, 1)
+		assert.Equal(t, song.ID, songs.Items[0].ID)
+
+		token, err := playback.GenerateStreamToken(song.ID, 0, time.Minute)
+		require.NoError(t, err)
+		_, err = playback.AuthorizeStream(song.ID, token, 0)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Restore song not in trash", func(t *testing.T) {
+		assert.Error(t, service.RestoreSong(song.ID))
+	})
+
+	t.Run("Restore refused when the file is gone", func(t *testing.T) {
+		require.NoError(t, service.DeleteSong(song.ID))
+		require.NoError(t, os.Remove(service.trashPath(song.FilePath)))
+
+		err := service.RestoreSong(song.ID)
+		assert.EqualError(t, err, fmt.Sprintf("song file %s not found in trash", song.FilePath))
+
+		songs, err := service.GetAllSongs(50, 0, "")
+		require.NoError(t, err)
+		assert.Empty(t, songs.Items, "the song stays in the trash")
+	})
+}
+
+func TestDeleteSongs(t *testing.T) {
+	service, storageDir, cleanup := setupTestAdminService(t)
+	defer cleanup()
+
+	var songs []*models.Song
+	for i := 0; i < 3; i++ {
+		file := newTestFileHeader(t, "track.mp3", []byte(fmt.Sprintf("fake mp3 data %d", i)))
+		song, err := service.UploadSong(file, fmt.Sprintf("Bad Import %d", i), "Some Artist", "", 1, 200, 0, 0)
+		require.NoError(t, err)
+		songs = append(songs, song)
+	}
+	require.NoError(t, service.DeleteSong(songs[2].ID))
+
+	deleted, failed, err := service.DeleteSongs([]int{songs[0].ID, 99999, songs[1].ID, songs[0].ID, songs[2].ID})
+	require.NoError(t, err)
+	assert.Equal(t, []int{songs[0].ID, songs[1].ID}, deleted)
+	assert.Equal(t, []int{99999, songs[2].ID}, failed, "missing and already trashed songs are reported")
+
+	listed, err := service.GetAllSongs(50, 0, "")
+	require.NoError(t, err)
+	assert.Empty(t, listed.Items)
+	for _, song := range songs[:2] {
+		assert.NoFileExists(t, filepath.Join(storageDir, song.FilePath))
+		assert.FileExists(t, service.trashPath(song.FilePath))
+	}
+
+	// Bulk-deleted songs can be restored one at a time
+	require.NoError(t, service.RestoreSong(songs[1].ID))
+
+	_, _, err = service.DeleteSongs(nil)
+	assert.Error(t, err)
+	_, _, err = service.DeleteSongs(make([]int, maxBulkDeleteSongs+1))
+	assert.Error(t, err)
+}
+
+func TestPurgeDeleted(t *testing.T) {
+	service, storageDir, cleanup := setupTestAdminService(t)
+	defer cleanup()
+
+	file := newTestFileHeader(t, "track.mp3", []byte("fake mp3 data"))
+	song, err := service.UploadSong(file, "Old Song", "Some Artist", "", 1, 200, 0, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, service.DeleteSong(song.ID))
+
+	// Pretend the song was deleted long ago
+	_, err = service.db.Exec(`UPDATE songs SET deleted_at = datetime('now', '-2 days') WHERE id = ?`, song.ID)
+	require.NoError(t, err)
+
+	purged, err := service.PurgeDeleted(24 * time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	assert.Equal(t, 0, countRows(t, service.db, "songs"))
+	assert.Empty(t, listStoredFiles(t, storageDir))
+	assert.Error(t, service.RestoreSong(song.ID))
+}
+
+func TestAdminListPagination(t *testing.T) {
+	service, _, cleanup := setupTestAdminService(t)
+	defer cleanup()
+
+	seedTestData(t, service.db)
+	for _, name := range []string{"alice", "bob", "carol"} {
+		_, err := service.db.Exec(`INSERT INTO users (username, email, password_hash) VALUES (?, ?, ?)`,
+			name, name+"@test.com", "hash")
+		require.NoError(t, err)
+	}
+
+	t.Run("Songs", func(t *testing.T) {
+		page, err := service.GetAllSongs(2, 0, "")
+		require.NoError(t, err)
+		assert.Len(t, page.Items, 2)
+		assert.Equal(t, 3, page.Meta.Total)
+		assert.True(t, page.Meta.HasMore)
+	})
+
+	t.Run("Users", func(t *testing.T) {
+		page, err := service.GetAllUsers(1, 0, "", "")
+		require.NoError(t, err)
+		assert.Len(t, page.Items, 1)
+		assert.Equal(t, 3, page.Meta.Total)
+
+		page, err = service.GetAllUsers(10, 0, "", "")
+		require.NoError(t, err)
+		assert.Len(t, page.Items, 3)
+		assert.Equal(t, 3, page.Meta.Total)
+		assert.False(t, page.Meta.HasMore)
+	})
+}
+
+func TestAdminUserSearch(t *testing.T) {
+	service, _, cleanup := setupTestAdminService(t)
+	defer cleanup()
+
+	for _, user := range []struct {
+		name             string
+		admin, suspended bool
+	}{
+		{"alice", true, false},
+		{"alfred", false, true},
+		{"al_bundy", false, false},
+		{"bob", false, false},
+	} {
+		_, err := service.db.Exec(`INSERT INTO users (username, email, password_hash, is_admin, suspended) VALUES (?, ?, ?, ?, ?)`,
+			user.name, user.name+"@test.com", "hash", user.admin, user.suspended)
+		require.NoError(t, err)
+	}
+	_, err := service.db.Exec(`UPDATE users SET email = 'alpha@test.com' WHERE username = 'bob'`)
+	require.NoError(t, err)
+
+	usernames := func(page *models.Paginated[models.User]) []string {
+		names := []string{}
+		for _, user := range page.Items {
+			names = append(names, user.Username)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	page, err := service.GetAllUsers(10, 0, "AL", "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"al_bundy", "alfred", "alice", "bob"}, usernames(page), "usernames and emails match by prefix")
+	assert.Equal(t, 4, page.Meta.Total)
+
+	page, err = service.GetAllUsers(2, 2, "al", "")
+	require.NoError(t, err)
+	assert.Len(t, page.Items, 2)
+	assert.Equal(t, 4, page.Meta.Total)
+	assert.False(t, page.Meta.HasMore)
+
+	page, err = service.GetAllUsers(10, 0, "al_", "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"al_bundy"}, usernames(page), "wildcards in the search match literally")
+
+	page, err = service.GetAllUsers(10, 0, "lice", "")
+	require.NoError(t, err)
+	assert.Empty(t, page.Items)
+
+	page, err = service.GetAllUsers(10, 0, "", UserFilterAdmins)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice"}, usernames(page))
+	page, err = service.GetAllUsers(10, 0, "al", UserFilterSuspended)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alfred"}, usernames(page))
+	assert.Equal(t, 1, page.Meta.Total)
+
+	_, err = service.GetAllUsers(10, 0, "", "moderators")
+	assert.Error(t, err)
+}
+
+func TestBackupDatabase(t *testing.T) {
+	service, _, cleanup := setupTestAdminService(t)
+	defer cleanup()
+	seedTestData(t, service.db)
+
+	backupDir := t.TempDir()
+	service.SetBackupPath(backupDir)
+
+	t.Run("Creates an openable copy", func(t *testing.T) {
+		path, err := service.CreateBackup("nightly")
+		require.NoError(t, err)
+		assert.Equal(t, backupDir, filepath.Dir(path))
+		assert.True(t, strings.HasSuffix(path, "-nightly.db"))
+
+		backup, err := sql.Open("sqlite3", path)
+		require.NoError(t, err)
+		defer backup.Close()
+
+		var integrity string
+		require.NoError(t, backup.QueryRow(`PRAGMA integrity_check`).Scan(&integrity))
+		assert.Equal(t, "ok", integrity)
+		assert.Equal(t, countRows(t, service.db, "songs"), countRows(t, backup, "songs"))
+	})
+
+	t.Run("Existing backup is not overwritten", func(t *testing.T) {
+		dest := filepath.Join(backupDir, "manual.db")
+		require.NoError(t, service.BackupDatabase(dest))
+		assert.Error(t, service.BackupDatabase(dest))
+	})
+
+	t.Run("Rejects path traversal in the label", func(t *testing.T) {
+		for _, label := range []string{"../escape", "a/b", `..\\x`, "name.db", strings.Repeat("a", 65)} {
+			_, err := service.CreateBackup(label)
+			assert.EqualError(t, err, "invalid backup name", label)
+		}
+
+		entries, err := os.ReadDir(filepath.Dir(backupDir))
+		require.NoError(t, err)
+		for _, entry := range entries {
+			assert.NotContains(t, entry.Name(), "escape")
+		}
+	})
+}
+
+// newTestZipHeader packs files (name -> content) into a zip upload
+func newTestZipHeader(t *testing.T, files [][2]string) *multipart.FileHeader {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, file := range files {
+		w, err := writer.Create(file[0])
+		require.NoError(t, err)
+		w.Write([]byte(file[1]))
+	}
+	require.NoError(t, writer.Close())
+	return newTestFileHeader(t, "songs.zip", buf.Bytes())
+}
+
+func TestBulkUpload(t *testing.T) {
+	service, storageDir, cleanup := setupTestAdminService(t)
+	defer cleanup()
+
+	zipFile := newTestZipHeader(t, [][2]string{
+		{"Plain Track.mp3", "fake mp3 data"},
+		{"Some Band - Live Song.wav", "fake wav data"},
+		{"album/Described.mp3", "fake mp3 data"},
+		{"album/Described.json", `{"title":"From Sidecar","artist":"Sidecar Artist","album":"Sidecar Album","category_id":2,"duration":180}`},
+		{"notes.txt", "not audio"},
+		{"../escape.mp3", "fake mp3 data"},
+		{"__MACOSX/._Plain Track.mp3", "resource fork"},
+	})
+
+	results, err := service.BulkUpload(zipFile, 1)
+	require.NoError(t, err)
+
+	byFile := make(map[string]models.BulkResult)
+	for _, result := range results {
+		byFile[result.File] = result
+	}
+	require.Len(t, byFile, 5, "directories, sidecars and archiver metadata are not reported")
+
+	for _, name := range []string{"Plain Track.mp3", "Some Band - Live Song.wav", "album/Described.mp3"} {
+		assert.True(t, byFile[name].Success, name)
+		assert.Greater(t, byFile[name].SongID, 0, name)
+	}
+	assert.False(t, byFile["notes.txt"].Success)
+	assert.Contains(t, byFile["notes.txt"].Error, "invalid format")
+	assert.False(t, byFile["../escape.mp3"].Success)
+	assert.Equal(t, "unsafe file path", byFile["../escape.mp3"].Error)
+
+	var title, artist string
+	var categoryID int
+	require.NoError(t, service.db.QueryRow(`
+		SELECT s.title, a.name, s.category_id FROM songs s JOIN artists a ON a.id = s.artist_id WHERE s.id = ?
+	`, byFile["album/Described.mp3"].SongID).Scan(&title, &artist, &categoryID))
+	assert.Equal(t, "From Sidecar", title)
+	assert.Equal(t, "Sidecar Artist", artist)
+	assert.Equal(t, 2, categoryID)
+
+	require.NoError(t, service.db.QueryRow(`
+		SELECT s.title, a.name, s.category_id FROM songs s JOIN artists a ON a.id = s.artist_id WHERE s.id = ?
+	`, byFile["Some Band - Live Song.wav"].SongID).Scan(&title, &artist, &categoryID))
+	assert.Equal(t, "Live Song", title)
+	assert.Equal(t, "Some Band", artist)
+	assert.Equal(t, 1, categoryID)
+
+	assert.Equal(t, 3, countRows(t, service.db, "songs"))
+	assert.Len(t, listStoredFiles(t, storageDir), 3)
+	assert.NoFileExists(t, filepath.Join(filepath.Dir(storageDir), "escape.mp3"))
+}
+
+func TestBulkUploadRejectsInvalidArchive(t *testing.T) {
+	service, _, cleanup := setupTestAdminService(t)
+	defer cleanup()
+
+	_, err := service.BulkUpload(newTestFileHeader(t, "songs.zip", []byte("not a zip")), 1)
+	assert.Error(t, err)
+	assert.Equal(t, 0, countRows(t, service.db, "songs"))
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// attemptLimiter allows max attempts per key within a fixed window that
+// starts at the key's first attempt. Expired keys are dropped as it goes
+type attemptLimiter struct {
+	max    int
+	window time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	attempts  map[string]*attemptWindow
+	lastSweep time.Time
+}
+
+type attemptWindow struct {
+	count   int
+	resetAt time.Time
+}
+
+func newAttemptLimiter(max int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{
+		max:      max,
+		window:   window,
+		now:      time.Now,
+		attempts: make(map[string]*attemptWindow),
+	}
+}
+
+// Allow records an attempt for key and reports whether it is within the limit
+func (l *attemptLimiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= l.window {
+		for k, w := range l.attempts {
+			if !now.Before(w.resetAt) {
+				delete(l.attempts, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	w, ok := l.attempts[key]
+	if !ok || !now.Before(w.resetAt) {
+		w = &attemptWindow{resetAt: now.Add(l.window)}
+		l.attempts[key] = w
+	}
+	w.count++
+	return w.count <= l.max
+}
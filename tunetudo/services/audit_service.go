@@ -0,0 +1,120 @@
+package services
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+	"tunetudo/logger"
+	"tunetudo/models"
+)
+
+// auditTimeFormat matches SQLite's CURRENT_TIMESTAMP so stored times compare as text
+const auditTimeFormat = "2006-01-02 15:04:05"
+
+type AuditService struct {
+	db *sql.DB
+}
+
+func NewAuditService(db *sql.DB) *AuditService {
+	return &AuditService{db: db}
+}
+
+// RecordAuditEvent stores a security event; it implements logger.AuditSink
+func (s *AuditService) RecordAuditEvent(eventType, userHash, maskedIP, details string, at time.Time) error {
+	_, err := s.db.Exec(`
+		INSERT INTO audit_log (event_type, user_hash, masked_ip, details, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, eventType, userHash, maskedIP, details, at.UTC().Format(auditTimeFormat))
+	return err
+}
+
+// auditPurgeInterval is how often entries past the retention are removed
+const auditPurgeInterval = time.Hour
+
+// PurgeAuditLog deletes entries older than olderThan, returning how many
+// were removed
+func (s *AuditService) PurgeAuditLog(olderThan time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-olderThan).UTC().Format(auditTimeFormat)
+	result, err := s.db.Exec(`DELETE FROM audit_log WHERE created_at < ?`, cutoff)
+	if err != nil {
+		logger.Error(logger.CategoryDB, "Failed to purge audit log", err)
+		return 0, err
+	}
+	purged, _ := result.RowsAffected()
+	if purged > 0 {
+		logger.Info(logger.CategoryAdmin, "Purged %d audit entries older than %s", purged, olderThan)
+	}
+	return purged, nil
+}
+
+// ScheduleAuditPurge keeps the audit log to retention, purging now and then
+// every auditPurgeInterval for the life of the process
+func (s *AuditService) ScheduleAuditPurge(retention time.Duration) {
+	s.PurgeAuditLog(retention)
+
+	go func() {
+		ticker := time.NewTicker(auditPurgeInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.PurgeAuditLog(retention)
+		}
+	}()
+}
+
+// QueryAuditLog returns a page of audit entries, newest first. An empty
+// eventType or zero from/to leaves that filter off; both bounds are inclusive
+func (s *AuditService) QueryAuditLog(eventType string, from, to time.Time, limit, offset int) (*models.Paginated[models.AuditEntry], error) {
+	var conditions []string
+	var args []interface{}
+
+	if eventType != "" {
+		conditions = append(conditions, "event_type = ?")
+		args = append(args, eventType)
+	}
+	if !from.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, from.UTC().Format(auditTimeFormat))
+	}
+	if !to.IsZero() {
+		conditions = append(conditions, "created_at <= ?")
+		args = append(args, to.UTC().Format(auditTimeFormat))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM audit_log `+where, args...).Scan(&total); err != nil {
+		logger.Error(logger.CategoryDB, "Failed to count audit entries", err)
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT id, event_type, user_hash, masked_ip, details, created_at
+		FROM audit_log `+where+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
+	if err != nil {
+		logger.Error(logger.CategoryDB, "Failed to query audit log", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+	for rows.Next() {
+		var entry models.AuditEntry
+		var maskedIP, details sql.NullString
+		if err := rows.Scan(&entry.ID, &entry.EventType, &entry.UserHash, &maskedIP, &details, &entry.CreatedAt); err != nil {
+			logger.Warning(logger.CategoryDB, "Failed to scan audit row")
+			continue
+		}
+		entry.MaskedIP = maskedIP.String
+		entry.Details = details.String
+		entries = append(entries, entry)
+	}
+
+	return models.NewPaginated(entries, total, limit, offset), nil
+}
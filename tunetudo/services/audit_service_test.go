@@ -0,0 +1,113 @@
+package services
+
+import (
+	"testing"
+	"time"
+	"tunetudo/logger"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupTestAuditService(t *testing.T) *AuditService {
+	db := setupTestDB(t)
+	service := NewAuditService(db)
+
+	logger.SetAuditSink(service)
+	t.Cleanup(func() { logger.SetAuditSink(nil) })
+
+	return service
+}
+
+func TestAuditLogRecordsAdminActions(t *testing.T) {
+	service := setupTestAuditService(t)
+
+	logger.AdminAction("auditadmin", "10.1.2.3", "SUSPEND_USER", "target_user_id=7")
+	logger.AccessDenied("someone", "10.1.2.3", "/api/admin/users", "Admin access required")
+	logger.FlushAudit()
+
+	page, err := service.QueryAuditLog("ADMIN_ACTION", time.Time{}, time.Time{}, 50, 0)
+	require.NoError(t, err)
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, 1, page.Meta.Total)
+
+	entry := page.Items[0]
+	assert.Equal(t, "ADMIN_ACTION", entry.EventType)
+	assert.Contains(t, entry.Details, "SUSPEND_USER")
+
+	// Only the hashed user and masked IP are stored
+	assert.Equal(t, logger.HashIdentifier("auditadmin"), entry.UserHash)
+	assert.Equal(t, "10.1.x.x", entry.MaskedIP)
+	assert.NotContains(t, entry.Details, "auditadmin")
+
+	all, err := service.QueryAuditLog("", time.Time{}, time.Time{}, 50, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, all.Meta.Total)
+}
+
+func TestAuditLogDateRange(t *testing.T) {
+	service := setupTestAuditService(t)
+
+	now := time.Now()
+	require.NoError(t, service.RecordAuditEvent("ADMIN_ACTION", "user_old", "10.0.x.x", "old", now.Add(-72*time.Hour)))
+	require.NoError(t, service.RecordAuditEvent("ADMIN_ACTION", "user_new", "10.0.x.x", "new", now))
+
+	t.Run("From excludes older entries", func(t *testing.T) {
+		page, err := service.QueryAuditLog("ADMIN_ACTION", now.Add(-time.Hour), time.Time{}, 50, 0)
+		require.NoError(t, err)
+		require.Len(t, page.Items, 1)
+		assert.Equal(t, "new", page.Items[0].Details)
+	})
+
+	t.Run("To excludes newer entries", func(t *testing.T) {
+		page, err := service.QueryAuditLog("ADMIN_ACTION", time.Time{}, now.Add(-24*time.Hour), 50, 0)
+		require.NoError(t, err)
+		require.Len(t, page.Items, 1)
+		assert.Equal(t, "old", page.Items[0].Details)
+	})
+
+	t.Run("Other event types are filtered out", func(t *testing.T) {
+		page, err := service.QueryAuditLog("ACCESS_DENIED", time.Time{}, time.Time{}, 50, 0)
+		require.NoError(t, err)
+		assert.Empty(t, page.Items)
+		assert.Equal(t, 0, page.Meta.Total)
+	})
+}
+
+func TestAuditLogQueuedWrites(t *testing.T) {
+	service := setupTestAuditService(t)
+
+	for i := 0; i < 50; i++ {
+		logger.AccessDenied("anonymous", "10.1.2.3", "/api/profile", "Authentication required")
+	}
+	// Replacing the sink writes out what was queued
+	logger.SetAuditSink(nil)
+
+	page, err := service.QueryAuditLog("ACCESS_DENIED", time.Time{}, time.Time{}, 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 50, page.Meta.Total)
+
+	// Without a sink events are only logged
+	logger.AccessDenied("anonymous", "10.1.2.3", "/api/profile", "Authentication required")
+	logger.FlushAudit()
+	page, err = service.QueryAuditLog("ACCESS_DENIED", time.Time{}, time.Time{}, 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 50, page.Meta.Total)
+}
+
+func TestPurgeAuditLog(t *testing.T) {
+	service := setupTestAuditService(t)
+
+	now := time.Now()
+	require.NoError(t, service.RecordAuditEvent("ACCESS_DENIED", "user_old", "10.0.x.x", "old", now.Add(-100*24*time.Hour)))
+	require.NoError(t, service.RecordAuditEvent("ACCESS_DENIED", "user_new", "10.0.x.x", "new", now.Add(-time.Hour)))
+
+	purged, err := service.PurgeAuditLog(90 * 24 * time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	page, err := service.QueryAuditLog("", time.Time{}, time.Time{}, 50, 0)
+	require.NoError(t, err)
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, "new", page.Items[0].Details)
+}
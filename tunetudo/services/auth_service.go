@@ -7,30 +7,132 @@ import (
 	"tunetudo/logger"
 	"tunetudo/models"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/base64"
 	"fmt"
-	"net/smtp"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	apperrors "tunetudo/errors"
 
 	"github.com/golang-jwt/jwt/v4"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// Password reset emails allowed per hour. The per-IP allowance is higher
+// so users behind one NAT can still reset their own accounts
+const (
+	passwordResetEmailLimit = 3
+	passwordResetIPLimit    = 10
+	passwordResetWindow     = time.Hour
+)
+
+// Reset emails are retried this many times in total, waiting
+// resetEmailRetryDelay before the second attempt and doubling after that
+const (
+	resetEmailAttempts   = 4
+	resetEmailRetryDelay = 2 * time.Second
+)
+
+// defaultResetTokenTTL is how long a reset link works when
+// SetResetTokenTTL isn't called
+const defaultResetTokenTTL = 15 * time.Minute
+
 type AuthService struct {
-	db        *sql.DB
-	jwtSecret []byte
+	db             *sql.DB
+	jwtSecret      []byte
+	storagePath    string
+	appBaseURL     string
+	passwordPolicy PasswordPolicy
+	bcryptCost     int
+
+	resetEmailLimiter *attemptLimiter
+	resetIPLimiter    *attemptLimiter
+	emailSender       EmailSender
+	emailRetryDelay   time.Duration
+	emails            sync.WaitGroup
+	resetTokenTTL     time.Duration
+
+	captcha        CaptchaVerifier
+	captchaOnReset bool
+	googleOAuth    OAuthProvider
 }
 
 func NewAuthService(db *sql.DB, jwtSecret string) *AuthService {
 	return &AuthService{
-		db:        db,
-		jwtSecret: []byte(jwtSecret),
+		db:                db,
+		jwtSecret:         []byte(jwtSecret),
+		appBaseURL:        "https://localhost:2701",
+		passwordPolicy:    DefaultPasswordPolicy(),
+		bcryptCost:        bcrypt.DefaultCost,
+		resetEmailLimiter: newAttemptLimiter(passwordResetEmailLimit, passwordResetWindow),
+		resetIPLimiter:    newAttemptLimiter(passwordResetIPLimit, passwordResetWindow),
+		emailRetryDelay:   resetEmailRetryDelay,
+		resetTokenTTL:     defaultResetTokenTTL,
+	}
+}
+
+// SetStoragePath tells the service where user files live so account
+// deletion can remove them
+func (s *AuthService) SetStoragePath(storagePath string) {
+	s.storagePath = storagePath
+}
+
+// SetAppBaseURL sets the public origin that emailed links point at
+func (s *AuthService) SetAppBaseURL(baseURL string) {
+	s.appBaseURL = strings.TrimRight(baseURL, "/")
+}
+
+// SetPasswordPolicy replaces the rules applied to new passwords
+func (s *AuthService) SetPasswordPolicy(policy PasswordPolicy) {
+	s.passwordPolicy = policy
+}
+
+// SetBcryptCost sets the cost of new password hashes. Existing hashes below
+// it are upgraded the next time their owner logs in
+func (s *AuthService) SetBcryptCost(cost int) {
+	s.bcryptCost = cost
+}
+
+// SetResetTokenTTL sets how long password reset links work; the reset
+// email states the same duration
+func (s *AuthService) SetResetTokenTTL(ttl time.Duration) {
+	if ttl > 0 {
+		s.resetTokenTTL = ttl
+	}
+}
+
+func (s *AuthService) hashPassword(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), s.bcryptCost)
+	return string(hashed), err
+}
+
+// upgradeHash rehashes a just-verified password whose stored hash is cheaper
+// than the configured cost. Failures only leave the old hash in place
+func (s *AuthService) upgradeHash(userID int, passwordHash, password string) {
+	if cost, err := bcrypt.Cost([]byte(passwordHash)); err != nil || cost >= s.bcryptCost {
+		return
+	}
+
+	hashedPassword, err := s.hashPassword(password)
+	if err != nil {
+		logger.Error(logger.CategoryAuth, "Failed to rehash password", err)
+		return
+	}
+	if _, err := s.db.Exec(`UPDATE users SET password_hash = ? WHERE id = ? AND password_hash = ?`,
+		hashedPassword, userID, passwordHash); err != nil {
+		logger.Error(logger.CategoryAuth, "Failed to store rehashed password", err)
 	}
 }
 
-// Add to existing AuthService struct
+// PasswordResetToken is a pending reset. Only the SHA-256 of the token is
+// kept; the token itself exists solely in the emailed link
 type PasswordResetToken struct {
-	Token     string
+	TokenHash string
 	Email     string
 	ExpiresAt time.Time
 }
@@ -46,19 +148,45 @@ func GenerateSecureToken() (string, error) {
 	return base64.URLEncoding.EncodeToString(bytes), nil
 }
 
-// SendPasswordResetEmail sends password reset email with token
-func SendPasswordResetEmail(toEmail, token string) error {
-	smtpHost := os.Getenv("SMTP_HOST")
-	smtpPort := os.Getenv("SMTP_PORT")
-	smtpUser := os.Getenv("SMTP_USER")
-	smtpPass := os.Getenv("SMTP_PASS")
-	fromEmail := os.Getenv("FROM_EMAIL")
+// hashResetToken is the form a reset token is stored and compared in
+func hashResetToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
 
-	if smtpHost == "" || smtpPort == "" || smtpUser == "" || smtpPass == "" {
-		return fmt.Errorf("email configuration missing in .env file")
+// issueResetToken creates and stores a reset token for email, valid for
+// ttl, replacing any earlier one
+func issueResetToken(email string, ttl time.Duration) (string, time.Time, error) {
+	token, err := GenerateSecureToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	passwordResetStore[email] = PasswordResetToken{
+		TokenHash: hashResetToken(token),
+		Email:     email,
+		ExpiresAt: expiresAt,
 	}
+	return token, expiresAt, nil
+}
 
-	resetLink := fmt.Sprintf("https://localhost:2701/reset-password.html?token=%s", token)
+// passwordResetLink is the page a reset email sends the user to
+func (s *AuthService) passwordResetLink(token string) string {
+	return s.appBaseURL + "/reset-password.html?token=" + url.QueryEscape(token)
+}
+
+// SetEmailSender sets how password reset emails are delivered. Without
+// one, reset requests are accepted but no email goes out
+func (s *AuthService) SetEmailSender(sender EmailSender) {
+	s.emailSender = sender
+}
+
+// sendPasswordResetEmail sends password reset email with the reset link
+func (s *AuthService) sendPasswordResetEmail(toEmail, resetLink string) error {
+	if s.emailSender == nil {
+		return fmt.Errorf("email delivery is not configured")
+	}
 
 	subject := "Password Reset Request - TuneTudo"
 	body := fmt.Sprintf(`Hello,
@@ -68,24 +196,14 @@ You requested a password reset for your TuneTudo account.
 Click the link below to reset your password:
 %s
 
-This link will expire in 15 minutes.
+This link will expire in %s.
 
 If you didn't request this, please ignore this email and your password will remain unchanged.
 
 Best regards,
-TuneTudo Team`, resetLink)
+TuneTudo Team`, resetLink, describeDuration(s.resetTokenTTL))
 
-	message := []byte(fmt.Sprintf("From: %s\r\n"+
-		"To: %s\r\n"+
-		"Subject: %s\r\n"+
-		"\r\n"+
-		"%s\r\n", fromEmail, toEmail, subject, body))
-
-	auth := smtp.PlainAuth("", smtpUser, smtpPass, smtpHost)
-	addr := smtpHost + ":" + smtpPort
-
-	err := smtp.SendMail(addr, auth, fromEmail, []string{toEmail}, message)
-	if err != nil {
+	if err := s.emailSender.Send(toEmail, subject, body); err != nil {
 		logger.Error(logger.CategoryAuth, "Failed to send password reset email", err)
 		return err
 	}
@@ -94,8 +212,33 @@ TuneTudo Team`, resetLink)
 	return nil
 }
 
-// RequestPasswordReset initiates password reset flow
-func (s *AuthService) RequestPasswordReset(email string) error {
+// describeDuration spells out a duration for an email, in whole hours when
+// it is one, otherwise in minutes
+func describeDuration(d time.Duration) string {
+	plural := func(n int64, unit string) string {
+		if n == 1 {
+			return "1 " + unit
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+	if d >= time.Hour && d%time.Hour == 0 {
+		return plural(int64(d/time.Hour), "hour")
+	}
+	return plural(max(int64(d.Round(time.Minute)/time.Minute), 1), "minute")
+}
+
+// RequestPasswordReset initiates password reset flow. Requests over the
+// per-email or per-IP limit are dropped without an error, so callers can't
+// tell them apart from normal ones
+func (s *AuthService) RequestPasswordReset(email, ipAddress string) error {
+	// Count against both limits even when the first one is already exceeded
+	emailAllowed := s.resetEmailLimiter.Allow(email)
+	ipAllowed := s.resetIPLimiter.Allow(ipAddress)
+	if !emailAllowed || !ipAllowed {
+		logger.Security("PASSWORD_RESET_THROTTLED", "anonymous", logger.MaskIP(ipAddress), "Password reset request dropped by rate limit")
+		return nil
+	}
+
 	// Check if user exists
 	var user models.User
 	err := s.db.QueryRow("SELECT id, email, username FROM users WHERE email = ?", email).
@@ -109,53 +252,65 @@ func (s *AuthService) RequestPasswordReset(email string) error {
 	
 	if err != nil {
 		logger.Error(logger.CategoryAuth, "Database error during password reset request", err)
-		return fmt.Errorf("failed to process request")
+		return internalError("failed to process request", err)
 	}
 
-	// Generate secure token
-	token, err := GenerateSecureToken()
+	// Generate and store a secure token
+	token, expiresAt, err := issueResetToken(email, s.resetTokenTTL)
 	if err != nil {
 		logger.Error(logger.CategoryAuth, "Failed to generate reset token", err)
-		return fmt.Errorf("failed to generate reset token")
-	}
-
-	// Store token with 15-minute expiration
-	expiresAt := time.Now().Add(15 * time.Minute)
-	passwordResetStore[email] = PasswordResetToken{
-		Token:     token,
-		Email:     email,
-		ExpiresAt: expiresAt,
+		return internalError("failed to generate reset token", err)
 	}
 
 	logger.Security("PASSWORD_RESET_REQUESTED", user.Username, email, 
 		fmt.Sprintf("Password reset token generated (expires: %s)", expiresAt))
 
-	// Send email
-	if err := SendPasswordResetEmail(email, token); err != nil {
-		delete(passwordResetStore, email)
-		return fmt.Errorf("failed to send reset email")
-	}
+	// Send in the background so a slow or flaky mail server doesn't hold up
+	// the response. The token stays valid while delivery is retried
+	s.emails.Add(1)
+	go s.deliverResetEmail(email, s.passwordResetLink(token))
 
 	return nil
 }
 
+// deliverResetEmail sends a reset email, retrying with backoff on failure
+func (s *AuthService) deliverResetEmail(toEmail, resetLink string) {
+	defer s.emails.Done()
+
+	delay := s.emailRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := s.sendPasswordResetEmail(toEmail, resetLink)
+		if err == nil {
+			return
+		}
+		if attempt == resetEmailAttempts {
+			logger.Error(logger.CategoryAuth, "Giving up on password reset email", err)
+			return
+		}
+		logger.Warning(logger.CategoryAuth, "Password reset email attempt %d failed, retrying in %s", attempt, delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
 // ValidateResetToken validates the reset token
 func (s *AuthService) ValidateResetToken(token string) (string, error) {
-	// Find token in store
+	// Find token in store by its hash
+	tokenHash := []byte(hashResetToken(token))
 	for email, resetData := range passwordResetStore {
-		if resetData.Token == token {
+		if subtle.ConstantTimeCompare([]byte(resetData.TokenHash), tokenHash) == 1 {
 			// Check expiration
 			if time.Now().After(resetData.ExpiresAt) {
 				delete(passwordResetStore, email)
 				logger.Security("PASSWORD_RESET_TOKEN_EXPIRED", "anonymous", email, "Expired token used")
-				return "", fmt.Errorf("reset token has expired")
+				return "", apperrors.BadRequestError("reset token has expired")
 			}
 			return email, nil
 		}
 	}
 
 	logger.Security("PASSWORD_RESET_INVALID_TOKEN", "anonymous", "unknown", "Invalid reset token used")
-	return "", fmt.Errorf("invalid reset token")
+	return "", apperrors.BadRequestError("invalid reset token")
 }
 
 // ResetPassword resets user password with token
@@ -167,8 +322,8 @@ func (s *AuthService) ResetPassword(token, newPassword string) error {
 	}
 
 	// Validate password policy
-	if len(newPassword) < 8 {
-		return fmt.Errorf("password must be at least 8 characters")
+	if err := s.CheckPasswordPolicy(newPassword); err != nil {
+		return err
 	}
 
 	// Get user
@@ -178,23 +333,23 @@ func (s *AuthService) ResetPassword(token, newPassword string) error {
 	
 	if err != nil {
 		logger.Error(logger.CategoryAuth, "User not found during password reset", err)
-		return fmt.Errorf("user not found")
+		return apperrors.NotFoundError("user not found")
 	}
 
 	// Hash new password with bcrypt
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), 12)
+	hashedPassword, err := s.hashPassword(newPassword)
 	if err != nil {
 		logger.Error(logger.CategoryAuth, "Failed to hash password", err)
-		return fmt.Errorf("failed to process password")
+		return internalError("failed to process password", err)
 	}
 
 	// Update password in database
 	_, err = s.db.Exec("UPDATE users SET password_hash = ? WHERE id = ?", 
-		string(hashedPassword), user.ID)
+		hashedPassword, user.ID)
 	
 	if err != nil {
 		logger.Error(logger.CategoryAuth, "Failed to update password", err)
-		return fmt.Errorf("failed to update password")
+		return internalError("failed to update password", err)
 	}
 
 	// Remove token from store
@@ -207,28 +362,53 @@ func (s *AuthService) ResetPassword(token, newPassword string) error {
 
 // RegisterUser creates a new user account
 func (s *AuthService) RegisterUser(req models.RegisterRequest, ipAddress string) (*models.User, error) {
+	if err := s.verifyCaptcha(req.CaptchaToken, ipAddress); err != nil {
+		return nil, err
+	}
+
+	// Every field is checked so the form can show all its problems at once.
+	// Whether the username or email is taken stays a single generic conflict
+	fields := apperrors.ValidationErrors{}
+	logName := "anonymous"
+	if username, err := NormalizeUsername(req.Username); err != nil {
+		logger.ValidationFailure(logName, ipAddress, "username", err.Error())
+		fields.Add("username", err.Error())
+	} else {
+		req.Username, logName = username, username
+	}
+
+	if email, err := NormalizeEmail(req.Email); err != nil {
+		logger.ValidationFailure(logName, ipAddress, "email", "Invalid email address")
+		fields.Add("email", err.Error())
+	} else {
+		req.Email = email
+	}
+
 	// Validate password strength
-	if len(req.Password) < 8 {
-		logger.ValidationFailure(req.Username, ipAddress, "password", "Password too short")
-		return nil, errors.New("password must be at least 8 characters")
+	if err := s.CheckPasswordPolicy(req.Password); err != nil {
+		logger.ValidationFailure(logName, ipAddress, "password", err.Error())
+		fields.Add("password", err.Error())
+	}
+	if err := fields.Err(); err != nil {
+		return nil, err
 	}
 
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := s.hashPassword(req.Password)
 	if err != nil {
 		logger.Error(logger.CategoryAuth, "Password hashing failed", err)
-		return nil, errors.New("failed to process registration")
+		return nil, internalError("failed to process registration", err)
 	}
 
 	// Insert user
 	result, err := s.db.Exec(
 		`INSERT INTO users (username, email, password_hash) VALUES (?, ?, ?)`,
-		req.Username, req.Email, string(hashedPassword),
+		req.Username, req.Email, hashedPassword,
 	)
 	if err != nil {
 		// Log without exposing email/username - don't reveal "no such user"
 		logger.AuthAttempt(req.Username, ipAddress, false, "Registration failed - duplicate")
-		return nil, errors.New("username or email already exists")
+		return nil, apperrors.ConflictError("username or email already exists")
 	}
 
 	id, _ := result.LastInsertId()
@@ -254,11 +434,11 @@ func (s *AuthService) LoginUser(req models.LoginRequest, ipAddress string) (stri
 	var passwordHash string
 
 	err := s.db.QueryRow(
-		`SELECT id, username, email, password_hash, is_admin, profile_image_path, created_at 
+		`SELECT id, username, email, password_hash, is_admin, suspended, profile_image_path, created_at 
 		FROM users WHERE username = ? OR email = ?`,
 		req.Username, req.Username,
 	).Scan(&user.ID, &user.Username, &user.Email, &passwordHash, &user.IsAdmin,
-		&user.ProfileImagePath, &user.CreatedAt)
+		&user.Suspended, &user.ProfileImagePath, &user.CreatedAt)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -269,27 +449,44 @@ func (s *AuthService) LoginUser(req models.LoginRequest, ipAddress string) (stri
 			logger.Error(logger.CategoryAuth, "Login query failed", err)
 		}
 		// Return same error message for both cases (timing attack prevention)
-		return "", nil, errors.New("authorization failed")
+		return "", nil, authorizationFailed()
 	}
 
 	// Verify password
 	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)); err != nil {
 		// Don't say "password incorrect" - use generic message
 		logger.AuthAttempt(user.Username, ipAddress, false, "Invalid credentials")
-		return "", nil, errors.New("authorization failed")
+		return "", nil, authorizationFailed()
+	}
+
+	// Only checked after the password so suspension doesn't reveal which accounts exist
+	if user.Suspended {
+		logger.AuthAttempt(user.Username, ipAddress, false, "Account suspended")
+		return "", nil, apperrors.NewAppError(apperrors.ErrCodeAuth, "account suspended", 401, nil)
 	}
 
+	s.upgradeHash(user.ID, passwordHash, req.Password)
+
+	token, err := s.startSession(&user, ipAddress, req.UserAgent)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, &user, nil
+}
+
+// startSession records a successful login and issues its JWT
+func (s *AuthService) startSession(user *models.User, ipAddress, userAgent string) (string, error) {
 	// Update last login
-	_, err = s.db.Exec(`UPDATE users SET last_login = CURRENT_TIMESTAMP WHERE id = ?`, user.ID)
+	_, err := s.db.Exec(`UPDATE users SET last_login = CURRENT_TIMESTAMP WHERE id = ?`, user.ID)
 	if err != nil {
 		logger.Warning(logger.CategoryAuth, "Failed to update last login time for user_id=%d", user.ID)
 	}
 
 	// Generate JWT token
-	token, err := s.GenerateToken(&user)
+	token, err := s.createSession(user, ipAddress, userAgent)
 	if err != nil {
 		logger.Error(logger.CategoryAuth, "Token generation failed", err)
-		return "", nil, errors.New("failed to generate authentication token")
+		return "", internalError("failed to generate authentication token", err)
 	}
 
 	// Log successful login - username will be hashed by logger
@@ -297,18 +494,27 @@ func (s *AuthService) LoginUser(req models.LoginRequest, ipAddress string) (stri
 	logger.SessionCreated(user.Username, ipAddress)
 	logger.Info(logger.CategoryAuth, "User login: user_id=%d from IP=%s", user.ID, logger.MaskIP(ipAddress))
 
-	return token, &user, nil
+	return token, nil
 }
 
-// GenerateToken creates a JWT token for the user
+// GenerateToken creates a JWT token for the user that isn't tied to a
+// session, so it can't be listed or revoked
 func (s *AuthService) GenerateToken(user *models.User) (string, error) {
+	return s.signToken(user, "", time.Now().Add(tokenLifetime))
+}
+
+// signToken creates a JWT for the user, tied to the session jti when set
+func (s *AuthService) signToken(user *models.User, jti string, expiresAt time.Time) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id":  user.ID,
 		"username": user.Username,
 		"is_admin": user.IsAdmin,
-		"exp":      time.Now().Add(time.Hour * 24 * 7).Unix(), // 7 days
+		"exp":      expiresAt.Unix(),
 		"iat":      time.Now().Unix(),
 	}
+	if jti != "" {
+		claims["jti"] = jti
+	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString(s.jwtSecret)
@@ -331,7 +537,7 @@ func (s *AuthService) ValidateToken(tokenString string) (jwt.MapClaims, error) {
 	if err != nil {
 		// Don't log token details - no sensitive data in logs
 		logger.Warning(logger.CategoryAuth, "Token validation failed")
-		return nil, errors.New("invalid or expired token")
+		return nil, unauthenticated("invalid or expired token")
 	}
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
@@ -342,42 +548,162 @@ func (s *AuthService) ValidateToken(tokenString string) (jwt.MapClaims, error) {
 				if username, ok := claims["username"].(string); ok {
 					logger.SessionExpired(username)
 				}
-				return nil, errors.New("token has expired")
+				return nil, unauthenticated("token has expired")
+			}
+		}
+		if jti, ok := claims["jti"].(string); ok {
+			if err := s.touchSession(jti); err != nil {
+				return nil, err
 			}
 		}
 		return claims, nil
 	}
 
-	return nil, errors.New("invalid token")
+	return nil, unauthenticated("invalid token")
 }
 
 // GetUserByID retrieves a user by ID
 func (s *AuthService) GetUserByID(userID int) (*models.User, error) {
 	var user models.User
 	err := s.db.QueryRow(
-		`SELECT id, username, email, is_admin, profile_image_path, created_at, last_login 
+		`SELECT id, username, email, is_admin, profile_image_path,
+			COALESCE(profile_image_medium_path, profile_image_path), COALESCE(profile_image_thumb_path, profile_image_path),
+			share_now_playing, safe_mode, created_at, last_login
 		FROM users WHERE id = ?`,
 		userID,
 	).Scan(&user.ID, &user.Username, &user.Email, &user.IsAdmin,
-		&user.ProfileImagePath, &user.CreatedAt, &user.LastLogin)
+		&user.ProfileImagePath, &user.ProfileImageMediumPath, &user.ProfileImageThumbPath,
+		&user.ShareNowPlaying, &user.SafeMode, &user.CreatedAt, &user.LastLogin)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("user not found")
+			return nil, apperrors.NotFoundError("user not found")
 		}
 		// Don't log user_id in error to avoid correlation
 		logger.Error(logger.CategoryDB, "Failed to retrieve user", err)
-		return nil, errors.New("failed to retrieve user information")
+		return nil, internalError("failed to retrieve user information", err)
 	}
 
 	return &user, nil
 }
 
-// CheckPasswordPolicy validates password strength
+// GetAccountStatus returns the user's current admin and suspension flags.
+// Tokens outlive role changes, so these are read from the database on each request
+func (s *AuthService) GetAccountStatus(userID int) (isAdmin bool, suspended bool, err error) {
+	err = s.db.QueryRow(`SELECT is_admin, suspended FROM users WHERE id = ?`, userID).Scan(&isAdmin, &suspended)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, false, apperrors.NotFoundError("user not found")
+		}
+		logger.Error(logger.CategoryDB, "Failed to retrieve account status", err)
+		return false, false, internalError("failed to retrieve user information", err)
+	}
+	return isAdmin, suspended, nil
+}
+
+// DeleteAccount permanently removes a user after re-checking their password,
+// along with their playlists, uploads, uploaded songs and files on disk.
+// Provider accounts without a password are confirmed by their session alone
+func (s *AuthService) DeleteAccount(userID int, currentPassword string) error {
+	var passwordHash string
+	err := s.db.QueryRow(`SELECT password_hash FROM users WHERE id = ?`, userID).Scan(&passwordHash)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.Error(logger.CategoryDB, "Failed to load user for deletion", err)
+		}
+		return apperrors.NotFoundError("user not found")
+	}
+
+	if passwordHash != "" {
+		if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(currentPassword)); err != nil {
+			return authorizationFailed()
+		}
+	}
+
+	// Collect file paths first; the rows are gone after the transaction
+	var songFiles []string
+	rows, err := s.db.Query(`SELECT file_path FROM songs WHERE uploaded_by_user_id = ?`, userID)
+	if err != nil {
+		logger.Error(logger.CategoryDB, "Failed to list uploaded songs for deletion", err)
+		return internalError("failed to delete account", err)
+	}
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err == nil {
+			songFiles = append(songFiles, path)
+		}
+	}
+	rows.Close()
+
+	// Playlists, collaborator entries, uploads, playback positions and the
+	// user's songs (with their playlist entries) all go via ON DELETE CASCADE
+	if _, err := s.db.Exec(`DELETE FROM users WHERE id = ?`, userID); err != nil {
+		logger.Error(logger.CategoryDB, "Failed to delete account", err)
+		return internalError("failed to delete account", err)
+	}
+
+	// File cleanup is best effort; the account itself is already gone
+	if s.storagePath != "" {
+		for _, path := range songFiles {
+			os.Remove(filepath.Join(s.storagePath, path))
+		}
+		userDir := fmt.Sprintf("%d", userID)
+		for _, dir := range []string{
+			filepath.Join(s.storagePath, "images", "profiles", userDir),
+			filepath.Join(s.storagePath, "media", "uploads", userDir),
+		} {
+			if err := os.RemoveAll(dir); err != nil {
+				logger.Warning(logger.CategoryFile, "Failed to remove user directory: %v", err)
+			}
+		}
+	}
+
+	logger.Info(logger.CategoryAuth, "Account deleted: user_id=%d", userID)
+	return nil
+}
+
+// CheckPasswordPolicy validates password strength against the configured policy
 func (s *AuthService) CheckPasswordPolicy(password string) error {
-	if len(password) < 8 {
-		return errors.New("password must be at least 8 characters")
+	if err := s.passwordPolicy.Check(password); err != nil {
+		return apperrors.ValidationError(err.Error(), nil)
+	}
+	return nil
+}
+
+// ChangePassword sets a new password after confirming the current one.
+// Provider accounts without a password can set a first one directly
+func (s *AuthService) ChangePassword(userID int, currentPassword, newPassword string) error {
+	var passwordHash string
+	err := s.db.QueryRow(`SELECT password_hash FROM users WHERE id = ?`, userID).Scan(&passwordHash)
+	if err == sql.ErrNoRows {
+		return apperrors.NotFoundError("user not found")
+	}
+	if err != nil {
+		logger.Error(logger.CategoryDB, "Failed to load user for password change", err)
+		return internalError("failed to change password", err)
+	}
+
+	if passwordHash != "" {
+		if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(currentPassword)); err != nil {
+			return apperrors.NewAppError(apperrors.ErrCodeAuth, "current password is incorrect", 401, nil)
+		}
+	}
+
+	if err := s.CheckPasswordPolicy(newPassword); err != nil {
+		return err
 	}
-	// Add more password policy checks as needed
+
+	hashedPassword, err := s.hashPassword(newPassword)
+	if err != nil {
+		logger.Error(logger.CategoryAuth, "Failed to hash password", err)
+		return internalError("failed to process password", err)
+	}
+
+	if _, err := s.db.Exec(`UPDATE users SET password_hash = ? WHERE id = ?`, hashedPassword, userID); err != nil {
+		logger.Error(logger.CategoryAuth, "Failed to update password", err)
+		return internalError("failed to change password", err)
+	}
+
+	logger.Info(logger.CategoryAuth, "Password changed: user_id=%d", userID)
 	return nil
 }
\ No newline at end of file
@@ -1,13 +1,77 @@
 package services
 
 import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+	apperrors "tunetudo/errors"
 	"tunetudo/models"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 )
 
+type sentEmail struct {
+	to, subject, body string
+}
+
+// mockEmailSender records delivered emails. When fail is set, its result
+// for each attempt (counting from 1) is returned instead of delivering
+type mockEmailSender struct {
+	mu       sync.Mutex
+	attempts int
+	sent     []sentEmail
+	fail     func(attempt int) error
+}
+
+func (m *mockEmailSender) Send(to, subject, body string) error {
+	m.mu.Lock()
+	m.attempts++
+	attempt := m.attempts
+	m.mu.Unlock()
+
+	if m.fail != nil {
+		if err := m.fail(attempt); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, sentEmail{to: to, subject: subject, body: body})
+	return nil
+}
+
+func (m *mockEmailSender) recipients() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	recipients := []string{}
+	for _, email := range m.sent {
+		recipients = append(recipients, email.to)
+	}
+	return recipients
+}
+
+// resetLinkFrom extracts the reset link from a password reset email
+func resetLinkFrom(t *testing.T, body string) *url.URL {
+	for _, field := range strings.Fields(body) {
+		if strings.HasPrefix(field, "https://") {
+			link, err := url.Parse(field)
+			require.NoError(t, err)
+			return link
+		}
+	}
+	t.Fatalf("no link in email body: %q", body)
+	return nil
+}
+
 func setupTestAuthService(t *testing.T) (*AuthService, func()) {
 	db := setupTestDB(t)
 	service := NewAuthService(db, "test-secret-key")
@@ -34,7 +98,7 @@ func TestRegisterUser(t *testing.T) {
 			req: models.RegisterRequest{
 				Username: "testuser",
 				Email:    "test@example.com",
-				Password: "password123",
+				Password: "Passw0rd-123",
 			},
 			expectError: false,
 		},
@@ -53,7 +117,7 @@ func TestRegisterUser(t *testing.T) {
 			req: models.RegisterRequest{
 				Username: "testuser",
 				Email:    "another@example.com",
-				Password: "password123",
+				Password: "Passw0rd-123",
 			},
 			expectError: true,
 			errorMsg:    "username or email already exists",
@@ -63,11 +127,71 @@ func TestRegisterUser(t *testing.T) {
 			req: models.RegisterRequest{
 				Username: "anotheruser",
 				Email:    "test@example.com",
-				Password: "password123",
+				Password: "Passw0rd-123",
+			},
+			expectError: true,
+			errorMsg:    "username or email already exists",
+		},
+		{
+			name: "Duplicate email with different domain case",
+			req: models.RegisterRequest{
+				Username: "thirduser",
+				Email:    "test@EXAMPLE.com",
+				Password: "Passw0rd-123",
 			},
 			expectError: true,
 			errorMsg:    "username or email already exists",
 		},
+		{
+			name: "Invalid email",
+			req: models.RegisterRequest{
+				Username: "bademail",
+				Email:    "a@.",
+				Password: "Passw0rd-123",
+			},
+			expectError: true,
+			errorMsg:    "invalid email address",
+		},
+		{
+			name: "Username too short",
+			req: models.RegisterRequest{
+				Username: "ab",
+				Email:    "short@example.com",
+				Password: "Passw0rd-123",
+			},
+			expectError: true,
+			errorMsg:    "username must be at least 3 characters",
+		},
+		{
+			name: "Username too long",
+			req: models.RegisterRequest{
+				Username: strings.Repeat("a", 10000),
+				Email:    "long@example.com",
+				Password: "Passw0rd-123",
+			},
+			expectError: true,
+			errorMsg:    "username must be at most 32 characters",
+		},
+		{
+			name: "Username with invalid characters",
+			req: models.RegisterRequest{
+				Username: "drop table;",
+				Email:    "chars@example.com",
+				Password: "Passw0rd-123",
+			},
+			expectError: true,
+			errorMsg:    "username may only contain letters, digits",
+		},
+		{
+			name: "Email too long",
+			req: models.RegisterRequest{
+				Username: "longemail",
+				Email:    "user@" + strings.Repeat("a", 250) + ".com",
+				Password: "Passw0rd-123",
+			},
+			expectError: true,
+			errorMsg:    "email address must be at most 254 characters",
+		},
 	}
 
 	for _, tt := range tests {
@@ -91,6 +215,35 @@ func TestRegisterUser(t *testing.T) {
 	}
 }
 
+func TestRegisterUserReportsEveryInvalidField(t *testing.T) {
+	service, cleanup := setupTestAuthService(t)
+	defer cleanup()
+
+	_, err := service.RegisterUser(models.RegisterRequest{
+		Username: "formfiller",
+		Email:    "not-an-email",
+		Password: "short",
+	}, "127.0.0.1")
+	require.Error(t, err)
+	appErr := apperrors.GetAppError(err)
+	require.NotNil(t, appErr)
+	assert.Equal(t, 400, appErr.StatusCode)
+	assert.Equal(t, "some fields are invalid", appErr.Message)
+	require.Len(t, appErr.Fields, 2)
+	assert.Contains(t, appErr.Fields, "email")
+	assert.Contains(t, appErr.Fields["password"], "at least 8 characters")
+	assert.Equal(t, 0, countRows(t, service.db, "users"))
+
+	// With one bad field its message is the error itself
+	_, err = service.RegisterUser(models.RegisterRequest{
+		Username: "x",
+		Email:    "formfiller@example.com",
+		Password: "Passw0rd-123",
+	}, "127.0.0.1")
+	require.Error(t, err)
+	assert.Equal(t, map[string]string{"username": err.Error()}, apperrors.GetAppError(err).Fields)
+}
+
 func TestLoginUser(t *testing.T) {
 	service, cleanup := setupTestAuthService(t)
 	defer cleanup()
@@ -99,7 +252,7 @@ func TestLoginUser(t *testing.T) {
 	regReq := models.RegisterRequest{
 		Username: "logintest",
 		Email:    "login@example.com",
-		Password: "password123",
+		Password: "Passw0rd-123",
 	}
 	ip := "127.0.0.1"
 	_, err := service.RegisterUser(regReq, ip)
@@ -115,7 +268,7 @@ func TestLoginUser(t *testing.T) {
 			name: "Valid login with username",
 			req: models.LoginRequest{
 				Username: "logintest",
-				Password: "password123",
+				Password: "Passw0rd-123",
 			},
 			expectError: false,
 		},
@@ -132,7 +285,7 @@ func TestLoginUser(t *testing.T) {
 			name: "Non-existent user",
 			req: models.LoginRequest{
 				Username: "nonexistent",
-				Password: "password123",
+				Password: "Passw0rd-123",
 			},
 			expectError: true,
 			errorMsg:    "authorization failed",
@@ -240,7 +393,7 @@ func TestGetUserByID(t *testing.T) {
 	regReq := models.RegisterRequest{
 		Username: "gettest",
 		Email:    "get@example.com",
-		Password: "password123",
+		Password: "Passw0rd-123",
 	}
 	ip := "127.0.0.1"
 	registeredUser, err := service.RegisterUser(regReq, ip)
@@ -291,7 +444,7 @@ func TestCheckPasswordPolicy(t *testing.T) {
 	}{
 		{
 			name:        "Valid password",
-			password:    "password123",
+			password:    "Passw0rd-123",
 			expectError: false,
 		},
 		{
@@ -301,9 +454,19 @@ func TestCheckPasswordPolicy(t *testing.T) {
 		},
 		{
 			name:        "Exactly 8 characters",
-			password:    "12345678",
+			password:    "Tun3Tud0",
 			expectError: false,
 		},
+		{
+			name:        "Digits only",
+			password:    "12345678",
+			expectError: true,
+		},
+		{
+			name:        "Common password",
+			password:    "Passw0rd",
+			expectError: true,
+		},
 		{
 			name:        "Empty password",
 			password:    "",
@@ -322,4 +485,388 @@ func TestCheckPasswordPolicy(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestLoginSuspendedUser(t *testing.T) {
+	service, cleanup := setupTestAuthService(t)
+	defer cleanup()
+
+	ip := "127.0.0.1"
+	user, err := service.RegisterUser(models.RegisterRequest{
+		Username: "suspendme",
+		Email:    "suspend@example.com",
+		Password: "Passw0rd-123",
+	}, ip)
+	require.NoError(t, err)
+
+	admin := NewAdminService(service.db, t.TempDir())
+	require.NoError(t, admin.SetSuspended(user.ID, true))
+
+	token, _, err := service.LoginUser(models.LoginRequest{Username: "suspendme", Password: "Passw0rd-123"}, ip)
+	assert.Error(t, err)
+	assert.Empty(t, token)
+
+	// A wrong password still gets the generic message
+	_, _, err = service.LoginUser(models.LoginRequest{Username: "suspendme", Password: "wrongpass1"}, ip)
+	assert.EqualError(t, err, "authorization failed")
+
+	require.NoError(t, admin.SetSuspended(user.ID, false))
+	_, _, err = service.LoginUser(models.LoginRequest{Username: "suspendme", Password: "Passw0rd-123"}, ip)
+	assert.NoError(t, err)
+}
+
+func TestSetAdminUnknownUser(t *testing.T) {
+	service, cleanup := setupTestAuthService(t)
+	defer cleanup()
+
+	admin := NewAdminService(service.db, t.TempDir())
+	assert.EqualError(t, admin.SetAdmin(12345, true), "user not found")
+	assert.EqualError(t, admin.SetSuspended(12345, true), "user not found")
+}
+
+func TestDeleteAccount(t *testing.T) {
+	service, cleanup := setupTestAuthService(t)
+	defer cleanup()
+	seedTestData(t, service.db)
+
+	storageDir := t.TempDir()
+	service.SetStoragePath(storageDir)
+
+	ip := "127.0.0.1"
+	user, err := service.RegisterUser(models.RegisterRequest{
+		Username: "leaving",
+		Email:    "leaving@example.com",
+		Password: "Passw0rd-123",
+	}, ip)
+	require.NoError(t, err)
+
+	playlists := NewPlaylistService(service.db)
+	playlist, err := playlists.CreatePlaylist(user.ID, models.CreatePlaylistRequest{Name: "Mine"})
+	require.NoError(t, err)
+	require.NoError(t, playlists.AddSong(playlist.ID, 1, user.ID))
+
+	users := NewUserService(service.db, storageDir)
+	upload, err := users.UploadSong(user.ID, newTestFileHeader(t, "mine.mp3", []byte("fake mp3 data")), 0)
+	require.NoError(t, err)
+	require.NoError(t, users.UploadProfileImage(user.ID, newTestFileHeader(t, "me.png", newTestPNG(t, 32, 32))))
+	require.NotEmpty(t, listStoredFiles(t, storageDir))
+
+	t.Run("Wrong password", func(t *testing.T) {
+		assert.EqualError(t, service.DeleteAccount(user.ID, "wrongpassword"), "authorization failed")
+		_, err := service.GetUserByID(user.ID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Deletes user, data and files", func(t *testing.T) {
+		require.NoError(t, service.DeleteAccount(user.ID, "Passw0rd-123"))
+
+		_, err := service.GetUserByID(user.ID)
+		assert.Error(t, err)
+		assert.Equal(t, 0, countRows(t, service.db, "playlists"))
+		assert.Equal(t, 0, countRows(t, service.db, "playlist_songs"))
+		assert.Equal(t, 0, countRows(t, service.db, "uploads"))
+
+		var remaining int
+		service.db.QueryRow(`SELECT COUNT(*) FROM songs WHERE id = ?`, upload.SongID).Scan(&remaining)
+		assert.Equal(t, 0, remaining)
+
+		// Catalog songs are untouched
+		assert.Equal(t, 3, countRows(t, service.db, "songs"))
+
+		assert.Empty(t, listStoredFiles(t, storageDir))
+		_, err = os.Stat(filepath.Join(storageDir, "media", "uploads"))
+		assert.NoError(t, err, "shared parent directories are kept")
+	})
+}
+
+func TestChangePassword(t *testing.T) {
+	service, cleanup := setupTestAuthService(t)
+	defer cleanup()
+
+	ip := "127.0.0.1"
+	user, err := service.RegisterUser(models.RegisterRequest{
+		Username: "changer",
+		Email:    "changer@example.com",
+		Password: "Passw0rd-123",
+	}, ip)
+	require.NoError(t, err)
+
+	t.Run("Wrong current password", func(t *testing.T) {
+		err := service.ChangePassword(user.ID, "Wrong-Passw0rd", "N3w-Password")
+		require.Error(t, err)
+		assert.Equal(t, "current password is incorrect", err.Error())
+	})
+
+	t.Run("New password breaks policy", func(t *testing.T) {
+		err := service.ChangePassword(user.ID, "Passw0rd-123", "weakpass")
+		require.Error(t, err)
+		assert.Equal(t, "password must contain an uppercase letter", err.Error())
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		require.NoError(t, service.ChangePassword(user.ID, "Passw0rd-123", "N3w-Password"))
+
+		_, _, err := service.LoginUser(models.LoginRequest{Username: "changer", Password: "Passw0rd-123"}, ip)
+		assert.Error(t, err)
+		_, _, err = service.LoginUser(models.LoginRequest{Username: "changer", Password: "N3w-Password"}, ip)
+		assert.NoError(t, err)
+	})
+}
+
+// storedHashCost returns the bcrypt cost of a user's stored password hash
+func storedHashCost(t *testing.T, service *AuthService, userID int) int {
+	var passwordHash string
+	require.NoError(t, service.db.QueryRow(`SELECT password_hash FROM users WHERE id = ?`, userID).Scan(&passwordHash))
+	cost, err := bcrypt.Cost([]byte(passwordHash))
+	require.NoError(t, err)
+	return cost
+}
+
+func TestBcryptCostApplied(t *testing.T) {
+	service, cleanup := setupTestAuthService(t)
+	defer cleanup()
+	service.SetBcryptCost(5)
+
+	user, err := service.RegisterUser(models.RegisterRequest{
+		Username: "hasher",
+		Email:    "hasher@example.com",
+		Password: "Passw0rd-123",
+	}, "127.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, 5, storedHashCost(t, service, user.ID))
+
+	service.SetBcryptCost(6)
+	require.NoError(t, service.ChangePassword(user.ID, "Passw0rd-123", "N3w-Password"))
+	assert.Equal(t, 6, storedHashCost(t, service, user.ID))
+}
+
+func TestLoginUpgradesLowCostHash(t *testing.T) {
+	service, cleanup := setupTestAuthService(t)
+	defer cleanup()
+	service.SetBcryptCost(bcrypt.MinCost)
+
+	ip := "127.0.0.1"
+	user, err := service.RegisterUser(models.RegisterRequest{
+		Username: "upgrader",
+		Email:    "upgrader@example.com",
+		Password: "Passw0rd-123",
+	}, ip)
+	require.NoError(t, err)
+
+	service.SetBcryptCost(bcrypt.MinCost + 1)
+
+	// A failed login leaves the hash alone
+	_, _, err = service.LoginUser(models.LoginRequest{Username: "upgrader", Password: "wrong"}, ip)
+	require.Error(t, err)
+	assert.Equal(t, bcrypt.MinCost, storedHashCost(t, service, user.ID))
+
+	_, _, err = service.LoginUser(models.LoginRequest{Username: "upgrader", Password: "Passw0rd-123"}, ip)
+	require.NoError(t, err)
+	assert.Equal(t, bcrypt.MinCost+1, storedHashCost(t, service, user.ID))
+
+	// The upgraded hash still verifies, and a lower configured cost never downgrades it
+	service.SetBcryptCost(bcrypt.MinCost)
+	_, _, err = service.LoginUser(models.LoginRequest{Username: "upgrader", Password: "Passw0rd-123"}, ip)
+	require.NoError(t, err)
+	assert.Equal(t, bcrypt.MinCost+1, storedHashCost(t, service, user.ID))
+}
+
+func TestPasswordResetLinkUsesBaseURL(t *testing.T) {
+	service, cleanup := setupTestAuthService(t)
+	defer cleanup()
+
+	service.SetAppBaseURL("https://music.example.com/")
+
+	token, err := GenerateSecureToken()
+	require.NoError(t, err)
+
+	link, err := url.Parse(service.passwordResetLink(token))
+	require.NoError(t, err)
+	assert.Equal(t, "https", link.Scheme)
+	assert.Equal(t, "music.example.com", link.Host)
+	assert.Equal(t, "/reset-password.html", link.Path)
+	assert.Equal(t, token, link.Query().Get("token"))
+}
+
+func TestResetTokenStoredAsHash(t *testing.T) {
+	service, cleanup := setupTestAuthService(t)
+	defer cleanup()
+
+	email := "hashed-reset@example.com"
+	token, _, err := issueResetToken(email, defaultResetTokenTTL)
+	require.NoError(t, err)
+	defer delete(passwordResetStore, email)
+
+	stored := passwordResetStore[email]
+	assert.NotEqual(t, token, stored.TokenHash, "the plaintext token must not be stored")
+	assert.Equal(t, hashResetToken(token), stored.TokenHash)
+
+	validated, err := service.ValidateResetToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, email, validated)
+
+	// Someone who can read the store still can't use what's in it
+	_, err = service.ValidateResetToken(stored.TokenHash)
+	assert.Error(t, err)
+}
+
+func TestResetTokenTTLMatchesEmail(t *testing.T) {
+	service, cleanup := setupTestAuthService(t)
+	defer cleanup()
+
+	user, err := service.RegisterUser(models.RegisterRequest{
+		Username: "resetttl",
+		Email:    "reset-ttl@example.com",
+		Password: "Passw0rd-123",
+	}, "127.0.0.1")
+	require.NoError(t, err)
+	defer delete(passwordResetStore, user.Email)
+
+	sender := &mockEmailSender{}
+	service.SetEmailSender(sender)
+	service.SetResetTokenTTL(2 * time.Hour)
+
+	requested := time.Now()
+	require.NoError(t, service.RequestPasswordReset(user.Email, "10.0.0.2"))
+	service.emails.Wait()
+
+	expiresAt := passwordResetStore[user.Email].ExpiresAt
+	assert.WithinDuration(t, requested.Add(2*time.Hour), expiresAt, 5*time.Second)
+	require.Len(t, sender.sent, 1)
+	assert.Contains(t, sender.sent[0].body, "This link will expire in 2 hours.")
+
+	assert.Equal(t, "15 minutes", describeDuration(defaultResetTokenTTL))
+	assert.Equal(t, "1 hour", describeDuration(time.Hour))
+	assert.Equal(t, "90 minutes", describeDuration(90*time.Minute))
+	assert.Equal(t, "1 minute", describeDuration(20*time.Second))
+}
+
+func TestRequestPasswordResetIsRateLimited(t *testing.T) {
+	service, cleanup := setupTestAuthService(t)
+	defer cleanup()
+
+	user, err := service.RegisterUser(models.RegisterRequest{
+		Username: "resetlimit",
+		Email:    "reset-limit@example.com",
+		Password: "Passw0rd-123",
+	}, "127.0.0.1")
+	require.NoError(t, err)
+	defer delete(passwordResetStore, user.Email)
+
+	sender := &mockEmailSender{}
+	service.SetEmailSender(sender)
+
+	for i := 0; i < passwordResetEmailLimit+1; i++ {
+		assert.NoError(t, service.RequestPasswordReset(user.Email, "10.0.0.1"), "excess requests look like successes")
+	}
+	service.emails.Wait()
+	assert.Len(t, sender.recipients(), passwordResetEmailLimit, "the request over the limit sends no email")
+
+	// An IP that used up its allowance on other addresses can't reach a fresh one
+	other, err := service.RegisterUser(models.RegisterRequest{
+		Username: "resetlimit2",
+		Email:    "reset-limit-2@example.com",
+		Password: "Passw0rd-123",
+	}, "127.0.0.1")
+	require.NoError(t, err)
+	defer delete(passwordResetStore, other.Email)
+
+	for i := 0; i < passwordResetIPLimit; i++ {
+		require.NoError(t, service.RequestPasswordReset(fmt.Sprintf("unknown%d@example.com", i), "10.0.0.2"))
+	}
+	sender = &mockEmailSender{}
+	service.SetEmailSender(sender)
+	require.NoError(t, service.RequestPasswordReset(other.Email, "10.0.0.2"))
+	service.emails.Wait()
+	assert.Empty(t, sender.recipients())
+	require.NoError(t, service.RequestPasswordReset(other.Email, "10.0.0.3"))
+	service.emails.Wait()
+	assert.Equal(t, []string{other.Email}, sender.recipients())
+}
+
+func TestRequestPasswordResetRetriesEmail(t *testing.T) {
+	service, cleanup := setupTestAuthService(t)
+	defer cleanup()
+	service.emailRetryDelay = time.Millisecond
+
+	user, err := service.RegisterUser(models.RegisterRequest{
+		Username: "resetretry",
+		Email:    "reset-retry@example.com",
+		Password: "Passw0rd-123",
+	}, "127.0.0.1")
+	require.NoError(t, err)
+	defer delete(passwordResetStore, user.Email)
+
+	// The first attempt hangs until released, then the mail server fails
+	// once more before accepting the message
+	release := make(chan struct{})
+	sender := &mockEmailSender{fail: func(attempt int) error {
+		switch attempt {
+		case 1:
+			<-release
+			return errors.New("421 service not available")
+		case 2:
+			return errors.New("451 try again later")
+		}
+		return nil
+	}}
+	service.SetEmailSender(sender)
+
+	require.NoError(t, service.RequestPasswordReset(user.Email, "10.0.0.4"), "the request doesn't wait for SMTP")
+	close(release)
+	service.emails.Wait()
+
+	assert.Equal(t, 3, sender.attempts)
+	require.Len(t, sender.sent, 1)
+	link := resetLinkFrom(t, sender.sent[0].body)
+	email, err := service.ValidateResetToken(link.Query().Get("token"))
+	require.NoError(t, err, "the token survives failed attempts")
+	assert.Equal(t, user.Email, email)
+}
+
+func TestAttemptLimiterWindowExpires(t *testing.T) {
+	now := time.Now()
+	limiter := newAttemptLimiter(2, time.Hour)
+	limiter.now = func() time.Time { return now }
+
+	assert.True(t, limiter.Allow("key"))
+	assert.True(t, limiter.Allow("key"))
+	assert.False(t, limiter.Allow("key"))
+	assert.True(t, limiter.Allow("other"), "keys are counted separately")
+
+	now = now.Add(time.Hour)
+	assert.True(t, limiter.Allow("key"), "a new window starts once the old one expires")
+	assert.Len(t, limiter.attempts, 1, "expired keys are swept")
+}
+
+func TestPasswordResetEmailContent(t *testing.T) {
+	service, cleanup := setupTestAuthService(t)
+	defer cleanup()
+
+	user, err := service.RegisterUser(models.RegisterRequest{
+		Username: "resetmail",
+		Email:    "reset-mail@example.com",
+		Password: "Passw0rd-123",
+	}, "127.0.0.1")
+	require.NoError(t, err)
+	defer delete(passwordResetStore, user.Email)
+
+	sender := &mockEmailSender{}
+	service.SetEmailSender(sender)
+	service.SetAppBaseURL("https://music.example.com")
+
+	require.NoError(t, service.RequestPasswordReset(user.Email, "10.0.0.5"))
+	service.emails.Wait()
+
+	require.Len(t, sender.sent, 1)
+	email := sender.sent[0]
+	assert.Equal(t, user.Email, email.to)
+	assert.Equal(t, "Password Reset Request - TuneTudo", email.subject)
+	assert.Contains(t, email.body, "expire in 15 minutes")
+
+	link := resetLinkFrom(t, email.body)
+	assert.Equal(t, "music.example.com", link.Host)
+	assert.Equal(t, "/reset-password.html", link.Path)
+	validated, err := service.ValidateResetToken(link.Query().Get("token"))
+	require.NoError(t, err)
+	assert.Equal(t, user.Email, validated)
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	apperrors "tunetudo/errors"
+	"tunetudo/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockCaptchaVerifier accepts only the token "good" and records what it saw
+type mockCaptchaVerifier struct {
+	tokens []string
+	ips    []string
+}
+
+func (m *mockCaptchaVerifier) Verify(token, remoteIP string) error {
+	m.tokens = append(m.tokens, token)
+	m.ips = append(m.ips, remoteIP)
+	if token != "good" {
+		return errors.New("captcha: rejected (invalid-input-response)")
+	}
+	return nil
+}
+
+func captchaRegisterRequest(username, token string) models.RegisterRequest {
+	return models.RegisterRequest{
+		Username:     username,
+		Email:        username + "@example.com",
+		Password:     "Passw0rd-123",
+		CaptchaToken: token,
+	}
+}
+
+func TestRegisterRequiresCaptcha(t *testing.T) {
+	service, cleanup := setupTestAuthService(t)
+	defer cleanup()
+	verifier := &mockCaptchaVerifier{}
+	service.SetCaptchaVerifier(verifier, false)
+
+	for _, token := range []string{"", "forged"} {
+		_, err := service.RegisterUser(captchaRegisterRequest("bot", token), "203.0.113.9")
+		require.Error(t, err)
+		appErr := apperrors.GetAppError(err)
+		require.NotNil(t, appErr)
+		assert.Equal(t, apperrors.ErrCodeValidation, appErr.Code)
+		assert.Equal(t, "verification failed, please try again", appErr.Message, "provider details stay out of the response")
+	}
+	var users int
+	require.NoError(t, service.db.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&users))
+	assert.Zero(t, users)
+
+	user, err := service.RegisterUser(captchaRegisterRequest("human", "good"), "203.0.113.9")
+	require.NoError(t, err)
+	assert.Equal(t, "human", user.Username)
+	assert.Equal(t, "203.0.113.9", verifier.ips[len(verifier.ips)-1])
+}
+
+func TestRegisterWithoutCaptchaConfigured(t *testing.T) {
+	service, cleanup := setupTestAuthService(t)
+	defer cleanup()
+
+	_, err := service.RegisterUser(captchaRegisterRequest("plain", ""), "127.0.0.1")
+	assert.NoError(t, err)
+	assert.NoError(t, service.VerifyPasswordResetCaptcha("", "127.0.0.1"))
+}
+
+func TestPasswordResetCaptchaIsOptIn(t *testing.T) {
+	service, cleanup := setupTestAuthService(t)
+	defer cleanup()
+	verifier := &mockCaptchaVerifier{}
+
+	service.SetCaptchaVerifier(verifier, false)
+	assert.NoError(t, service.VerifyPasswordResetCaptcha("", "127.0.0.1"))
+	assert.Empty(t, verifier.tokens, "reset requests are not checked unless asked for")
+
+	service.SetCaptchaVerifier(verifier, true)
+	assert.Error(t, service.VerifyPasswordResetCaptcha("", "127.0.0.1"))
+	assert.NoError(t, service.VerifyPasswordResetCaptcha("good", "127.0.0.1"))
+}
+
+func TestHTTPCaptchaVerifier(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "site-secret", r.PostForm.Get("secret"))
+		assert.Equal(t, "198.51.100.4", r.PostForm.Get("remoteip"))
+		if r.PostForm.Get("response") == "good" {
+			w.Write([]byte(`{"success": true}`))
+			return
+		}
+		w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-response"]}`))
+	}))
+	defer server.Close()
+
+	verifier, err := NewCaptchaVerifier("hCaptcha", "site-secret")
+	require.NoError(t, err)
+	verifier.verifyURL = server.URL
+
+	assert.NoError(t, verifier.Verify("good", "198.51.100.4"))
+	assert.Error(t, verifier.Verify("bad", "198.51.100.4"))
+	assert.Error(t, verifier.Verify("", "198.51.100.4"), "an empty token is rejected without asking the provider")
+
+	server.Close()
+	assert.Error(t, verifier.Verify("good", "198.51.100.4"), "an unreachable provider fails closed")
+}
+
+func TestNewCaptchaVerifierRejectsBadConfig(t *testing.T) {
+	_, err := NewCaptchaVerifier("turnstile", "secret")
+	assert.Error(t, err)
+	_, err = NewCaptchaVerifier(CaptchaReCaptcha, "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,364 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"tunetudo/logger"
+	"tunetudo/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxUploadChunks    = 1000
+	uploadSessionTTL   = 1 * time.Hour
+	assembledChunkName = "assembled"
+
+	// uploadCleanupInterval is how often abandoned sessions are swept
+	uploadCleanupInterval = 10 * time.Minute
+)
+
+// ChunkedUploadService lets clients send large tracks in pieces so a
+// dropped connection only costs the current chunk, not the whole file
+type ChunkedUploadService struct {
+	userService *UserService
+	tempDir     string
+	sessionTTL  time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*uploadSession
+}
+
+type uploadSession struct {
+	id          string
+	userID      int
+	filename    string
+	totalSize   int64
+	totalChunks int
+	received    map[int]int64 // chunk index -> bytes
+	dir         string
+	updatedAt   time.Time
+	completing  bool // set while CompleteUpload runs; chunks are refused
+}
+
+func NewChunkedUploadService(userService *UserService, tempDir string) *ChunkedUploadService {
+	return &ChunkedUploadService{
+		userService: userService,
+		tempDir:     tempDir,
+		sessionTTL:  uploadSessionTTL,
+		sessions:    make(map[string]*uploadSession),
+	}
+}
+
+// InitUpload validates the announced file and opens an upload session
+func (s *ChunkedUploadService) InitUpload(userID int, req models.InitUploadRequest) (*models.UploadSession, error) {
+	s.CleanupExpired()
+
+	if req.Filename == "" {
+		return nil, errors.New("filename is required")
+	}
+	ext := filepath.Ext(req.Filename)
+	if ext != ".mp4" && ext != ".wav" && ext != ".mp3" {
+		return nil, errors.New("unsupported file format. Only MP4, WAV, and MP3 allowed")
+	}
+	if req.TotalSize <= 0 {
+		return nil, errors.New("invalid file size")
+	}
+	if limit := s.userService.maxAudioBytes; req.TotalSize > limit {
+		return nil, fileTooLarge(limit)
+	}
+	if req.TotalChunks <= 0 || req.TotalChunks > maxUploadChunks {
+		return nil, fmt.Errorf("total chunks must be between 1 and %d", maxUploadChunks)
+	}
+
+	id := uuid.New().String()
+	dir := filepath.Join(s.tempDir, id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		logger.Error(logger.CategoryUpload, "Failed to create upload session directory", err)
+		return nil, errors.New("failed to start upload")
+	}
+
+	session := &uploadSession{
+		id:          id,
+		userID:      userID,
+		filename:    filepath.Base(req.Filename),
+		totalSize:   req.TotalSize,
+		totalChunks: req.TotalChunks,
+		received:    make(map[int]int64),
+		dir:         dir,
+		updatedAt:   time.Now(),
+	}
+
+	s.mu.Lock()
+	s.sessions[id] = session
+	s.mu.Unlock()
+
+	logger.Info(logger.CategoryUpload, "Chunked upload started: upload_id=%s user_id=%d chunks=%d", id, userID, req.TotalChunks)
+	return session.toModel(s.sessionTTL), nil
+}
+
+// UploadChunk stores one chunk. Re-sending an index replaces it, so a
+// client can safely retry a chunk whose response it never saw. Each write
+// goes to its own temp file and is only renamed into place once accepted,
+// so concurrent retries of one index can't clobber each other
+func (s *ChunkedUploadService) UploadChunk(userID int, uploadID string, index int, data io.Reader) (*models.UploadSession, error) {
+	session, err := s.getSession(userID, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 || index >= session.totalChunks {
+		return nil, errors.New("chunk index out of range")
+	}
+
+	dst, err := os.CreateTemp(session.dir, chunkFilename(index)+".*.part")
+	if err != nil {
+		logger.Error(logger.CategoryUpload, "Failed to create chunk file", err)
+		return nil, errors.New("failed to store chunk")
+	}
+	tempPath := dst.Name()
+
+	// Never accept more bytes than the whole file was announced as
+	written, err := io.Copy(dst, io.LimitReader(data, session.totalSize+1))
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		logger.Error(logger.CategoryUpload, "Failed to write chunk", err)
+		return nil, errors.New("failed to store chunk")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sessions[session.id] != session {
+		os.Remove(tempPath)
+		return nil, errors.New("upload session not found")
+	}
+	if session.completing {
+		os.Remove(tempPath)
+		return nil, errors.New("upload is already being completed")
+	}
+
+	var total int64
+	for i, n := range session.received {
+		if i != index {
+			total += n
+		}
+	}
+	if total+written > session.totalSize {
+		os.Remove(tempPath)
+		return nil, errors.New("chunks exceed declared file size")
+	}
+	if err := os.Rename(tempPath, filepath.Join(session.dir, chunkFilename(index))); err != nil {
+		os.Remove(tempPath)
+		logger.Error(logger.CategoryUpload, "Failed to store chunk", err)
+		return nil, errors.New("failed to store chunk")
+	}
+
+	session.received[index] = written
+	session.updatedAt = time.Now()
+
+	return session.toModel(s.sessionTTL), nil
+}
+
+// CompleteUpload reassembles the chunks in order and hands the file to the
+// regular upload path, which performs the final validation. The session is
+// marked as completing first, so late chunks and a second complete are
+// refused while it runs
+func (s *ChunkedUploadService) CompleteUpload(userID int, uploadID string) (*models.Upload, error) {
+	session, err := s.getSession(userID, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if session.completing {
+		s.mu.Unlock()
+		return nil, errors.New("upload is already being completed")
+	}
+	missing := session.totalChunks - len(session.received)
+	if missing > 0 {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("upload incomplete: %d chunks missing", missing)
+	}
+	session.completing = true
+	s.mu.Unlock()
+
+	assembledPath := filepath.Join(session.dir, assembledChunkName)
+	size, err := assembleChunks(session.dir, session.totalChunks, assembledPath)
+	if err != nil {
+		logger.Error(logger.CategoryUpload, "Failed to assemble chunks", err)
+		s.abortCompletion(session)
+		return nil, errors.New("failed to assemble upload")
+	}
+	if size != session.totalSize {
+		s.removeSession(session)
+		return nil, errors.New("assembled file size does not match declared size")
+	}
+
+	assembled, err := os.Open(assembledPath)
+	if err != nil {
+		logger.Error(logger.CategoryUpload, "Failed to open assembled upload", err)
+		s.abortCompletion(session)
+		return nil, errors.New("failed to assemble upload")
+	}
+	defer assembled.Close()
+
+	upload, err := s.userService.storeUploadedSong(userID, session.filename, size, assembled, 0)
+	s.removeSession(session)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info(logger.CategoryUpload, "Chunked upload completed: upload_id=%s user_id=%d", uploadID, userID)
+	return upload, nil
+}
+
+// CleanupExpired removes sessions that haven't received a chunk within the
+// session TTL, returning how many were removed
+func (s *ChunkedUploadService) CleanupExpired() int {
+	cutoff := time.Now().Add(-s.sessionTTL)
+
+	s.mu.Lock()
+	var expired []*uploadSession
+	for id, session := range s.sessions {
+		if session.updatedAt.Before(cutoff) && !session.completing {
+			expired = append(expired, session)
+			delete(s.sessions, id)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, session := range expired {
+		os.RemoveAll(session.dir)
+	}
+	if len(expired) > 0 {
+		logger.Info(logger.CategoryUpload, "Removed %d abandoned upload sessions", len(expired))
+	}
+	return len(expired)
+}
+
+// ScheduleCleanup removes the session directories a previous run left in
+// the temp dir, since sessions don't outlive the process, then sweeps
+// expired sessions every uploadCleanupInterval for the life of the process
+func (s *ChunkedUploadService) ScheduleCleanup() {
+	s.removeLeftovers()
+
+	go func() {
+		ticker := time.NewTicker(uploadCleanupInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.CleanupExpired()
+		}
+	}()
+}
+
+// removeLeftovers deletes session directories no live session owns. Only
+// entries named like a session are touched, in case the temp dir is shared
+func (s *ChunkedUploadService) removeLeftovers() {
+	entries, err := os.ReadDir(s.tempDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warning(logger.CategoryUpload, "Failed to list upload temp dir: %v", err)
+		}
+		return
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		if _, err := uuid.Parse(entry.Name()); err != nil || !entry.IsDir() {
+			continue
+		}
+		s.mu.Lock()
+		_, live := s.sessions[entry.Name()]
+		s.mu.Unlock()
+		if live {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(s.tempDir, entry.Name())); err != nil {
+			logger.Warning(logger.CategoryUpload, "Failed to remove leftover upload session: %s", entry.Name())
+			continue
+		}
+		removed++
+	}
+	if removed > 0 {
+		logger.Info(logger.CategoryUpload, "Removed %d upload sessions left from a previous run", removed)
+	}
+}
+
+// getSession looks up a session owned by userID. Another user's session is
+// reported as not found so upload ids can't be probed.
+func (s *ChunkedUploadService) getSession(userID int, uploadID string) (*uploadSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[uploadID]
+	if !ok || session.userID != userID {
+		return nil, errors.New("upload session not found")
+	}
+	if time.Since(session.updatedAt) > s.sessionTTL {
+		return nil, errors.New("upload session expired")
+	}
+	return session, nil
+}
+
+// abortCompletion reopens a session whose chunks are all still in place,
+// so the client may try completing it again
+func (s *ChunkedUploadService) abortCompletion(session *uploadSession) {
+	s.mu.Lock()
+	session.completing = false
+	s.mu.Unlock()
+}
+
+func (s *ChunkedUploadService) removeSession(session *uploadSession) {
+	s.mu.Lock()
+	delete(s.sessions, session.id)
+	s.mu.Unlock()
+	os.RemoveAll(session.dir)
+}
+
+func (u *uploadSession) toModel(ttl time.Duration) *models.UploadSession {
+	return &models.UploadSession{
+		ID:             u.id,
+		Filename:       u.filename,
+		TotalSize:      u.totalSize,
+		TotalChunks:    u.totalChunks,
+		ChunksReceived: len(u.received),
+		ExpiresAt:      u.updatedAt.Add(ttl),
+	}
+}
+
+func chunkFilename(index int) string {
+	return fmt.Sprintf("chunk_%06d", index)
+}
+
+// assembleChunks concatenates chunk files 0..totalChunks-1 into destPath
+func assembleChunks(dir string, totalChunks int, destPath string) (int64, error) {
+	dst, err := os.Create(destPath)
+	if err != nil {
+		return 0, err
+	}
+	defer dst.Close()
+
+	var total int64
+	for i := 0; i < totalChunks; i++ {
+		chunk, err := os.Open(filepath.Join(dir, chunkFilename(i)))
+		if err != nil {
+			return 0, err
+		}
+		n, err := io.Copy(dst, chunk)
+		chunk.Close()
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+
+	return total, nil
+}
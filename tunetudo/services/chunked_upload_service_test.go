@@ -0,0 +1,217 @@
+package services
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+	"tunetudo/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupTestChunkedUploadService(t *testing.T) (*ChunkedUploadService, string, int, func()) {
+	db := setupTestDB(t)
+
+	storageDir := "./test_storage_" + t.Name()
+	os.MkdirAll(storageDir, 0755)
+
+	result, err := db.Exec(`INSERT INTO users (username, email, password_hash) VALUES (?, ?, ?)`,
+		"chunkuser", "chunk@test.com", "hash")
+	require.NoError(t, err)
+	userID, _ := result.LastInsertId()
+
+	userService := NewUserService(db, storageDir)
+	service := NewChunkedUploadService(userService, filepath.Join(storageDir, "tmp", "chunks"))
+
+	cleanup := func() {
+		db.Close()
+		os.RemoveAll(storageDir)
+	}
+
+	return service, storageDir, int(userID), cleanup
+}
+
+func TestChunkedUploadReassembly(t *testing.T) {
+	service, storageDir, userID, cleanup := setupTestChunkedUploadService(t)
+	defer cleanup()
+
+	chunks := [][]byte{
+		bytes.Repeat([]byte("a"), 1024),
+		bytes.Repeat([]byte("b"), 1024),
+		[]byte("tail"),
+	}
+	content := bytes.Join(chunks, nil)
+
+	session, err := service.InitUpload(userID, models.InitUploadRequest{
+		Filename:    "long-mix.mp3",
+		TotalSize:   int64(len(content)),
+		TotalChunks: len(chunks),
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, session.ID)
+
+	// Send out of order, retrying one chunk, to mimic a flaky connection
+	for _, i := range []int{2, 0, 1, 0} {
+		_, err := service.UploadChunk(userID, session.ID, i, bytes.NewReader(chunks[i]))
+		require.NoError(t, err)
+	}
+
+	upload, err := service.CompleteUpload(userID, session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "long-mix.mp3", upload.OriginalFilename)
+	assert.Equal(t, int64(len(content)), upload.FileSizeBytes)
+
+	stored, err := os.ReadFile(filepath.Join(storageDir, upload.StoredPath))
+	require.NoError(t, err)
+	assert.Equal(t, content, stored)
+
+	// Session temp files are removed once the upload completes
+	_, err = os.Stat(filepath.Join(storageDir, "tmp", "chunks", session.ID))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestChunkedUploadConcurrentWrites(t *testing.T) {
+	service, storageDir, userID, cleanup := setupTestChunkedUploadService(t)
+	defer cleanup()
+
+	session, err := service.InitUpload(userID, models.InitUploadRequest{
+		Filename: "retry.mp3", TotalSize: 8, TotalChunks: 2,
+	})
+	require.NoError(t, err)
+	_, err = service.UploadChunk(userID, session.ID, 1, bytes.NewReader([]byte("5678")))
+	require.NoError(t, err)
+
+	t.Run("Retries of one index race safely", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				service.UploadChunk(userID, session.ID, 0, bytes.NewReader([]byte("1234")))
+			}()
+		}
+		wg.Wait()
+
+		entries, err := os.ReadDir(service.sessions[session.ID].dir)
+		require.NoError(t, err)
+		assert.Len(t, entries, 2, "no temp files are left behind")
+	})
+
+	t.Run("A rejected rewrite keeps the accepted chunk", func(t *testing.T) {
+		_, err := service.UploadChunk(userID, session.ID, 0, bytes.NewReader([]byte("123456")))
+		assert.Error(t, err)
+	})
+
+	t.Run("Chunks and completes are refused while completing", func(t *testing.T) {
+		service.sessions[session.ID].completing = true
+		_, err := service.UploadChunk(userID, session.ID, 0, bytes.NewReader([]byte("abcd")))
+		assert.Error(t, err)
+		_, err = service.CompleteUpload(userID, session.ID)
+		assert.Error(t, err)
+		service.sessions[session.ID].completing = false
+	})
+
+	upload, err := service.CompleteUpload(userID, session.ID)
+	require.NoError(t, err)
+	stored, err := os.ReadFile(filepath.Join(storageDir, upload.StoredPath))
+	require.NoError(t, err)
+	assert.Equal(t, "12345678", string(stored))
+}
+
+func TestChunkedUploadValidation(t *testing.T) {
+	service, _, userID, cleanup := setupTestChunkedUploadService(t)
+	defer cleanup()
+
+	t.Run("Unsupported format", func(t *testing.T) {
+		_, err := service.InitUpload(userID, models.InitUploadRequest{
+			Filename: "notes.txt", TotalSize: 10, TotalChunks: 1,
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("Too large", func(t *testing.T) {
+		_, err := service.InitUpload(userID, models.InitUploadRequest{
+			Filename: "huge.mp3", TotalSize: 51 * 1024 * 1024, TotalChunks: 10,
+		})
+		assert.Error(t, err)
+	})
+
+	session, err := service.InitUpload(userID, models.InitUploadRequest{
+		Filename: "song.mp3", TotalSize: 8, TotalChunks: 2,
+	})
+	require.NoError(t, err)
+
+	t.Run("Incomplete upload", func(t *testing.T) {
+		_, err := service.UploadChunk(userID, session.ID, 0, bytes.NewReader([]byte("1234")))
+		require.NoError(t, err)
+
+		_, err = service.CompleteUpload(userID, session.ID)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "chunks missing")
+	})
+
+	t.Run("Chunk index out of range", func(t *testing.T) {
+		_, err := service.UploadChunk(userID, session.ID, 5, bytes.NewReader([]byte("x")))
+		assert.Error(t, err)
+	})
+
+	t.Run("Chunks exceed declared size", func(t *testing.T) {
+		_, err := service.UploadChunk(userID, session.ID, 1, bytes.NewReader([]byte("too many bytes")))
+		assert.Error(t, err)
+	})
+
+	t.Run("Other user's session", func(t *testing.T) {
+		_, err := service.UploadChunk(userID+1, session.ID, 1, bytes.NewReader([]byte("5678")))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "upload session not found")
+	})
+}
+
+func TestChunkedUploadCleanupExpired(t *testing.T) {
+	service, _, userID, cleanup := setupTestChunkedUploadService(t)
+	defer cleanup()
+
+	session, err := service.InitUpload(userID, models.InitUploadRequest{
+		Filename: "song.mp3", TotalSize: 4, TotalChunks: 1,
+	})
+	require.NoError(t, err)
+
+	// Age the session past its TTL
+	service.sessions[session.ID].updatedAt = time.Now().Add(-2 * service.sessionTTL)
+	dir := service.sessions[session.ID].dir
+
+	assert.Equal(t, 1, service.CleanupExpired())
+
+	_, err = os.Stat(dir)
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = service.UploadChunk(userID, session.ID, 0, bytes.NewReader([]byte("data")))
+	assert.Error(t, err)
+}
+
+func TestChunkedUploadRemovesLeftovers(t *testing.T) {
+	service, _, userID, cleanup := setupTestChunkedUploadService(t)
+	defer cleanup()
+
+	live, err := service.InitUpload(userID, models.InitUploadRequest{
+		Filename: "song.mp3", TotalSize: 4, TotalChunks: 1,
+	})
+	require.NoError(t, err)
+
+	// Sessions from before a restart are no longer in memory
+	leftover := filepath.Join(service.tempDir, "0b6a5d1e-8f0c-4d3b-9a8e-2f1c7d6e5b4a")
+	require.NoError(t, os.MkdirAll(leftover, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(leftover, chunkFilename(0)), []byte("old"), 0644))
+	unrelated := filepath.Join(service.tempDir, "keep-me")
+	require.NoError(t, os.MkdirAll(unrelated, 0755))
+
+	service.removeLeftovers()
+
+	assert.NoDirExists(t, leftover)
+	assert.DirExists(t, unrelated, "only session directories are removed")
+	assert.DirExists(t, service.sessions[live.ID].dir)
+}
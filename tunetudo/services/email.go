@@ -0,0 +1,169 @@
+package services
+
+import (
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+	"tunetudo/logger"
+)
+
+// TLS modes for SMTPSender
+const (
+	// SMTPStartTLS connects in plaintext and requires upgrading with STARTTLS
+	SMTPStartTLS = "starttls"
+	// SMTPImplicitTLS speaks TLS from the first byte, as on port 465
+	SMTPImplicitTLS = "implicit"
+)
+
+const smtpDialTimeout = 10 * time.Second
+
+// EmailSender delivers a plain-text email to a single recipient
+type EmailSender interface {
+	Send(to, subject, body string) error
+}
+
+// SMTPSender sends mail through an SMTP server, never in plaintext
+type SMTPSender struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+	tlsMode  string
+}
+
+// NewSMTPSender returns a sender for host:port. An empty tlsMode picks
+// implicit TLS on port 465 and STARTTLS everywhere else
+func NewSMTPSender(host, port, username, password, from, tlsMode string) (*SMTPSender, error) {
+	if host == "" || port == "" || from == "" {
+		return nil, fmt.Errorf("SMTP host, port and sender address are required")
+	}
+	if _, err := mail.ParseAddress(from); err != nil {
+		return nil, fmt.Errorf("invalid sender address %q: %w", from, err)
+	}
+
+	tlsMode = strings.ToLower(tlsMode)
+	if tlsMode == "" {
+		tlsMode = SMTPStartTLS
+		if port == "465" {
+			tlsMode = SMTPImplicitTLS
+		}
+	}
+	if tlsMode != SMTPStartTLS && tlsMode != SMTPImplicitTLS {
+		return nil, fmt.Errorf("unsupported SMTP TLS mode %q", tlsMode)
+	}
+
+	return &SMTPSender{
+		host:     host,
+		port:     port,
+		username: username,
+		password: password,
+		from:     from,
+		tlsMode:  tlsMode,
+	}, nil
+}
+
+func (s *SMTPSender) Send(to, subject, body string) error {
+	recipient, message, err := composeMessage(s.from, to, subject, body)
+	if err != nil {
+		return err
+	}
+
+	client, err := s.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if s.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+
+	sender, _ := mail.ParseAddress(s.from)
+	if err := client.Mail(sender.Address); err != nil {
+		return fmt.Errorf("smtp mail from: %w", err)
+	}
+	if err := client.Rcpt(recipient); err != nil {
+		return fmt.Errorf("smtp rcpt to: %w", err)
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	if _, err := w.Write(message); err != nil {
+		w.Close()
+		return fmt.Errorf("smtp write: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	return client.Quit()
+}
+
+// dial opens a client whose connection is already encrypted
+func (s *SMTPSender) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(s.host, s.port)
+	tlsConfig := &tls.Config{ServerName: s.host, MinVersion: tls.VersionTLS12}
+	dialer := &net.Dialer{Timeout: smtpDialTimeout}
+
+	if s.tlsMode == SMTPImplicitTLS {
+		conn, err := tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+		if err != nil {
+			return nil, fmt.Errorf("smtp dial: %w", err)
+		}
+		client, err := smtp.NewClient(conn, s.host)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("smtp handshake: %w", err)
+		}
+		return client, nil
+	}
+
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("smtp dial: %w", err)
+	}
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("smtp handshake: %w", err)
+	}
+	if ok, _ := client.Extension("STARTTLS"); !ok {
+		client.Close()
+		return nil, fmt.Errorf("smtp server %s does not offer STARTTLS", addr)
+	}
+	if err := client.StartTLS(tlsConfig); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("smtp starttls: %w", err)
+	}
+	return client, nil
+}
+
+// composeMessage builds the raw message for one recipient, returning the
+// bare recipient address for RCPT TO. Header values have CR and LF removed
+// and addresses must parse, so no input can start a header of its own
+func composeMessage(from, to, subject, body string) (string, []byte, error) {
+	sender, err := mail.ParseAddress(logger.RemoveCarriageReturns(from))
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid sender address: %w", err)
+	}
+	recipient, err := mail.ParseAddress(logger.RemoveCarriageReturns(to))
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid recipient address: %w", err)
+	}
+
+	message := fmt.Sprintf("From: %s\r\n"+
+		"To: %s\r\n"+
+		"Subject: %s\r\n"+
+		"\r\n"+
+		"%s\r\n", sender, recipient, mime.QEncoding.Encode("utf-8", logger.RemoveCarriageReturns(subject)), body)
+	return recipient.Address, []byte(message), nil
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// headerNames lists the header fields of a raw message
+func headerNames(message []byte) []string {
+	head, _, _ := strings.Cut(string(message), "\r\n\r\n")
+	var names []string
+	for _, line := range strings.Split(head, "\r\n") {
+		name, _, _ := strings.Cut(line, ":")
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestComposeMessage(t *testing.T) {
+	recipient, message, err := composeMessage("TuneTudo <noreply@example.com>", "Listener <listener@example.com>", "Hello", "Body text")
+	require.NoError(t, err)
+
+	assert.Equal(t, "listener@example.com", recipient)
+	assert.Equal(t, []string{"From", "To", "Subject"}, headerNames(message))
+	assert.Contains(t, string(message), "\r\n\r\nBody text\r\n")
+}
+
+func TestComposeMessageBlocksHeaderInjection(t *testing.T) {
+	_, _, err := composeMessage("noreply@example.com", "victim@example.com\r\nBcc: attacker@evil.example", "Reset", "body")
+	assert.Error(t, err, "a recipient carrying extra headers is not an address")
+
+	_, _, err = composeMessage("noreply@example.com\nBcc: attacker@evil.example", "victim@example.com", "Reset", "body")
+	assert.Error(t, err)
+
+	_, message, err := composeMessage("noreply@example.com", "victim@example.com", "Reset\r\nBcc: attacker@evil.example", "body")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"From", "To", "Subject"}, headerNames(message))
+	assert.NotContains(t, string(message), "\r\nBcc:")
+}
+
+func TestNewSMTPSenderTLSMode(t *testing.T) {
+	tests := []struct {
+		port, mode, expected string
+	}{
+		{"587", "", SMTPStartTLS},
+		{"465", "", SMTPImplicitTLS},
+		{"2525", "IMPLICIT", SMTPImplicitTLS},
+		{"465", "starttls", SMTPStartTLS},
+	}
+	for _, tt := range tests {
+		sender, err := NewSMTPSender("smtp.example.com", tt.port, "user", "pass", "noreply@example.com", tt.mode)
+		require.NoError(t, err)
+		assert.Equal(t, tt.expected, sender.tlsMode, "port %s mode %q", tt.port, tt.mode)
+	}
+
+	_, err := NewSMTPSender("smtp.example.com", "25", "", "", "noreply@example.com", "none")
+	assert.Error(t, err, "plaintext delivery is not supported")
+	_, err = NewSMTPSender("", "587", "", "", "noreply@example.com", "")
+	assert.Error(t, err)
+}
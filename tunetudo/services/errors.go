@@ -0,0 +1,39 @@
+package services
+
+import (
+	"errors"
+	apperrors "tunetudo/errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Helpers for AppErrors whose wording clients already depend on. The
+// apperrors 401/403 constructors replace the message with a generic one
+
+// authorizationFailed covers every credential mismatch so callers can't
+// tell an unknown user from a wrong password
+func authorizationFailed() error {
+	return apperrors.NewAppError(apperrors.ErrCodeAuth, "authorization failed", 401, nil)
+}
+
+// notPermitted is returned when a user can see a resource but not change it
+func notPermitted() error {
+	return apperrors.NewAppError(apperrors.ErrCodeForbidden, "unauthorized", 403, nil)
+}
+
+// unauthenticated is returned for missing, invalid or expired credentials
+func unauthenticated(message string) error {
+	return apperrors.NewAppError(apperrors.ErrCodeUnauthorized, message, 401, nil)
+}
+
+// internalError keeps a specific message for failures the caller has
+// already logged; use apperrors.InternalError to log and hide the cause
+func internalError(message string, err error) error {
+	return apperrors.NewAppError(apperrors.ErrCodeInternal, message, 500, err)
+}
+
+// isUniqueViolation reports whether a write failed on a UNIQUE constraint
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"database/sql"
+	"strings"
+	apperrors "tunetudo/errors"
+	"tunetudo/logger"
+)
+
+// explicitFilter is an extra WHERE condition over songs s for listings. In
+// safe mode it hides songs flagged explicit and songs in explicit
+// categories; otherwise it adds nothing
+func explicitFilter(safe bool) string {
+	if !safe {
+		return ""
+	}
+	return ` AND s.explicit = 0 AND NOT EXISTS (
+		SELECT 1 FROM categories ec WHERE ec.id = s.category_id AND ec.explicit = 1
+	)`
+}
+
+// SetExplicitCategories marks exactly the named categories (matched
+// case-insensitively) as explicit and clears the flag on all others
+func (s *SearchService) SetExplicitCategories(names []string) error {
+	placeholders := make([]string, 0, len(names))
+	args := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			placeholders = append(placeholders, "LOWER(?)")
+			args = append(args, name)
+		}
+	}
+
+	query := `UPDATE categories SET explicit = 0`
+	if len(placeholders) > 0 {
+		query = `UPDATE categories SET explicit = (LOWER(name) IN (` + strings.Join(placeholders, ", ") + `))`
+	}
+	if _, err := s.db.Exec(query, args...); err != nil {
+		logger.Error(logger.CategoryDB, "Failed to set explicit categories", err)
+		return err
+	}
+
+	s.InvalidateCategories()
+	return nil
+}
+
+// GetSafeMode reports whether the user has asked for explicit content to
+// be hidden from listings
+func (s *AuthService) GetSafeMode(userID int) (bool, error) {
+	var safe bool
+	err := s.db.QueryRow(`SELECT safe_mode FROM users WHERE id = ?`, userID).Scan(&safe)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, apperrors.NotFoundError("user not found")
+		}
+		logger.Error(logger.CategoryDB, "Failed to retrieve safe mode setting", err)
+		return false, internalError("failed to retrieve user information", err)
+	}
+	return safe, nil
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seedExplicitFixture flags "Test Song 1" as explicit and moves "Test Song 3"
+// into Rock, which is then marked as an explicit category
+func seedExplicitFixture(t *testing.T, db *sql.DB) {
+	_, err := db.Exec(`UPDATE songs SET explicit = 1 WHERE title = 'Test Song 1'`)
+	require.NoError(t, err)
+	_, err = db.Exec(`UPDATE songs SET category_id = (SELECT id FROM categories WHERE name = 'Rock') WHERE title = 'Test Song 3'`)
+	require.NoError(t, err)
+	require.NoError(t, NewSearchService(db).SetExplicitCategories([]string{"rock"}))
+}
+
+func TestSafeModeFiltersSearchAndCategories(t *testing.T) {
+	service, cleanup := setupTestSearchService(t)
+	defer cleanup()
+	seedExplicitFixture(t, service.db)
+
+	results, err := service.FullTextSearch("Test Song", 20, 0, "", false)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"Test Song 1", "Test Song 2", "Test Song 3"}, songTitles(results.Songs.Items))
+
+	results, err = service.FullTextSearch("Test Song", 20, 0, "", true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Test Song 2"}, songTitles(results.Songs.Items))
+	assert.Equal(t, 1, results.Songs.Meta.Total)
+
+	page, err := service.GetSongsByCategory(1, 20, 0, "", true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Test Song 2"}, songTitles(page.Items))
+	assert.Equal(t, 1, page.Meta.Total)
+
+	page, err = service.GetSongsByCategory(2, 20, 0, "", true)
+	require.NoError(t, err)
+	assert.Empty(t, page.Items, "every song in an explicit category is hidden")
+
+	page, err = service.GetSongsByCategory(2, 20, 0, "", false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Test Song 3"}, songTitles(page.Items))
+}
+
+func TestSafeModeFiltersRecentAndRecommendations(t *testing.T) {
+	service, cleanup := setupTestPlaybackService(t)
+	defer cleanup()
+	seedExplicitFixture(t, service.db)
+
+	songs, err := service.GetRecentSongs(20, "", false)
+	require.NoError(t, err)
+	assert.Len(t, songs, 3)
+
+	songs, err = service.GetRecentSongs(20, "", true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Test Song 2"}, songTitles(songs))
+
+	result, err := service.db.Exec(`INSERT INTO users (username, email, password_hash) VALUES ('listener', 'l@test.com', 'h')`)
+	require.NoError(t, err)
+	userID, _ := result.LastInsertId()
+
+	songs, err = service.GetRecommendations(int(userID), 20, false)
+	require.NoError(t, err)
+	assert.Len(t, songs, 3)
+
+	songs, err = service.GetRecommendations(int(userID), 20, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Test Song 2"}, songTitles(songs))
+}
+
+func TestSetExplicitCategoriesReplacesPreviousSet(t *testing.T) {
+	service, cleanup := setupTestSearchService(t)
+	defer cleanup()
+
+	require.NoError(t, service.SetExplicitCategories([]string{"Rock", " jazz "}))
+	require.NoError(t, service.SetExplicitCategories([]string{"POP"}))
+
+	categories, err := service.GetAllCategories()
+	require.NoError(t, err)
+	explicit := map[string]bool{}
+	for _, category := range categories {
+		explicit[category.Name] = category.Explicit
+	}
+	assert.Equal(t, map[string]bool{"Pop": true, "Rock": false, "Jazz": false, "Classical": false}, explicit)
+
+	require.NoError(t, service.SetExplicitCategories(nil))
+	categories, err = service.GetAllCategories()
+	require.NoError(t, err)
+	for _, category := range categories {
+		assert.False(t, category.Explicit, category.Name)
+	}
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"io"
+	"os"
+)
+
+// saveFileAtomically writes src to a temporary file beside destPath and
+// renames it into place once fully written, so a partial write is never
+// visible under the final name. On error nothing is left on disk.
+func saveFileAtomically(src io.Reader, destPath string) (int64, error) {
+	tmpPath := destPath + ".tmp"
+
+	dst, err := os.Create(tmpPath)
+	if err != nil {
+		return 0, err
+	}
+
+	written, err := io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return 0, err
+	}
+
+	if err := os.Rename(tmpPath, destPath); err != nil {
+		os.Remove(tmpPath)
+		return 0, err
+	}
+
+	return written, nil
+}
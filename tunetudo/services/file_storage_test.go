@@ -0,0 +1,51 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingReader returns some data and then an error, like a dropped upload
+type failingReader struct {
+	data io.Reader
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	n, err := r.data.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset")
+	}
+	return n, err
+}
+
+func TestSaveFileAtomically(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("Complete write", func(t *testing.T) {
+		dest := filepath.Join(dir, "song.mp3")
+		written, err := saveFileAtomically(strings.NewReader("audio"), dest)
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), written)
+
+		content, err := os.ReadFile(dest)
+		require.NoError(t, err)
+		assert.Equal(t, "audio", string(content))
+		assert.NoFileExists(t, dest+".tmp")
+	})
+
+	t.Run("Partial write leaves nothing behind", func(t *testing.T) {
+		dest := filepath.Join(dir, "partial.mp3")
+		_, err := saveFileAtomically(&failingReader{data: strings.NewReader("half an upload")}, dest)
+		assert.Error(t, err)
+
+		assert.NoFileExists(t, dest)
+		assert.NoFileExists(t, dest+".tmp")
+	})
+}
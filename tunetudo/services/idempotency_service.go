@@ -0,0 +1,99 @@
+package services
+
+import (
+	"database/sql"
+	"time"
+	apperrors "tunetudo/errors"
+	"tunetudo/models"
+)
+
+// defaultIdempotencyTTL is how long a processed key keeps replaying its
+// response when no TTL is configured
+const defaultIdempotencyTTL = 24 * time.Hour
+
+// IdempotencyService records the response to each request sent with an
+// Idempotency-Key so a retried request gets the same answer instead of
+// running twice. Keys are scoped to the user that sent them
+type IdempotencyService struct {
+	db  *sql.DB
+	ttl time.Duration
+	now func() time.Time
+}
+
+func NewIdempotencyService(db *sql.DB) *IdempotencyService {
+	return &IdempotencyService{db: db, ttl: defaultIdempotencyTTL, now: time.Now}
+}
+
+// SetTTL sets how long a processed key is remembered
+func (s *IdempotencyService) SetTTL(ttl time.Duration) {
+	if ttl > 0 {
+		s.ttl = ttl
+	}
+}
+
+// Begin claims key for a request. It returns nil when the request should
+// run, or the stored response when the key was already processed. A key
+// still being processed, or reused for a different endpoint, is an error
+func (s *IdempotencyService) Begin(userID int, key, method, path string) (*models.IdempotentResponse, error) {
+	now := s.now().UTC()
+	if _, err := s.db.Exec(
+		`DELETE FROM idempotency_keys WHERE created_at < ?`,
+		now.Add(-s.ttl).Format(auditTimeFormat),
+	); err != nil {
+		return nil, apperrors.InternalError(err)
+	}
+
+	result, err := s.db.Exec(`
+		INSERT OR IGNORE INTO idempotency_keys (user_id, idempotency_key, method, path, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, userID, key, method, path, now.Format(auditTimeFormat))
+	if err != nil {
+		return nil, apperrors.InternalError(err)
+	}
+	if claimed, _ := result.RowsAffected(); claimed == 1 {
+		return nil, nil
+	}
+
+	var storedMethod, storedPath string
+	var status sql.NullInt64
+	var contentType sql.NullString
+	var body []byte
+	err = s.db.QueryRow(`
+		SELECT method, path, status, content_type, body
+		FROM idempotency_keys
+		WHERE user_id = ? AND idempotency_key = ?
+	`, userID, key).Scan(&storedMethod, &storedPath, &status, &contentType, &body)
+	if err != nil {
+		return nil, apperrors.InternalError(err)
+	}
+
+	if storedMethod != method || storedPath != path {
+		return nil, apperrors.ValidationError("Idempotency-Key was already used for a different request", nil)
+	}
+	if !status.Valid {
+		return nil, apperrors.ConflictError("A request with this Idempotency-Key is still being processed")
+	}
+	return &models.IdempotentResponse{
+		Status:      int(status.Int64),
+		ContentType: contentType.String,
+		Body:        body,
+	}, nil
+}
+
+// Complete stores the response for a key claimed by Begin
+func (s *IdempotencyService) Complete(userID int, key string, response models.IdempotentResponse) error {
+	_, err := s.db.Exec(`
+		UPDATE idempotency_keys SET status = ?, content_type = ?, body = ?
+		WHERE user_id = ? AND idempotency_key = ?
+	`, response.Status, response.ContentType, response.Body, userID, key)
+	return err
+}
+
+// Release forgets a claimed key whose request failed, so it can be retried
+func (s *IdempotencyService) Release(userID int, key string) error {
+	_, err := s.db.Exec(
+		`DELETE FROM idempotency_keys WHERE user_id = ? AND idempotency_key = ? AND status IS NULL`,
+		userID, key,
+	)
+	return err
+}
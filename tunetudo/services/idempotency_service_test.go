@@ -0,0 +1,65 @@
+package services
+
+import (
+	"testing"
+	"time"
+	"tunetudo/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupTestIdempotencyService(t *testing.T) (*IdempotencyService, int) {
+	db := setupTestDB(t)
+	result, err := db.Exec(`INSERT INTO users (username, email, password_hash) VALUES ('idem', 'idem@example.com', 'x')`)
+	require.NoError(t, err)
+	userID, _ := result.LastInsertId()
+	return NewIdempotencyService(db), int(userID)
+}
+
+func TestIdempotencyKeyLifecycle(t *testing.T) {
+	service, userID := setupTestIdempotencyService(t)
+
+	stored, err := service.Begin(userID, "key-1", "POST", "/api/playlists")
+	require.NoError(t, err)
+	assert.Nil(t, stored, "a new key runs the request")
+
+	// A concurrent retry must not run the handler a second time
+	_, err = service.Begin(userID, "key-1", "POST", "/api/playlists")
+	assert.Error(t, err)
+
+	response := models.IdempotentResponse{Status: 201, ContentType: "application/json", Body: []byte(`{"id":1}`)}
+	require.NoError(t, service.Complete(userID, "key-1", response))
+
+	stored, err = service.Begin(userID, "key-1", "POST", "/api/playlists")
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.Equal(t, response, *stored)
+
+	_, err = service.Begin(userID, "key-1", "POST", "/api/upload")
+	assert.Error(t, err, "a key cannot be reused for another endpoint")
+
+	// Released keys can be claimed again
+	_, err = service.Begin(userID, "key-2", "POST", "/api/upload")
+	require.NoError(t, err)
+	require.NoError(t, service.Release(userID, "key-2"))
+	stored, err = service.Begin(userID, "key-2", "POST", "/api/upload")
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+}
+
+func TestIdempotencyKeyExpires(t *testing.T) {
+	service, userID := setupTestIdempotencyService(t)
+	now := time.Now()
+	service.now = func() time.Time { return now }
+	service.SetTTL(time.Hour)
+
+	_, err := service.Begin(userID, "key-1", "POST", "/api/playlists")
+	require.NoError(t, err)
+	require.NoError(t, service.Complete(userID, "key-1", models.IdempotentResponse{Status: 201}))
+
+	now = now.Add(2 * time.Hour)
+	stored, err := service.Begin(userID, "key-1", "POST", "/api/playlists")
+	require.NoError(t, err)
+	assert.Nil(t, stored, "an expired key runs the request again")
+}
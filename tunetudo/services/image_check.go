@@ -0,0 +1,160 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+)
+
+// maxImageDimension bounds the width and height of uploaded images so a
+// small file can't expand into a huge bitmap when it is displayed
+const maxImageDimension = 4000
+
+// imageHeaderBytes is how much of a file checkImage reads up front. It
+// covers the WebP header and the metadata boxes AVIF encoders write first
+const imageHeaderBytes = 64 * 1024
+
+// imageFormats maps the accepted extensions to the format their content
+// must have
+var imageFormats = map[string]string{
+	".jpg":  "jpeg",
+	".jpeg": "jpeg",
+	".png":  "png",
+	".webp": "webp",
+	".avif": "avif",
+}
+
+var errUnrecognizedImage = errors.New("file is not a valid image")
+
+// checkImage verifies that src holds an image in the format ext claims and
+// that neither side exceeds maxImageDimension. Only the headers are read:
+// JPEG and PNG through the standard decoders, WebP and AVIF by parsing
+// their containers
+func checkImage(ext string, src io.Reader) error {
+	want, ok := imageFormats[strings.ToLower(ext)]
+	if !ok {
+		return errors.New("unsupported file type. Only JPG, PNG, WebP and AVIF allowed")
+	}
+
+	head := make([]byte, imageHeaderBytes)
+	n, err := io.ReadFull(src, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	head = head[:n]
+
+	format, width, height, err := imageSize(head, io.MultiReader(bytes.NewReader(head), src))
+	if err != nil {
+		return errUnrecognizedImage
+	}
+	if format != want {
+		return errors.New("file content does not match its extension")
+	}
+	if width <= 0 || height <= 0 {
+		return errUnrecognizedImage
+	}
+	if width > maxImageDimension || height > maxImageDimension {
+		return fmt.Errorf("image too large. Maximum size is %dx%d pixels", maxImageDimension, maxImageDimension)
+	}
+	return nil
+}
+
+// imageSize identifies an image by its magic bytes and returns its
+// dimensions. full reads the whole file from the start
+func imageSize(head []byte, full io.Reader) (format string, width, height int, err error) {
+	var config image.Config
+	switch {
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		config, err = png.DecodeConfig(full)
+		return "png", config.Width, config.Height, err
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8, 0xFF}):
+		// Metadata can push the frame header well past the first bytes
+		config, err = jpeg.DecodeConfig(full)
+		return "jpeg", config.Width, config.Height, err
+	case len(head) >= 12 && string(head[0:4]) == "RIFF" && string(head[8:12]) == "WEBP":
+		width, height, err = webpSize(head)
+		return "webp", width, height, err
+	case len(head) >= 12 && string(head[4:8]) == "ftyp" && isAVIF(head):
+		width, height, err = avifSize(head)
+		return "avif", width, height, err
+	}
+	return "", 0, 0, errUnrecognizedImage
+}
+
+// webpSize reads the dimensions from the first chunk of a WebP file, which
+// is a lossy (VP8), lossless (VP8L) or extended (VP8X) header
+func webpSize(head []byte) (int, int, error) {
+	if len(head) < 30 {
+		return 0, 0, errUnrecognizedImage
+	}
+	chunk := head[12:16]
+	data := head[20:]
+	switch string(chunk) {
+	case "VP8 ":
+		// 3-byte frame tag, start code, then 14-bit width and height
+		if !bytes.Equal(data[3:6], []byte{0x9D, 0x01, 0x2A}) {
+			return 0, 0, errUnrecognizedImage
+		}
+		width := int(binary.LittleEndian.Uint16(data[6:8]) & 0x3FFF)
+		height := int(binary.LittleEndian.Uint16(data[8:10]) & 0x3FFF)
+		return width, height, nil
+	case "VP8L":
+		// Signature byte, then width-1 and height-1 packed in 14 bits each
+		if data[0] != 0x2F {
+			return 0, 0, errUnrecognizedImage
+		}
+		bits := binary.LittleEndian.Uint32(data[1:5])
+		return int(bits&0x3FFF) + 1, int(bits>>14&0x3FFF) + 1, nil
+	case "VP8X":
+		// Flags and reserved bytes, then 24-bit canvas width-1 and height-1
+		width := int(data[4]) | int(data[5])<<8 | int(data[6])<<16
+		height := int(data[7]) | int(data[8])<<8 | int(data[9])<<16
+		return width + 1, height + 1, nil
+	}
+	return 0, 0, errUnrecognizedImage
+}
+
+// isAVIF reports whether the ftyp box at the start of head lists an AVIF
+// brand, as major brand or compatible brand
+func isAVIF(head []byte) bool {
+	size := int(binary.BigEndian.Uint32(head[0:4]))
+	if size < 16 || size > len(head) {
+		return false
+	}
+	for i := 8; i+4 <= size; i += 4 {
+		// Bytes 12-15 are the minor version, not a brand
+		if i == 12 {
+			continue
+		}
+		if brand := string(head[i : i+4]); brand == "avif" || brand == "avis" {
+			return true
+		}
+	}
+	return false
+}
+
+// avifSize returns the largest image spatial extents ("ispe") property in
+// head. An AVIF file describes each of its images, including thumbnails and
+// alpha planes, with one
+func avifSize(head []byte) (int, int, error) {
+	width, height := 0, 0
+	for i := 4; i+16 <= len(head); i++ {
+		if string(head[i:i+4]) != "ispe" || binary.BigEndian.Uint32(head[i-4:i]) != 20 {
+			continue
+		}
+		// Box size and type, 4 bytes of version and flags, then the extents
+		w := int(binary.BigEndian.Uint32(head[i+8 : i+12]))
+		h := int(binary.BigEndian.Uint32(head[i+12 : i+16]))
+		width, height = max(width, w), max(height, h)
+	}
+	if width == 0 || height == 0 {
+		return 0, 0, errUnrecognizedImage
+	}
+	return width, height, nil
+}
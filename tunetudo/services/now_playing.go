@@ -0,0 +1,123 @@
+package services
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+	apperrors "tunetudo/errors"
+	"tunetudo/logger"
+	"tunetudo/models"
+)
+
+// defaultNowPlayingTTL is how long a stream keeps counting as what its
+// listener is playing without another request for audio
+const defaultNowPlayingTTL = 5 * time.Minute
+
+// nowPlayingStore remembers the song each user last streamed. It is kept in
+// memory only, so presence starts empty after a restart. Stale entries are
+// dropped as it goes
+type nowPlayingStore struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu        sync.Mutex
+	entries   map[int]nowPlayingEntry
+	lastSweep time.Time
+}
+
+type nowPlayingEntry struct {
+	songID    int
+	updatedAt time.Time
+}
+
+func newNowPlayingStore(ttl time.Duration) *nowPlayingStore {
+	return &nowPlayingStore{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[int]nowPlayingEntry),
+	}
+}
+
+// Set records that userID is streaming songID and reports whether this
+// starts a new play, rather than continuing the one already in progress
+func (p *nowPlayingStore) Set(userID, songID int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	if now.Sub(p.lastSweep) >= p.ttl {
+		for id, entry := range p.entries {
+			if p.expired(entry, now) {
+				delete(p.entries, id)
+			}
+		}
+		p.lastSweep = now
+	}
+	previous, ok := p.entries[userID]
+	p.entries[userID] = nowPlayingEntry{songID: songID, updatedAt: now}
+	return !ok || previous.songID != songID || p.expired(previous, now)
+}
+
+// Get returns the song userID is playing, if they streamed one within ttl
+func (p *nowPlayingStore) Get(userID int) (nowPlayingEntry, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry, ok := p.entries[userID]
+	if !ok {
+		return nowPlayingEntry{}, false
+	}
+	if p.expired(entry, p.now()) {
+		delete(p.entries, userID)
+		return nowPlayingEntry{}, false
+	}
+	return entry, true
+}
+
+func (p *nowPlayingStore) expired(entry nowPlayingEntry, now time.Time) bool {
+	return !now.Before(entry.updatedAt.Add(p.ttl))
+}
+
+// SetNowPlayingTTL sets how long after their last stream request a user
+// still shows as playing that song. Non-positive values keep the default
+func (s *PlaybackService) SetNowPlayingTTL(ttl time.Duration) {
+	if ttl > 0 {
+		s.nowPlaying.ttl = ttl
+	}
+}
+
+// GetNowPlaying returns what userID is listening to, or nil when they have
+// not streamed anything recently
+func (s *PlaybackService) GetNowPlaying(userID int) (*models.NowPlaying, error) {
+	entry, ok := s.nowPlaying.Get(userID)
+	if !ok {
+		return nil, nil
+	}
+
+	song, err := s.GetSongByID(entry.songID)
+	if err != nil {
+		// The song was deleted mid-play; there is nothing to show
+		return nil, nil
+	}
+	return &models.NowPlaying{Song: song, UpdatedAt: entry.updatedAt}, nil
+}
+
+// GetUserNowPlaying returns what another user is listening to, if they have
+// chosen to share it. Viewers always see their own presence
+func (s *PlaybackService) GetUserNowPlaying(viewerID, userID int) (*models.NowPlaying, error) {
+	if viewerID != userID {
+		var shared bool
+		err := s.db.QueryRow(`SELECT share_now_playing FROM users WHERE id = ?`, userID).Scan(&shared)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil, apperrors.NotFoundError("user not found")
+			}
+			logger.Error(logger.CategoryDB, "Failed to look up now playing visibility", err)
+			return nil, internalError("failed to fetch now playing", err)
+		}
+		if !shared {
+			return nil, apperrors.ForbiddenError("this user does not share what they are playing")
+		}
+	}
+	return s.GetNowPlaying(userID)
+}
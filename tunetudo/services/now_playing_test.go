@@ -0,0 +1,140 @@
+package services
+
+import (
+	"testing"
+	"time"
+	apperrors "tunetudo/errors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamUpdatesNowPlaying(t *testing.T) {
+	service, cleanup := setupTestPlaybackService(t)
+	defer cleanup()
+	service.SetNowPlayingTTL(time.Minute)
+
+	now := time.Now()
+	service.nowPlaying.now = func() time.Time { return now }
+
+	// Anonymous streams and failed authorizations record nothing
+	_, err := service.AuthorizeStream(1, signedStreamToken(service, 1), 0)
+	require.NoError(t, err)
+	_, err = service.AuthorizeStream(2, "bad.token.here", 7)
+	require.Error(t, err)
+	playing, err := service.GetNowPlaying(7)
+	require.NoError(t, err)
+	assert.Nil(t, playing)
+
+	_, err = service.AuthorizeStream(1, signedStreamToken(service, 1), 7)
+	require.NoError(t, err)
+	_, err = service.AuthorizeStream(2, signedStreamToken(service, 2), 7)
+	require.NoError(t, err)
+
+	playing, err = service.GetNowPlaying(7)
+	require.NoError(t, err)
+	require.NotNil(t, playing)
+	assert.Equal(t, 2, playing.Song.ID, "the latest stream wins")
+	assert.Equal(t, now, playing.UpdatedAt)
+
+	now = now.Add(59 * time.Second)
+	playing, err = service.GetNowPlaying(7)
+	require.NoError(t, err)
+	assert.NotNil(t, playing)
+
+	now = now.Add(time.Second)
+	playing, err = service.GetNowPlaying(7)
+	require.NoError(t, err)
+	assert.Nil(t, playing, "presence expires after the TTL")
+}
+
+func TestStreamRecordsOnePlayPerListen(t *testing.T) {
+	service, cleanup := setupTestPlaybackService(t)
+	defer cleanup()
+	service.SetNowPlayingTTL(time.Minute)
+
+	now := time.Now()
+	service.nowPlaying.now = func() time.Time { return now }
+
+	result, err := service.db.Exec(`INSERT INTO users (username, email, password_hash) VALUES (?, ?, ?)`,
+		"listener", "listener@test.com", "hash")
+	require.NoError(t, err)
+	listenerID, _ := result.LastInsertId()
+
+	stream := func(songID int) {
+		_, err := service.AuthorizeStream(songID, signedStreamToken(service, songID), int(listenerID))
+		require.NoError(t, err)
+	}
+
+	// Range requests for the same listen count once
+	stream(1)
+	stream(1)
+	assert.Equal(t, 1, countRows(t, service.db, "plays"))
+
+	stream(2)
+	stream(1)
+	assert.Equal(t, 3, countRows(t, service.db, "plays"))
+
+	// Coming back to a song after the presence lapsed is a new play
+	now = now.Add(2 * time.Minute)
+	stream(1)
+	assert.Equal(t, 4, countRows(t, service.db, "plays"))
+
+	_, err = service.AuthorizeStream(1, signedStreamToken(service, 1), 0)
+	require.NoError(t, err)
+	assert.Equal(t, 4, countRows(t, service.db, "plays"), "anonymous streams are not recorded")
+}
+
+func TestNowPlayingSweepsStaleEntries(t *testing.T) {
+	store := newNowPlayingStore(time.Minute)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	store.Set(1, 10)
+	store.Set(2, 20)
+	now = now.Add(2 * time.Minute)
+	store.Set(3, 30)
+
+	assert.Len(t, store.entries, 1)
+	entry, ok := store.Get(3)
+	assert.True(t, ok)
+	assert.Equal(t, 30, entry.songID)
+}
+
+func TestGetUserNowPlayingRespectsPrivacy(t *testing.T) {
+	service, cleanup := setupTestPlaybackService(t)
+	defer cleanup()
+
+	result, err := service.db.Exec(`INSERT INTO users (username, email, password_hash) VALUES (?, ?, ?)`,
+		"listener", "listener@test.com", "hash")
+	require.NoError(t, err)
+	listenerID64, _ := result.LastInsertId()
+	listenerID := int(listenerID64)
+
+	_, err = service.AuthorizeStream(1, signedStreamToken(service, 1), listenerID)
+	require.NoError(t, err)
+
+	// Users can always see their own presence
+	playing, err := service.GetUserNowPlaying(listenerID, listenerID)
+	require.NoError(t, err)
+	require.NotNil(t, playing)
+
+	_, err = service.GetUserNowPlaying(99, listenerID)
+	require.Error(t, err)
+	if appErr := apperrors.GetAppError(err); assert.NotNil(t, appErr) {
+		assert.Equal(t, apperrors.ErrCodeForbidden, appErr.Code)
+	}
+
+	_, err = service.db.Exec(`UPDATE users SET share_now_playing = 1 WHERE id = ?`, listenerID)
+	require.NoError(t, err)
+	playing, err = service.GetUserNowPlaying(99, listenerID)
+	require.NoError(t, err)
+	require.NotNil(t, playing)
+	assert.Equal(t, 1, playing.Song.ID)
+
+	_, err = service.GetUserNowPlaying(99, 12345)
+	require.Error(t, err)
+	if appErr := apperrors.GetAppError(err); assert.NotNil(t, appErr) {
+		assert.Equal(t, apperrors.ErrCodeNotFound, appErr.Code)
+	}
+}
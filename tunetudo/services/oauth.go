@@ -0,0 +1,321 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	apperrors "tunetudo/errors"
+	"tunetudo/logger"
+	"tunetudo/models"
+	"unicode"
+)
+
+// OAuthGoogle is the users.provider value for accounts signed in with Google
+const OAuthGoogle = "google"
+
+const (
+	googleAuthURL     = "https://accounts.google.com/o/oauth2/v2/auth"
+	googleTokenURL    = "https://oauth2.googleapis.com/token"
+	googleUserInfoURL = "https://openidconnect.googleapis.com/v1/userinfo"
+
+	oauthRequestTimeout = 10 * time.Second
+
+	// maxOAuthUsernameLength bounds usernames derived from an email address
+	maxOAuthUsernameLength = 30
+)
+
+// OAuthProfile is what a provider tells us about the person signing in
+type OAuthProfile struct {
+	ProviderID    string
+	Email         string
+	EmailVerified bool
+}
+
+// OAuthProvider runs one provider's authorization code flow
+type OAuthProvider interface {
+	// AuthCodeURL is where the browser is sent to sign in; state comes back
+	// unchanged on the callback
+	AuthCodeURL(state string) string
+	// Exchange trades the callback's code for the signed-in user's profile
+	Exchange(ctx context.Context, code string) (*OAuthProfile, error)
+}
+
+// GoogleOAuth signs users in with their Google account, asking only for
+// their email address
+type GoogleOAuth struct {
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	tokenURL     string
+	userInfoURL  string
+	client       *http.Client
+}
+
+// NewGoogleOAuth returns a provider for a Google OAuth client whose
+// authorized redirect URI is redirectURL
+func NewGoogleOAuth(clientID, clientSecret, redirectURL string) (*GoogleOAuth, error) {
+	if clientID == "" || clientSecret == "" || redirectURL == "" {
+		return nil, errors.New("Google OAuth client id, secret and redirect URL are required")
+	}
+	return &GoogleOAuth{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURL:  redirectURL,
+		tokenURL:     googleTokenURL,
+		userInfoURL:  googleUserInfoURL,
+		client:       &http.Client{Timeout: oauthRequestTimeout},
+	}, nil
+}
+
+func (g *GoogleOAuth) AuthCodeURL(state string) string {
+	return googleAuthURL + "?" + url.Values{
+		"client_id":     {g.clientID},
+		"redirect_uri":  {g.redirectURL},
+		"response_type": {"code"},
+		"scope":         {"openid email"},
+		"state":         {state},
+	}.Encode()
+}
+
+func (g *GoogleOAuth) Exchange(ctx context.Context, code string) (*OAuthProfile, error) {
+	form := url.Values{
+		"client_id":     {g.clientID},
+		"client_secret": {g.clientSecret},
+		"redirect_uri":  {g.redirectURL},
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := g.doJSON(req, &token); err != nil {
+		return nil, fmt.Errorf("google token exchange: %w", err)
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("google token exchange: no access token")
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, g.userInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+
+	var info struct {
+		Sub           string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}
+	if err := g.doJSON(req, &info); err != nil {
+		return nil, fmt.Errorf("google userinfo: %w", err)
+	}
+	if info.Sub == "" {
+		return nil, errors.New("google userinfo: no subject")
+	}
+	return &OAuthProfile{ProviderID: info.Sub, Email: info.Email, EmailVerified: info.EmailVerified}, nil
+}
+
+func (g *GoogleOAuth) doJSON(req *http.Request, out interface{}) error {
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// SetGoogleOAuth enables signing in with Google
+func (s *AuthService) SetGoogleOAuth(provider OAuthProvider) {
+	s.googleOAuth = provider
+}
+
+// GoogleAuthURL returns where to send the browser to start a Google sign-in
+func (s *AuthService) GoogleAuthURL(state string) (string, error) {
+	if s.googleOAuth == nil {
+		return "", apperrors.NotFoundError("Google sign-in is not enabled")
+	}
+	return s.googleOAuth.AuthCodeURL(state), nil
+}
+
+// LoginWithGoogle completes a Google sign-in, returning the same token as
+// LoginUser for the linked or newly created account
+func (s *AuthService) LoginWithGoogle(code, ipAddress, userAgent string) (string, *models.User, error) {
+	if s.googleOAuth == nil {
+		return "", nil, apperrors.NotFoundError("Google sign-in is not enabled")
+	}
+
+	profile, err := s.googleOAuth.Exchange(context.Background(), code)
+	if err != nil {
+		logger.Error(logger.CategoryAuth, "Google sign-in exchange failed", err)
+		return "", nil, authorizationFailed()
+	}
+	return s.loginOAuthUser(OAuthGoogle, profile, ipAddress, userAgent)
+}
+
+// loginOAuthUser signs in the account linked to a provider identity. An
+// unlinked identity is linked to the account with the same email, or gets
+// a new account without a password
+func (s *AuthService) loginOAuthUser(provider string, profile *OAuthProfile, ipAddress, userAgent string) (string, *models.User, error) {
+	if !profile.EmailVerified {
+		logger.AuthAttempt("oauth_user", ipAddress, false, provider+" email not verified")
+		return "", nil, authorizationFailed()
+	}
+	email, err := NormalizeEmail(profile.Email)
+	if err != nil {
+		logger.AuthAttempt("oauth_user", ipAddress, false, provider+" email invalid")
+		return "", nil, authorizationFailed()
+	}
+
+	user, err := s.findOAuthUser(provider, profile.ProviderID, email, ipAddress)
+	if err == sql.ErrNoRows {
+		user, err = s.createOAuthUser(provider, profile.ProviderID, email)
+	}
+	if err != nil {
+		if appErr := apperrors.GetAppError(err); appErr != nil {
+			return "", nil, err
+		}
+		logger.Error(logger.CategoryAuth, "OAuth account lookup failed", err)
+		return "", nil, internalError("failed to sign in", err)
+	}
+
+	if user.Suspended {
+		logger.AuthAttempt(user.Username, ipAddress, false, "Account suspended")
+		return "", nil, apperrors.NewAppError(apperrors.ErrCodeAuth, "account suspended", 401, nil)
+	}
+
+	// The provider vouches for the address, as long as the account still uses it
+	if _, err := s.db.Exec(`UPDATE users SET email_verified = 1 WHERE id = ? AND email = ?`, user.ID, email); err != nil {
+		logger.Warning(logger.CategoryDB, "Failed to mark email verified for user_id=%d", user.ID)
+	}
+
+	token, err := s.startSession(user, ipAddress, userAgent)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, user, nil
+}
+
+// findOAuthUser returns the account already linked to the identity, linking
+// the account with the same email if there is one. Anyone can register a
+// password account for an address they don't own, so linking one whose
+// email was never verified also drops its password and sessions: only the
+// provider's user gets in afterwards
+func (s *AuthService) findOAuthUser(provider, providerID, email, ipAddress string) (*models.User, error) {
+	var user models.User
+	var linkedProvider, linkedID sql.NullString
+	var emailVerified bool
+	scan := func(row *sql.Row) error {
+		return row.Scan(&user.ID, &user.Username, &user.Email, &user.IsAdmin, &user.Suspended,
+			&user.ProfileImagePath, &user.CreatedAt, &linkedProvider, &linkedID, &emailVerified)
+	}
+	const columns = `id, username, email, is_admin, suspended, profile_image_path, created_at, provider, provider_id, email_verified`
+
+	err := scan(s.db.QueryRow(`SELECT `+columns+` FROM users WHERE provider = ? AND provider_id = ?`, provider, providerID))
+	if err != sql.ErrNoRows {
+		return &user, err
+	}
+
+	if err := scan(s.db.QueryRow(`SELECT `+columns+` FROM users WHERE email = ?`, email)); err != nil {
+		return nil, err
+	}
+	// The address belongs to an account linked to some other identity
+	if linkedID.Valid {
+		logger.Security("OAUTH_LINK_REFUSED", logger.HashIdentifier(user.Username), logger.MaskIP(ipAddress), "Email already linked to another identity")
+		return nil, authorizationFailed()
+	}
+
+	if emailVerified {
+		if _, err := s.db.Exec(`UPDATE users SET provider = ?, provider_id = ? WHERE id = ?`, provider, providerID, user.ID); err != nil {
+			return nil, err
+		}
+		logger.Security("OAUTH_LINKED", logger.HashIdentifier(user.Username), logger.MaskIP(ipAddress), "Linked "+provider+" sign-in")
+		return &user, nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`UPDATE users SET provider = ?, provider_id = ?, password_hash = '' WHERE id = ?`, provider, providerID, user.ID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM sessions WHERE user_id = ?`, user.ID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	logger.Security("OAUTH_LINKED", logger.HashIdentifier(user.Username), logger.MaskIP(ipAddress),
+		"Linked "+provider+" sign-in to an unverified account; password and sessions cleared")
+	return &user, nil
+}
+
+// createOAuthUser registers an account for an identity with no password;
+// one can be set later through ChangePassword or password reset
+func (s *AuthService) createOAuthUser(provider, providerID, email string) (*models.User, error) {
+	username, err := s.availableUsername(oauthUsername(email))
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.db.Exec(
+		`INSERT INTO users (username, email, password_hash, provider, provider_id) VALUES (?, ?, '', ?, ?)`,
+		username, email, provider, providerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := result.LastInsertId()
+
+	logger.Info(logger.CategoryAuth, "New user registered via %s: ID=%d", provider, id)
+	return &models.User{ID: int(id), Username: username, Email: email, CreatedAt: time.Now()}, nil
+}
+
+// oauthUsername derives a username from the local part of an email address
+func oauthUsername(email string) string {
+	local, _, _ := strings.Cut(email, "@")
+	var name strings.Builder
+	for _, r := range local {
+		if name.Len() >= maxOAuthUsernameLength-4 {
+			break
+		}
+		if r <= unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.' || r == '-') {
+			name.WriteRune(r)
+		}
+	}
+	if name.Len() < minUsernameLength {
+		return "user"
+	}
+	return name.String()
+}
+
+// availableUsername returns base, or base with the first free numeric suffix
+func (s *AuthService) availableUsername(base string) (string, error) {
+	candidate := base
+	for i := 2; ; i++ {
+		var taken bool
+		if err := s.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE username = ?)`, candidate).Scan(&taken); err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s%d", base, i)
+	}
+}
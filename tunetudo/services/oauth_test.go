@@ -0,0 +1,244 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"tunetudo/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockOAuthProvider hands back profile for any code, or fails with err
+type mockOAuthProvider struct {
+	profile OAuthProfile
+	err     error
+}
+
+func (m *mockOAuthProvider) AuthCodeURL(state string) string {
+	return "https://provider.example/auth?state=" + state
+}
+
+func (m *mockOAuthProvider) Exchange(ctx context.Context, code string) (*OAuthProfile, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	profile := m.profile
+	return &profile, nil
+}
+
+func setupTestGoogleLogin(t *testing.T) (*AuthService, *mockOAuthProvider) {
+	service, cleanup := setupTestAuthService(t)
+	t.Cleanup(cleanup)
+	provider := &mockOAuthProvider{}
+	service.SetGoogleOAuth(provider)
+	return service, provider
+}
+
+func TestGoogleLoginCreatesUser(t *testing.T) {
+	service, provider := setupTestGoogleLogin(t)
+	provider.profile = OAuthProfile{ProviderID: "g-1", Email: "New.Listener@Example.com", EmailVerified: true}
+
+	token, user, err := service.LoginWithGoogle("code", "127.0.0.1", "test-agent")
+	require.NoError(t, err)
+	assert.Equal(t, "New.Listener", user.Username)
+	assert.Equal(t, "New.Listener@example.com", user.Email, "normalized like a registered address")
+
+	claims, err := service.ValidateToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, float64(user.ID), claims["user_id"])
+
+	// Signing in again finds the same account rather than creating another
+	_, again, err := service.LoginWithGoogle("code", "127.0.0.1", "test-agent")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, again.ID)
+	assert.Equal(t, 1, countRows(t, service.db, "users"))
+
+	// There is no password to log in with
+	_, _, err = service.LoginUser(models.LoginRequest{Username: "New.Listener", Password: ""}, "127.0.0.1")
+	assert.Error(t, err)
+}
+
+func TestGoogleLoginLinksExistingAccount(t *testing.T) {
+	service, provider := setupTestGoogleLogin(t)
+	existing, err := service.RegisterUser(models.RegisterRequest{
+		Username: "pianist",
+		Email:    "pianist@example.com",
+		Password: "Passw0rd-123",
+	}, "127.0.0.1")
+	require.NoError(t, err)
+	_, err = service.db.Exec(`UPDATE users SET email_verified = 1 WHERE id = ?`, existing.ID)
+	require.NoError(t, err)
+
+	provider.profile = OAuthProfile{ProviderID: "g-2", Email: "pianist@example.com", EmailVerified: true}
+	_, user, err := service.LoginWithGoogle("code", "127.0.0.1", "test-agent")
+	require.NoError(t, err)
+	assert.Equal(t, existing.ID, user.ID)
+
+	var linkedProvider, linkedID string
+	require.NoError(t, service.db.QueryRow(`SELECT provider, provider_id FROM users WHERE id = ?`, user.ID).
+		Scan(&linkedProvider, &linkedID))
+	assert.Equal(t, OAuthGoogle, linkedProvider)
+	assert.Equal(t, "g-2", linkedID)
+
+	// The password keeps working alongside Google sign-in
+	_, _, err = service.LoginUser(models.LoginRequest{Username: "pianist", Password: "Passw0rd-123"}, "127.0.0.1")
+	assert.NoError(t, err)
+
+	// A different Google identity using the same address is refused
+	provider.profile.ProviderID = "g-3"
+	_, _, err = service.LoginWithGoogle("code", "127.0.0.1", "test-agent")
+	assert.Error(t, err)
+}
+
+func TestGoogleLoginTakesOverUnverifiedAccount(t *testing.T) {
+	service, provider := setupTestGoogleLogin(t)
+	// Someone registers an address they don't own and signs in with it
+	squatter, err := service.RegisterUser(models.RegisterRequest{
+		Username: "squatter",
+		Email:    "victim@example.com",
+		Password: "Passw0rd-123",
+	}, "127.0.0.1")
+	require.NoError(t, err)
+	squatterToken, _, err := service.LoginUser(models.LoginRequest{Username: "squatter", Password: "Passw0rd-123"}, "127.0.0.1")
+	require.NoError(t, err)
+
+	provider.profile = OAuthProfile{ProviderID: "g-4", Email: "victim@example.com", EmailVerified: true}
+	_, user, err := service.LoginWithGoogle("code", "127.0.0.1", "test-agent")
+	require.NoError(t, err)
+	assert.Equal(t, squatter.ID, user.ID)
+
+	// The password and the sessions it opened no longer work
+	_, _, err = service.LoginUser(models.LoginRequest{Username: "squatter", Password: "Passw0rd-123"}, "127.0.0.1")
+	assert.Error(t, err)
+	_, err = service.ValidateToken(squatterToken)
+	assert.Error(t, err)
+
+	var verified bool
+	require.NoError(t, service.db.QueryRow(`SELECT email_verified FROM users WHERE id = ?`, user.ID).Scan(&verified))
+	assert.True(t, verified)
+}
+
+func TestLinkedAccountSetsFirstPassword(t *testing.T) {
+	service, provider := setupTestGoogleLogin(t)
+	_, err := service.RegisterUser(models.RegisterRequest{
+		Username: "linked",
+		Email:    "linked@example.com",
+		Password: "Passw0rd-123",
+	}, "127.0.0.1")
+	require.NoError(t, err)
+
+	provider.profile = OAuthProfile{ProviderID: "g-7", Email: "linked@example.com", EmailVerified: true}
+	_, user, err := service.LoginWithGoogle("code", "127.0.0.1", "test-agent")
+	require.NoError(t, err)
+
+	require.NoError(t, service.ChangePassword(user.ID, "", "N3w-Password"))
+	_, _, err = service.LoginUser(models.LoginRequest{Username: "linked", Password: "N3w-Password"}, "127.0.0.1")
+	assert.NoError(t, err)
+
+	// Once set, the password has to be confirmed again
+	err = service.ChangePassword(user.ID, "", "Oth3r-Password")
+	assert.EqualError(t, err, "current password is incorrect")
+}
+
+func TestLinkedAccountDeletesItself(t *testing.T) {
+	service, provider := setupTestGoogleLogin(t)
+	_, err := service.RegisterUser(models.RegisterRequest{
+		Username: "leaving",
+		Email:    "leaving@example.com",
+		Password: "Passw0rd-123",
+	}, "127.0.0.1")
+	require.NoError(t, err)
+
+	provider.profile = OAuthProfile{ProviderID: "g-8", Email: "leaving@example.com", EmailVerified: true}
+	_, user, err := service.LoginWithGoogle("code", "127.0.0.1", "test-agent")
+	require.NoError(t, err)
+
+	require.NoError(t, service.DeleteAccount(user.ID, ""))
+	var count int
+	require.NoError(t, service.db.QueryRow(`SELECT COUNT(*) FROM users WHERE id = ?`, user.ID).Scan(&count))
+	assert.Equal(t, 0, count)
+}
+
+func TestGoogleLoginRejections(t *testing.T) {
+	service, provider := setupTestGoogleLogin(t)
+
+	provider.profile = OAuthProfile{ProviderID: "g-4", Email: "unverified@example.com", EmailVerified: false}
+	_, _, err := service.LoginWithGoogle("code", "127.0.0.1", "test-agent")
+	assert.Error(t, err, "an unverified email can't claim an account")
+
+	provider.err = errors.New("invalid_grant")
+	_, _, err = service.LoginWithGoogle("code", "127.0.0.1", "test-agent")
+	assert.Error(t, err)
+	assert.Equal(t, 0, countRows(t, service.db, "users"))
+
+	provider.err = nil
+	provider.profile = OAuthProfile{ProviderID: "g-5", Email: "banned@example.com", EmailVerified: true}
+	_, user, err := service.LoginWithGoogle("code", "127.0.0.1", "test-agent")
+	require.NoError(t, err)
+	_, err = service.db.Exec(`UPDATE users SET suspended = 1 WHERE id = ?`, user.ID)
+	require.NoError(t, err)
+	_, _, err = service.LoginWithGoogle("code", "127.0.0.1", "test-agent")
+	assert.EqualError(t, err, "account suspended")
+
+	service.SetGoogleOAuth(nil)
+	_, err = service.GoogleAuthURL("state")
+	assert.Error(t, err)
+}
+
+func TestGoogleLoginPicksFreeUsername(t *testing.T) {
+	service, provider := setupTestGoogleLogin(t)
+	_, err := service.RegisterUser(models.RegisterRequest{
+		Username: "sam",
+		Email:    "sam@example.com",
+		Password: "Passw0rd-123",
+	}, "127.0.0.1")
+	require.NoError(t, err)
+
+	provider.profile = OAuthProfile{ProviderID: "g-6", Email: "sam@other.example", EmailVerified: true}
+	_, user, err := service.LoginWithGoogle("code", "127.0.0.1", "test-agent")
+	require.NoError(t, err)
+	assert.Equal(t, "sam2", user.Username)
+
+	assert.Equal(t, "user", oauthUsername("+++@example.com"))
+}
+
+func TestGoogleOAuthExchange(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			require.NoError(t, r.ParseForm())
+			assert.Equal(t, "the-code", r.PostForm.Get("code"))
+			assert.Equal(t, "client-secret", r.PostForm.Get("client_secret"))
+			w.Write([]byte(`{"access_token": "access", "token_type": "Bearer"}`))
+		case "/userinfo":
+			assert.Equal(t, "Bearer access", r.Header.Get("Authorization"))
+			w.Write([]byte(`{"sub": "1234", "email": "fan@example.com", "email_verified": true}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	google, err := NewGoogleOAuth("client-id", "client-secret", "https://music.example.com/api/auth/google/callback")
+	require.NoError(t, err)
+	google.tokenURL = server.URL + "/token"
+	google.userInfoURL = server.URL + "/userinfo"
+
+	profile, err := google.Exchange(context.Background(), "the-code")
+	require.NoError(t, err)
+	assert.Equal(t, OAuthProfile{ProviderID: "1234", Email: "fan@example.com", EmailVerified: true}, *profile)
+
+	authURL, err := url.Parse(google.AuthCodeURL("xyz"))
+	require.NoError(t, err)
+	assert.Equal(t, "xyz", authURL.Query().Get("state"))
+	assert.Equal(t, "https://music.example.com/api/auth/google/callback", authURL.Query().Get("redirect_uri"))
+
+	google.tokenURL = server.URL + "/missing"
+	_, err = google.Exchange(context.Background(), "the-code")
+	assert.Error(t, err)
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// commonPasswordsList holds well-known passwords, one per line, lowercase
+//
+//go:embed common_passwords.txt
+var commonPasswordsList string
+
+var commonPasswords = loadCommonPasswords(commonPasswordsList)
+
+func loadCommonPasswords(list string) map[string]bool {
+	passwords := make(map[string]bool)
+	for _, line := range strings.Split(list, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			passwords[strings.ToLower(line)] = true
+		}
+	}
+	return passwords
+}
+
+// PasswordPolicy describes the rules a new password must satisfy
+type PasswordPolicy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	RejectCommon  bool
+}
+
+// DefaultPasswordPolicy matches the defaults in config.LoadConfig
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:    8,
+		RequireUpper: true,
+		RequireLower: true,
+		RequireDigit: true,
+		RejectCommon: true,
+	}
+}
+
+// Check returns an error naming the first rule password breaks
+func (p PasswordPolicy) Check(password string) error {
+	if len([]rune(password)) < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters", p.MinLength)
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+
+	if p.RequireUpper && !hasUpper {
+		return errors.New("password must contain an uppercase letter")
+	}
+	if p.RequireLower && !hasLower {
+		return errors.New("password must contain a lowercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		return errors.New("password must contain a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		return errors.New("password must contain a symbol")
+	}
+	if p.RejectCommon && commonPasswords[strings.ToLower(password)] {
+		return errors.New("password is too common")
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	strict := PasswordPolicy{
+		MinLength:     10,
+		RequireUpper:  true,
+		RequireLower:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+		RejectCommon:  true,
+	}
+
+	tests := []struct {
+		name     string
+		policy   PasswordPolicy
+		password string
+		errorMsg string
+	}{
+		{"meets every rule", strict, "Str0ng-Passw", ""},
+		{"too short", strict, "Sh0rt-pw", "password must be at least 10 characters"},
+		{"length counts characters not bytes", PasswordPolicy{MinLength: 4}, "ñéüß", ""},
+		{"missing uppercase", strict, "str0ng-passw", "password must contain an uppercase letter"},
+		{"missing lowercase", strict, "STR0NG-PASSW", "password must contain a lowercase letter"},
+		{"missing digit", strict, "Strong-Passw", "password must contain a digit"},
+		{"missing symbol", strict, "Str0ngPassw0rd", "password must contain a symbol"},
+		{"common password", PasswordPolicy{MinLength: 8, RejectCommon: true}, "password123", "password is too common"},
+		{"common password ignores case", PasswordPolicy{MinLength: 8, RejectCommon: true}, "PassWord123", "password is too common"},
+		{"common password allowed when rule off", PasswordPolicy{MinLength: 8}, "password123", ""},
+		{"rules off accept anything long enough", PasswordPolicy{MinLength: 8}, "aaaaaaaa", ""},
+		{"default policy", DefaultPasswordPolicy(), "Tune2dayTudo", ""},
+		{"default policy rejects lowercase only", DefaultPasswordPolicy(), "tunetudo99", "password must contain an uppercase letter"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check(tt.password)
+			if tt.errorMsg == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Equal(t, tt.errorMsg, err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"database/sql"
+	apperrors "tunetudo/errors"
+	"tunetudo/logger"
+	"tunetudo/models"
+)
+
+// Features listed in a user's permissions, so the frontend can decide what
+// to show without knowing the rules behind them
+const (
+	FeaturePlaylists = "playlists"
+	FeatureUpload    = "upload"
+	FeatureAdmin     = "admin"
+)
+
+// GetPermissions reports the user's current role and account state and the
+// features those allow. A suspended account is given no features
+func (s *AuthService) GetPermissions(userID int) (*models.Permissions, error) {
+	var permissions models.Permissions
+	err := s.db.QueryRow(`SELECT is_admin, email_verified, suspended FROM users WHERE id = ?`, userID).
+		Scan(&permissions.IsAdmin, &permissions.EmailVerified, &permissions.Suspended)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, apperrors.NotFoundError("user not found")
+		}
+		logger.Error(logger.CategoryDB, "Failed to retrieve permissions", err)
+		return nil, internalError("failed to retrieve user information", err)
+	}
+
+	permissions.Features = []string{}
+	if permissions.Suspended {
+		return &permissions, nil
+	}
+	permissions.Features = append(permissions.Features, FeaturePlaylists, FeatureUpload)
+	if permissions.IsAdmin {
+		permissions.Features = append(permissions.Features, FeatureAdmin)
+	}
+	return &permissions, nil
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"testing"
+	"tunetudo/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetPermissions(t *testing.T) {
+	service, userID := setupTestSessions(t)
+
+	permissions, err := service.GetPermissions(userID)
+	require.NoError(t, err)
+	assert.Equal(t, models.Permissions{
+		Features: []string{FeaturePlaylists, FeatureUpload},
+	}, *permissions)
+
+	_, err = service.db.Exec(`UPDATE users SET is_admin = 1 WHERE id = ?`, userID)
+	require.NoError(t, err)
+	permissions, err = service.GetPermissions(userID)
+	require.NoError(t, err)
+	assert.True(t, permissions.IsAdmin)
+	assert.Equal(t, []string{FeaturePlaylists, FeatureUpload, FeatureAdmin}, permissions.Features)
+
+	_, err = service.db.Exec(`UPDATE users SET suspended = 1 WHERE id = ?`, userID)
+	require.NoError(t, err)
+	permissions, err = service.GetPermissions(userID)
+	require.NoError(t, err)
+	assert.True(t, permissions.Suspended)
+	assert.Empty(t, permissions.Features)
+
+	_, err = service.GetPermissions(userID + 1)
+	assert.Error(t, err)
+}
+
+func TestEmailVerifiedBySignInProvider(t *testing.T) {
+	service, provider := setupTestGoogleLogin(t)
+	provider.profile = OAuthProfile{ProviderID: "g-7", Email: "verified@example.com", EmailVerified: true}
+
+	_, user, err := service.LoginWithGoogle("code", "127.0.0.1", "test-agent")
+	require.NoError(t, err)
+	permissions, err := service.GetPermissions(user.ID)
+	require.NoError(t, err)
+	assert.True(t, permissions.EmailVerified)
+
+	// Saving the same address keeps it verified; a new one has to be verified again
+	users := NewUserService(service.db, t.TempDir())
+	same := "verified@example.com"
+	_, err = users.UpdateProfile(user.ID, models.UpdateProfileRequest{Email: &same})
+	require.NoError(t, err)
+	permissions, err = service.GetPermissions(user.ID)
+	require.NoError(t, err)
+	assert.True(t, permissions.EmailVerified)
+
+	changed := "elsewhere@example.com"
+	_, err = users.UpdateProfile(user.ID, models.UpdateProfileRequest{Email: &changed})
+	require.NoError(t, err)
+	permissions, err = service.GetPermissions(user.ID)
+	require.NoError(t, err)
+	assert.False(t, permissions.EmailVerified)
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"database/sql"
+	"tunetudo/logger"
+	"tunetudo/models"
+)
+
+// GetRecentlyPlayedArtists returns the distinct catalog artists a user has
+// played, most recently played first
+func (s *PlaybackService) GetRecentlyPlayedArtists(userID, limit int) ([]models.RecentArtist, error) {
+	if limit <= 0 || limit > 50 {
+		limit = 10
+	}
+
+	rows, err := s.db.Query(`
+		SELECT a.id, a.name, pp.updated_at
+		FROM playback_positions pp
+		JOIN songs s ON pp.song_id = s.id AND `+catalogSongs+`
+		JOIN artists a ON s.artist_id = a.id
+		WHERE pp.user_id = ?
+		ORDER BY pp.updated_at DESC, pp.id DESC
+	`, userID)
+	if err != nil {
+		logger.Error(logger.CategoryDB, "Failed to retrieve recently played artists", err)
+		return nil, internalError("failed to fetch play history", err)
+	}
+	defer rows.Close()
+
+	// One row per song played, newest first, so the first row seen for an
+	// artist carries its last-played time
+	artists := []models.RecentArtist{}
+	seen := map[int]bool{}
+	for rows.Next() && len(artists) < limit {
+		var artist models.RecentArtist
+		if err := rows.Scan(&artist.ID, &artist.Name, &artist.LastPlayedAt); err != nil {
+			logger.Warning(logger.CategoryDB, "Failed to scan play history row")
+			continue
+		}
+		if !seen[artist.ID] {
+			seen[artist.ID] = true
+			artists = append(artists, artist)
+		}
+	}
+
+	return artists, nil
+}
+
+// GetRecentlyPlayedAlbums returns the distinct albums of catalog songs a
+// user has played, most recently played first
+func (s *PlaybackService) GetRecentlyPlayedAlbums(userID, limit int) ([]models.RecentAlbum, error) {
+	if limit <= 0 || limit > 50 {
+		limit = 10
+	}
+
+	rows, err := s.db.Query(`
+		SELECT al.id, al.title, al.artist_id, al.cover_image_path, al.release_date,
+			   ar.name, pp.updated_at
+		FROM playback_positions pp
+		JOIN songs s ON pp.song_id = s.id AND `+catalogSongs+`
+		JOIN albums al ON s.album_id = al.id
+		LEFT JOIN artists ar ON al.artist_id = ar.id
+		WHERE pp.user_id = ?
+		ORDER BY pp.updated_at DESC, pp.id DESC
+	`, userID)
+	if err != nil {
+		logger.Error(logger.CategoryDB, "Failed to retrieve recently played albums", err)
+		return nil, internalError("failed to fetch play history", err)
+	}
+	defer rows.Close()
+
+	albums := []models.RecentAlbum{}
+	seen := map[int]bool{}
+	for rows.Next() && len(albums) < limit {
+		var album models.RecentAlbum
+		var artistName sql.NullString
+		err := rows.Scan(
+			&album.ID, &album.Title, &album.ArtistID, &album.CoverImagePath, &album.ReleaseDate,
+			&artistName, &album.LastPlayedAt,
+		)
+		if err != nil {
+			logger.Warning(logger.CategoryDB, "Failed to scan play history row")
+			continue
+		}
+		if seen[album.ID] {
+			continue
+		}
+		seen[album.ID] = true
+
+		if artistName.Valid {
+			album.Artist = &models.Artist{ID: album.ArtistID, Name: artistName.String}
+		}
+		albums = append(albums, album)
+	}
+
+	return albums, nil
+}
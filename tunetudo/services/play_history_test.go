@@ -0,0 +1,77 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecentlyPlayedArtistsAndAlbums(t *testing.T) {
+	service, cleanup := setupTestPlaybackService(t)
+	defer cleanup()
+	db := service.db
+
+	exec := func(query string, args ...interface{}) int {
+		result, err := db.Exec(query, args...)
+		require.NoError(t, err)
+		id, _ := result.LastInsertId()
+		return int(id)
+	}
+	listener := exec(`INSERT INTO users (username, email, password_hash) VALUES ('listener', 'listener@test.com', 'hash')`)
+	newcomer := exec(`INSERT INTO users (username, email, password_hash) VALUES ('newcomer', 'newcomer@test.com', 'hash')`)
+
+	// Seeded: artist 1 with album 1 holding songs 1-3
+	nina := exec(`INSERT INTO artists (name) VALUES ('Nina Simone')`)
+	pastel := exec(`INSERT INTO albums (title, artist_id) VALUES ('Pastel Blues', ?)`, nina)
+	ninaSong := exec(`INSERT INTO songs (title, artist_id, album_id, duration_seconds, file_path, format)
+		VALUES ('Sinnerman', ?, ?, 600, '/test/song.mp3', 'mp3')`, nina, pastel)
+	single := exec(`INSERT INTO songs (title, artist_id, duration_seconds, file_path, format)
+		VALUES ('Single', ?, 200, '/test/song.mp3', 'mp3')`, nina)
+
+	play := func(songID int, at string) {
+		exec(`INSERT INTO playback_positions (user_id, song_id, position_seconds, updated_at) VALUES (?, ?, 30, ?)`,
+			listener, songID, at)
+	}
+	play(1, "2024-01-01 10:00:00")
+	play(ninaSong, "2024-01-02 10:00:00")
+	play(2, "2024-01-03 10:00:00")
+	play(single, "2024-01-04 10:00:00")
+
+	t.Run("artists", func(t *testing.T) {
+		artists, err := service.GetRecentlyPlayedArtists(listener, 10)
+		require.NoError(t, err)
+		require.Len(t, artists, 2)
+		assert.Equal(t, "Nina Simone", artists[0].Name)
+		assert.Equal(t, "2024-01-04", artists[0].LastPlayedAt.Format("2006-01-02"))
+		assert.Equal(t, "Test Artist", artists[1].Name)
+		assert.Equal(t, "2024-01-03", artists[1].LastPlayedAt.Format("2006-01-02"))
+
+		limited, err := service.GetRecentlyPlayedArtists(listener, 1)
+		require.NoError(t, err)
+		assert.Len(t, limited, 1)
+	})
+
+	t.Run("albums", func(t *testing.T) {
+		albums, err := service.GetRecentlyPlayedAlbums(listener, 10)
+		require.NoError(t, err)
+		require.Len(t, albums, 2, "songs without an album are skipped")
+		assert.Equal(t, "Test Album", albums[0].Title)
+		assert.Equal(t, "2024-01-03", albums[0].LastPlayedAt.Format("2006-01-02"))
+		assert.Equal(t, "Pastel Blues", albums[1].Title)
+		require.NotNil(t, albums[1].Artist)
+		assert.Equal(t, "Nina Simone", albums[1].Artist.Name)
+	})
+
+	t.Run("no history", func(t *testing.T) {
+		artists, err := service.GetRecentlyPlayedArtists(newcomer, 10)
+		require.NoError(t, err)
+		assert.NotNil(t, artists)
+		assert.Empty(t, artists)
+
+		albums, err := service.GetRecentlyPlayedAlbums(newcomer, 10)
+		require.NoError(t, err)
+		assert.NotNil(t, albums)
+		assert.Empty(t, albums)
+	})
+}
@@ -2,22 +2,33 @@ package services
 
 import (
 	"database/sql"
-	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
+	apperrors "tunetudo/errors"
 	"tunetudo/logger"
 	"tunetudo/models"
 )
 
+// MaxSongsByIDs caps how many songs GetSongsByIDs looks up at once
+const MaxSongsByIDs = 200
+
 type PlaybackService struct {
-	db          *sql.DB
-	storagePath string
+	db           *sql.DB
+	storagePath  string
+	streamSecret []byte
+	requireAuth  bool
+	nowPlaying   *nowPlayingStore
 }
 
 func NewPlaybackService(db *sql.DB, storagePath string) *PlaybackService {
 	return &PlaybackService{
-		db:          db,
-		storagePath: storagePath,
+		db:           db,
+		storagePath:  storagePath,
+		streamSecret: randomStreamSecret(),
+		nowPlaying:   newNowPlayingStore(defaultNowPlayingTTL),
 	}
 }
 
@@ -34,7 +45,7 @@ func (s *PlaybackService) GetSongByID(songID int) (*models.Song, error) {
 		LEFT JOIN artists a ON s.artist_id = a.id
 		LEFT JOIN albums al ON s.album_id = al.id
 		LEFT JOIN categories c ON s.category_id = c.id
-		WHERE s.id = ?
+		WHERE s.id = ? AND s.deleted_at IS NULL
 	`, songID).Scan(
 		&song.ID, &song.Title, &song.ArtistID, &song.AlbumID, &song.CategoryID,
 		&song.DurationSeconds, &song.FilePath, &song.Format, &song.UploadedByUserID,
@@ -44,11 +55,11 @@ func (s *PlaybackService) GetSongByID(songID int) (*models.Song, error) {
 	if err != nil {
 		if err == sql.ErrNoRows {
 			// Don't reveal internal details to user
-			return nil, errors.New("track not found")
+			return nil, apperrors.NotFoundError("track not found")
 		}
 		// Log internal error without exposing to user
 		logger.Error(logger.CategoryDB, "Failed to retrieve song", err)
-		return nil, errors.New("track not found")
+		return nil, apperrors.NotFoundError("track not found")
 	}
 
 	if artistName.Valid {
@@ -64,17 +75,102 @@ func (s *PlaybackService) GetSongByID(songID int) (*models.Song, error) {
 	return &song, nil
 }
 
-// AuthorizeStream validates that a song can be streamed
-func (s *PlaybackService) AuthorizeStream(songID int) (string, error) {
+// GetSongsByIDs returns the songs with the given ids in the order asked
+// for, in one query. Missing or deleted songs are left out, and a repeated
+// id is returned once
+func (s *PlaybackService) GetSongsByIDs(ids []int) ([]models.Song, error) {
+	if len(ids) > MaxSongsByIDs {
+		return nil, apperrors.ValidationError(fmt.Sprintf("at most %d song ids can be requested at once", MaxSongsByIDs), nil)
+	}
+	songs := []models.Song{}
+	if len(ids) == 0 {
+		return songs, nil
+	}
+
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := s.db.Query(`
+		SELECT s.id, s.title, s.artist_id, s.album_id, s.category_id,
+			   COALESCE(s.duration_seconds, 0), s.file_path, s.format, s.uploaded_by_user_id,
+			   s.created_at, a.name, al.title, c.name
+		FROM songs s
+		LEFT JOIN artists a ON s.artist_id = a.id
+		LEFT JOIN albums al ON s.album_id = al.id
+		LEFT JOIN categories c ON s.category_id = c.id
+		WHERE s.id IN (`+strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")+`) AND s.deleted_at IS NULL
+	`, args...)
+	if err != nil {
+		logger.Error(logger.CategoryDB, "Failed to retrieve songs", err)
+		return nil, internalError("failed to retrieve songs", err)
+	}
+	defer rows.Close()
+
+	found := make(map[int]models.Song, len(ids))
+	for rows.Next() {
+		var song models.Song
+		var artistName, albumTitle, categoryName sql.NullString
+		if err := rows.Scan(
+			&song.ID, &song.Title, &song.ArtistID, &song.AlbumID, &song.CategoryID,
+			&song.DurationSeconds, &song.FilePath, &song.Format, &song.UploadedByUserID,
+			&song.CreatedAt, &artistName, &albumTitle, &categoryName,
+		); err != nil {
+			logger.Error(logger.CategoryDB, "Failed to read song", err)
+			return nil, internalError("failed to retrieve songs", err)
+		}
+
+		if artistName.Valid {
+			song.Artist = &models.Artist{ID: song.ArtistID, Name: artistName.String}
+		}
+		if albumTitle.Valid && song.AlbumID != nil {
+			song.Album = &models.Album{ID: *song.AlbumID, Title: albumTitle.String}
+		}
+		if categoryName.Valid && song.CategoryID != nil {
+			song.Category = &models.Category{ID: *song.CategoryID, Name: categoryName.String}
+		}
+		found[song.ID] = song
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error(logger.CategoryDB, "Failed to retrieve songs", err)
+		return nil, internalError("failed to retrieve songs", err)
+	}
+
+	for _, id := range ids {
+		if song, ok := found[id]; ok {
+			songs = append(songs, song)
+			delete(found, id)
+		}
+	}
+	return songs, nil
+}
+
+// AuthorizeStream validates that a song can be streamed with a token from
+// GenerateStreamToken, returning the file to send. The listener is userID
+// when the request is signed in, otherwise the user the token was minted
+// for; their now playing presence and play history are updated. Without
+// either the stream is anonymous, which SetRequireAuthToStream refuses
+func (s *PlaybackService) AuthorizeStream(songID int, token string, userID int) (string, error) {
+	tokenUserID, err := s.verifyStreamToken(songID, token)
+	if userID == 0 {
+		userID = tokenUserID
+	}
+	if s.requireAuth && userID == 0 {
+		return "", unauthenticated("sign in to stream songs")
+	}
+	if err != nil {
+		return "", err
+	}
+
 	var filePath string
-	err := s.db.QueryRow(`SELECT file_path FROM songs WHERE id = ?`, songID).Scan(&filePath)
+	err = s.db.QueryRow(`SELECT file_path FROM songs WHERE id = ? AND deleted_at IS NULL`, songID).Scan(&filePath)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return "", errors.New("track not found")
+			return "", apperrors.NotFoundError("track not found")
 		}
 		// Log error without exposing details
 		logger.Error(logger.CategoryDB, "Failed to authorize stream", err)
-		return "", errors.New("track not found")
+		return "", apperrors.NotFoundError("track not found")
 	}
 
 	// Check if file exists
@@ -82,34 +178,47 @@ func (s *PlaybackService) AuthorizeStream(songID int) (string, error) {
 	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
 		// Log the issue for debugging but don't expose file paths to user
 		logger.Warning(logger.CategoryFile, "Song file not found on disk: song_id=%d", songID)
-		return "", errors.New("track not found")
+		return "", apperrors.NotFoundError("track not found")
 	}
 
 	// Log file access
 	logger.Info(logger.CategoryFile, "Song stream authorized: song_id=%d", songID)
 
+	// A player fetches a track in several range requests; only the first
+	// one of a listen counts as a play
+	if userID != 0 && s.nowPlaying.Set(userID, songID) {
+		if _, err := s.db.Exec(`INSERT INTO plays (user_id, song_id) VALUES (?, ?)`, userID, songID); err != nil {
+			logger.Error(logger.CategoryDB, "Failed to record play", err)
+		}
+	}
+
 	return fullPath, nil
 }
 
 // GetRecentSongs retrieves recently added songs (excluding personal uploads)
-func (s *PlaybackService) GetRecentSongs(limit int) ([]models.Song, error) {
+// in the given sort order, newest first by default. safe leaves out explicit songs
+func (s *PlaybackService) GetRecentSongs(limit int, sort string, safe bool) ([]models.Song, error) {
 	if limit <= 0 {
 		limit = 20
 	}
+	order, err := songOrderBy(sort)
+	if err != nil {
+		return nil, err
+	}
 
 	rows, err := s.db.Query(`
 		SELECT s.id, s.title, s.artist_id, s.duration_seconds, s.file_path,
 			   s.format, s.created_at, a.name as artist_name
 		FROM songs s
 		LEFT JOIN artists a ON s.artist_id = a.id
-		WHERE s.uploaded_by_user_id IS NULL
-		ORDER BY s.created_at DESC
+		WHERE s.uploaded_by_user_id IS NULL AND s.deleted_at IS NULL`+explicitFilter(safe)+`
+		ORDER BY `+order+`
 		LIMIT ?
 	`, limit)
 
 	if err != nil {
 		logger.Error(logger.CategoryDB, "Failed to retrieve recent songs", err)
-		return nil, err
+		return nil, internalError("failed to fetch songs", err)
 	}
 	defer rows.Close()
 
@@ -137,4 +246,310 @@ func (s *PlaybackService) GetRecentSongs(limit int) ([]models.Song, error) {
 	logger.Info(logger.CategoryAPI, "Retrieved %d recent songs", len(songs))
 
 	return songs, nil
-}
\ No newline at end of file
+}
+
+// GetRecommendations returns catalog songs the user hasn't played yet,
+// ranked first by how often their category appears in the user's plays and
+// own playlists, then by how many listeners a song has. New users have no
+// category weights, so they get the most popular songs. safe leaves out
+// explicit songs
+func (s *PlaybackService) GetRecommendations(userID, limit int, safe bool) ([]models.Song, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	// history is every play plus every song in the user's own playlists;
+	// each entry adds weight to its category in affinity. played is every
+	// play plus every saved position, since a position also means the song
+	// was played even if that predates the plays table; those songs are
+	// left out of the results
+	rows, err := s.db.Query(`
+		WITH history AS (
+			SELECT song_id FROM plays WHERE user_id = ?
+			UNION ALL
+			SELECT ps.song_id FROM playlist_songs ps
+			JOIN playlists p ON ps.playlist_id = p.id
+			WHERE p.user_id = ?
+		),
+		affinity AS (
+			SELECT hs.category_id, COUNT(*) AS weight
+			FROM history h
+			JOIN songs hs ON h.song_id = hs.id
+			WHERE hs.category_id IS NOT NULL
+			GROUP BY hs.category_id
+		),
+		popularity AS (
+			SELECT song_id, COUNT(DISTINCT user_id) AS listeners
+			FROM plays
+			GROUP BY song_id
+		),
+		played AS (
+			SELECT song_id FROM plays WHERE user_id = ?
+			UNION
+			SELECT song_id FROM playback_positions WHERE user_id = ?
+		)
+		SELECT s.id, s.title, s.artist_id, s.category_id, s.duration_seconds,
+			   s.file_path, s.format, s.created_at, a.name, c.name
+		FROM songs s
+		LEFT JOIN artists a ON s.artist_id = a.id
+		LEFT JOIN categories c ON s.category_id = c.id
+		LEFT JOIN affinity af ON s.category_id = af.category_id
+		LEFT JOIN popularity pop ON s.id = pop.song_id
+		WHERE s.uploaded_by_user_id IS NULL AND s.deleted_at IS NULL
+		  AND s.id NOT IN (SELECT song_id FROM played)`+explicitFilter(safe)+`
+		ORDER BY COALESCE(af.weight, 0) DESC, COALESCE(pop.listeners, 0) DESC,
+			s.created_at DESC, s.id DESC
+		LIMIT ?
+	`, userID, userID, userID, userID, limit)
+	if err != nil {
+		logger.Error(logger.CategoryDB, "Failed to retrieve recommendations", err)
+		return nil, internalError("failed to fetch recommendations", err)
+	}
+	defer rows.Close()
+
+	songs := []models.Song{}
+	for rows.Next() {
+		var song models.Song
+		var artistName, categoryName sql.NullString
+
+		err := rows.Scan(
+			&song.ID, &song.Title, &song.ArtistID, &song.CategoryID, &song.DurationSeconds,
+			&song.FilePath, &song.Format, &song.CreatedAt, &artistName, &categoryName,
+		)
+		if err != nil {
+			logger.Warning(logger.CategoryDB, "Failed to scan recommendation row")
+			continue
+		}
+
+		if artistName.Valid {
+			song.Artist = &models.Artist{ID: song.ArtistID, Name: artistName.String}
+		}
+		if categoryName.Valid && song.CategoryID != nil {
+			song.Category = &models.Category{ID: *song.CategoryID, Name: categoryName.String}
+		}
+
+		songs = append(songs, song)
+	}
+
+	return songs, nil
+}
+
+// GetRelatedSongs returns other catalog songs like songID: same artist
+// first, then same album, then same category. A song with no relatives
+// gets an empty list
+func (s *PlaybackService) GetRelatedSongs(songID, limit int) ([]models.Song, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 10
+	}
+
+	var exists int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM songs WHERE id = ? AND deleted_at IS NULL`, songID).Scan(&exists)
+	if err != nil || exists == 0 {
+		if err != nil {
+			logger.Error(logger.CategoryDB, "Failed to look up song for related songs", err)
+		}
+		return nil, apperrors.NotFoundError("track not found")
+	}
+
+	rows, err := s.db.Query(`
+		SELECT s.id, s.title, s.artist_id, s.album_id, s.category_id, s.duration_seconds,
+			   s.file_path, s.format, s.created_at, a.name
+		FROM songs seed
+		JOIN songs s ON s.id != seed.id AND (
+			s.artist_id = seed.artist_id OR s.album_id = seed.album_id OR s.category_id = seed.category_id
+		)
+		LEFT JOIN artists a ON s.artist_id = a.id
+		WHERE seed.id = ? AND s.uploaded_by_user_id IS NULL AND s.deleted_at IS NULL
+		ORDER BY CASE
+				WHEN s.artist_id = seed.artist_id THEN 0
+				WHEN s.album_id = seed.album_id THEN 1
+				ELSE 2
+			END,
+			s.created_at DESC, s.id DESC
+		LIMIT ?
+	`, songID, limit)
+	if err != nil {
+		logger.Error(logger.CategoryDB, "Failed to retrieve related songs", err)
+		return nil, internalError("failed to fetch related songs", err)
+	}
+	defer rows.Close()
+
+	songs := []models.Song{}
+	for rows.Next() {
+		var song models.Song
+		var artistName sql.NullString
+
+		err := rows.Scan(
+			&song.ID, &song.Title, &song.ArtistID, &song.AlbumID, &song.CategoryID, &song.DurationSeconds,
+			&song.FilePath, &song.Format, &song.CreatedAt, &artistName,
+		)
+		if err != nil {
+			logger.Warning(logger.CategoryDB, "Failed to scan related song row")
+			continue
+		}
+
+		if artistName.Valid {
+			song.Artist = &models.Artist{ID: song.ArtistID, Name: artistName.String}
+		}
+
+		songs = append(songs, song)
+	}
+
+	return songs, nil
+}
+
+// BuildQueue returns the playable songs of a playlist the user owns or
+// collaborates on, in queue order.
+// Songs whose files are missing on disk are skipped
+func (s *PlaybackService) BuildQueue(playlistID, userID int) ([]models.Song, error) {
+	// Owners and collaborators can play the playlist
+	var allowed int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*) FROM playlists
+		WHERE id = ? AND (user_id = ? OR id IN (
+			SELECT playlist_id FROM playlist_collaborators WHERE user_id = ?
+		))
+	`, playlistID, userID, userID).Scan(&allowed)
+	if err != nil || allowed == 0 {
+		if err != nil {
+			logger.Error(logger.CategoryDB, "Failed to load playlist for queue", err)
+		}
+		return nil, apperrors.NotFoundError("no playlist found")
+	}
+
+	rows, err := s.db.Query(`
+		SELECT s.id, s.title, s.artist_id, s.album_id, s.duration_seconds,
+			   s.file_path, s.format, a.name
+		FROM playlist_songs ps
+		JOIN songs s ON ps.song_id = s.id
+		LEFT JOIN artists a ON s.artist_id = a.id
+		WHERE ps.playlist_id = ? AND s.deleted_at IS NULL
+		ORDER BY ps.queue_number, ps.added_at
+	`, playlistID)
+	if err != nil {
+		logger.Error(logger.CategoryDB, "Failed to build playback queue", err)
+		return nil, internalError("failed to build queue", err)
+	}
+	defer rows.Close()
+
+	queue := []models.Song{}
+	for rows.Next() {
+		var song models.Song
+		var artistName sql.NullString
+
+		err := rows.Scan(
+			&song.ID, &song.Title, &song.ArtistID, &song.AlbumID, &song.DurationSeconds,
+			&song.FilePath, &song.Format, &artistName,
+		)
+		if err != nil {
+			logger.Warning(logger.CategoryDB, "Failed to scan queue row")
+			continue
+		}
+
+		if _, err := os.Stat(filepath.Join(s.storagePath, song.FilePath)); err != nil {
+			logger.Warning(logger.CategoryFile, "Skipping queued song with missing file: song_id=%d", song.ID)
+			continue
+		}
+
+		if artistName.Valid {
+			song.Artist = &models.Artist{ID: song.ArtistID, Name: artistName.String}
+		}
+
+		queue = append(queue, song)
+	}
+
+	return queue, nil
+}
+
+// GetNextSong returns the song after currentSongID in the playlist queue,
+// wrapping around to the first song at the end
+func (s *PlaybackService) GetNextSong(playlistID, userID, currentSongID int) (*models.Song, error) {
+	return s.stepQueue(playlistID, userID, currentSongID, 1)
+}
+
+// GetPreviousSong returns the song before currentSongID in the playlist
+// queue, wrapping around to the last song at the start
+func (s *PlaybackService) GetPreviousSong(playlistID, userID, currentSongID int) (*models.Song, error) {
+	return s.stepQueue(playlistID, userID, currentSongID, -1)
+}
+
+func (s *PlaybackService) stepQueue(playlistID, userID, currentSongID, step int) (*models.Song, error) {
+	queue, err := s.BuildQueue(playlistID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, song := range queue {
+		if song.ID == currentSongID {
+			next := (i + step + len(queue)) % len(queue)
+			return &queue[next], nil
+		}
+	}
+
+	return nil, apperrors.NotFoundError("song not in queue")
+}
+
+// SavePosition records where the user stopped in a song, replacing any
+// earlier position
+func (s *PlaybackService) SavePosition(userID, songID, positionSeconds int) (*models.PlaybackPosition, error) {
+	var duration sql.NullInt64
+	err := s.db.QueryRow(`SELECT duration_seconds FROM songs WHERE id = ? AND deleted_at IS NULL`, songID).Scan(&duration)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.Error(logger.CategoryDB, "Failed to look up song for position", err)
+		}
+		return nil, apperrors.NotFoundError("track not found")
+	}
+
+	if positionSeconds < 0 {
+		return nil, apperrors.ValidationError("position cannot be negative", nil)
+	}
+	// Unknown durations are stored as 0, so only enforce a known one
+	if duration.Valid && duration.Int64 > 0 && int64(positionSeconds) > duration.Int64 {
+		return nil, apperrors.ValidationError("position is beyond the end of the track", nil)
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO playback_positions (user_id, song_id, position_seconds, updated_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(user_id, song_id) DO UPDATE SET
+			position_seconds = excluded.position_seconds,
+			updated_at = excluded.updated_at
+	`, userID, songID, positionSeconds)
+	if err != nil {
+		logger.Error(logger.CategoryDB, "Failed to save playback position", err)
+		return nil, internalError("failed to save position", err)
+	}
+
+	return s.GetPosition(userID, songID)
+}
+
+// GetPosition returns the user's resume position for a song, or 0 if they
+// haven't played it yet
+func (s *PlaybackService) GetPosition(userID, songID int) (*models.PlaybackPosition, error) {
+	var exists int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM songs WHERE id = ? AND deleted_at IS NULL`, songID).Scan(&exists)
+	if err != nil || exists == 0 {
+		if err != nil {
+			logger.Error(logger.CategoryDB, "Failed to look up song for position", err)
+		}
+		return nil, apperrors.NotFoundError("track not found")
+	}
+
+	position := &models.PlaybackPosition{SongID: songID}
+	var updatedAt time.Time
+	err = s.db.QueryRow(`
+		SELECT position_seconds, updated_at FROM playback_positions
+		WHERE user_id = ? AND song_id = ?
+	`, userID, songID).Scan(&position.PositionSeconds, &updatedAt)
+	if err == sql.ErrNoRows {
+		return position, nil
+	}
+	if err != nil {
+		logger.Error(logger.CategoryDB, "Failed to load playback position", err)
+		return nil, internalError("failed to load position", err)
+	}
+
+	position.UpdatedAt = &updatedAt
+	return position, nil
+}
@@ -1,9 +1,14 @@
 package services
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+	apperrors "tunetudo/errors"
+	"tunetudo/models"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -70,6 +75,12 @@ func TestGetSongByID(t *testing.T) {
 	}
 }
 
+// signedStreamToken signs a token for any song ID, existing or not
+func signedStreamToken(service *PlaybackService, songID int) string {
+	expiresAt := time.Now().Add(time.Minute).Unix()
+	return fmt.Sprintf("%d.0.%d.%s", songID, expiresAt, service.signStream(songID, 0, expiresAt))
+}
+
 func TestAuthorizeStream(t *testing.T) {
 	service, cleanup := setupTestPlaybackService(t)
 	defer cleanup()
@@ -95,7 +106,7 @@ func TestAuthorizeStream(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			filePath, err := service.AuthorizeStream(tt.songID)
+			filePath, err := service.AuthorizeStream(tt.songID, signedStreamToken(service, tt.songID), 0)
 
 			if tt.expectError {
 				assert.Error(t, err)
@@ -111,6 +122,61 @@ func TestAuthorizeStream(t *testing.T) {
 	}
 }
 
+func TestStreamTokens(t *testing.T) {
+	service, cleanup := setupTestPlaybackService(t)
+	defer cleanup()
+	service.SetStreamSecret("stream-test-secret")
+
+	valid, err := service.GenerateStreamToken(1, 0, time.Minute)
+	require.NoError(t, err)
+	expired, err := service.GenerateStreamToken(1, 0, -time.Second)
+	require.NoError(t, err)
+	otherSong, err := service.GenerateStreamToken(2, 0, time.Minute)
+	require.NoError(t, err)
+
+	parts := strings.Split(valid, ".")
+	retargeted := "2." + parts[1] + "." + parts[2] + "." + parts[3]
+	reassigned := parts[0] + ".7." + parts[2] + "." + parts[3]
+	extended := parts[0] + "." + parts[1] + ".9999999999." + parts[3]
+
+	foreign := NewPlaybackService(service.db, service.storagePath)
+	foreign.SetStreamSecret("another-secret")
+	forged, err := foreign.GenerateStreamToken(1, 0, time.Minute)
+	require.NoError(t, err)
+
+	_, err = service.GenerateStreamToken(99999, 0, time.Minute)
+	assert.Error(t, err, "tokens are only minted for existing songs")
+
+	tests := []struct {
+		name    string
+		token   string
+		allowed bool
+	}{
+		{"Valid token", valid, true},
+		{"Expired token", expired, false},
+		{"Token for a different song", otherSong, false},
+		{"Song ID edited in the token", retargeted, false},
+		{"User ID edited in the token", reassigned, false},
+		{"Expiry edited in the token", extended, false},
+		{"Signed with another secret", forged, false},
+		{"Missing token", "", false},
+		{"Malformed token", "not-a-token", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath, err := service.AuthorizeStream(1, tt.token, 0)
+			if tt.allowed {
+				require.NoError(t, err)
+				assert.NotEmpty(t, filePath)
+			} else {
+				assert.Error(t, err)
+				assert.Empty(t, filePath)
+			}
+		})
+	}
+}
+
 func TestGetRecentSongs(t *testing.T) {
 	service, cleanup := setupTestPlaybackService(t)
 	defer cleanup()
@@ -144,7 +210,7 @@ func TestGetRecentSongs(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			songs, err := service.GetRecentSongs(tt.limit)
+			songs, err := service.GetRecentSongs(tt.limit, "", false)
 			require.NoError(t, err)
 			assert.Len(t, songs, tt.expectedLen)
 			
@@ -175,10 +241,360 @@ func TestGetRecentSongsExcludesUserUploads(t *testing.T) {
 		"User Upload Song", 1, "/test/user.mp3", "mp3", userID)
 
 	// Recent songs should NOT include user uploads
-	songs, err := service.GetRecentSongs(20)
+	songs, err := service.GetRecentSongs(20, "", false)
 	require.NoError(t, err)
 	
 	for _, song := range songs {
 		assert.Nil(t, song.UploadedByUserID, "User uploads should not appear in recent songs")
 	}
-}
\ No newline at end of file
+}
+
+// setupTestQueue creates a playlist holding songs 3, 1, 2 in that queue order
+// plus a song whose file is missing. It returns the playlist and owner IDs
+func setupTestQueue(t *testing.T, service *PlaybackService) (int, int) {
+	result, err := service.db.Exec(`INSERT INTO users (username, email, password_hash) VALUES (?, ?, ?)`,
+		"queueuser", "queue@test.com", "hash")
+	require.NoError(t, err)
+	userID, _ := result.LastInsertId()
+
+	result, err = service.db.Exec(`INSERT INTO playlists (user_id, name) VALUES (?, ?)`, userID, "Queue")
+	require.NoError(t, err)
+	playlistID, _ := result.LastInsertId()
+
+	result, err = service.db.Exec(`INSERT INTO songs (title, artist_id, file_path, format) VALUES (?, ?, ?, ?)`,
+		"Missing File", 1, "/test/missing.mp3", "mp3")
+	require.NoError(t, err)
+	missingID, _ := result.LastInsertId()
+
+	entries := []struct {
+		songID      int64
+		queueNumber int
+	}{
+		{3, 1}, {missingID, 2}, {1, 3}, {2, 4},
+	}
+	for _, e := range entries {
+		_, err := service.db.Exec(`INSERT INTO playlist_songs (playlist_id, song_id, queue_number) VALUES (?, ?, ?)`,
+			playlistID, e.songID, e.queueNumber)
+		require.NoError(t, err)
+	}
+
+	return int(playlistID), int(userID)
+}
+
+func TestBuildQueue(t *testing.T) {
+	service, cleanup := setupTestPlaybackService(t)
+	defer cleanup()
+
+	playlistID, userID := setupTestQueue(t, service)
+
+	t.Run("Ordered by queue number without missing files", func(t *testing.T) {
+		queue, err := service.BuildQueue(playlistID, userID)
+		require.NoError(t, err)
+
+		var ids []int
+		for _, song := range queue {
+			ids = append(ids, song.ID)
+		}
+		assert.Equal(t, []int{3, 1, 2}, ids)
+	})
+
+	t.Run("Other users cannot read the queue", func(t *testing.T) {
+		_, err := service.BuildQueue(playlistID, userID+1)
+		assert.Error(t, err)
+	})
+}
+
+func TestQueueNavigation(t *testing.T) {
+	service, cleanup := setupTestPlaybackService(t)
+	defer cleanup()
+
+	playlistID, userID := setupTestQueue(t, service)
+
+	tests := []struct {
+		name     string
+		current  int
+		next     int
+		previous int
+	}{
+		{name: "First song wraps back to last", current: 3, next: 1, previous: 2},
+		{name: "Middle song", current: 1, next: 2, previous: 3},
+		{name: "Last song wraps forward to first", current: 2, next: 3, previous: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, err := service.GetNextSong(playlistID, userID, tt.current)
+			require.NoError(t, err)
+			assert.Equal(t, tt.next, next.ID)
+
+			previous, err := service.GetPreviousSong(playlistID, userID, tt.current)
+			require.NoError(t, err)
+			assert.Equal(t, tt.previous, previous.ID)
+		})
+	}
+
+	t.Run("Song not in queue", func(t *testing.T) {
+		_, err := service.GetNextSong(playlistID, userID, 99999)
+		assert.Error(t, err)
+	})
+}
+
+func TestPlaybackPosition(t *testing.T) {
+	service, cleanup := setupTestPlaybackService(t)
+	defer cleanup()
+
+	result, err := service.db.Exec(`INSERT INTO users (username, email, password_hash) VALUES (?, ?, ?)`,
+		"resumeuser", "resume@test.com", "hash")
+	require.NoError(t, err)
+	id, _ := result.LastInsertId()
+	userID := int(id)
+
+	t.Run("No saved position", func(t *testing.T) {
+		position, err := service.GetPosition(userID, 1)
+		require.NoError(t, err)
+		assert.Equal(t, 0, position.PositionSeconds)
+		assert.Nil(t, position.UpdatedAt)
+	})
+
+	t.Run("Save and fetch", func(t *testing.T) {
+		_, err := service.SavePosition(userID, 1, 42)
+		require.NoError(t, err)
+
+		position, err := service.GetPosition(userID, 1)
+		require.NoError(t, err)
+		assert.Equal(t, 42, position.PositionSeconds)
+		assert.NotNil(t, position.UpdatedAt)
+	})
+
+	t.Run("Overwrite", func(t *testing.T) {
+		_, err := service.SavePosition(userID, 1, 120)
+		require.NoError(t, err)
+
+		position, err := service.GetPosition(userID, 1)
+		require.NoError(t, err)
+		assert.Equal(t, 120, position.PositionSeconds)
+		assert.Equal(t, 1, countRows(t, service.db, "playback_positions"))
+	})
+
+	t.Run("Position beyond duration", func(t *testing.T) {
+		// Seeded songs are 180 seconds long
+		_, err := service.SavePosition(userID, 1, 181)
+		assert.Error(t, err)
+
+		_, err = service.SavePosition(userID, 1, -1)
+		assert.Error(t, err)
+	})
+
+	t.Run("Unknown song", func(t *testing.T) {
+		_, err := service.SavePosition(userID, 99999, 10)
+		assert.EqualError(t, err, "track not found")
+
+		_, err = service.GetPosition(userID, 99999)
+		assert.EqualError(t, err, "track not found")
+	})
+}
+
+func TestGetRecommendations(t *testing.T) {
+	service, cleanup := setupTestPlaybackService(t)
+	defer cleanup()
+	db := service.db
+
+	insertUser := func(name string) int {
+		result, err := db.Exec(`INSERT INTO users (username, email, password_hash) VALUES (?, ?, 'hash')`,
+			name, name+"@test.com")
+		require.NoError(t, err)
+		id, _ := result.LastInsertId()
+		return int(id)
+	}
+	insertSong := func(title string, categoryID int, uploadedBy interface{}) int {
+		result, err := db.Exec(`INSERT INTO songs (title, artist_id, category_id, duration_seconds, file_path, format, uploaded_by_user_id)
+			VALUES (?, 1, ?, 180, '/test/song.mp3', 'mp3', ?)`, title, categoryID, uploadedBy)
+		require.NoError(t, err)
+		id, _ := result.LastInsertId()
+		return int(id)
+	}
+	play := func(userID int, songIDs ...int) {
+		for _, songID := range songIDs {
+			_, err := db.Exec(`INSERT INTO plays (user_id, song_id) VALUES (?, ?)`, userID, songID)
+			require.NoError(t, err)
+		}
+	}
+	ids := func(songs []models.Song) []int {
+		var out []int
+		for _, song := range songs {
+			out = append(out, song.ID)
+		}
+		return out
+	}
+
+	listener := insertUser("listener")
+	newcomer := insertUser("newcomer")
+	other := insertUser("other")
+	another := insertUser("another")
+
+	// Seeded songs 1-3 are Pop (category 1); Rock is 2 and Jazz 3
+	rock1, rock2, rock3 := insertSong("Rock 1", 2, nil), insertSong("Rock 2", 2, nil), insertSong("Rock 3", 2, nil)
+	jazz1, jazz2 := insertSong("Jazz 1", 3, nil), insertSong("Jazz 2", 3, nil)
+	upload := insertSong("Rock Upload", 2, listener)
+
+	// More Rock songs, but more Jazz plays
+	play(listener, rock1, rock2, jazz1, jazz1, jazz1)
+	play(other, 1, 2, 2, 2)
+	play(another, 1)
+
+	t.Run("history biases towards the most played category", func(t *testing.T) {
+		songs, err := service.GetRecommendations(listener, 10, false)
+		require.NoError(t, err)
+
+		assert.Equal(t, []int{jazz2, rock3, 1, 2, 3}, ids(songs))
+		assert.NotContains(t, ids(songs), upload, "uploads are not recommended")
+		require.NotNil(t, songs[0].Category)
+		assert.Equal(t, "Jazz", songs[0].Category.Name)
+	})
+
+	t.Run("songs with a saved position count as played", func(t *testing.T) {
+		_, err := db.Exec(`INSERT INTO playback_positions (user_id, song_id, position_seconds) VALUES (?, ?, 30)`, listener, jazz2)
+		require.NoError(t, err)
+		songs, err := service.GetRecommendations(listener, 10, false)
+		require.NoError(t, err)
+		assert.Equal(t, []int{rock3, 1, 2, 3}, ids(songs))
+	})
+
+	t.Run("new users get popular songs", func(t *testing.T) {
+		songs, err := service.GetRecommendations(newcomer, 2, false)
+		require.NoError(t, err)
+
+		assert.Equal(t, []int{1}, ids(songs)[:1], "most listened song first")
+		assert.Len(t, songs, 2)
+		assert.NotContains(t, ids(songs), upload)
+	})
+}
+
+func TestGetRelatedSongs(t *testing.T) {
+	service, cleanup := setupTestPlaybackService(t)
+	defer cleanup()
+	db := service.db
+
+	result, err := db.Exec(`INSERT INTO users (username, email, password_hash) VALUES ('uploader', 'uploader@test.com', 'hash')`)
+	require.NoError(t, err)
+	userID, _ := result.LastInsertId()
+
+	insertArtist := func(name string) int64 {
+		result, err := db.Exec(`INSERT INTO artists (name) VALUES (?)`, name)
+		require.NoError(t, err)
+		id, _ := result.LastInsertId()
+		return id
+	}
+	insertSong := func(title string, artistID, albumID, categoryID, uploadedBy interface{}) int {
+		result, err := db.Exec(`INSERT INTO songs (title, artist_id, album_id, category_id, duration_seconds, file_path, format, uploaded_by_user_id)
+			VALUES (?, ?, ?, ?, 180, '/test/song.mp3', 'mp3', ?)`, title, artistID, albumID, categoryID, uploadedBy)
+		require.NoError(t, err)
+		id, _ := result.LastInsertId()
+		return int(id)
+	}
+
+	// Seeded songs 1-3 share artist 1, album 1 and category 1
+	other := insertArtist("Other Artist")
+	sameArtist := insertSong("Same Artist", 1, nil, 2, nil)
+	sameAlbum := insertSong("Same Album", other, 1, 3, nil)
+	sameCategory := insertSong("Same Category", other, nil, 1, nil)
+	insertSong("Unrelated", other, nil, 4, nil)
+	upload := insertSong("Upload By Same Artist", 1, nil, 1, userID)
+
+	songs, err := service.GetRelatedSongs(1, 10)
+	require.NoError(t, err)
+
+	var ids []int
+	for _, song := range songs {
+		ids = append(ids, song.ID)
+	}
+	require.Len(t, ids, 5)
+	assert.ElementsMatch(t, []int{2, 3, sameArtist}, ids[:3], "same-artist songs rank first")
+	assert.Equal(t, []int{sameAlbum, sameCategory}, ids[3:])
+	assert.NotContains(t, ids, 1, "the seed song is excluded")
+	assert.NotContains(t, ids, upload, "uploads are excluded")
+
+	t.Run("no relatives", func(t *testing.T) {
+		lonely := insertSong("Lonely", insertArtist("Loner"), nil, nil, nil)
+		songs, err := service.GetRelatedSongs(lonely, 10)
+		require.NoError(t, err)
+		assert.NotNil(t, songs)
+		assert.Empty(t, songs)
+	})
+
+	t.Run("unknown song", func(t *testing.T) {
+		_, err := service.GetRelatedSongs(99999, 10)
+		assert.Error(t, err)
+	})
+}
+
+func TestGetSongsByIDs(t *testing.T) {
+	service, cleanup := setupTestPlaybackService(t)
+	defer cleanup()
+
+	t.Run("Keeps the requested order and skips missing ids", func(t *testing.T) {
+		songs, err := service.GetSongsByIDs([]int{3, 99999, 1, 3, 2})
+		require.NoError(t, err)
+
+		var ids []int
+		for _, song := range songs {
+			ids = append(ids, song.ID)
+		}
+		assert.Equal(t, []int{3, 1, 2}, ids)
+		require.NotNil(t, songs[0].Artist)
+		assert.Equal(t, "Test Artist", songs[0].Artist.Name)
+	})
+
+	t.Run("Deleted songs are left out", func(t *testing.T) {
+		_, err := service.db.Exec(`UPDATE songs SET deleted_at = CURRENT_TIMESTAMP WHERE id = 2`)
+		require.NoError(t, err)
+		songs, err := service.GetSongsByIDs([]int{2})
+		require.NoError(t, err)
+		assert.Empty(t, songs)
+	})
+
+	t.Run("Too many ids", func(t *testing.T) {
+		ids := make([]int, MaxSongsByIDs+1)
+		for i := range ids {
+			ids[i] = i + 1
+		}
+		_, err := service.GetSongsByIDs(ids)
+		assert.Error(t, err)
+
+		_, err = service.GetSongsByIDs(ids[:MaxSongsByIDs])
+		assert.NoError(t, err)
+	})
+}
+
+func TestStreamRequiresAuth(t *testing.T) {
+	service, cleanup := setupTestPlaybackService(t)
+	defer cleanup()
+
+	anonymous, err := service.GenerateStreamToken(1, 0, time.Minute)
+	require.NoError(t, err)
+	forUser, err := service.GenerateStreamToken(1, 7, time.Minute)
+	require.NoError(t, err)
+
+	_, err = service.AuthorizeStream(1, anonymous, 0)
+	assert.NoError(t, err, "anonymous streaming is allowed by default")
+
+	service.SetRequireAuthToStream(true)
+	for _, token := range []string{anonymous, "", "not-a-token"} {
+		_, err = service.AuthorizeStream(1, token, 0)
+		appErr := apperrors.GetAppError(err)
+		require.NotNil(t, appErr, token)
+		assert.Equal(t, 401, appErr.StatusCode, token)
+	}
+
+	_, err = service.AuthorizeStream(1, forUser, 0)
+	assert.NoError(t, err, "a token minted for a user signs the stream in")
+	_, err = service.AuthorizeStream(1, anonymous, 7)
+	assert.NoError(t, err, "as does the request's own login")
+
+	_, err = service.AuthorizeStream(2, forUser, 0)
+	assert.Error(t, err, "a token for another song signs nobody in")
+	_, err = service.AuthorizeStream(2, forUser, 7)
+	appErr := apperrors.GetAppError(err)
+	require.NotNil(t, appErr)
+	assert.Equal(t, 403, appErr.StatusCode, "signed-in listeners still need a valid token")
+}
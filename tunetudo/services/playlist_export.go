@@ -0,0 +1,67 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	apperrors "tunetudo/errors"
+	"tunetudo/logger"
+)
+
+// SetStreamExport lets ExportM3U sign stream URLs with playback's tokens.
+// baseURL is the public origin the URLs are prefixed with, and each token
+// lasts at least ttl
+func (s *PlaylistService) SetStreamExport(playback *PlaybackService, baseURL string, ttl time.Duration) {
+	s.playback = playback
+	s.streamBaseURL = strings.TrimRight(baseURL, "/")
+	s.streamTokenTTL = ttl
+}
+
+// ExportM3U returns the playlist as an extended M3U file listing a signed
+// stream URL for each playable song, in queue order. Songs whose files are
+// missing are left out
+func (s *PlaylistService) ExportM3U(playlistID, userID int) (string, error) {
+	if s.playback == nil {
+		return "", apperrors.NotFoundError("playlist export is not enabled")
+	}
+
+	playlist, err := s.GetPlaylistByID(playlistID, userID)
+	if err != nil {
+		return "", err
+	}
+	songs, err := s.playback.BuildQueue(playlistID, userID)
+	if err != nil {
+		return "", err
+	}
+
+	// Every URL has to outlive a full play-through of the playlist
+	ttl := s.streamTokenTTL
+	for _, song := range songs {
+		ttl += time.Duration(song.DurationSeconds) * time.Second
+	}
+
+	var m3u strings.Builder
+	m3u.WriteString("#EXTM3U\n")
+	fmt.Fprintf(&m3u, "#PLAYLIST:%s\n", m3uText(playlist.Name))
+	for _, song := range songs {
+		token, err := s.playback.GenerateStreamToken(song.ID, userID, ttl)
+		if err != nil {
+			logger.Warning(logger.CategoryPlaylist, "Skipping song_id=%d in playlist export", song.ID)
+			continue
+		}
+
+		title := m3uText(song.Title)
+		if song.Artist != nil && song.Artist.Name != "" {
+			title = m3uText(song.Artist.Name) + " - " + title
+		}
+		fmt.Fprintf(&m3u, "#EXTINF:%d,%s\n", song.DurationSeconds, title)
+		fmt.Fprintf(&m3u, "%s/api/songs/%d/stream?token=%s\n", s.streamBaseURL, song.ID, url.QueryEscape(token))
+	}
+	return m3u.String(), nil
+}
+
+// m3uText keeps a name on its line of the file
+func m3uText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
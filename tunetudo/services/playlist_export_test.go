@@ -0,0 +1,46 @@
+package services
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportM3U(t *testing.T) {
+	playback, cleanup := setupTestPlaybackService(t)
+	defer cleanup()
+	playback.SetStreamSecret("stream-secret")
+	playlistID, userID := setupTestQueue(t, playback)
+
+	service := NewPlaylistService(playback.db)
+	_, err := service.ExportM3U(playlistID, userID)
+	assert.Error(t, err, "export needs stream URLs configured")
+
+	service.SetStreamExport(playback, "https://music.example.com/", time.Hour)
+	m3u, err := service.ExportM3U(playlistID, userID)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSuffix(m3u, "\n"), "\n")
+	require.Len(t, lines, 8, "the song with a missing file is left out")
+	assert.Equal(t, "#EXTM3U", lines[0])
+	assert.Equal(t, "#PLAYLIST:Queue", lines[1])
+
+	for i, songID := range []int{3, 1, 2} {
+		assert.Equal(t, "#EXTINF:180,Test Artist - Test Song "+string(rune(songID+'0')), lines[2+i*2])
+
+		streamURL, err := url.Parse(lines[3+i*2])
+		require.NoError(t, err)
+		assert.Equal(t, "music.example.com", streamURL.Host)
+		assert.Equal(t, "/api/songs/"+string(rune(songID+'0'))+"/stream", streamURL.Path)
+		tokenUserID, err := playback.verifyStreamToken(songID, streamURL.Query().Get("token"))
+		assert.NoError(t, err)
+		assert.Equal(t, userID, tokenUserID, "plays from the export count for its owner")
+	}
+
+	_, err = service.ExportM3U(playlistID, userID+1)
+	assert.Error(t, err, "other users cannot export the playlist")
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"sync"
+	"time"
+	"tunetudo/logger"
+	"tunetudo/models"
+)
+
+// playlistEventBuffer is how many events a slow subscriber can fall behind
+// before further events to it are dropped
+const playlistEventBuffer = 16
+
+// PlaylistHub fans playlist events out to in-process subscribers, such as
+// the WebSocket connections of a collaborative playlist
+type PlaylistHub struct {
+	mu          sync.RWMutex
+	subscribers map[int]map[chan models.PlaylistEvent]struct{}
+}
+
+func NewPlaylistHub() *PlaylistHub {
+	return &PlaylistHub{subscribers: make(map[int]map[chan models.PlaylistEvent]struct{})}
+}
+
+// Subscribe returns a channel receiving the playlist's events and a
+// function that ends the subscription and closes the channel
+func (h *PlaylistHub) Subscribe(playlistID int) (<-chan models.PlaylistEvent, func()) {
+	events := make(chan models.PlaylistEvent, playlistEventBuffer)
+
+	h.mu.Lock()
+	if h.subscribers[playlistID] == nil {
+		h.subscribers[playlistID] = make(map[chan models.PlaylistEvent]struct{})
+	}
+	h.subscribers[playlistID][events] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subscribers[playlistID], events)
+			if len(h.subscribers[playlistID]) == 0 {
+				delete(h.subscribers, playlistID)
+			}
+			h.mu.Unlock()
+			close(events)
+		})
+	}
+}
+
+// Publish delivers event to every subscriber of its playlist without
+// blocking; subscribers with a full buffer miss it
+func (h *PlaylistHub) Publish(event models.PlaylistEvent) {
+	if event.At.IsZero() {
+		event.At = time.Now().UTC()
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for events := range h.subscribers[event.PlaylistID] {
+		select {
+		case events <- event:
+		default:
+			logger.Warning(logger.CategoryPlaylist, "Dropped playlist event for slow subscriber: playlist_id=%d", event.PlaylistID)
+		}
+	}
+}
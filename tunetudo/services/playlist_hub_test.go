@@ -0,0 +1,77 @@
+package services
+
+import (
+	"testing"
+	"time"
+	"tunetudo/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func receiveEvent(t *testing.T, events <-chan models.PlaylistEvent) models.PlaylistEvent {
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no playlist event received")
+		return models.PlaylistEvent{}
+	}
+}
+
+func TestPlaylistHub(t *testing.T) {
+	hub := NewPlaylistHub()
+	first, unsubscribeFirst := hub.Subscribe(1)
+	second, unsubscribeSecond := hub.Subscribe(1)
+	other, unsubscribeOther := hub.Subscribe(2)
+	defer unsubscribeSecond()
+	defer unsubscribeOther()
+
+	hub.Publish(models.PlaylistEvent{Type: models.PlaylistEventSongAdded, PlaylistID: 1, SongID: 7})
+
+	for _, events := range []<-chan models.PlaylistEvent{first, second} {
+		event := receiveEvent(t, events)
+		assert.Equal(t, models.PlaylistEventSongAdded, event.Type)
+		assert.Equal(t, 7, event.SongID)
+		assert.False(t, event.At.IsZero())
+	}
+	assert.Empty(t, other, "other playlists' subscribers are not notified")
+
+	unsubscribeFirst()
+	unsubscribeFirst()
+	_, open := <-first
+	assert.False(t, open, "unsubscribing closes the channel")
+
+	// Publishing never blocks on a subscriber that stopped reading
+	for i := 0; i < playlistEventBuffer*2; i++ {
+		hub.Publish(models.PlaylistEvent{Type: models.PlaylistEventSongRemoved, PlaylistID: 1})
+	}
+	assert.Len(t, second, playlistEventBuffer)
+}
+
+func TestPlaylistMutationsPublishEvents(t *testing.T) {
+	service, _, userID, cleanup := setupTestPlaylistService(t)
+	defer cleanup()
+
+	playlist, err := service.CreatePlaylist(userID, models.CreatePlaylistRequest{Name: "Live"})
+	require.NoError(t, err)
+
+	events, unsubscribe := service.SubscribeEvents(playlist.ID)
+	defer unsubscribe()
+
+	require.NoError(t, service.AddSong(playlist.ID, 1, userID))
+	event := receiveEvent(t, events)
+	assert.Equal(t, models.PlaylistEvent{
+		Type: models.PlaylistEventSongAdded, PlaylistID: playlist.ID, SongID: 1, UserID: userID, At: event.At,
+	}, event)
+
+	require.NoError(t, service.RemoveSong(playlist.ID, 1, userID))
+	assert.Equal(t, models.PlaylistEventSongRemoved, receiveEvent(t, events).Type)
+
+	// Failed mutations publish nothing
+	assert.Error(t, service.RemoveSong(playlist.ID, 1, userID))
+	assert.Empty(t, events)
+
+	require.NoError(t, service.DeletePlaylist(playlist.ID, userID))
+	assert.Equal(t, models.PlaylistEventDeleted, receiveEvent(t, events).Type)
+}
@@ -2,58 +2,156 @@ package services
 
 import (
 	"database/sql"
-	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+	apperrors "tunetudo/errors"
 	"tunetudo/models"
 )
 
+// maxPlaylistNameLength is counted in characters after trimming
+const maxPlaylistNameLength = 100
+
+const (
+	// defaultMaxPlaylistSongs caps playlists when SetMaxSongs isn't called
+	defaultMaxPlaylistSongs = 1000
+	// defaultMaxUserPlaylists caps each user's library when
+	// SetMaxPlaylists isn't called
+	defaultMaxUserPlaylists = 200
+	// maxBatchAddSongs bounds one AddSongs request
+	maxBatchAddSongs = 1000
+)
+
+// Reasons reported for songs a batch add skipped
+const (
+	SkipReasonDuplicate = "already in playlist"
+	SkipReasonNotFound  = "song not found"
+	SkipReasonFull      = "playlist is full"
+)
+
+// errPlaylistLimit is returned when a user already has as many playlists
+// as they may own
+var errPlaylistLimit = apperrors.ConflictError("playlist limit reached")
+
+// errStaleVersion tells a client its copy of the playlist is out of date
+var errStaleVersion = apperrors.ConflictError("playlist was changed by someone else; reload it and try again")
+
 type PlaylistService struct {
-	db *sql.DB
+	db           *sql.DB
+	hub          *PlaylistHub
+	maxSongs     int
+	maxPlaylists int
+
+	// Used by ExportM3U to write signed stream URLs
+	playback       *PlaybackService
+	streamBaseURL  string
+	streamTokenTTL time.Duration
 }
 
 func NewPlaylistService(db *sql.DB) *PlaylistService {
-	return &PlaylistService{db: db}
+	return &PlaylistService{
+		db:           db,
+		hub:          NewPlaylistHub(),
+		maxSongs:     defaultMaxPlaylistSongs,
+		maxPlaylists: defaultMaxUserPlaylists,
+	}
+}
+
+// SetMaxSongs sets how many songs a playlist may hold
+func (s *PlaylistService) SetMaxSongs(max int) {
+	if max > 0 {
+		s.maxSongs = max
+	}
+}
+
+// SetMaxPlaylists sets how many playlists one user may own
+func (s *PlaylistService) SetMaxPlaylists(max int) {
+	if max > 0 {
+		s.maxPlaylists = max
+	}
+}
+
+// SubscribeEvents streams changes to a playlist until the returned function
+// is called. Callers check access first, e.g. with GetPlaylistByID
+func (s *PlaylistService) SubscribeEvents(playlistID int) (<-chan models.PlaylistEvent, func()) {
+	return s.hub.Subscribe(playlistID)
 }
 
 // CreatePlaylist creates a new playlist for a user
 func (s *PlaylistService) CreatePlaylist(userID int, req models.CreatePlaylistRequest) (*models.Playlist, error) {
-	if req.Name == "" {
-		return nil, errors.New("enter valid playlist name")
+	// Reported per field like registration, so forms can mark the input
+	fields := apperrors.ValidationErrors{}
+	if name, err := normalizePlaylistName(req.Name); err != nil {
+		fields.Add("name", err.Error())
+	} else {
+		req.Name = name
+	}
+	if err := fields.Err(); err != nil {
+		return nil, err
 	}
 
-	result, err := s.db.Exec(
-		`INSERT INTO playlists (user_id, name, description) VALUES (?, ?, ?)`,
-		userID, req.Name, req.Description,
-	)
+	id, err := s.insertPlaylistUnderLimit(s.db, userID, req.Name, req.Description, req.IsPublic)
+	if err == errPlaylistLimit {
+		return nil, err
+	}
 	if err != nil {
-		return nil, errors.New("Playlist already exists")
+		return nil, apperrors.ConflictError("Playlist already exists")
 	}
 
-	id, _ := result.LastInsertId()
-
 	playlist := &models.Playlist{
-		ID:          int(id),
+		ID:          id,
 		UserID:      userID,
 		Name:        req.Name,
 		Description: req.Description,
+		IsPublic:    req.IsPublic,
 	}
 
 	return playlist, nil
 }
 
-// GetUserPlaylists retrieves all playlists for a user
-func (s *PlaylistService) GetUserPlaylists(userID int) ([]models.Playlist, error) {
+// NameAvailable reports whether the user could create a playlist called
+// name, normalizing it the same way CreatePlaylist does
+func (s *PlaylistService) NameAvailable(userID int, name string) (bool, error) {
+	name, err := normalizePlaylistName(name)
+	if err != nil {
+		return false, err
+	}
+
+	var taken bool
+	err = s.db.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM playlists WHERE user_id = ? AND name = ?)`,
+		userID, name,
+	).Scan(&taken)
+	if err != nil {
+		return false, apperrors.InternalError(err)
+	}
+	return !taken, nil
+}
+
+// GetUserPlaylists retrieves a page of playlists for a user
+func (s *PlaylistService) GetUserPlaylists(userID, limit, offset int) (*models.Paginated[models.Playlist], error) {
+	var total int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM playlists WHERE user_id = ?`, userID).Scan(&total)
+	if err != nil {
+		return nil, apperrors.InternalError(err)
+	}
+
 	rows, err := s.db.Query(`
-		SELECT p.id, p.user_id, p.name, p.description, p.created_at,
-			   COUNT(ps.id) as song_count
+		SELECT p.id, p.user_id, p.name, p.description, p.is_public, p.created_at, p.version,
+			   COUNT(s.id) as song_count,
+			   COALESCE(SUM(s.duration_seconds), 0) as total_duration_seconds
 		FROM playlists p
 		LEFT JOIN playlist_songs ps ON p.id = ps.playlist_id
+		LEFT JOIN songs s ON ps.song_id = s.id AND s.deleted_at IS NULL
 		WHERE p.user_id = ?
 		GROUP BY p.id
 		ORDER BY p.created_at DESC
-	`, userID)
+		LIMIT ? OFFSET ?
+	`, userID, limit, offset)
 
 	if err != nil {
-		return nil, err
+		return nil, apperrors.InternalError(err)
 	}
 	defer rows.Close()
 
@@ -62,7 +160,8 @@ func (s *PlaylistService) GetUserPlaylists(userID int) ([]models.Playlist, error
 		var playlist models.Playlist
 		err := rows.Scan(
 			&playlist.ID, &playlist.UserID, &playlist.Name,
-			&playlist.Description, &playlist.CreatedAt, &playlist.SongCount,
+			&playlist.Description, &playlist.IsPublic, &playlist.CreatedAt, &playlist.Version,
+			&playlist.SongCount, &playlist.TotalDurationSeconds,
 		)
 		if err != nil {
 			continue
@@ -70,23 +169,83 @@ func (s *PlaylistService) GetUserPlaylists(userID int) ([]models.Playlist, error
 		playlists = append(playlists, playlist)
 	}
 
-	return playlists, nil
+	return models.NewPaginated(playlists, total, limit, offset), nil
 }
 
-// GetPlaylistByID retrieves a specific playlist
+// playlistTotalsColumns selects song_count and total_duration_seconds for the
+// playlist aliased p, counting the same songs GetPlaylistSongs returns
+const playlistTotalsColumns = `
+	(SELECT COUNT(*) FROM playlist_songs ps JOIN songs s ON ps.song_id = s.id
+	 WHERE ps.playlist_id = p.id AND s.deleted_at IS NULL),
+	(SELECT COALESCE(SUM(s.duration_seconds), 0) FROM playlist_songs ps JOIN songs s ON ps.song_id = s.id
+	 WHERE ps.playlist_id = p.id AND s.deleted_at IS NULL)`
+
+// GetFeaturedPlaylists returns every featured playlist, newest first, with
+// its songs. They are shown to anyone whether or not they are public, and
+// a playlist drops out if its owner is no longer an admin
+func (s *PlaylistService) GetFeaturedPlaylists() ([]models.FeaturedPlaylist, error) {
+	rows, err := s.db.Query(`
+		SELECT p.id, p.user_id, p.name, p.description, p.is_public, p.created_at, p.version,`+playlistTotalsColumns+`
+		FROM playlists p
+		JOIN users u ON p.user_id = u.id
+		WHERE p.is_featured = 1 AND u.is_admin = 1
+		ORDER BY p.created_at DESC, p.id DESC
+	`)
+	if err != nil {
+		return nil, apperrors.InternalError(err)
+	}
+
+	featured := []models.FeaturedPlaylist{}
+	for rows.Next() {
+		var playlist models.FeaturedPlaylist
+		if err := rows.Scan(
+			&playlist.ID, &playlist.UserID, &playlist.Name,
+			&playlist.Description, &playlist.IsPublic, &playlist.CreatedAt, &playlist.Version,
+			&playlist.SongCount, &playlist.TotalDurationSeconds,
+		); err != nil {
+			rows.Close()
+			return nil, apperrors.InternalError(err)
+		}
+		featured = append(featured, playlist)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, apperrors.InternalError(err)
+	}
+
+	// Songs are loaded once the playlist rows are closed
+	for i := range featured {
+		songs, err := s.GetPlaylistSongs(featured[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		featured[i].Songs = songs
+	}
+	return featured, nil
+}
+
+// GetPlaylistByID retrieves a specific playlist with its song count and
+// total duration
 func (s *PlaylistService) GetPlaylistByID(playlistID int, userID int) (*models.Playlist, error) {
 	var playlist models.Playlist
 	err := s.db.QueryRow(`
-		SELECT id, user_id, name, description, created_at
-		FROM playlists
-		WHERE id = ? AND user_id = ?
-	`, playlistID, userID).Scan(
+		SELECT p.id, p.user_id, p.name, p.description, p.is_public, p.created_at, p.version,`+playlistTotalsColumns+`
+		FROM playlists p
+		WHERE p.id = ? AND (p.user_id = ? OR p.id IN (
+			SELECT playlist_id FROM playlist_collaborators WHERE user_id = ?
+		))
+	`, playlistID, userID, userID).Scan(
 		&playlist.ID, &playlist.UserID, &playlist.Name,
-		&playlist.Description, &playlist.CreatedAt,
+		&playlist.Description, &playlist.IsPublic, &playlist.CreatedAt, &playlist.Version,
+		&playlist.SongCount, &playlist.TotalDurationSeconds,
 	)
 
+	if err == sql.ErrNoRows {
+		return nil, apperrors.NotFoundError("no playlist found")
+	}
 	if err != nil {
-		return nil, errors.New("no playlist found")
+		return nil, apperrors.InternalError(err)
 	}
 
 	return &playlist, nil
@@ -96,21 +255,22 @@ func (s *PlaylistService) GetPlaylistByID(playlistID int, userID int) (*models.P
 func (s *PlaylistService) GetPlaylistSongs(playlistID int) ([]models.PlaylistSong, error) {
 	rows, err := s.db.Query(`
 		SELECT ps.id, ps.playlist_id, ps.song_id, ps.queue_number, ps.added_at,
-			   s.title, s.artist_id, s.album_id, s.duration_seconds, s.file_path, s.format,
+			   s.title, s.artist_id, s.album_id, COALESCE(s.duration_seconds, 0), s.file_path, s.format,
 			   a.name as artist_name
 		FROM playlist_songs ps
 		JOIN songs s ON ps.song_id = s.id
 		LEFT JOIN artists a ON s.artist_id = a.id
-		WHERE ps.playlist_id = ?
+		WHERE ps.playlist_id = ? AND s.deleted_at IS NULL
 		ORDER BY ps.queue_number, ps.added_at
 	`, playlistID)
 
 	if err != nil {
-		return nil, err
+		return nil, apperrors.InternalError(err)
 	}
 	defer rows.Close()
 
-	var playlistSongs []models.PlaylistSong
+	// Non-nil so an empty playlist serializes as [] rather than null
+	playlistSongs := []models.PlaylistSong{}
 	for rows.Next() {
 		var ps models.PlaylistSong
 		var song models.Song
@@ -133,31 +293,54 @@ func (s *PlaylistService) GetPlaylistSongs(playlistID int) ([]models.PlaylistSon
 
 		playlistSongs = append(playlistSongs, ps)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, apperrors.InternalError(err)
+	}
 
 	return playlistSongs, nil
 }
 
-// AddSong adds a song to a playlist
-func (s *PlaylistService) AddSong(playlistID, songID, userID int) error {
-	// Verify playlist belongs to user
-	var ownerID int
-	err := s.db.QueryRow(`SELECT user_id FROM playlists WHERE id = ?`, playlistID).Scan(&ownerID)
+// GetSongContext returns the zero-based position of a song in a playlist's
+// play order with the songs either side of it; prev or next is nil at the
+// ends. Callers check access first, e.g. with GetPlaylistByID
+func (s *PlaylistService) GetSongContext(playlistID, songID int) (index int, prev, next *models.Song, err error) {
+	songs, err := s.GetPlaylistSongs(playlistID)
 	if err != nil {
-		return errors.New("no playlist found")
+		return 0, nil, nil, err
 	}
-	if ownerID != userID {
-		return errors.New("unauthorized")
+
+	for i, ps := range songs {
+		if ps.SongID != songID {
+			continue
+		}
+		if i > 0 {
+			prev = songs[i-1].Song
+		}
+		if i < len(songs)-1 {
+			next = songs[i+1].Song
+		}
+		return i, prev, next, nil
+	}
+
+	return 0, nil, nil, apperrors.NotFoundError("song not in playlist")
+}
+
+// AddSong adds a song to a playlist
+func (s *PlaylistService) AddSong(playlistID, songID, userID int) error {
+	// Owners and editors may change the songs
+	if err := s.checkCanEdit(playlistID, userID); err != nil {
+		return err
 	}
 
 	// Check if song already in playlist
 	var exists int
-	err = s.db.QueryRow(
+	err := s.db.QueryRow(
 		`SELECT COUNT(*) FROM playlist_songs WHERE playlist_id = ? AND song_id = ?`,
 		playlistID, songID,
 	).Scan(&exists)
 
 	if err == nil && exists > 0 {
-		return errors.New("Song already in the playlist")
+		return apperrors.ConflictError("Song already in the playlist")
 	}
 
 	// Get next queue number
@@ -173,24 +356,163 @@ func (s *PlaylistService) AddSong(playlistID, songID, userID int) error {
 	}
 
 	// Add song to playlist
-	_, err = s.db.Exec(
-		`INSERT INTO playlist_songs (playlist_id, song_id, queue_number) VALUES (?, ?, ?)`,
-		playlistID, songID, queueNumber,
-	)
+	added, err := s.insertUnderLimit(s.db, playlistID, songID, queueNumber)
+	if err != nil {
+		return apperrors.InternalError(err)
+	}
+	if !added {
+		return apperrors.ConflictError(SkipReasonFull)
+	}
+	if err := bumpVersion(s.db, playlistID); err != nil {
+		return apperrors.InternalError(err)
+	}
 
-	return err
+	s.hub.Publish(models.PlaylistEvent{
+		Type: models.PlaylistEventSongAdded, PlaylistID: playlistID, SongID: songID, UserID: userID,
+	})
+	return nil
 }
 
-// RemoveSong removes a song from a playlist
-func (s *PlaylistService) RemoveSong(playlistID, songID, userID int) error {
-	// Verify playlist belongs to user
-	var ownerID int
-	err := s.db.QueryRow(`SELECT user_id FROM playlists WHERE id = ?`, playlistID).Scan(&ownerID)
+// AddSongs appends songIDs to a playlist in order, skipping songs that are
+// missing, already present or don't fit under the size limit. The added
+// songs are committed together
+func (s *PlaylistService) AddSongs(playlistID int, songIDs []int, userID int) (*models.BatchAddResult, error) {
+	if err := s.checkCanEdit(playlistID, userID); err != nil {
+		return nil, err
+	}
+	if len(songIDs) == 0 {
+		return nil, apperrors.ValidationError("song_ids required", nil)
+	}
+	if len(songIDs) > maxBatchAddSongs {
+		return nil, apperrors.ValidationError(fmt.Sprintf("at most %d songs can be added at once", maxBatchAddSongs), nil)
+	}
+
+	tx, err := s.db.Begin()
 	if err != nil {
-		return errors.New("no playlist found")
+		return nil, apperrors.InternalError(err)
 	}
-	if ownerID != userID {
-		return errors.New("unauthorized")
+	defer tx.Rollback()
+
+	var maxQueue sql.NullInt64
+	if err := tx.QueryRow(
+		`SELECT MAX(queue_number) FROM playlist_songs WHERE playlist_id = ?`, playlistID,
+	).Scan(&maxQueue); err != nil {
+		return nil, apperrors.InternalError(err)
+	}
+	queueNumber := 0
+	if maxQueue.Valid {
+		queueNumber = int(maxQueue.Int64) + 1
+	}
+
+	result := &models.BatchAddResult{Added: []int{}, Skipped: []models.SkippedSong{}}
+	seen := map[int]bool{}
+	full := false
+	for _, songID := range songIDs {
+		skip := func(reason string) {
+			result.Skipped = append(result.Skipped, models.SkippedSong{SongID: songID, Reason: reason})
+		}
+		if full {
+			skip(SkipReasonFull)
+			continue
+		}
+		if seen[songID] {
+			skip(SkipReasonDuplicate)
+			continue
+		}
+		seen[songID] = true
+
+		var present, available int
+		err := tx.QueryRow(`
+			SELECT
+				(SELECT COUNT(*) FROM playlist_songs WHERE playlist_id = ? AND song_id = ?),
+				(SELECT COUNT(*) FROM songs WHERE id = ? AND deleted_at IS NULL)
+		`, playlistID, songID, songID).Scan(&present, &available)
+		if err != nil {
+			return nil, apperrors.InternalError(err)
+		}
+		if present > 0 {
+			skip(SkipReasonDuplicate)
+			continue
+		}
+		if available == 0 {
+			skip(SkipReasonNotFound)
+			continue
+		}
+
+		added, err := s.insertUnderLimit(tx, playlistID, songID, queueNumber)
+		if err != nil {
+			return nil, apperrors.InternalError(err)
+		}
+		if !added {
+			full = true
+			skip(SkipReasonFull)
+			continue
+		}
+		result.Added = append(result.Added, songID)
+		queueNumber++
+	}
+	if len(result.Added) > 0 {
+		if err := bumpVersion(tx, playlistID); err != nil {
+			return nil, apperrors.InternalError(err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, apperrors.InternalError(err)
+	}
+
+	for _, songID := range result.Added {
+		s.hub.Publish(models.PlaylistEvent{
+			Type: models.PlaylistEventSongAdded, PlaylistID: playlistID, SongID: songID, UserID: userID,
+		})
+	}
+	return result, nil
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertPlaylistUnderLimit creates a playlist unless the user already owns
+// maxPlaylists, returning errPlaylistLimit if they do. Like insertUnderLimit
+// the count and insert are one statement
+func (s *PlaylistService) insertPlaylistUnderLimit(db execer, userID int, name string, description *string, isPublic bool) (int, error) {
+	result, err := db.Exec(`
+		INSERT INTO playlists (user_id, name, description, is_public)
+		SELECT ?, ?, ?, ?
+		WHERE (SELECT COUNT(*) FROM playlists WHERE user_id = ?) < ?
+	`, userID, name, description, isPublic, userID, s.maxPlaylists)
+	if err != nil {
+		return 0, err
+	}
+	if inserted, _ := result.RowsAffected(); inserted == 0 {
+		return 0, errPlaylistLimit
+	}
+	id, _ := result.LastInsertId()
+	return int(id), nil
+}
+
+// insertUnderLimit adds a song unless the playlist already holds maxSongs.
+// The count and insert are one statement so concurrent adds can't overshoot
+func (s *PlaylistService) insertUnderLimit(db execer, playlistID, songID, queueNumber int) (bool, error) {
+	result, err := db.Exec(`
+		INSERT INTO playlist_songs (playlist_id, song_id, queue_number)
+		SELECT ?, ?, ?
+		WHERE (SELECT COUNT(*) FROM playlist_songs WHERE playlist_id = ?) < ?
+	`, playlistID, songID, queueNumber, playlistID, s.maxSongs)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n == 1, nil
+}
+
+// RemoveSong removes a song from a playlist
+func (s *PlaylistService) RemoveSong(playlistID, songID, userID int) error {
+	// Owners and editors may change the songs
+	if err := s.checkCanEdit(playlistID, userID); err != nil {
+		return err
 	}
 
 	result, err := s.db.Exec(
@@ -198,17 +520,257 @@ func (s *PlaylistService) RemoveSong(playlistID, songID, userID int) error {
 		playlistID, songID,
 	)
 	if err != nil {
-		return err
+		return apperrors.InternalError(err)
 	}
 
 	rows, _ := result.RowsAffected()
 	if rows == 0 {
-		return errors.New("song not found in playlist")
+		return apperrors.NotFoundError("song not found in playlist")
+	}
+	if err := bumpVersion(s.db, playlistID); err != nil {
+		return apperrors.InternalError(err)
+	}
+
+	s.hub.Publish(models.PlaylistEvent{
+		Type: models.PlaylistEventSongRemoved, PlaylistID: playlistID, SongID: songID, UserID: userID,
+	})
+	return nil
+}
+
+// MoveSong takes a song out of one of the user's playlists and appends it
+// to another they own, in one transaction. When the destination already
+// holds the song it is only removed from the source
+func (s *PlaylistService) MoveSong(songID, fromPlaylistID, toPlaylistID, userID int) error {
+	if fromPlaylistID == toPlaylistID {
+		return apperrors.ValidationError("choose a different playlist to move the song to", nil)
+	}
+	for _, playlistID := range []int{fromPlaylistID, toPlaylistID} {
+		if err := s.checkOwner(playlistID, userID); err != nil {
+			return err
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return apperrors.InternalError(err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		`DELETE FROM playlist_songs WHERE playlist_id = ? AND song_id = ?`,
+		fromPlaylistID, songID,
+	)
+	if err != nil {
+		return apperrors.InternalError(err)
+	}
+	if removed, _ := result.RowsAffected(); removed == 0 {
+		return apperrors.NotFoundError("song not found in playlist")
+	}
+
+	var present int
+	var maxQueue sql.NullInt64
+	if err := tx.QueryRow(`
+		SELECT COUNT(CASE WHEN song_id = ? THEN 1 END), MAX(queue_number)
+		FROM playlist_songs WHERE playlist_id = ?
+	`, songID, toPlaylistID).Scan(&present, &maxQueue); err != nil {
+		return apperrors.InternalError(err)
+	}
+
+	added := false
+	if present == 0 {
+		queueNumber := 0
+		if maxQueue.Valid {
+			queueNumber = int(maxQueue.Int64) + 1
+		}
+		if added, err = s.insertUnderLimit(tx, toPlaylistID, songID, queueNumber); err != nil {
+			return apperrors.InternalError(err)
+		}
+		if !added {
+			return apperrors.ConflictError(SkipReasonFull)
+		}
+		if err := bumpVersion(tx, toPlaylistID); err != nil {
+			return apperrors.InternalError(err)
+		}
+	}
+	if err := bumpVersion(tx, fromPlaylistID); err != nil {
+		return apperrors.InternalError(err)
 	}
 
+	if err := tx.Commit(); err != nil {
+		return apperrors.InternalError(err)
+	}
+
+	s.hub.Publish(models.PlaylistEvent{
+		Type: models.PlaylistEventSongRemoved, PlaylistID: fromPlaylistID, SongID: songID, UserID: userID,
+	})
+	if added {
+		s.hub.Publish(models.PlaylistEvent{
+			Type: models.PlaylistEventSongAdded, PlaylistID: toPlaylistID, SongID: songID, UserID: userID,
+		})
+	}
 	return nil
 }
 
+// ClearPlaylist removes every song from a playlist the user owns, keeping
+// the playlist itself, and returns how many were removed. A playlist that
+// is missing or belongs to someone else is reported as not found
+func (s *PlaylistService) ClearPlaylist(playlistID, userID int) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, apperrors.InternalError(err)
+	}
+	defer tx.Rollback()
+
+	var owned bool
+	err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM playlists WHERE id = ? AND user_id = ?)`,
+		playlistID, userID).Scan(&owned)
+	if err != nil {
+		return 0, apperrors.InternalError(err)
+	}
+	if !owned {
+		return 0, apperrors.NotFoundError("no playlist found")
+	}
+
+	result, err := tx.Exec(`DELETE FROM playlist_songs WHERE playlist_id = ?`, playlistID)
+	if err != nil {
+		return 0, apperrors.InternalError(err)
+	}
+	removed, _ := result.RowsAffected()
+	if removed > 0 {
+		if err := bumpVersion(tx, playlistID); err != nil {
+			return 0, apperrors.InternalError(err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, apperrors.InternalError(err)
+	}
+
+	if removed > 0 {
+		s.hub.Publish(models.PlaylistEvent{Type: models.PlaylistEventCleared, PlaylistID: playlistID, UserID: userID})
+	}
+	return int(removed), nil
+}
+
+// UpdatePlaylist changes the name, description or visibility of a playlist
+// the user owns. It fails with a conflict if the playlist is no longer at
+// req.Version, and returns the playlist at its new version
+func (s *PlaylistService) UpdatePlaylist(playlistID, userID int, req models.UpdatePlaylistRequest) (*models.Playlist, error) {
+	if err := s.checkOwner(playlistID, userID); err != nil {
+		return nil, err
+	}
+	if req.Name != nil {
+		name, err := normalizePlaylistName(*req.Name)
+		if err != nil {
+			return nil, err
+		}
+		req.Name = &name
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, apperrors.InternalError(err)
+	}
+	defer tx.Rollback()
+
+	if err := claimVersion(tx, playlistID, req.Version); err != nil {
+		return nil, err
+	}
+	if req.Name != nil {
+		if _, err := tx.Exec(`UPDATE playlists SET name = ? WHERE id = ?`, *req.Name, playlistID); err != nil {
+			return nil, apperrors.ConflictError("Playlist already exists")
+		}
+	}
+	if req.Description != nil {
+		if _, err := tx.Exec(`UPDATE playlists SET description = ? WHERE id = ?`, *req.Description, playlistID); err != nil {
+			return nil, apperrors.InternalError(err)
+		}
+	}
+	if req.IsPublic != nil {
+		if _, err := tx.Exec(`UPDATE playlists SET is_public = ? WHERE id = ?`, *req.IsPublic, playlistID); err != nil {
+			return nil, apperrors.InternalError(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, apperrors.InternalError(err)
+	}
+
+	s.hub.Publish(models.PlaylistEvent{Type: models.PlaylistEventUpdated, PlaylistID: playlistID, UserID: userID})
+	return s.GetPlaylistByID(playlistID, userID)
+}
+
+// ReorderSongs puts the playlist's songs in the order of req.SongIDs, which
+// must list each of them once. Owners and editors may reorder. It fails
+// with a conflict if the playlist is no longer at req.Version, and returns
+// the new version
+func (s *PlaylistService) ReorderSongs(playlistID, userID int, req models.ReorderSongsRequest) (int, error) {
+	if err := s.checkCanEdit(playlistID, userID); err != nil {
+		return 0, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, apperrors.InternalError(err)
+	}
+	defer tx.Rollback()
+
+	if err := claimVersion(tx, playlistID, req.Version); err != nil {
+		return 0, err
+	}
+
+	// The version check above means nobody changed the songs since the
+	// client read them, so a mismatch here is a bad request
+	var count int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM playlist_songs WHERE playlist_id = ?`, playlistID).Scan(&count); err != nil {
+		return 0, apperrors.InternalError(err)
+	}
+	seen := map[int]bool{}
+	for _, songID := range req.SongIDs {
+		seen[songID] = true
+	}
+	if len(req.SongIDs) != count || len(seen) != count {
+		return 0, apperrors.ValidationError("song_ids must list every song in the playlist once", nil)
+	}
+
+	for i, songID := range req.SongIDs {
+		result, err := tx.Exec(`UPDATE playlist_songs SET queue_number = ? WHERE playlist_id = ? AND song_id = ?`,
+			i, playlistID, songID)
+		if err != nil {
+			return 0, apperrors.InternalError(err)
+		}
+		if updated, _ := result.RowsAffected(); updated == 0 {
+			return 0, apperrors.ValidationError("song_ids must list every song in the playlist once", nil)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, apperrors.InternalError(err)
+	}
+
+	s.hub.Publish(models.PlaylistEvent{Type: models.PlaylistEventSongsReordered, PlaylistID: playlistID, UserID: userID})
+	return req.Version + 1, nil
+}
+
+// claimVersion moves the playlist from expected to the next version, or
+// returns errStaleVersion if it has already moved on
+func claimVersion(db execer, playlistID, expected int) error {
+	result, err := db.Exec(`UPDATE playlists SET version = version + 1 WHERE id = ? AND version = ?`,
+		playlistID, expected)
+	if err != nil {
+		return apperrors.InternalError(err)
+	}
+	if claimed, _ := result.RowsAffected(); claimed == 0 {
+		return errStaleVersion
+	}
+	return nil
+}
+
+// bumpVersion records a change made without a version check, so clients
+// holding the old version have to refetch before their next edit
+func bumpVersion(db execer, playlistID int) error {
+	_, err := db.Exec(`UPDATE playlists SET version = version + 1 WHERE id = ?`, playlistID)
+	return err
+}
+
 // DeletePlaylist deletes a playlist
 func (s *PlaylistService) DeletePlaylist(playlistID, userID int) error {
 	result, err := s.db.Exec(
@@ -216,13 +778,214 @@ func (s *PlaylistService) DeletePlaylist(playlistID, userID int) error {
 		playlistID, userID,
 	)
 	if err != nil {
-		return err
+		return apperrors.InternalError(err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return apperrors.NotFoundError("no playlist found")
+	}
+
+	s.hub.Publish(models.PlaylistEvent{Type: models.PlaylistEventDeleted, PlaylistID: playlistID, UserID: userID})
+	return nil
+}
+
+// ClonePlaylist copies a playlist and its songs, in order, to targetUserID.
+// The source must belong to the caller or be public. newName defaults to
+// the source's name; if the caller already has a playlist by that name the
+// first free "<name> (copy N)" is used instead
+func (s *PlaylistService) ClonePlaylist(sourcePlaylistID, targetUserID int, newName string) (*models.Playlist, error) {
+	var source models.Playlist
+	err := s.db.QueryRow(`
+		SELECT id, user_id, name, description, is_public FROM playlists WHERE id = ?
+	`, sourcePlaylistID).Scan(&source.ID, &source.UserID, &source.Name, &source.Description, &source.IsPublic)
+	if err != nil || (source.UserID != targetUserID && !source.IsPublic) {
+		// Private playlists of other users look the same as missing ones
+		return nil, apperrors.NotFoundError("no playlist found")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, apperrors.InternalError(err)
+	}
+	defer tx.Rollback()
+
+	if newName == "" {
+		newName = source.Name
+	} else if newName, err = normalizePlaylistName(newName); err != nil {
+		return nil, err
+	}
+	name, err := uniquePlaylistName(tx, targetUserID, newName)
+	if err != nil {
+		return nil, apperrors.InternalError(err)
+	}
+
+	id, err := s.insertPlaylistUnderLimit(tx, targetUserID, name, source.Description, false)
+	if err == errPlaylistLimit {
+		return nil, err
+	}
+	if err != nil {
+		return nil, apperrors.InternalError(err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO playlist_songs (playlist_id, song_id, queue_number)
+		SELECT ?, song_id, queue_number FROM playlist_songs
+		WHERE playlist_id = ?
+		ORDER BY queue_number, added_at
+		LIMIT ?
+	`, id, sourcePlaylistID, s.maxSongs)
+	if err != nil {
+		return nil, apperrors.InternalError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, apperrors.InternalError(err)
+	}
+
+	return &models.Playlist{
+		ID:          id,
+		UserID:      targetUserID,
+		Name:        name,
+		Description: source.Description,
+	}, nil
+}
+
+// normalizePlaylistName trims a playlist name, so names that differ only in
+// surrounding spaces hit the unique constraint instead of sitting side by side
+func normalizePlaylistName(name string) (string, error) {
+	if name == "" {
+		return "", apperrors.ValidationError("enter valid playlist name", nil)
+	}
+	trimmed := strings.TrimSpace(name)
+	if trimmed == "" {
+		return "", apperrors.ValidationError("playlist name cannot be only whitespace", nil)
+	}
+	if utf8.RuneCountInString(trimmed) > maxPlaylistNameLength {
+		return "", apperrors.ValidationError(fmt.Sprintf("playlist name must be at most %d characters", maxPlaylistNameLength), nil)
+	}
+	return trimmed, nil
+}
+
+// uniquePlaylistName returns name if the user doesn't already have a
+// playlist called that, otherwise the first free copy name. The name is cut
+// short where needed so the suffix still fits within maxPlaylistNameLength
+func uniquePlaylistName(tx *sql.Tx, userID int, name string) (string, error) {
+	candidate := name
+	for n := 1; ; n++ {
+		var count int
+		err := tx.QueryRow(`SELECT COUNT(*) FROM playlists WHERE user_id = ? AND name = ?`, userID, candidate).Scan(&count)
+		if err != nil || count == 0 {
+			return candidate, err
+		}
+
+		suffix := " (copy)"
+		if n > 1 {
+			suffix = fmt.Sprintf(" (copy %d)", n)
+		}
+		base := []rune(name)
+		if room := maxPlaylistNameLength - utf8.RuneCountInString(suffix); len(base) > room {
+			base = base[:room]
+		}
+		candidate = strings.TrimRight(string(base), " ") + suffix
+	}
+}
+
+// checkCanEdit allows the owner and collaborators with the editor role.
+// Deleting or renaming the playlist stays owner-only
+func (s *PlaylistService) checkCanEdit(playlistID, userID int) error {
+	var ownerID int
+	err := s.db.QueryRow(`SELECT user_id FROM playlists WHERE id = ?`, playlistID).Scan(&ownerID)
+	if err != nil {
+		return apperrors.NotFoundError("no playlist found")
+	}
+	if ownerID == userID {
+		return nil
+	}
+
+	var role string
+	err = s.db.QueryRow(
+		`SELECT role FROM playlist_collaborators WHERE playlist_id = ? AND user_id = ?`,
+		playlistID, userID,
+	).Scan(&role)
+	if err != nil || role != models.CollaboratorRoleEditor {
+		return notPermitted()
+	}
+	return nil
+}
+
+// checkOwner verifies the playlist exists and belongs to userID
+func (s *PlaylistService) checkOwner(playlistID, userID int) error {
+	var ownerID int
+	err := s.db.QueryRow(`SELECT user_id FROM playlists WHERE id = ?`, playlistID).Scan(&ownerID)
+	if err != nil {
+		return apperrors.NotFoundError("no playlist found")
+	}
+	if ownerID != userID {
+		return notPermitted()
+	}
+	return nil
+}
+
+// AddCollaborator lets the owner invite another user by username. Inviting
+// an existing collaborator again updates their role
+func (s *PlaylistService) AddCollaborator(playlistID, ownerID int, username, role string) (*models.PlaylistCollaborator, error) {
+	if err := s.checkOwner(playlistID, ownerID); err != nil {
+		return nil, err
+	}
+
+	if role == "" {
+		role = models.CollaboratorRoleEditor
+	}
+	if role != models.CollaboratorRoleEditor && role != models.CollaboratorRoleViewer {
+		return nil, apperrors.ValidationError("role must be editor or viewer", nil)
+	}
+
+	collaborator := &models.PlaylistCollaborator{PlaylistID: playlistID, Role: role}
+	err := s.db.QueryRow(`SELECT id, username FROM users WHERE username = ?`, username).
+		Scan(&collaborator.UserID, &collaborator.Username)
+	if err != nil {
+		return nil, apperrors.NotFoundError("user not found")
+	}
+	if collaborator.UserID == ownerID {
+		return nil, apperrors.BadRequestError("owner is already a member of the playlist")
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO playlist_collaborators (playlist_id, user_id, role) VALUES (?, ?, ?)
+		ON CONFLICT(playlist_id, user_id) DO UPDATE SET role = excluded.role
+	`, playlistID, collaborator.UserID, role)
+	if err != nil {
+		return nil, apperrors.InternalError(err)
+	}
+
+	return collaborator, nil
+}
+
+// RemoveCollaborator removes a collaborator. The owner can remove anyone;
+// a collaborator can only remove themselves
+func (s *PlaylistService) RemoveCollaborator(playlistID, requesterID, collaboratorID int) error {
+	if requesterID != collaboratorID {
+		if err := s.checkOwner(playlistID, requesterID); err != nil {
+			return err
+		}
+	}
+
+	result, err := s.db.Exec(
+		`DELETE FROM playlist_collaborators WHERE playlist_id = ? AND user_id = ?`,
+		playlistID, collaboratorID,
+	)
+	if err != nil {
+		return apperrors.InternalError(err)
 	}
 
 	rows, _ := result.RowsAffected()
 	if rows == 0 {
-		return errors.New("no playlist found")
+		return apperrors.NotFoundError("collaborator not found")
 	}
 
+	s.hub.Publish(models.PlaylistEvent{
+		Type: models.PlaylistEventCollaboratorRemoved, PlaylistID: playlistID, UserID: collaboratorID,
+	})
 	return nil
-}
\ No newline at end of file
+}
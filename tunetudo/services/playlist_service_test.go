@@ -1,7 +1,9 @@
 package services
 
 import (
+	"strings"
 	"testing"
+	apperrors "tunetudo/errors"
 	"tunetudo/models"
 
 	"github.com/stretchr/testify/assert"
@@ -20,7 +22,7 @@ func setupTestPlaylistService(t *testing.T) (*PlaylistService, *AuthService, int
 	user, err := authService.RegisterUser(models.RegisterRequest{
 		Username: "playlistuser",
 		Email:    "playlist@test.com",
-		Password: "password123",
+		Password: "Passw0rd-123",
 	}, ip)
 	require.NoError(t, err)
 	
@@ -40,6 +42,7 @@ func TestCreatePlaylist(t *testing.T) {
 		req         models.CreatePlaylistRequest
 		expectError bool
 		errorMsg    string
+		errorCode   string
 	}{
 		{
 			name: "Valid playlist",
@@ -56,6 +59,7 @@ func TestCreatePlaylist(t *testing.T) {
 			},
 			expectError: true,
 			errorMsg:    "enter valid playlist name",
+			errorCode:   apperrors.ErrCodeValidation,
 		},
 		{
 			name: "Duplicate playlist name",
@@ -64,6 +68,7 @@ func TestCreatePlaylist(t *testing.T) {
 			},
 			expectError: true,
 			errorMsg:    "Playlist already exists",
+			errorCode:   apperrors.ErrCodeConflict,
 		},
 		{
 			name: "Playlist without description",
@@ -81,6 +86,9 @@ func TestCreatePlaylist(t *testing.T) {
 			if tt.expectError {
 				assert.Error(t, err)
 				assert.Contains(t, err.Error(), tt.errorMsg)
+				if appErr := apperrors.GetAppError(err); assert.NotNil(t, appErr) {
+					assert.Equal(t, tt.errorCode, appErr.Code)
+				}
 				assert.Nil(t, playlist)
 			} else {
 				require.NoError(t, err)
@@ -93,6 +101,68 @@ func TestCreatePlaylist(t *testing.T) {
 	}
 }
 
+func TestCreatePlaylistLimit(t *testing.T) {
+	service, _, userID, cleanup := setupTestPlaylistService(t)
+	defer cleanup()
+	service.SetMaxPlaylists(2)
+
+	first, err := service.CreatePlaylist(userID, models.CreatePlaylistRequest{Name: "One"})
+	require.NoError(t, err)
+	_, err = service.CreatePlaylist(userID, models.CreatePlaylistRequest{Name: "Two"})
+	require.NoError(t, err)
+
+	_, err = service.CreatePlaylist(userID, models.CreatePlaylistRequest{Name: "Three"})
+	require.Error(t, err)
+	assert.Equal(t, "playlist limit reached", err.Error())
+
+	_, err = service.ClonePlaylist(first.ID, userID, "")
+	require.Error(t, err, "cloning counts against the same limit")
+	assert.Equal(t, "playlist limit reached", err.Error())
+
+	// Deleting one frees up room again
+	require.NoError(t, service.DeletePlaylist(first.ID, userID))
+	_, err = service.CreatePlaylist(userID, models.CreatePlaylistRequest{Name: "Three"})
+	assert.NoError(t, err)
+}
+
+func TestPlaylistNameAvailable(t *testing.T) {
+	service, authService, userID, cleanup := setupTestPlaylistService(t)
+	defer cleanup()
+
+	_, err := service.CreatePlaylist(userID, models.CreatePlaylistRequest{Name: "Road Trip"})
+	require.NoError(t, err)
+
+	other, err := authService.RegisterUser(models.RegisterRequest{
+		Username: "otheruser",
+		Email:    "other@test.com",
+		Password: "Passw0rd-123",
+	}, "127.0.0.1")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		userID    int
+		playlist  string
+		available bool
+	}{
+		{"free name", userID, "Workout", true},
+		{"taken name", userID, "Road Trip", false},
+		{"collides after trimming", userID, "  Road Trip\t", false},
+		{"names are per user", other.ID, "Road Trip", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			available, err := service.NameAvailable(tt.userID, tt.playlist)
+			require.NoError(t, err)
+			assert.Equal(t, tt.available, available)
+		})
+	}
+
+	_, err = service.NameAvailable(userID, "   ")
+	assert.Error(t, err, "names create would reject are reported as invalid")
+}
+
 func TestGetUserPlaylists(t *testing.T) {
 	service, _, userID, cleanup := setupTestPlaylistService(t)
 	defer cleanup()
@@ -101,8 +171,9 @@ func TestGetUserPlaylists(t *testing.T) {
 	service.CreatePlaylist(userID, models.CreatePlaylistRequest{Name: "Playlist 1"})
 	service.CreatePlaylist(userID, models.CreatePlaylistRequest{Name: "Playlist 2"})
 
-	playlists, err := service.GetUserPlaylists(userID)
+	page, err := service.GetUserPlaylists(userID, 50, 0)
 	require.NoError(t, err)
+	playlists := page.Items
 	assert.Len(t, playlists, 2)
 	assert.Equal(t, "Playlist 1", playlists[1].Name)
 	assert.Equal(t, "Playlist 2", playlists[0].Name)
@@ -344,4 +415,622 @@ func TestGetPlaylistSongs(t *testing.T) {
 // Helper function
 func stringPtr(s string) *string {
 	return &s
-}
\ No newline at end of file
+}
+func TestPlaylistTotals(t *testing.T) {
+	service, _, userID, cleanup := setupTestPlaylistService(t)
+	defer cleanup()
+
+	playlist, err := service.CreatePlaylist(userID, models.CreatePlaylistRequest{Name: "Totals"})
+	require.NoError(t, err)
+	_, err = service.CreatePlaylist(userID, models.CreatePlaylistRequest{Name: "Empty"})
+	require.NoError(t, err)
+
+	// An upload without a known duration counts as a song but adds no time
+	result, err := service.db.Exec(`INSERT INTO songs (title, artist_id, file_path, format) VALUES ('No Duration', 1, 'u.mp3', 'mp3')`)
+	require.NoError(t, err)
+	unknownID, _ := result.LastInsertId()
+
+	for _, songID := range []int{1, 2, 3, int(unknownID)} {
+		require.NoError(t, service.AddSong(playlist.ID, songID, userID))
+	}
+	_, err = service.db.Exec(`UPDATE songs SET deleted_at = CURRENT_TIMESTAMP WHERE id = 3`)
+	require.NoError(t, err)
+
+	page, err := service.GetUserPlaylists(userID, 50, 0)
+	require.NoError(t, err)
+	require.Len(t, page.Items, 2)
+	assert.Equal(t, "Empty", page.Items[0].Name)
+	assert.Equal(t, 0, page.Items[0].SongCount)
+	assert.Equal(t, 0, page.Items[0].TotalDurationSeconds)
+	assert.Equal(t, 3, page.Items[1].SongCount)
+	assert.Equal(t, 2*180, page.Items[1].TotalDurationSeconds)
+
+	// The detail view lists the same songs
+	songs, err := service.GetPlaylistSongs(playlist.ID)
+	require.NoError(t, err)
+	assert.Len(t, songs, 3)
+}
+
+func TestGetUserPlaylistsPagination(t *testing.T) {
+	service, _, userID, cleanup := setupTestPlaylistService(t)
+	defer cleanup()
+
+	for _, name := range []string{"One", "Two", "Three"} {
+		_, err := service.CreatePlaylist(userID, models.CreatePlaylistRequest{Name: name})
+		require.NoError(t, err)
+	}
+
+	page, err := service.GetUserPlaylists(userID, 1, 1)
+	require.NoError(t, err)
+	assert.Len(t, page.Items, 1)
+	assert.Equal(t, 3, page.Meta.Total)
+	assert.Equal(t, 1, page.Meta.Offset)
+	assert.True(t, page.Meta.HasMore)
+}
+
+func TestCreatePlaylistNormalizesName(t *testing.T) {
+	service, _, userID, cleanup := setupTestPlaylistService(t)
+	defer cleanup()
+
+	playlist, err := service.CreatePlaylist(userID, models.CreatePlaylistRequest{Name: "  Road Trip  "})
+	require.NoError(t, err)
+	assert.Equal(t, "Road Trip", playlist.Name)
+
+	atLimit := strings.Repeat("é", maxPlaylistNameLength)
+	_, err = service.CreatePlaylist(userID, models.CreatePlaylistRequest{Name: atLimit})
+	require.NoError(t, err, "the limit counts characters, not bytes")
+
+	tests := []struct {
+		name      string
+		input     string
+		errorMsg  string
+		errorCode string
+	}{
+		{"Whitespace only", " \t  ", "playlist name cannot be only whitespace", apperrors.ErrCodeValidation},
+		{"Over length", strings.Repeat("a", maxPlaylistNameLength+1), "playlist name must be at most 100 characters", apperrors.ErrCodeValidation},
+		{"Trims to a duplicate", "Road Trip ", "Playlist already exists", apperrors.ErrCodeConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.CreatePlaylist(userID, models.CreatePlaylistRequest{Name: tt.input})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errorMsg)
+			if appErr := apperrors.GetAppError(err); assert.NotNil(t, appErr) {
+				assert.Equal(t, tt.errorCode, appErr.Code)
+			}
+		})
+	}
+
+	_, err = service.ClonePlaylist(playlist.ID, userID, "   ")
+	assert.Error(t, err, "clone names are validated too")
+	clone, err := service.ClonePlaylist(playlist.ID, userID, " Road Trip II ")
+	require.NoError(t, err)
+	assert.Equal(t, "Road Trip II", clone.Name)
+}
+
+func TestClonePlaylist(t *testing.T) {
+	service, authService, userID, cleanup := setupTestPlaylistService(t)
+	defer cleanup()
+
+	source, err := service.CreatePlaylist(userID, models.CreatePlaylistRequest{Name: "Road Trip"})
+	require.NoError(t, err)
+
+	// Add songs out of ID order so the copy has to preserve queue order
+	for _, songID := range []int{3, 1, 2} {
+		require.NoError(t, service.AddSong(source.ID, songID, userID))
+	}
+
+	songIDs := func(playlistID int) []int {
+		songs, err := service.GetPlaylistSongs(playlistID)
+		require.NoError(t, err)
+		var ids []int
+		for _, ps := range songs {
+			ids = append(ids, ps.SongID)
+		}
+		return ids
+	}
+
+	t.Run("Owned playlist keeps song order", func(t *testing.T) {
+		clone, err := service.ClonePlaylist(source.ID, userID, "")
+		require.NoError(t, err)
+		assert.NotEqual(t, source.ID, clone.ID)
+		assert.Equal(t, "Road Trip (copy)", clone.Name)
+		assert.Equal(t, []int{3, 1, 2}, songIDs(clone.ID))
+	})
+
+	t.Run("Name collisions get a numbered copy", func(t *testing.T) {
+		clone, err := service.ClonePlaylist(source.ID, userID, "")
+		require.NoError(t, err)
+		assert.Equal(t, "Road Trip (copy 2)", clone.Name)
+
+		named, err := service.ClonePlaylist(source.ID, userID, "Snapshot")
+		require.NoError(t, err)
+		assert.Equal(t, "Snapshot", named.Name)
+	})
+
+	t.Run("Copy names of a full length name stay within the limit", func(t *testing.T) {
+		long, err := service.CreatePlaylist(userID, models.CreatePlaylistRequest{Name: strings.Repeat("é", maxPlaylistNameLength)})
+		require.NoError(t, err)
+
+		first, err := service.ClonePlaylist(long.ID, userID, "")
+		require.NoError(t, err)
+		assert.Equal(t, strings.Repeat("é", maxPlaylistNameLength-7)+" (copy)", first.Name)
+
+		second, err := service.ClonePlaylist(long.ID, userID, "")
+		require.NoError(t, err)
+		assert.Equal(t, strings.Repeat("é", maxPlaylistNameLength-9)+" (copy 2)", second.Name)
+	})
+
+	other, err := authService.RegisterUser(models.RegisterRequest{
+		Username: "otheruser",
+		Email:    "other@test.com",
+		Password: "Passw0rd-123",
+	}, "127.0.0.1")
+	require.NoError(t, err)
+
+	t.Run("Private playlist of another user", func(t *testing.T) {
+		_, err := service.ClonePlaylist(source.ID, other.ID, "")
+		assert.EqualError(t, err, "no playlist found")
+	})
+
+	t.Run("Public playlist of another user", func(t *testing.T) {
+		public, err := service.CreatePlaylist(userID, models.CreatePlaylistRequest{Name: "Shared", IsPublic: true})
+		require.NoError(t, err)
+		require.NoError(t, service.AddSong(public.ID, 2, userID))
+
+		clone, err := service.ClonePlaylist(public.ID, other.ID, "")
+		require.NoError(t, err)
+		assert.Equal(t, other.ID, clone.UserID)
+		assert.Equal(t, "Shared", clone.Name)
+		assert.False(t, clone.IsPublic)
+		assert.Equal(t, []int{2}, songIDs(clone.ID))
+	})
+}
+
+func TestPlaylistCollaborators(t *testing.T) {
+	service, authService, ownerID, cleanup := setupTestPlaylistService(t)
+	defer cleanup()
+
+	register := func(username string) int {
+		user, err := authService.RegisterUser(models.RegisterRequest{
+			Username: username,
+			Email:    username + "@test.com",
+			Password: "Passw0rd-123",
+		}, "127.0.0.1")
+		require.NoError(t, err)
+		return user.ID
+	}
+	editorID := register("editoruser")
+	viewerID := register("vieweruser")
+	strangerID := register("strangeruser")
+
+	playlist, err := service.CreatePlaylist(ownerID, models.CreatePlaylistRequest{Name: "Group Mix"})
+	require.NoError(t, err)
+
+	_, err = service.AddCollaborator(playlist.ID, ownerID, "editoruser", "")
+	require.NoError(t, err)
+	_, err = service.AddCollaborator(playlist.ID, ownerID, "vieweruser", models.CollaboratorRoleViewer)
+	require.NoError(t, err)
+
+	t.Run("Editor can add and remove songs", func(t *testing.T) {
+		require.NoError(t, service.AddSong(playlist.ID, 1, editorID))
+		require.NoError(t, service.AddSong(playlist.ID, 2, editorID))
+		require.NoError(t, service.RemoveSong(playlist.ID, 2, editorID))
+
+		songs, err := service.GetPlaylistSongs(playlist.ID)
+		require.NoError(t, err)
+		assert.Len(t, songs, 1)
+	})
+
+	t.Run("Editor cannot delete the playlist", func(t *testing.T) {
+		assert.Error(t, service.DeletePlaylist(playlist.ID, editorID))
+
+		_, err := service.GetPlaylistByID(playlist.ID, ownerID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Editor cannot invite others", func(t *testing.T) {
+		_, err := service.AddCollaborator(playlist.ID, editorID, "strangeruser", "")
+		assert.EqualError(t, err, "unauthorized")
+	})
+
+	t.Run("Viewer can read but not edit", func(t *testing.T) {
+		_, err := service.GetPlaylistByID(playlist.ID, viewerID)
+		assert.NoError(t, err)
+		assert.EqualError(t, service.AddSong(playlist.ID, 3, viewerID), "unauthorized")
+	})
+
+	t.Run("Stranger has no access", func(t *testing.T) {
+		_, err := service.GetPlaylistByID(playlist.ID, strangerID)
+		assert.Error(t, err)
+		assert.EqualError(t, service.AddSong(playlist.ID, 3, strangerID), "unauthorized")
+	})
+
+	t.Run("Invalid invitations", func(t *testing.T) {
+		_, err := service.AddCollaborator(playlist.ID, ownerID, "nobody", "")
+		assert.EqualError(t, err, "user not found")
+
+		_, err = service.AddCollaborator(playlist.ID, ownerID, "strangeruser", "admin")
+		assert.Error(t, err)
+	})
+
+	t.Run("Removed editor loses access", func(t *testing.T) {
+		require.NoError(t, service.RemoveCollaborator(playlist.ID, ownerID, editorID))
+		assert.EqualError(t, service.AddSong(playlist.ID, 3, editorID), "unauthorized")
+
+		assert.EqualError(t, service.RemoveCollaborator(playlist.ID, ownerID, editorID), "collaborator not found")
+	})
+
+	t.Run("Collaborator can leave", func(t *testing.T) {
+		assert.NoError(t, service.RemoveCollaborator(playlist.ID, viewerID, viewerID))
+	})
+}
+
+func TestGetSongContext(t *testing.T) {
+	service, _, userID, cleanup := setupTestPlaylistService(t)
+	defer cleanup()
+
+	playlist, err := service.CreatePlaylist(userID, models.CreatePlaylistRequest{Name: "Context"})
+	require.NoError(t, err)
+	for _, songID := range []int{3, 1, 2} {
+		require.NoError(t, service.AddSong(playlist.ID, songID, userID))
+	}
+
+	tests := []struct {
+		name           string
+		songID         int
+		index          int
+		prevID, nextID int // 0 means none
+	}{
+		{"First song", 3, 0, 0, 1},
+		{"Middle song", 1, 1, 3, 2},
+		{"Last song", 2, 2, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index, prev, next, err := service.GetSongContext(playlist.ID, tt.songID)
+			require.NoError(t, err)
+			assert.Equal(t, tt.index, index)
+			if tt.prevID == 0 {
+				assert.Nil(t, prev)
+			} else if assert.NotNil(t, prev) {
+				assert.Equal(t, tt.prevID, prev.ID)
+			}
+			if tt.nextID == 0 {
+				assert.Nil(t, next)
+			} else if assert.NotNil(t, next) {
+				assert.Equal(t, tt.nextID, next.ID)
+			}
+		})
+	}
+
+	require.NoError(t, service.RemoveSong(playlist.ID, 1, userID))
+	_, _, _, err = service.GetSongContext(playlist.ID, 1)
+	require.Error(t, err)
+	if appErr := apperrors.GetAppError(err); assert.NotNil(t, appErr) {
+		assert.Equal(t, apperrors.ErrCodeNotFound, appErr.Code)
+	}
+}
+
+func TestPlaylistSongLimit(t *testing.T) {
+	service, _, userID, cleanup := setupTestPlaylistService(t)
+	defer cleanup()
+	service.SetMaxSongs(2)
+
+	playlist, err := service.CreatePlaylist(userID, models.CreatePlaylistRequest{Name: "Tiny"})
+	require.NoError(t, err)
+
+	require.NoError(t, service.AddSong(playlist.ID, 1, userID))
+	require.NoError(t, service.AddSong(playlist.ID, 2, userID))
+
+	err = service.AddSong(playlist.ID, 3, userID)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "playlist is full")
+	assert.Equal(t, 2, countRows(t, service.db, "playlist_songs"))
+}
+
+func TestAddSongsRespectsLimit(t *testing.T) {
+	service, _, userID, cleanup := setupTestPlaylistService(t)
+	defer cleanup()
+	service.SetMaxSongs(3)
+
+	playlist, err := service.CreatePlaylist(userID, models.CreatePlaylistRequest{Name: "Batch"})
+	require.NoError(t, err)
+	require.NoError(t, service.AddSong(playlist.ID, 1, userID))
+
+	// Seeded songs are 1-3
+	inserted, err := service.db.Exec(`INSERT INTO songs (title, artist_id, file_path, format) VALUES ('Fourth', 1, '/test/song.mp3', 'mp3')`)
+	require.NoError(t, err)
+	fourth, _ := inserted.LastInsertId()
+
+	result, err := service.AddSongs(playlist.ID, []int{1, 3, 99999, 3, 2, int(fourth)}, userID)
+	require.NoError(t, err)
+	assert.Equal(t, []int{3, 2}, result.Added, "adds in request order up to the limit")
+	assert.Equal(t, []models.SkippedSong{
+		{SongID: 1, Reason: SkipReasonDuplicate},
+		{SongID: 99999, Reason: SkipReasonNotFound},
+		{SongID: 3, Reason: SkipReasonDuplicate},
+		{SongID: int(fourth), Reason: SkipReasonFull},
+	}, result.Skipped)
+
+	songs, err := service.GetPlaylistSongs(playlist.ID)
+	require.NoError(t, err)
+	var ids []int
+	for _, ps := range songs {
+		ids = append(ids, ps.SongID)
+	}
+	assert.Equal(t, []int{1, 3, 2}, ids)
+
+	result, err = service.AddSongs(playlist.ID, []int{99999}, userID)
+	require.NoError(t, err)
+	assert.Empty(t, result.Added)
+}
+
+func TestPlaylistVersionConflicts(t *testing.T) {
+	service, _, userID, cleanup := setupTestPlaylistService(t)
+	defer cleanup()
+
+	playlist, err := service.CreatePlaylist(userID, models.CreatePlaylistRequest{Name: "Shared Edit"})
+	require.NoError(t, err)
+	for _, songID := range []int{1, 2, 3} {
+		require.NoError(t, service.AddSong(playlist.ID, songID, userID))
+	}
+
+	read, err := service.GetPlaylistByID(playlist.ID, userID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, read.Version, "every mutation moves the version on")
+
+	t.Run("Reorder at the current version succeeds", func(t *testing.T) {
+		version, err := service.ReorderSongs(playlist.ID, userID, models.ReorderSongsRequest{
+			SongIDs: []int{3, 1, 2}, Version: read.Version,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, read.Version+1, version)
+
+		songs, err := service.GetPlaylistSongs(playlist.ID)
+		require.NoError(t, err)
+		var ids []int
+		for _, ps := range songs {
+			ids = append(ids, ps.SongID)
+		}
+		assert.Equal(t, []int{3, 1, 2}, ids)
+	})
+
+	t.Run("Stale version is rejected", func(t *testing.T) {
+		_, err := service.ReorderSongs(playlist.ID, userID, models.ReorderSongsRequest{
+			SongIDs: []int{1, 2, 3}, Version: read.Version,
+		})
+		require.Error(t, err)
+		appErr := apperrors.GetAppError(err)
+		require.NotNil(t, appErr)
+		assert.Equal(t, 409, appErr.StatusCode)
+
+		name := "Overwritten"
+		_, err = service.UpdatePlaylist(playlist.ID, userID, models.UpdatePlaylistRequest{Name: &name, Version: read.Version})
+		assert.Equal(t, errStaleVersion, err)
+
+		current, err := service.GetPlaylistByID(playlist.ID, userID)
+		require.NoError(t, err)
+		assert.Equal(t, "Shared Edit", current.Name)
+	})
+
+	t.Run("Refetched version succeeds", func(t *testing.T) {
+		current, err := service.GetPlaylistByID(playlist.ID, userID)
+		require.NoError(t, err)
+
+		name := "  Renamed  "
+		public := true
+		updated, err := service.UpdatePlaylist(playlist.ID, userID, models.UpdatePlaylistRequest{
+			Name: &name, IsPublic: &public, Version: current.Version,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "Renamed", updated.Name)
+		assert.True(t, updated.IsPublic)
+		assert.Equal(t, current.Version+1, updated.Version)
+	})
+
+	t.Run("Reorder must list every song once", func(t *testing.T) {
+		current, err := service.GetPlaylistByID(playlist.ID, userID)
+		require.NoError(t, err)
+		for _, songIDs := range [][]int{{1, 2}, {1, 1, 2}, {1, 2, 99999}} {
+			_, err := service.ReorderSongs(playlist.ID, userID, models.ReorderSongsRequest{
+				SongIDs: songIDs, Version: current.Version,
+			})
+			assert.Error(t, err, songIDs)
+		}
+		again, err := service.GetPlaylistByID(playlist.ID, userID)
+		require.NoError(t, err)
+		assert.Equal(t, current.Version, again.Version, "a rejected reorder changes nothing")
+	})
+}
+
+func TestClearPlaylist(t *testing.T) {
+	service, authService, userID, cleanup := setupTestPlaylistService(t)
+	defer cleanup()
+
+	other, err := authService.RegisterUser(models.RegisterRequest{
+		Username: "otherlistener",
+		Email:    "otherlistener@test.com",
+		Password: "Passw0rd-123",
+	}, "127.0.0.1")
+	require.NoError(t, err)
+
+	playlist, err := service.CreatePlaylist(userID, models.CreatePlaylistRequest{Name: "Spring Clean"})
+	require.NoError(t, err)
+	for _, songID := range []int{1, 2, 3} {
+		require.NoError(t, service.AddSong(playlist.ID, songID, userID))
+	}
+	before, err := service.GetPlaylistByID(playlist.ID, userID)
+	require.NoError(t, err)
+
+	for _, requester := range []struct {
+		name       string
+		playlistID int
+		userID     int
+	}{
+		{"another user's playlist", playlist.ID, other.ID},
+		{"missing playlist", 99999, userID},
+	} {
+		_, err := service.ClearPlaylist(requester.playlistID, requester.userID)
+		require.Error(t, err, requester.name)
+		appErr := apperrors.GetAppError(err)
+		require.NotNil(t, appErr)
+		assert.Equal(t, 404, appErr.StatusCode, requester.name)
+	}
+	songs, err := service.GetPlaylistSongs(playlist.ID)
+	require.NoError(t, err)
+	assert.Len(t, songs, 3, "a refused clear removes nothing")
+
+	removed, err := service.ClearPlaylist(playlist.ID, userID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, removed)
+
+	after, err := service.GetPlaylistByID(playlist.ID, userID)
+	require.NoError(t, err, "the playlist itself is kept")
+	assert.Equal(t, "Spring Clean", after.Name)
+	assert.Equal(t, before.Version+1, after.Version)
+	songs, err = service.GetPlaylistSongs(playlist.ID)
+	require.NoError(t, err)
+	assert.Empty(t, songs)
+
+	removed, err = service.ClearPlaylist(playlist.ID, userID)
+	require.NoError(t, err)
+	assert.Zero(t, removed, "clearing an empty playlist is a no-op")
+}
+
+func TestFeaturedPlaylists(t *testing.T) {
+	service, authService, adminID, cleanup := setupTestPlaylistService(t)
+	defer cleanup()
+	admin := NewAdminService(service.db, t.TempDir())
+	_, err := service.db.Exec(`UPDATE users SET is_admin = 1 WHERE id = ?`, adminID)
+	require.NoError(t, err)
+
+	listener, err := authService.RegisterUser(models.RegisterRequest{
+		Username: "casualfan",
+		Email:    "casualfan@test.com",
+		Password: "Passw0rd-123",
+	}, "127.0.0.1")
+	require.NoError(t, err)
+
+	// Featured playlists are shown even when they aren't public
+	picks, err := service.CreatePlaylist(adminID, models.CreatePlaylistRequest{Name: "Staff Picks"})
+	require.NoError(t, err)
+	require.NoError(t, service.AddSong(picks.ID, 2, adminID))
+	require.NoError(t, service.AddSong(picks.ID, 1, adminID))
+	_, err = service.CreatePlaylist(adminID, models.CreatePlaylistRequest{Name: "Drafts"})
+	require.NoError(t, err)
+	mine, err := service.CreatePlaylist(listener.ID, models.CreatePlaylistRequest{Name: "Mine", IsPublic: true})
+	require.NoError(t, err)
+
+	featured, err := service.GetFeaturedPlaylists()
+	require.NoError(t, err)
+	assert.Empty(t, featured)
+
+	require.NoError(t, admin.SetFeatured(picks.ID, true))
+	err = admin.SetFeatured(mine.ID, true)
+	require.Error(t, err, "only an admin's playlist can be featured")
+	assert.Equal(t, 400, apperrors.GetAppError(err).StatusCode)
+	err = admin.SetFeatured(99999, true)
+	require.Error(t, err)
+	assert.Equal(t, 404, apperrors.GetAppError(err).StatusCode)
+
+	featured, err = service.GetFeaturedPlaylists()
+	require.NoError(t, err)
+	require.Len(t, featured, 1)
+	assert.Equal(t, "Staff Picks", featured[0].Name)
+	require.Len(t, featured[0].Songs, 2)
+	assert.Equal(t, 2, featured[0].Songs[0].SongID)
+	assert.Equal(t, 1, featured[0].Songs[1].SongID)
+	assert.Equal(t, 2, featured[0].SongCount)
+	assert.Equal(t, 360, featured[0].TotalDurationSeconds)
+
+	// A playlist stops being featured when its owner loses admin rights
+	require.NoError(t, admin.SetAdmin(adminID, false))
+	featured, err = service.GetFeaturedPlaylists()
+	require.NoError(t, err)
+	assert.Empty(t, featured)
+
+	require.NoError(t, admin.SetAdmin(adminID, true))
+	require.NoError(t, admin.SetFeatured(picks.ID, false))
+	featured, err = service.GetFeaturedPlaylists()
+	require.NoError(t, err)
+	assert.Empty(t, featured)
+}
+
+func TestMoveSong(t *testing.T) {
+	service, _, userID, cleanup := setupTestPlaylistService(t)
+	defer cleanup()
+
+	from, err := service.CreatePlaylist(userID, models.CreatePlaylistRequest{Name: "Inbox"})
+	require.NoError(t, err)
+	to, err := service.CreatePlaylist(userID, models.CreatePlaylistRequest{Name: "Keepers"})
+	require.NoError(t, err)
+	for _, songID := range []int{1, 2, 3} {
+		require.NoError(t, service.AddSong(from.ID, songID, userID))
+	}
+	require.NoError(t, service.AddSong(to.ID, 3, userID))
+
+	songIDs := func(playlistID int) []int {
+		songs, err := service.GetPlaylistSongs(playlistID)
+		require.NoError(t, err)
+		ids := []int{}
+		for _, ps := range songs {
+			ids = append(ids, ps.SongID)
+		}
+		return ids
+	}
+
+	require.NoError(t, service.MoveSong(1, from.ID, to.ID, userID))
+	assert.Equal(t, []int{2, 3}, songIDs(from.ID))
+	assert.Equal(t, []int{3, 1}, songIDs(to.ID), "moved songs go to the end of the queue")
+
+	// A song the destination already has is just taken out of the source
+	require.NoError(t, service.MoveSong(3, from.ID, to.ID, userID))
+	assert.Equal(t, []int{2}, songIDs(from.ID))
+	assert.Equal(t, []int{3, 1}, songIDs(to.ID))
+
+	err = service.MoveSong(1, from.ID, to.ID, userID)
+	require.Error(t, err, "the song is no longer in the source")
+	assert.Equal(t, 404, apperrors.GetAppError(err).StatusCode)
+	assert.Error(t, service.MoveSong(2, from.ID, from.ID, userID))
+}
+
+func TestMoveSongRequiresOwnership(t *testing.T) {
+	service, authService, userID, cleanup := setupTestPlaylistService(t)
+	defer cleanup()
+
+	other, err := authService.RegisterUser(models.RegisterRequest{
+		Username: "neighbour",
+		Email:    "neighbour@test.com",
+		Password: "Passw0rd-123",
+	}, "127.0.0.1")
+	require.NoError(t, err)
+
+	mine, err := service.CreatePlaylist(userID, models.CreatePlaylistRequest{Name: "Mine"})
+	require.NoError(t, err)
+	require.NoError(t, service.AddSong(mine.ID, 1, userID))
+	theirs, err := service.CreatePlaylist(other.ID, models.CreatePlaylistRequest{Name: "Theirs"})
+	require.NoError(t, err)
+	require.NoError(t, service.AddSong(theirs.ID, 2, other.ID))
+
+	// Even an editor can't move songs in or out of someone else's playlist
+	_, err = service.AddCollaborator(theirs.ID, other.ID, "playlistuser", models.CollaboratorRoleEditor)
+	require.NoError(t, err)
+
+	err = service.MoveSong(1, mine.ID, theirs.ID, userID)
+	require.Error(t, err)
+	assert.Equal(t, 403, apperrors.GetAppError(err).StatusCode)
+	err = service.MoveSong(2, theirs.ID, mine.ID, userID)
+	require.Error(t, err)
+	assert.Equal(t, 403, apperrors.GetAppError(err).StatusCode)
+	err = service.MoveSong(1, mine.ID, 99999, userID)
+	require.Error(t, err)
+	assert.Equal(t, 404, apperrors.GetAppError(err).StatusCode)
+
+	songs, err := service.GetPlaylistSongs(mine.ID)
+	require.NoError(t, err)
+	assert.Len(t, songs, 1, "a refused move changes nothing")
+	songs, err = service.GetPlaylistSongs(theirs.ID)
+	require.NoError(t, err)
+	assert.Len(t, songs, 1)
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+	// Registers the WebP decoder with image.Decode
+	_ "golang.org/x/image/webp"
+)
+
+// Square sizes, in pixels, stored alongside each profile picture
+const (
+	profileImageMediumSize = 256
+	profileImageThumbSize  = 64
+)
+
+// profileImageSizes holds the files written next to a profile picture,
+// relative to the same directory
+type profileImageSizes struct {
+	medium, thumb string
+}
+
+// writeProfileImageSizes decodes the picture at originalPath and writes
+// center-cropped square copies at the medium and thumbnail sizes beside it,
+// named after the original. Images smaller than a size are not enlarged.
+// JPEGs stay JPEG; everything else is written as PNG to keep transparency.
+// Formats without a decoder (AVIF) return an error and get no copies
+func writeProfileImageSizes(originalPath string) (*profileImageSizes, error) {
+	file, err := os.Open(originalPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, format, err := image.Decode(file)
+	if err != nil {
+		return nil, err
+	}
+
+	ext := ".png"
+	if format == "jpeg" {
+		ext = ".jpg"
+	}
+	base := strings.TrimSuffix(originalPath, filepath.Ext(originalPath))
+
+	sizes := &profileImageSizes{}
+	for _, size := range []struct {
+		pixels int
+		name   *string
+	}{
+		{profileImageMediumSize, &sizes.medium},
+		{profileImageThumbSize, &sizes.thumb},
+	} {
+		path := base + "_" + strconv.Itoa(size.pixels) + ext
+		if err := writeSquare(path, img, size.pixels, format == "jpeg"); err != nil {
+			sizes.remove(filepath.Dir(originalPath))
+			return nil, err
+		}
+		*size.name = filepath.Base(path)
+	}
+	return sizes, nil
+}
+
+// writeSquare scales the centered square of img to at most pixels wide
+func writeSquare(path string, img image.Image, pixels int, asJPEG bool) error {
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	crop := image.Rect(0, 0, side, side).Add(image.Pt(
+		bounds.Min.X+(bounds.Dx()-side)/2,
+		bounds.Min.Y+(bounds.Dy()-side)/2,
+	))
+
+	pixels = min(pixels, side)
+	scaled := image.NewRGBA(image.Rect(0, 0, pixels, pixels))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), img, crop, draw.Src, nil)
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if asJPEG {
+		err = jpeg.Encode(out, scaled, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(out, scaled)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// remove deletes whichever of the copies were written to dir
+func (p *profileImageSizes) remove(dir string) {
+	for _, name := range []string{p.medium, p.thumb} {
+		if name != "" {
+			os.Remove(filepath.Join(dir, name))
+		}
+	}
+}
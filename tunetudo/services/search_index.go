@@ -0,0 +1,46 @@
+package services
+
+import (
+	"tunetudo/logger"
+)
+
+// populateSearchIndex fills songs_fts with every catalog song
+const populateSearchIndex = `
+	INSERT INTO songs_fts (song_id, title, artist_name, album_title, category_name)
+	SELECT s.id, s.title, COALESCE(a.name, ''), COALESCE(al.title, ''), COALESCE(c.name, '')
+	FROM songs s
+	LEFT JOIN artists a ON s.artist_id = a.id
+	LEFT JOIN albums al ON s.album_id = al.id
+	LEFT JOIN categories c ON s.category_id = c.id
+	WHERE ` + catalogSongs
+
+// RebuildSearchIndex replaces the contents of songs_fts with the current
+// catalog, for when songs were imported or edited outside the app. Searches
+// keep seeing the old index until the rebuild commits
+func (s *AdminService) RebuildSearchIndex() (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		logger.Error(logger.CategoryDB, "Failed to begin search index rebuild", err)
+		return 0, internalError("failed to rebuild search index", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM songs_fts`); err != nil {
+		logger.Error(logger.CategoryDB, "Failed to clear search index", err)
+		return 0, internalError("failed to rebuild search index", err)
+	}
+	result, err := tx.Exec(populateSearchIndex)
+	if err != nil {
+		logger.Error(logger.CategoryDB, "Failed to populate search index", err)
+		return 0, internalError("failed to rebuild search index", err)
+	}
+	indexed, _ := result.RowsAffected()
+
+	if err := tx.Commit(); err != nil {
+		logger.Error(logger.CategoryDB, "Failed to commit search index rebuild", err)
+		return 0, internalError("failed to rebuild search index", err)
+	}
+
+	logger.Info(logger.CategoryDB, "Search index rebuilt: %d songs", indexed)
+	return int(indexed), nil
+}
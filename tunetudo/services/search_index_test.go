@@ -0,0 +1,57 @@
+package services
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// matchSongIDs runs an index query the way a full-text search would
+func matchSongIDs(t *testing.T, db *sql.DB, query string) []int {
+	rows, err := db.Query(`SELECT song_id FROM songs_fts WHERE songs_fts MATCH ? ORDER BY song_id`, query)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		require.NoError(t, rows.Scan(&id))
+		ids = append(ids, id)
+	}
+	require.NoError(t, rows.Err())
+	return ids
+}
+
+func TestRebuildSearchIndex(t *testing.T) {
+	service, _, cleanup := setupTestAdminService(t)
+	defer cleanup()
+	seedTestData(t, service.db)
+
+	// Uploads through the service keep the index current
+	song, err := service.UploadSong(newTestFileHeader(t, "track.mp3", []byte("fake mp3 data")),
+		"Harbour Lights", "Coastal", "Tides", 2, 200, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int{song.ID}, matchSongIDs(t, service.db, "harbour"))
+
+	// Drift: the index loses every row and picks up one for a song that
+	// no longer exists, and one seeded song is trashed
+	_, err = service.db.Exec(`DELETE FROM songs_fts`)
+	require.NoError(t, err)
+	_, err = service.db.Exec(`INSERT INTO songs_fts (song_id, title) VALUES (9999, 'Ghost Track')`)
+	require.NoError(t, err)
+	_, err = service.db.Exec(`UPDATE songs SET deleted_at = CURRENT_TIMESTAMP WHERE title = 'Test Song 3'`)
+	require.NoError(t, err)
+	assert.Empty(t, matchSongIDs(t, service.db, "harbour"))
+
+	indexed, err := service.RebuildSearchIndex()
+	require.NoError(t, err)
+	assert.Equal(t, 3, indexed, "two live seeded songs and the upload")
+
+	assert.Equal(t, []int{song.ID}, matchSongIDs(t, service.db, "harbour"))
+	assert.Equal(t, []int{song.ID}, matchSongIDs(t, service.db, "artist_name:coastal"))
+	assert.Len(t, matchSongIDs(t, service.db, "test song"), 2)
+	assert.Empty(t, matchSongIDs(t, service.db, "ghost"))
+	assert.Equal(t, 3, countRows(t, service.db, "songs_fts"))
+}
@@ -2,67 +2,210 @@ package services
 
 import (
 	"database/sql"
+	"fmt"
 	"strings"
+	"time"
+	"unicode/utf8"
+	apperrors "tunetudo/errors"
 	"tunetudo/models"
 )
 
+// defaultCategoryCacheTTL is how long the category list is served from
+// memory unless SetCategoryCacheTTL says otherwise
+const defaultCategoryCacheTTL = 5 * time.Minute
+
+// Bounds on the length of a search query, in characters, unless
+// SetQueryLengths says otherwise. A single letter matches nearly every
+// song, so it is refused rather than searched
+const (
+	defaultMinSearchLength = 2
+	defaultMaxSearchLength = 200
+)
+
 type SearchService struct {
-	db *sql.DB
+	db             *sql.DB
+	categories     *ttlCache[[]models.Category]
+	minQueryLength int
+	maxQueryLength int
 }
 
 func NewSearchService(db *sql.DB) *SearchService {
-	return &SearchService{db: db}
+	return &SearchService{
+		db:             db,
+		categories:     newTTLCache[[]models.Category](defaultCategoryCacheTTL),
+		minQueryLength: defaultMinSearchLength,
+		maxQueryLength: defaultMaxSearchLength,
+	}
+}
+
+// SetQueryLengths sets the shortest and longest search query accepted;
+// values that aren't positive keep the current bound
+func (s *SearchService) SetQueryLengths(min, max int) {
+	if min > 0 {
+		s.minQueryLength = min
+	}
+	if max > 0 {
+		s.maxQueryLength = max
+	}
+}
+
+// SetCategoryCacheTTL sets how long the category list is cached; zero
+// turns caching off
+func (s *SearchService) SetCategoryCacheTTL(ttl time.Duration) {
+	s.categories = newTTLCache[[]models.Category](ttl)
 }
 
-// FullTextSearch performs comprehensive search across songs, artists, and albums
-func (s *SearchService) FullTextSearch(query string) (*models.SearchResult, error) {
+// InvalidateCategories drops the cached category list. Anything that
+// changes the categories table must call it
+func (s *SearchService) InvalidateCategories() {
+	s.categories.Invalidate()
+}
+
+// Search match modes. With SearchMatchAll every word of the query must
+// appear in one of the searched fields; SearchMatchAny needs just one
+const (
+	SearchMatchAll = "all"
+	SearchMatchAny = "any"
+)
+
+// maxSearchTokens caps how many words of a query are searched for, which
+// bounds the number of LIKE clauses a single request can generate
+const maxSearchTokens = 10
+
+// FullTextSearch performs comprehensive search across songs, artists, and albums.
+// The query is split into words, combined according to match (SearchMatchAll
+// when empty). limit and offset page through the song matches; safe leaves
+// out explicit songs. An empty or whitespace-only query finds nothing, and
+// one outside the configured lengths is a validation error
+func (s *SearchService) FullTextSearch(query string, limit, offset int, match string, safe bool) (*models.SearchResult, error) {
 	result := &models.SearchResult{
-		Songs:     []models.Song{},
+		Songs:     models.NewPaginated([]models.Song{}, 0, limit, offset),
 		Artists:   []models.Artist{},
 		Albums:    []models.Album{},
 		Playlists: []models.Playlist{},
 	}
 
+	if match == "" {
+		match = SearchMatchAll
+	}
+	if match != SearchMatchAll && match != SearchMatchAny {
+		return nil, apperrors.ValidationError("match must be one of all, any", nil)
+	}
+
+	query = strings.TrimSpace(query)
 	if query == "" {
 		return result, nil
 	}
+	if length := utf8.RuneCountInString(query); length < s.minQueryLength {
+		return nil, apperrors.ValidationError("search term too short", nil)
+	} else if length > s.maxQueryLength {
+		return nil, apperrors.ValidationError(
+			fmt.Sprintf("search term too long. Maximum length is %d characters", s.maxQueryLength), nil)
+	}
 
-	searchTerm := "%" + strings.ToLower(query) + "%"
+	tokens := searchTokens(query)
+	if len(tokens) == 0 {
+		return result, nil
+	}
+	terms := &searchTerms{tokens: tokens, any: match == SearchMatchAny}
 
-	// Search songs
-	songs, err := s.searchSongs(searchTerm)
-	if err == nil {
-		result.Songs = songs
+	// No matches are empty slices, not errors, so any error here is a real
+	// failure and must not be passed off as an empty result
+	songs, err := s.searchSongs(terms, limit, offset, safe)
+	if err != nil {
+		return nil, fmt.Errorf("search songs: %w", err)
 	}
+	result.Songs = songs
 
-	// Search artists
-	artists, err := s.searchArtists(searchTerm)
-	if err == nil {
-		result.Artists = artists
+	artists, err := s.searchArtists(terms)
+	if err != nil {
+		return nil, fmt.Errorf("search artists: %w", err)
 	}
+	result.Artists = artists
 
-	// Search albums
-	albums, err := s.searchAlbums(searchTerm)
-	if err == nil {
-		result.Albums = albums
+	albums, err := s.searchAlbums(terms)
+	if err != nil {
+		return nil, fmt.Errorf("search albums: %w", err)
 	}
+	result.Albums = albums
 
 	return result, nil
 }
 
-func (s *SearchService) searchSongs(searchTerm string) ([]models.Song, error) {
+// searchTokens splits a query into its distinct lowercased words, keeping
+// the first maxSearchTokens
+func searchTokens(query string) []string {
+	var tokens []string
+	seen := map[string]bool{}
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		if seen[word] {
+			continue
+		}
+		seen[word] = true
+		tokens = append(tokens, word)
+		if len(tokens) == maxSearchTokens {
+			break
+		}
+	}
+	return tokens
+}
+
+// searchTerms is a tokenized query and how its words combine
+type searchTerms struct {
+	tokens []string
+	any    bool
+}
+
+// where builds a condition requiring each token (or, in any mode, at least
+// one token) to appear in one of columns, with a placeholder per
+// comparison, and returns it with the matching arguments
+func (t *searchTerms) where(columns ...string) (string, []interface{}) {
+	var clauses []string
+	var args []interface{}
+	for _, token := range t.tokens {
+		comparisons := make([]string, len(columns))
+		for i, column := range columns {
+			comparisons[i] = "LOWER(" + column + ") LIKE ?"
+			args = append(args, "%"+token+"%")
+		}
+		clauses = append(clauses, "("+strings.Join(comparisons, " OR ")+")")
+	}
+	join := " AND "
+	if t.any {
+		join = " OR "
+	}
+	return "(" + strings.Join(clauses, join) + ")", args
+}
+
+func (s *SearchService) searchSongs(terms *searchTerms, limit, offset int, safe bool) (*models.Paginated[models.Song], error) {
+	match, args := terms.where("s.title", "a.name", "al.title")
+
+	var total int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*)
+		FROM songs s
+		LEFT JOIN artists a ON s.artist_id = a.id
+		LEFT JOIN albums al ON s.album_id = al.id
+		WHERE `+match+`
+		AND s.uploaded_by_user_id IS NULL AND s.deleted_at IS NULL`+explicitFilter(safe)+`
+	`, args...).Scan(&total)
+	if err != nil {
+		return nil, err
+	}
+
 	rows, err := s.db.Query(`
 		SELECT s.id, s.title, s.artist_id, s.album_id, s.category_id, 
-			   s.duration_seconds, s.file_path, s.format, s.uploaded_by_user_id, s.created_at,
+			   COALESCE(s.duration_seconds, 0), s.file_path, s.format, s.uploaded_by_user_id, s.created_at,
 			   a.name as artist_name, al.title as album_title, c.name as category_name
 		FROM songs s
 		LEFT JOIN artists a ON s.artist_id = a.id
 		LEFT JOIN albums al ON s.album_id = al.id
 		LEFT JOIN categories c ON s.category_id = c.id
-		WHERE (LOWER(s.title) LIKE ? OR LOWER(a.name) LIKE ? OR LOWER(al.title) LIKE ?)
-		AND s.uploaded_by_user_id IS NULL
-		LIMIT 50
-	`, searchTerm, searchTerm, searchTerm)
+		WHERE `+match+`
+		AND s.uploaded_by_user_id IS NULL AND s.deleted_at IS NULL`+explicitFilter(safe)+`
+		ORDER BY s.title
+		LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
 
 	if err != nil {
 		return nil, err
@@ -80,7 +223,7 @@ func (s *SearchService) searchSongs(searchTerm string) ([]models.Song, error) {
 			&song.CreatedAt, &artistName, &albumTitle, &categoryName,
 		)
 		if err != nil {
-			continue
+			return nil, err
 		}
 
 		if artistName.Valid {
@@ -95,17 +238,21 @@ func (s *SearchService) searchSongs(searchTerm string) ([]models.Song, error) {
 
 		songs = append(songs, song)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	return songs, nil
+	return models.NewPaginated(songs, total, limit, offset), nil
 }
 
-func (s *SearchService) searchArtists(searchTerm string) ([]models.Artist, error) {
+func (s *SearchService) searchArtists(terms *searchTerms) ([]models.Artist, error) {
+	match, args := terms.where("name")
 	rows, err := s.db.Query(`
 		SELECT id, name, description, created_at
 		FROM artists
-		WHERE LOWER(name) LIKE ?
+		WHERE `+match+`
 		LIMIT 20
-	`, searchTerm)
+	`, args...)
 
 	if err != nil {
 		return nil, err
@@ -117,23 +264,27 @@ func (s *SearchService) searchArtists(searchTerm string) ([]models.Artist, error
 		var artist models.Artist
 		err := rows.Scan(&artist.ID, &artist.Name, &artist.Description, &artist.CreatedAt)
 		if err != nil {
-			continue
+			return nil, err
 		}
 		artists = append(artists, artist)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
 	return artists, nil
 }
 
-func (s *SearchService) searchAlbums(searchTerm string) ([]models.Album, error) {
+func (s *SearchService) searchAlbums(terms *searchTerms) ([]models.Album, error) {
+	match, args := terms.where("a.title", "ar.name")
 	rows, err := s.db.Query(`
 		SELECT a.id, a.title, a.artist_id, a.cover_image_path, a.release_date,
 			   ar.name as artist_name
 		FROM albums a
 		LEFT JOIN artists ar ON a.artist_id = ar.id
-		WHERE LOWER(a.title) LIKE ? OR LOWER(ar.name) LIKE ?
+		WHERE `+match+`
 		LIMIT 20
-	`, searchTerm, searchTerm)
+	`, args...)
 
 	if err != nil {
 		return nil, err
@@ -150,7 +301,7 @@ func (s *SearchService) searchAlbums(searchTerm string) ([]models.Album, error)
 			&album.ReleaseDate, &artistName,
 		)
 		if err != nil {
-			continue
+			return nil, err
 		}
 
 		if artistName.Valid {
@@ -159,22 +310,205 @@ func (s *SearchService) searchAlbums(searchTerm string) ([]models.Album, error)
 
 		albums = append(albums, album)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
 	return albums, nil
 }
 
-// GetSongsByCategory retrieves songs filtered by category
-func (s *SearchService) GetSongsByCategory(categoryID int) ([]models.Song, error) {
+// catalogSongs restricts a songs join to the public catalog: no personal
+// uploads and nothing in the trash
+const catalogSongs = `s.uploaded_by_user_id IS NULL AND s.deleted_at IS NULL`
+
+// ListArtists returns a page of artists with catalog songs, alphabetically.
+// Artists whose only songs are user uploads are left out
+func (s *SearchService) ListArtists(limit, offset int) (*models.Paginated[models.Artist], error) {
+	var total int
+	err := s.db.QueryRow(`
+		SELECT COUNT(DISTINCT ar.id)
+		FROM artists ar
+		JOIN songs s ON s.artist_id = ar.id AND ` + catalogSongs,
+	).Scan(&total)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT ar.id, ar.name, ar.description, ar.created_at, COUNT(s.id)
+		FROM artists ar
+		JOIN songs s ON s.artist_id = ar.id AND `+catalogSongs+`
+		GROUP BY ar.id
+		ORDER BY ar.name COLLATE NOCASE, ar.id
+		LIMIT ? OFFSET ?
+	`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var artists []models.Artist
+	for rows.Next() {
+		var artist models.Artist
+		err := rows.Scan(&artist.ID, &artist.Name, &artist.Description, &artist.CreatedAt, &artist.SongCount)
+		if err != nil {
+			continue
+		}
+		artists = append(artists, artist)
+	}
+
+	return models.NewPaginated(artists, total, limit, offset), nil
+}
+
+// ListAlbums returns a page of albums with catalog songs, alphabetically by
+// title. Albums holding only user uploads are left out
+func (s *SearchService) ListAlbums(limit, offset int) (*models.Paginated[models.Album], error) {
+	var total int
+	err := s.db.QueryRow(`
+		SELECT COUNT(DISTINCT a.id)
+		FROM albums a
+		JOIN songs s ON s.album_id = a.id AND ` + catalogSongs,
+	).Scan(&total)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT a.id, a.title, a.artist_id, a.cover_image_path, a.release_date,
+			   ar.name as artist_name, COUNT(s.id)
+		FROM albums a
+		JOIN songs s ON s.album_id = a.id AND `+catalogSongs+`
+		LEFT JOIN artists ar ON a.artist_id = ar.id
+		GROUP BY a.id
+		ORDER BY a.title COLLATE NOCASE, a.id
+		LIMIT ? OFFSET ?
+	`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var albums []models.Album
+	for rows.Next() {
+		var album models.Album
+		var artistName sql.NullString
+
+		err := rows.Scan(
+			&album.ID, &album.Title, &album.ArtistID, &album.CoverImagePath,
+			&album.ReleaseDate, &artistName, &album.SongCount,
+		)
+		if err != nil {
+			continue
+		}
+
+		if artistName.Valid {
+			album.Artist = &models.Artist{ID: album.ArtistID, Name: artistName.String}
+		}
+
+		albums = append(albums, album)
+	}
+
+	return models.NewPaginated(albums, total, limit, offset), nil
+}
+
+// GetAlbum returns an album with its catalog songs in disc and track order.
+// Songs without a known position follow the numbered ones in upload order,
+// and a missing disc number counts as disc 1
+func (s *SearchService) GetAlbum(albumID int) (*models.Album, error) {
+	var album models.Album
+	var artistName sql.NullString
+	err := s.db.QueryRow(`
+		SELECT a.id, a.title, a.artist_id, a.cover_image_path, a.release_date, ar.name
+		FROM albums a
+		LEFT JOIN artists ar ON a.artist_id = ar.id
+		WHERE a.id = ?
+	`, albumID).Scan(&album.ID, &album.Title, &album.ArtistID, &album.CoverImagePath, &album.ReleaseDate, &artistName)
+	if err == sql.ErrNoRows {
+		return nil, apperrors.NotFoundError("album not found")
+	}
+	if err != nil {
+		return nil, apperrors.InternalError(err)
+	}
+	if artistName.Valid {
+		album.Artist = &models.Artist{ID: album.ArtistID, Name: artistName.String}
+	}
+
+	rows, err := s.db.Query(`
+		SELECT s.id, s.title, s.artist_id, s.album_id, s.category_id,
+			   s.duration_seconds, s.track_number, s.disc_number, s.file_path, s.format,
+			   s.uploaded_by_user_id, s.created_at
+		FROM songs s
+		WHERE s.album_id = ? AND `+catalogSongs+`
+		ORDER BY COALESCE(s.disc_number, 1), s.track_number IS NULL, s.track_number, s.created_at, s.id
+	`, albumID)
+	if err != nil {
+		return nil, apperrors.InternalError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var song models.Song
+		var duration sql.NullInt64
+		if err := rows.Scan(
+			&song.ID, &song.Title, &song.ArtistID, &song.AlbumID, &song.CategoryID,
+			&duration, &song.TrackNumber, &song.DiscNumber, &song.FilePath, &song.Format,
+			&song.UploadedByUserID, &song.CreatedAt,
+		); err != nil {
+			return nil, apperrors.InternalError(err)
+		}
+		song.DurationSeconds = int(duration.Int64)
+		song.Artist = album.Artist
+		album.Songs = append(album.Songs, song)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperrors.InternalError(err)
+	}
+
+	// Albums made up only of user uploads stay private, as in ListAlbums
+	if len(album.Songs) == 0 {
+		return nil, apperrors.NotFoundError("album not found")
+	}
+	album.SongCount = len(album.Songs)
+	return &album, nil
+}
+
+// categorySongOrders maps the sort values GetSongsByCategory accepts to
+// their ORDER BY clause. Only these strings ever reach the query
+var categorySongOrders = map[string]string{
+	"recent": "s.created_at DESC, s.id DESC",
+	"title":  "s.title COLLATE NOCASE, s.id",
+}
+
+// GetSongsByCategory retrieves a page of songs filtered by category, newest
+// first or by title. An empty sort means "recent"; safe leaves out explicit songs
+func (s *SearchService) GetSongsByCategory(categoryID, limit, offset int, sort string, safe bool) (*models.Paginated[models.Song], error) {
+	if sort == "" {
+		sort = "recent"
+	}
+	order, ok := categorySongOrders[sort]
+	if !ok {
+		return nil, apperrors.ValidationError("sort must be recent or title", nil)
+	}
+
+	var total int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*) FROM songs s
+		WHERE s.category_id = ? AND s.uploaded_by_user_id IS NULL AND s.deleted_at IS NULL`+explicitFilter(safe)+`
+	`, categoryID).Scan(&total)
+	if err != nil {
+		return nil, err
+	}
+
 	rows, err := s.db.Query(`
 		SELECT s.id, s.title, s.artist_id, s.album_id, s.category_id,
 			   s.duration_seconds, s.file_path, s.format, s.uploaded_by_user_id, s.created_at,
 			   a.name as artist_name
 		FROM songs s
 		LEFT JOIN artists a ON s.artist_id = a.id
-		WHERE s.category_id = ? AND s.uploaded_by_user_id IS NULL
-		ORDER BY s.created_at DESC
-		LIMIT 100
-	`, categoryID)
+		WHERE s.category_id = ? AND s.uploaded_by_user_id IS NULL AND s.deleted_at IS NULL`+explicitFilter(safe)+`
+		ORDER BY `+order+`
+		LIMIT ? OFFSET ?
+	`, categoryID, limit, offset)
 
 	if err != nil {
 		return nil, err
@@ -202,12 +536,17 @@ func (s *SearchService) GetSongsByCategory(categoryID int) ([]models.Song, error
 		songs = append(songs, song)
 	}
 
-	return songs, nil
+	return models.NewPaginated(songs, total, limit, offset), nil
 }
 
-// GetAllCategories retrieves all categories
+// GetAllCategories retrieves all categories, from the cache when fresh
 func (s *SearchService) GetAllCategories() ([]models.Category, error) {
-	rows, err := s.db.Query(`SELECT id, name, description FROM categories ORDER BY name`)
+	if cached, ok := s.categories.Get(); ok {
+		// Callers get their own copy so they can't alter the cached list
+		return append([]models.Category(nil), cached...), nil
+	}
+
+	rows, err := s.db.Query(`SELECT id, name, description, explicit FROM categories ORDER BY name`)
 	if err != nil {
 		return nil, err
 	}
@@ -216,12 +555,16 @@ func (s *SearchService) GetAllCategories() ([]models.Category, error) {
 	var categories []models.Category
 	for rows.Next() {
 		var cat models.Category
-		err := rows.Scan(&cat.ID, &cat.Name, &cat.Description)
+		err := rows.Scan(&cat.ID, &cat.Name, &cat.Description, &cat.Explicit)
 		if err != nil {
 			continue
 		}
 		categories = append(categories, cat)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
+	s.categories.Set(append([]models.Category(nil), categories...))
 	return categories, nil
 }
\ No newline at end of file
@@ -1,8 +1,13 @@
 package services
 
 import (
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 	"log"
+	apperrors "tunetudo/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -62,15 +67,15 @@ func TestFullTextSearch(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := service.FullTextSearch(tt.query)
+			result, err := service.FullTextSearch(tt.query, 50, 0, "", false)
 			log.Printf("Search results for query '%s': %+v", tt.query, result)
 			require.NoError(t, err)
 			assert.NotNil(t, result)
 
 			if tt.expectSongs {
-				assert.Greater(t, len(result.Songs), 0)
+				assert.Greater(t, len(result.Songs.Items), 0)
 			} else {
-				assert.Len(t, result.Songs, 0)
+				assert.Len(t, result.Songs.Items, 0)
 			}
 			if tt.expectAlbums {
 				assert.Greater(t, len(result.Albums), 0)
@@ -81,6 +86,32 @@ func TestFullTextSearch(t *testing.T) {
 	}
 }
 
+func TestFullTextSearchSurfacesQueryFailures(t *testing.T) {
+	service, cleanup := setupTestSearchService(t)
+	defer cleanup()
+
+	// Song and artist searches still work; only the album query breaks
+	_, err := service.db.Exec(`ALTER TABLE albums DROP COLUMN release_date`)
+	require.NoError(t, err)
+
+	result, err := service.FullTextSearch("Test", 50, 0, "", false)
+	assert.Error(t, err, "a failed query is not the same as no results")
+	assert.Nil(t, result)
+}
+
+func TestFullTextSearchKeepsSongsWithoutDuration(t *testing.T) {
+	service, cleanup := setupTestSearchService(t)
+	defer cleanup()
+
+	_, err := service.db.Exec(`UPDATE songs SET duration_seconds = NULL WHERE title = 'Test Song 2'`)
+	require.NoError(t, err)
+
+	result, err := service.FullTextSearch("Test Song", 50, 0, "", false)
+	require.NoError(t, err)
+	assert.Len(t, result.Songs.Items, 3)
+	assert.Equal(t, 3, result.Songs.Meta.Total)
+}
+
 func TestFullTextSearchMalicious(t *testing.T) {
 	service, cleanup := setupTestSearchService(t)
 	defer cleanup()
@@ -103,14 +134,14 @@ func TestFullTextSearchMalicious(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, _ := service.FullTextSearch(tt.query)
+			result, _ := service.FullTextSearch(tt.query, 50, 0, "", false)
 			log.Printf("Search results for query '%s': %+v", tt.query, result)
 			assert.NotNil(t, result)
 
 			if tt.expectSongs {
-				assert.Len(t, result.Songs, 0)
+				assert.Len(t, result.Songs.Items, 0)
 			} else {
-				assert.Len(t, result.Songs, 0)
+				assert.Len(t, result.Songs.Items, 0)
 			}
 			if tt.expectAlbums {
 				assert.Greater(t, len(result.Albums), 0)
@@ -150,8 +181,9 @@ func TestGetSongsByCategory(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			songs, err := service.GetSongsByCategory(tt.categoryID)
+			page, err := service.GetSongsByCategory(tt.categoryID, 100, 0, "", false)
 			require.NoError(t, err)
+			songs := page.Items
 
 			if tt.expectSongs {
 				assert.Greater(t, len(songs), 0)
@@ -205,9 +237,9 @@ func TestSearchExcludesUserUploads(t *testing.T) {
 		"User Upload Song", 1, "/test/user.mp3", "mp3", userID)
 
 	// Search should NOT return user uploads
-	result, err := service.FullTextSearch("User Upload")
+	result, err := service.FullTextSearch("User Upload", 50, 0, "", false)
 	require.NoError(t, err)
-	assert.Len(t, result.Songs, 0, "User uploads should not appear in search")
+	assert.Len(t, result.Songs.Items, 0, "User uploads should not appear in search")
 }
 
 func TestCategorySearchExcludesUserUploads(t *testing.T) {
@@ -228,11 +260,389 @@ func TestCategorySearchExcludesUserUploads(t *testing.T) {
 		"User Upload Song", 1, 1, "/test/user.mp3", "mp3", userID)
 
 	// Category search should NOT return user uploads
-	songs, err := service.GetSongsByCategory(1)
+	page, err := service.GetSongsByCategory(1, 100, 0, "", false)
 	require.NoError(t, err)
+	songs := page.Items
 	
 	// Check that user uploads are not in results
 	for _, song := range songs {
 		assert.Nil(t, song.UploadedByUserID, "User uploads should not appear in category search")
 	}
-}
\ No newline at end of file
+}
+func TestSearchPagination(t *testing.T) {
+	service, cleanup := setupTestSearchService(t)
+	defer cleanup()
+
+	t.Run("Category listing", func(t *testing.T) {
+		page, err := service.GetSongsByCategory(1, 2, 0, "", false)
+		require.NoError(t, err)
+		assert.Len(t, page.Items, 2)
+		assert.Equal(t, 3, page.Meta.Total)
+		assert.True(t, page.Meta.HasMore)
+
+		page, err = service.GetSongsByCategory(1, 2, 2, "", false)
+		require.NoError(t, err)
+		assert.Len(t, page.Items, 1)
+		assert.Equal(t, 3, page.Meta.Total)
+		assert.False(t, page.Meta.HasMore)
+	})
+
+	t.Run("Song search", func(t *testing.T) {
+		result, err := service.FullTextSearch("Test Song", 1, 0, "", false)
+		require.NoError(t, err)
+		assert.Len(t, result.Songs.Items, 1)
+		assert.Equal(t, 3, result.Songs.Meta.Total)
+		assert.Equal(t, 1, result.Songs.Meta.Limit)
+		assert.True(t, result.Songs.Meta.HasMore)
+	})
+}
+
+func TestBrowseArtistsAndAlbums(t *testing.T) {
+	service, cleanup := setupTestSearchService(t)
+	defer cleanup()
+	db := service.db
+
+	result, err := db.Exec(`INSERT INTO users (username, email, password_hash) VALUES ('uploader', 'uploader@test.com', 'hash')`)
+	require.NoError(t, err)
+	userID, _ := result.LastInsertId()
+
+	insertArtist := func(name string) int64 {
+		result, err := db.Exec(`INSERT INTO artists (name) VALUES (?)`, name)
+		require.NoError(t, err)
+		id, _ := result.LastInsertId()
+		return id
+	}
+	insertAlbum := func(title string, artistID int64) int64 {
+		result, err := db.Exec(`INSERT INTO albums (title, artist_id) VALUES (?, ?)`, title, artistID)
+		require.NoError(t, err)
+		id, _ := result.LastInsertId()
+		return id
+	}
+	insertSong := func(artistID, albumID int64, uploadedBy interface{}, deletedAt interface{}) {
+		_, err := db.Exec(`INSERT INTO songs (title, artist_id, album_id, duration_seconds, file_path, format, uploaded_by_user_id, deleted_at)
+			VALUES ('Song', ?, ?, 120, '/test/song.mp3', 'mp3', ?, ?)`, artistID, albumID, uploadedBy, deletedAt)
+		require.NoError(t, err)
+	}
+
+	// Seeded: "Test Artist" with "Test Album" and three catalog songs
+	abba := insertArtist("abba")
+	insertSong(abba, insertAlbum("Arrival", abba), nil, nil)
+
+	uploaderArtist := insertArtist("Bedroom Producer")
+	insertSong(uploaderArtist, insertAlbum("Bedroom Demos", uploaderArtist), userID, nil)
+
+	trashed := insertArtist("Gone")
+	insertSong(trashed, insertAlbum("Gone Album", trashed), nil, "2024-01-01 00:00:00")
+
+	t.Run("artists", func(t *testing.T) {
+		page, err := service.ListArtists(10, 0)
+		require.NoError(t, err)
+
+		assert.Equal(t, 2, page.Meta.Total, "upload-only and trashed artists are excluded")
+		require.Len(t, page.Items, 2)
+		assert.Equal(t, "abba", page.Items[0].Name, "ordered case-insensitively")
+		assert.Equal(t, 1, page.Items[0].SongCount)
+		assert.Equal(t, "Test Artist", page.Items[1].Name)
+		assert.Equal(t, 3, page.Items[1].SongCount)
+		assert.False(t, page.Meta.HasMore)
+	})
+
+	t.Run("albums", func(t *testing.T) {
+		page, err := service.ListAlbums(10, 0)
+		require.NoError(t, err)
+
+		assert.Equal(t, 2, page.Meta.Total)
+		require.Len(t, page.Items, 2)
+		assert.Equal(t, "Arrival", page.Items[0].Title)
+		assert.Equal(t, 1, page.Items[0].SongCount)
+		require.NotNil(t, page.Items[0].Artist)
+		assert.Equal(t, "abba", page.Items[0].Artist.Name)
+		assert.Equal(t, "Test Album", page.Items[1].Title)
+		assert.Equal(t, 3, page.Items[1].SongCount)
+	})
+
+	t.Run("pagination", func(t *testing.T) {
+		page, err := service.ListArtists(1, 0)
+		require.NoError(t, err)
+		require.Len(t, page.Items, 1)
+		assert.Equal(t, "abba", page.Items[0].Name)
+		assert.True(t, page.Meta.HasMore)
+
+		page, err = service.ListArtists(1, 1)
+		require.NoError(t, err)
+		require.Len(t, page.Items, 1)
+		assert.Equal(t, "Test Artist", page.Items[0].Name)
+		assert.False(t, page.Meta.HasMore)
+	})
+}
+
+func TestGetAllCategoriesIsCached(t *testing.T) {
+	service, cleanup := setupTestSearchService(t)
+	defer cleanup()
+
+	first, err := service.GetAllCategories()
+	require.NoError(t, err)
+	require.Len(t, first, 4)
+
+	// A row written behind the cache's back stays invisible until it is
+	// invalidated, which shows later reads don't reach the database
+	_, err = service.db.Exec(`INSERT INTO categories (name, description) VALUES ('Ambient', 'Slow')`)
+	require.NoError(t, err)
+
+	first[0].Name = "Mutated by caller"
+	cached, err := service.GetAllCategories()
+	require.NoError(t, err)
+	assert.Len(t, cached, 4)
+	assert.NotEqual(t, "Mutated by caller", cached[0].Name, "callers can't alter the cached list")
+
+	service.InvalidateCategories()
+	fresh, err := service.GetAllCategories()
+	require.NoError(t, err)
+	assert.Len(t, fresh, 5)
+}
+
+func TestCategoryCacheExpires(t *testing.T) {
+	service, cleanup := setupTestSearchService(t)
+	defer cleanup()
+
+	now := time.Now()
+	service.SetCategoryCacheTTL(time.Minute)
+	service.categories.now = func() time.Time { return now }
+
+	_, err := service.GetAllCategories()
+	require.NoError(t, err)
+	_, err = service.db.Exec(`INSERT INTO categories (name, description) VALUES ('Ambient', 'Slow')`)
+	require.NoError(t, err)
+
+	now = now.Add(time.Minute)
+	categories, err := service.GetAllCategories()
+	require.NoError(t, err)
+	assert.Len(t, categories, 5)
+
+	service.SetCategoryCacheTTL(0)
+	_, err = service.db.Exec(`INSERT INTO categories (name, description) VALUES ('Folk', 'Acoustic')`)
+	require.NoError(t, err)
+	categories, err = service.GetAllCategories()
+	require.NoError(t, err)
+	assert.Len(t, categories, 6, "a zero TTL disables caching")
+}
+
+func TestCategoryCacheConcurrentAccess(t *testing.T) {
+	service, cleanup := setupTestSearchService(t)
+	defer cleanup()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if i == 0 && j%10 == 0 {
+					service.InvalidateCategories()
+					continue
+				}
+				categories, err := service.GetAllCategories()
+				if assert.NoError(t, err) {
+					assert.Len(t, categories, 4)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestGetAlbumTrackOrder(t *testing.T) {
+	service, cleanup := setupTestSearchService(t)
+	defer cleanup()
+	db := service.db
+
+	result, err := db.Exec(`INSERT INTO albums (title, artist_id) VALUES ('Double Album', 1)`)
+	require.NoError(t, err)
+	albumID, _ := result.LastInsertId()
+
+	// Inserted out of order; NULL positions sort after numbered tracks and
+	// a NULL disc counts as disc 1
+	for _, song := range []struct {
+		title       string
+		track, disc interface{}
+	}{
+		{"Disc 2 Track 1", 1, 2},
+		{"Unnumbered", nil, nil},
+		{"Disc 1 Track 2", 2, 1},
+		{"Disc 1 Track 1", 1, nil},
+		{"Disc 2 Track 2", 2, 2},
+	} {
+		_, err := db.Exec(`INSERT INTO songs (title, artist_id, album_id, duration_seconds, track_number, disc_number, file_path, format)
+			VALUES (?, 1, ?, 120, ?, ?, '/test/song.mp3', 'mp3')`, song.title, albumID, song.track, song.disc)
+		require.NoError(t, err)
+	}
+
+	album, err := service.GetAlbum(int(albumID))
+	require.NoError(t, err)
+	assert.Equal(t, "Double Album", album.Title)
+	require.NotNil(t, album.Artist)
+	assert.Equal(t, "Test Artist", album.Artist.Name)
+
+	var titles []string
+	for _, song := range album.Songs {
+		titles = append(titles, song.Title)
+	}
+	assert.Equal(t, []string{"Disc 1 Track 1", "Disc 1 Track 2", "Unnumbered", "Disc 2 Track 1", "Disc 2 Track 2"}, titles)
+	assert.Equal(t, 5, album.SongCount)
+
+	_, err = service.GetAlbum(99999)
+	assert.Error(t, err)
+}
+
+func TestGetSongsByCategoryPagesLargeCategory(t *testing.T) {
+	service, cleanup := setupTestSearchService(t)
+	defer cleanup()
+
+	// Category 2 starts empty; titles run backwards against upload time
+	for i := 0; i < 120; i++ {
+		_, err := service.db.Exec(`INSERT INTO songs (title, artist_id, category_id, duration_seconds, file_path, format, created_at)
+			VALUES (?, 1, 2, 180, '/test/song.mp3', 'mp3', ?)`,
+			fmt.Sprintf("Track %03d", 119-i), time.Date(2024, 1, 1, 0, i, 0, 0, time.UTC).Format(auditTimeFormat))
+		require.NoError(t, err)
+	}
+
+	first, err := service.GetSongsByCategory(2, 100, 0, "", false)
+	require.NoError(t, err)
+	assert.Len(t, first.Items, 100)
+	assert.Equal(t, 120, first.Meta.Total)
+	assert.True(t, first.Meta.HasMore)
+	assert.Equal(t, "Track 000", first.Items[0].Title, "recent first by default")
+
+	second, err := service.GetSongsByCategory(2, 100, 100, "recent", false)
+	require.NoError(t, err)
+	require.Len(t, second.Items, 20)
+	assert.False(t, second.Meta.HasMore)
+	assert.Equal(t, "Track 119", second.Items[19].Title)
+
+	seen := map[int]bool{}
+	for _, song := range append(first.Items, second.Items...) {
+		seen[song.ID] = true
+	}
+	assert.Len(t, seen, 120, "pages don't overlap")
+
+	byTitle, err := service.GetSongsByCategory(2, 100, 100, "title", false)
+	require.NoError(t, err)
+	require.Len(t, byTitle.Items, 20)
+	assert.Equal(t, "Track 100", byTitle.Items[0].Title)
+
+	_, err = service.GetSongsByCategory(2, 10, 0, "title; DROP TABLE songs", false)
+	assert.Error(t, err)
+}
+
+// seedKeywordSongs adds songs whose words are spread across title, artist
+// and album
+func seedKeywordSongs(t *testing.T, service *SearchService) {
+	for _, song := range []struct{ title, artist, album string }{
+		{"Blue Piano", "Jazz Trio", "Late Sets"},
+		{"Night Standards", "Jazz Quartet", "Horns"},
+		{"Sonata No. 8", "Concert Hall", "Piano Works"},
+	} {
+		result, err := service.db.Exec(`INSERT INTO artists (name) VALUES (?)`, song.artist)
+		require.NoError(t, err)
+		artistID, _ := result.LastInsertId()
+		result, err = service.db.Exec(`INSERT INTO albums (title, artist_id) VALUES (?, ?)`, song.album, artistID)
+		require.NoError(t, err)
+		albumID, _ := result.LastInsertId()
+		_, err = service.db.Exec(`INSERT INTO songs (title, artist_id, album_id, category_id, duration_seconds, file_path, format)
+			VALUES (?, ?, ?, 1, 200, '/test/keyword.mp3', 'mp3')`, song.title, artistID, albumID)
+		require.NoError(t, err)
+	}
+}
+
+func TestFullTextSearchMatchesAllWords(t *testing.T) {
+	service, cleanup := setupTestSearchService(t)
+	defer cleanup()
+	seedKeywordSongs(t, service)
+
+	tests := []struct {
+		name   string
+		query  string
+		titles []string
+	}{
+		{"words in different fields", "jazz piano", []string{"Blue Piano"}},
+		{"word order does not matter", "PIANO   jazz", []string{"Blue Piano"}},
+		{"repeated words", "jazz jazz piano", []string{"Blue Piano"}},
+		{"single word", "piano", []string{"Blue Piano", "Sonata No. 8"}},
+		{"one word missing", "jazz violin", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := service.FullTextSearch(tt.query, 50, 0, SearchMatchAll, false)
+			require.NoError(t, err)
+			assert.Equal(t, tt.titles, songTitles(result.Songs.Items))
+			assert.Equal(t, len(tt.titles), result.Songs.Meta.Total)
+		})
+	}
+
+	t.Run("all is the default", func(t *testing.T) {
+		result, err := service.FullTextSearch("jazz piano", 50, 0, "", false)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Blue Piano"}, songTitles(result.Songs.Items))
+	})
+
+	t.Run("artists and albums need every word too", func(t *testing.T) {
+		result, err := service.FullTextSearch("jazz trio", 50, 0, "", false)
+		require.NoError(t, err)
+		require.Len(t, result.Artists, 1)
+		assert.Equal(t, "Jazz Trio", result.Artists[0].Name)
+		require.Len(t, result.Albums, 1)
+		assert.Equal(t, "Late Sets", result.Albums[0].Title)
+	})
+}
+
+func TestFullTextSearchMatchAny(t *testing.T) {
+	service, cleanup := setupTestSearchService(t)
+	defer cleanup()
+	seedKeywordSongs(t, service)
+
+	result, err := service.FullTextSearch("jazz piano", 50, 0, SearchMatchAny, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Blue Piano", "Night Standards", "Sonata No. 8"}, songTitles(result.Songs.Items))
+	assert.Equal(t, 3, result.Songs.Meta.Total)
+	assert.Len(t, result.Artists, 2)
+
+	result, err = service.FullTextSearch("violin cello", 50, 0, SearchMatchAny, false)
+	require.NoError(t, err)
+	assert.Empty(t, result.Songs.Items)
+
+	_, err = service.FullTextSearch("jazz piano", 50, 0, "some", false)
+	assert.EqualError(t, err, "match must be one of all, any")
+}
+
+func TestFullTextSearchQueryLength(t *testing.T) {
+	service, cleanup := setupTestSearchService(t)
+	defer cleanup()
+
+	for _, query := range []string{"a", "  a  ", "é"} {
+		_, err := service.FullTextSearch(query, 50, 0, "", false)
+		require.Error(t, err, query)
+		assert.Equal(t, "search term too short", err.Error())
+		assert.Equal(t, 400, apperrors.GetAppError(err).StatusCode)
+	}
+
+	// Whitespace on its own is an empty query, which finds nothing
+	result, err := service.FullTextSearch(" \t ", 50, 0, "", false)
+	require.NoError(t, err)
+	assert.Empty(t, result.Songs.Items)
+
+	result, err = service.FullTextSearch(" so ", 50, 0, "", false)
+	require.NoError(t, err)
+	assert.Len(t, result.Songs.Items, 3, "a query at the minimum length is searched")
+
+	_, err = service.FullTextSearch(strings.Repeat("x", defaultMaxSearchLength+1), 50, 0, "", false)
+	assert.Error(t, err)
+
+	service.SetQueryLengths(5, 9)
+	_, err = service.FullTextSearch("song", 50, 0, "", false)
+	assert.Error(t, err)
+	result, err = service.FullTextSearch("Test Song", 50, 0, "", false)
+	require.NoError(t, err)
+	assert.Len(t, result.Songs.Items, 3)
+	_, err = service.FullTextSearch("Test Song 1", 50, 0, "", false)
+	assert.Error(t, err)
+}
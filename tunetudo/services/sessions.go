@@ -0,0 +1,122 @@
+package services
+
+import (
+	"time"
+	apperrors "tunetudo/errors"
+	"tunetudo/logger"
+	"tunetudo/models"
+)
+
+const (
+	// tokenLifetime is how long a login token, and its session, stays valid
+	tokenLifetime = 7 * 24 * time.Hour
+
+	// sessionSeenInterval limits how often a session's last_seen is
+	// rewritten while it is in use
+	sessionSeenInterval = time.Minute
+
+	maxUserAgentLength = 255
+)
+
+// createSession records a new session for a login and returns its token
+func (s *AuthService) createSession(user *models.User, ipAddress, userAgent string) (string, error) {
+	jti, err := GenerateSecureToken()
+	if err != nil {
+		return "", err
+	}
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	now := time.Now().UTC()
+	expiresAt := now.Add(tokenLifetime)
+
+	// Expired sessions are cleared out whenever their user logs in again
+	if _, err := s.db.Exec(`DELETE FROM sessions WHERE user_id = ? AND expires_at <= ?`,
+		user.ID, now.Format(auditTimeFormat)); err != nil {
+		logger.Warning(logger.CategoryDB, "Failed to remove expired sessions for user_id=%d", user.ID)
+	}
+	if _, err := s.db.Exec(`
+		INSERT INTO sessions (user_id, jti, ip_masked, user_agent, created_at, last_seen, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, user.ID, jti, logger.MaskIP(ipAddress), userAgent,
+		now.Format(auditTimeFormat), now.Format(auditTimeFormat), expiresAt.Format(auditTimeFormat),
+	); err != nil {
+		return "", err
+	}
+
+	return s.signToken(user, jti, expiresAt)
+}
+
+// touchSession fails for a token whose session was revoked, and otherwise
+// notes that the session is still in use
+func (s *AuthService) touchSession(jti string) error {
+	now := time.Now().UTC()
+	result, err := s.db.Exec(`UPDATE sessions SET last_seen = ? WHERE jti = ? AND last_seen <= ?`,
+		now.Format(auditTimeFormat), jti, now.Add(-sessionSeenInterval).Format(auditTimeFormat))
+	if err != nil {
+		logger.Error(logger.CategoryDB, "Failed to update session", err)
+		return internalError("failed to verify session", err)
+	}
+	if updated, _ := result.RowsAffected(); updated > 0 {
+		return nil
+	}
+
+	var exists bool
+	if err := s.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM sessions WHERE jti = ?)`, jti).Scan(&exists); err != nil {
+		logger.Error(logger.CategoryDB, "Failed to look up session", err)
+		return internalError("failed to verify session", err)
+	}
+	if !exists {
+		logger.Warning(logger.CategoryAuth, "Revoked session token used")
+		return unauthenticated("session has been revoked")
+	}
+	return nil
+}
+
+// ListSessions returns the user's unexpired sessions, most recently used
+// first. currentJTI marks the one the request came from
+func (s *AuthService) ListSessions(userID int, currentJTI string) ([]models.Session, error) {
+	rows, err := s.db.Query(`
+		SELECT id, jti, COALESCE(ip_masked, ''), COALESCE(user_agent, ''), created_at, last_seen
+		FROM sessions
+		WHERE user_id = ? AND expires_at > ?
+		ORDER BY last_seen DESC, id DESC
+	`, userID, time.Now().UTC().Format(auditTimeFormat))
+	if err != nil {
+		logger.Error(logger.CategoryDB, "Failed to list sessions", err)
+		return nil, internalError("failed to list sessions", err)
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		var jti string
+		if err := rows.Scan(&session.ID, &jti, &session.IPAddress, &session.UserAgent,
+			&session.CreatedAt, &session.LastSeen); err != nil {
+			logger.Error(logger.CategoryDB, "Failed to read session", err)
+			return nil, internalError("failed to list sessions", err)
+		}
+		session.Current = jti == currentJTI
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error(logger.CategoryDB, "Failed to list sessions", err)
+		return nil, internalError("failed to list sessions", err)
+	}
+	return sessions, nil
+}
+
+// RevokeSession signs out one of the user's sessions; its token is refused
+// from then on
+func (s *AuthService) RevokeSession(userID, sessionID int) error {
+	result, err := s.db.Exec(`DELETE FROM sessions WHERE id = ? AND user_id = ?`, sessionID, userID)
+	if err != nil {
+		logger.Error(logger.CategoryDB, "Failed to revoke session", err)
+		return internalError("failed to revoke session", err)
+	}
+	if revoked, _ := result.RowsAffected(); revoked == 0 {
+		return apperrors.NotFoundError("session not found")
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"testing"
+	"tunetudo/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loginWithAgent(t *testing.T, service *AuthService, userAgent string) string {
+	token, _, err := service.LoginUser(models.LoginRequest{
+		Username:  "traveller",
+		Password:  "Passw0rd-123",
+		UserAgent: userAgent,
+	}, "203.0.113.45")
+	require.NoError(t, err)
+	return token
+}
+
+func setupTestSessions(t *testing.T) (*AuthService, int) {
+	service, cleanup := setupTestAuthService(t)
+	t.Cleanup(cleanup)
+	user, err := service.RegisterUser(models.RegisterRequest{
+		Username: "traveller",
+		Email:    "traveller@example.com",
+		Password: "Passw0rd-123",
+	}, "127.0.0.1")
+	require.NoError(t, err)
+	return service, user.ID
+}
+
+func TestLoginCreatesSession(t *testing.T) {
+	service, userID := setupTestSessions(t)
+
+	token := loginWithAgent(t, service, "Laptop Browser")
+	assert.Equal(t, 1, countRows(t, service.db, "sessions"))
+
+	claims, err := service.ValidateToken(token)
+	require.NoError(t, err)
+	jti, _ := claims["jti"].(string)
+	require.NotEmpty(t, jti)
+
+	loginWithAgent(t, service, "Phone App")
+	sessions, err := service.ListSessions(userID, jti)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+
+	byAgent := map[string]models.Session{}
+	for _, session := range sessions {
+		byAgent[session.UserAgent] = session
+	}
+	assert.True(t, byAgent["Laptop Browser"].Current)
+	assert.False(t, byAgent["Phone App"].Current)
+	assert.NotEqual(t, "203.0.113.45", byAgent["Laptop Browser"].IPAddress, "addresses are stored masked")
+	assert.NotEmpty(t, byAgent["Laptop Browser"].IPAddress)
+}
+
+func TestRevokeSessionInvalidatesToken(t *testing.T) {
+	service, userID := setupTestSessions(t)
+
+	revoked := loginWithAgent(t, service, "Stolen Laptop")
+	kept := loginWithAgent(t, service, "Phone App")
+
+	claims, err := service.ValidateToken(revoked)
+	require.NoError(t, err)
+	sessions, err := service.ListSessions(userID, claims["jti"].(string))
+	require.NoError(t, err)
+	var revokedID int
+	for _, session := range sessions {
+		if session.Current {
+			revokedID = session.ID
+		}
+	}
+	require.NotZero(t, revokedID)
+
+	// Nobody else can revoke the session
+	assert.Error(t, service.RevokeSession(userID+1, revokedID))
+
+	require.NoError(t, service.RevokeSession(userID, revokedID))
+	_, err = service.ValidateToken(revoked)
+	assert.EqualError(t, err, "session has been revoked")
+	_, err = service.ValidateToken(kept)
+	assert.NoError(t, err, "other sessions are unaffected")
+
+	assert.Error(t, service.RevokeSession(userID, revokedID), "a session can only be revoked once")
+}
+
+func TestTokensWithoutSessionStillValidate(t *testing.T) {
+	service, userID := setupTestSessions(t)
+
+	token, err := service.GenerateToken(&models.User{ID: userID, Username: "traveller"})
+	require.NoError(t, err)
+	_, err = service.ValidateToken(token)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"sort"
+	"strings"
+	apperrors "tunetudo/errors"
+)
+
+// defaultSongSort is used when a song listing is given no sort
+const defaultSongSort = "created_desc"
+
+// songSortOrders maps the sort values song listings accept to an ORDER BY
+// clause over songs s joined to artists a. Only these strings ever reach a
+// query, so client input can't inject SQL
+var songSortOrders = map[string]string{
+	"created_desc": "s.created_at DESC, s.id DESC",
+	"title_asc":    "s.title COLLATE NOCASE, s.id",
+	"duration_asc": "COALESCE(s.duration_seconds, 0), s.id",
+	"artist_asc":   "a.name COLLATE NOCASE, s.title COLLATE NOCASE, s.id",
+}
+
+// songOrderBy returns the ORDER BY clause for an allowed sort value
+func songOrderBy(value string) (string, error) {
+	if value == "" {
+		value = defaultSongSort
+	}
+	if order, ok := songSortOrders[value]; ok {
+		return order, nil
+	}
+
+	allowed := make([]string, 0, len(songSortOrders))
+	for key := range songSortOrders {
+		allowed = append(allowed, key)
+	}
+	sort.Strings(allowed)
+	return "", apperrors.ValidationError("sort must be one of "+strings.Join(allowed, ", "), nil)
+}
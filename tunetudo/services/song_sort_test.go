@@ -0,0 +1,103 @@
+package services
+
+import (
+	"database/sql"
+	"testing"
+	apperrors "tunetudo/errors"
+	"tunetudo/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seedSortFixture replaces the catalog with three songs that order
+// differently under every sort
+func seedSortFixture(t *testing.T, db *sql.DB) {
+	_, err := db.Exec(`DELETE FROM songs`)
+	require.NoError(t, err)
+
+	for _, song := range []struct {
+		title, artist, createdAt string
+		duration                 int
+	}{
+		{"beta", "Zed", "2024-01-01 10:00:00", 300},
+		{"Alpha", "adele", "2024-01-03 10:00:00", 200},
+		{"gamma", "Mike", "2024-01-02 10:00:00", 100},
+	} {
+		result, err := db.Exec(`INSERT INTO artists (name, name_key) VALUES (?, ?)`, song.artist, song.artist)
+		require.NoError(t, err)
+		artistID, _ := result.LastInsertId()
+
+		_, err = db.Exec(`INSERT INTO songs (title, artist_id, duration_seconds, file_path, format, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			song.title, artistID, song.duration, "/test/song.mp3", "mp3", song.createdAt)
+		require.NoError(t, err)
+	}
+}
+
+var songSortTests = []struct {
+	sort   string
+	titles []string
+}{
+	{"", []string{"Alpha", "gamma", "beta"}},
+	{"created_desc", []string{"Alpha", "gamma", "beta"}},
+	{"title_asc", []string{"Alpha", "beta", "gamma"}},
+	{"duration_asc", []string{"gamma", "Alpha", "beta"}},
+	{"artist_asc", []string{"Alpha", "gamma", "beta"}},
+}
+
+var rejectedSongSorts = []string{"newest", "TITLE_ASC", "title_asc; DROP TABLE songs", "s.id"}
+
+func songTitles(songs []models.Song) []string {
+	titles := make([]string, len(songs))
+	for i, song := range songs {
+		titles[i] = song.Title
+	}
+	return titles
+}
+
+func TestGetRecentSongsSort(t *testing.T) {
+	service, cleanup := setupTestPlaybackService(t)
+	defer cleanup()
+	seedSortFixture(t, service.db)
+
+	for _, tt := range songSortTests {
+		t.Run("sort="+tt.sort, func(t *testing.T) {
+			songs, err := service.GetRecentSongs(20, tt.sort, false)
+			require.NoError(t, err)
+			assert.Equal(t, tt.titles, songTitles(songs))
+		})
+	}
+
+	for _, sort := range rejectedSongSorts {
+		_, err := service.GetRecentSongs(20, sort, false)
+		require.Error(t, err, sort)
+		if appErr := apperrors.GetAppError(err); assert.NotNil(t, appErr) {
+			assert.Equal(t, apperrors.ErrCodeValidation, appErr.Code)
+		}
+	}
+	assert.Equal(t, 3, countRows(t, service.db, "songs"))
+}
+
+func TestAdminGetAllSongsSort(t *testing.T) {
+	service, _, cleanup := setupTestAdminService(t)
+	defer cleanup()
+	seedSortFixture(t, service.db)
+
+	for _, tt := range songSortTests {
+		t.Run("sort="+tt.sort, func(t *testing.T) {
+			page, err := service.GetAllSongs(50, 0, tt.sort)
+			require.NoError(t, err)
+			assert.Equal(t, tt.titles, songTitles(page.Items))
+		})
+	}
+
+	for _, sort := range rejectedSongSorts {
+		_, err := service.GetAllSongs(50, 0, sort)
+		require.Error(t, err, sort)
+		if appErr := apperrors.GetAppError(err); assert.NotNil(t, appErr) {
+			assert.Equal(t, apperrors.ErrCodeValidation, appErr.Code)
+		}
+	}
+	assert.Equal(t, 3, countRows(t, service.db, "songs"))
+}
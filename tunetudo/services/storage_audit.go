@@ -0,0 +1,190 @@
+package services
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	apperrors "tunetudo/errors"
+	"tunetudo/logger"
+)
+
+// AuditStorage cross-references the storage tree with the database. It
+// returns files (relative to the storage root, slash-separated) that no
+// song, upload, profile or album refers to, and the IDs of live songs whose
+// file is missing from disk. Trashed songs keep a file left in the old
+// in-storage trash referenced
+func (s *AdminService) AuditStorage() (orphanFiles []string, missingFiles []int, err error) {
+	referenced, missingFiles, err := s.referencedStorageFiles()
+	if err != nil {
+		return nil, nil, internalError("failed to audit storage", err)
+	}
+
+	backupDir, _ := filepath.Abs(s.backupPath)
+	orphanFiles = []string{}
+	err = filepath.WalkDir(s.storagePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.storagePath, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if rel == "." {
+				return nil
+			}
+			if strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if abs, _ := filepath.Abs(path); s.backupPath != "" && abs == backupDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// Dotfiles are OS or editor clutter (.DS_Store), not media
+		if !strings.HasPrefix(d.Name(), ".") && !referenced[rel] {
+			orphanFiles = append(orphanFiles, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error(logger.CategoryFile, "Failed to walk storage for audit", err)
+		return nil, nil, internalError("failed to audit storage", err)
+	}
+
+	sort.Strings(orphanFiles)
+	return orphanFiles, missingFiles, nil
+}
+
+// referencedStorageFiles returns every storage path the database points at,
+// keyed by storageKey, and the live songs whose file does not exist
+func (s *AdminService) referencedStorageFiles() (map[string]bool, []int, error) {
+	referenced := make(map[string]bool)
+	missing := []int{}
+
+	rows, err := s.db.Query(`SELECT id, file_path, deleted_at IS NOT NULL FROM songs ORDER BY id`)
+	if err != nil {
+		logger.Error(logger.CategoryDB, "Failed to list song files for audit", err)
+		return nil, nil, err
+	}
+	for rows.Next() {
+		var id int
+		var filePath string
+		var deleted bool
+		if err := rows.Scan(&id, &filePath, &deleted); err != nil {
+			rows.Close()
+			logger.Error(logger.CategoryDB, "Failed to scan song file for audit", err)
+			return nil, nil, err
+		}
+
+		// The trash lives outside storage, apart from files deleted
+		// before it moved there
+		if deleted {
+			rel, _ := filepath.Rel(s.storagePath, s.legacyTrashPath(filePath))
+			referenced[rel] = true
+			continue
+		}
+		key := storageKey(filePath)
+		referenced[key] = true
+		if _, err := os.Stat(filepath.Join(s.storagePath, key)); os.IsNotExist(err) {
+			missing = append(missing, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		logger.Error(logger.CategoryDB, "Failed to list song files for audit", err)
+		return nil, nil, err
+	}
+
+	// Originals kept after transcoding, profile pictures and their resized
+	// copies, and album covers
+	for _, query := range []string{
+		`SELECT stored_path FROM uploads WHERE stored_path IS NOT NULL`,
+		`SELECT profile_image_path FROM users WHERE profile_image_path IS NOT NULL`,
+		`SELECT profile_image_medium_path FROM users WHERE profile_image_medium_path IS NOT NULL`,
+		`SELECT profile_image_thumb_path FROM users WHERE profile_image_thumb_path IS NOT NULL`,
+		`SELECT cover_image_path FROM albums WHERE cover_image_path IS NOT NULL`,
+	} {
+		paths, err := s.db.Query(query)
+		if err != nil {
+			logger.Error(logger.CategoryDB, "Failed to list referenced files for audit", err)
+			return nil, nil, err
+		}
+		for paths.Next() {
+			var path string
+			if err := paths.Scan(&path); err != nil {
+				paths.Close()
+				logger.Error(logger.CategoryDB, "Failed to scan referenced file for audit", err)
+				return nil, nil, err
+			}
+			referenced[storageKey(path)] = true
+		}
+		paths.Close()
+	}
+
+	return referenced, missing, nil
+}
+
+// storageKey normalizes a stored path to the relative form the storage walk
+// produces. Some rows carry a leading slash
+func storageKey(path string) string {
+	return filepath.Clean(strings.TrimLeft(filepath.FromSlash(path), string(filepath.Separator)))
+}
+
+// RemoveOrphanFiles deletes the given files if a fresh audit still reports
+// them as orphans, returning the ones removed. Anything else is left alone,
+// so a stale or tampered list can't delete referenced media
+func (s *AdminService) RemoveOrphanFiles(files []string) ([]string, error) {
+	if len(files) == 0 {
+		return nil, apperrors.ValidationError("no files given", nil)
+	}
+
+	orphans, _, err := s.AuditStorage()
+	if err != nil {
+		return nil, err
+	}
+	confirmed := make(map[string]bool, len(orphans))
+	for _, orphan := range orphans {
+		confirmed[orphan] = true
+	}
+
+	removed := []string{}
+	for _, file := range files {
+		if !confirmed[file] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.storagePath, filepath.FromSlash(file))); err != nil {
+			logger.Warning(logger.CategoryFile, "Failed to remove orphaned file: %s", file)
+			continue
+		}
+		delete(confirmed, file)
+		removed = append(removed, file)
+	}
+
+	logger.Info(logger.CategoryFile, "Removed %d orphaned files from storage", len(removed))
+	return removed, nil
+}
+
+// ScheduleStorageAudits runs AuditStorage every interval for the life of
+// the process, logging what it finds. Cleanup stays a manual admin step
+func (s *AdminService) ScheduleStorageAudits(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			orphans, missing, err := s.AuditStorage()
+			if err != nil {
+				continue
+			}
+			if len(orphans) > 0 || len(missing) > 0 {
+				logger.Warning(logger.CategoryFile, "Storage audit: %d orphaned files, %d songs with missing files",
+					len(orphans), len(missing))
+			} else {
+				logger.Info(logger.CategoryFile, "Storage audit: no problems found")
+			}
+		}
+	}()
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeStorageFile(t *testing.T, storageDir, rel string) {
+	path := filepath.Join(storageDir, filepath.FromSlash(rel))
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte("data"), 0644))
+}
+
+func TestAuditStorage(t *testing.T) {
+	service, storageDir, cleanup := setupTestAdminService(t)
+	defer cleanup()
+
+	kept, err := service.UploadSong(newTestFileHeader(t, "kept.mp3", []byte("fake mp3 data")), "Kept", "Artist", "", 0, 0, 0, 0)
+	require.NoError(t, err)
+	trashed, err := service.UploadSong(newTestFileHeader(t, "trashed.mp3", []byte("fake mp3 data")), "Trashed", "Artist", "", 0, 0, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, service.DeleteSong(trashed.ID))
+
+	result, err := service.db.Exec(`INSERT INTO songs (title, artist_id, duration_seconds, file_path, format)
+		VALUES ('Gone', ?, 180, 'media/songs/gone.mp3', 'mp3')`, kept.ArtistID)
+	require.NoError(t, err)
+	goneID, _ := result.LastInsertId()
+
+	writeStorageFile(t, storageDir, "media/songs/stray.mp3")
+	writeStorageFile(t, storageDir, "images/profiles/9/old.png")
+	writeStorageFile(t, storageDir, "tmp/chunks/session/0")
+	writeStorageFile(t, storageDir, ".DS_Store")
+
+	orphans, missing, err := service.AuditStorage()
+	require.NoError(t, err)
+	// Chunks from before the upload temp dir moved out of storage are orphans
+	assert.Equal(t, []string{"images/profiles/9/old.png", "media/songs/stray.mp3", "tmp/chunks/session/0"}, orphans)
+	assert.Equal(t, []int{int(goneID)}, missing)
+
+	t.Run("Cleanup removes only confirmed orphans", func(t *testing.T) {
+		removed, err := service.RemoveOrphanFiles([]string{
+			"media/songs/stray.mp3",
+			"tmp/chunks/session/0",
+			filepath.ToSlash(kept.FilePath),
+			"../outside.txt",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"media/songs/stray.mp3", "tmp/chunks/session/0"}, removed)
+		assert.NoFileExists(t, filepath.Join(storageDir, "media", "songs", "stray.mp3"))
+		assert.FileExists(t, filepath.Join(storageDir, kept.FilePath))
+
+		orphans, _, err := service.AuditStorage()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"images/profiles/9/old.png"}, orphans)
+	})
+
+	t.Run("Restoring a trashed song keeps its file referenced", func(t *testing.T) {
+		require.NoError(t, service.RestoreSong(trashed.ID))
+		orphans, missing, err := service.AuditStorage()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"images/profiles/9/old.png"}, orphans)
+		assert.Equal(t, []int{int(goneID)}, missing)
+	})
+
+	t.Run("Files in the old in-storage trash stay referenced", func(t *testing.T) {
+		result, err := service.db.Exec(`INSERT INTO songs (title, artist_id, duration_seconds, file_path, format, deleted_at)
+			VALUES ('Old Trash', ?, 180, 'media/songs/old.mp3', 'mp3', CURRENT_TIMESTAMP)`, kept.ArtistID)
+		require.NoError(t, err)
+		oldID, _ := result.LastInsertId()
+		writeStorageFile(t, storageDir, "trash/old.mp3")
+
+		orphans, _, err := service.AuditStorage()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"images/profiles/9/old.png"}, orphans)
+
+		require.NoError(t, service.RestoreSong(int(oldID)))
+		assert.FileExists(t, filepath.Join(storageDir, "media", "songs", "old.mp3"))
+	})
+
+	_, err = service.RemoveOrphanFiles(nil)
+	assert.Error(t, err)
+}
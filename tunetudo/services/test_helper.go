@@ -1,8 +1,15 @@
 package services
 
 import (
+	"bytes"
 	"database/sql"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -16,7 +23,7 @@ func setupTestDB(t *testing.T) *sql.DB {
 	// Remove if exists
 	os.Remove(dbPath)
 	
-	db, err := sql.Open("sqlite3", dbPath)
+	db, err := sql.Open("sqlite3", dbPath+"?_foreign_keys=on")
 	if err != nil {
 		t.Fatalf("Failed to open test database: %v", err)
 	}
@@ -41,13 +48,23 @@ func createTables(t *testing.T, db *sql.DB) {
 			email TEXT UNIQUE NOT NULL,
 			password_hash TEXT NOT NULL,
 			is_admin INTEGER DEFAULT 0,
+			suspended INTEGER DEFAULT 0,
 			profile_image_path TEXT,
+			profile_image_medium_path TEXT,
+			profile_image_thumb_path TEXT,
+			share_now_playing INTEGER DEFAULT 0,
+			safe_mode INTEGER NOT NULL DEFAULT 0,
+			provider TEXT,
+			provider_id TEXT,
+			email_verified INTEGER NOT NULL DEFAULT 0,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			last_login DATETIME
 		)`,
+		`CREATE UNIQUE INDEX idx_users_provider ON users(provider, provider_id)`,
 		`CREATE TABLE artists (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			name TEXT NOT NULL,
+			name_key TEXT,
 			description TEXT,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
@@ -57,12 +74,13 @@ func createTables(t *testing.T, db *sql.DB) {
 			artist_id INTEGER,
 			cover_image_path TEXT,
 			release_date DATE,
-			FOREIGN KEY(artist_id) REFERENCES artists(id)
+			FOREIGN KEY(artist_id) REFERENCES artists(id) ON DELETE CASCADE
 		)`,
 		`CREATE TABLE categories (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			name TEXT NOT NULL UNIQUE,
-			description TEXT
+			description TEXT,
+			explicit INTEGER NOT NULL DEFAULT 0
 		)`,
 		`CREATE TABLE songs (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -71,23 +89,30 @@ func createTables(t *testing.T, db *sql.DB) {
 			album_id INTEGER,
 			category_id INTEGER,
 			duration_seconds INTEGER,
+			track_number INTEGER,
+			disc_number INTEGER,
 			file_path TEXT NOT NULL,
 			format TEXT NOT NULL,
 			uploaded_by_user_id INTEGER,
+			explicit INTEGER NOT NULL DEFAULT 0,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			FOREIGN KEY(artist_id) REFERENCES artists(id),
-			FOREIGN KEY(album_id) REFERENCES albums(id),
-			FOREIGN KEY(category_id) REFERENCES categories(id),
-			FOREIGN KEY(uploaded_by_user_id) REFERENCES users(id)
+			deleted_at DATETIME,
+			FOREIGN KEY(artist_id) REFERENCES artists(id) ON DELETE CASCADE,
+			FOREIGN KEY(album_id) REFERENCES albums(id) ON DELETE SET NULL,
+			FOREIGN KEY(category_id) REFERENCES categories(id) ON DELETE SET NULL,
+			FOREIGN KEY(uploaded_by_user_id) REFERENCES users(id) ON DELETE CASCADE
 		)`,
 		`CREATE TABLE playlists (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			user_id INTEGER NOT NULL,
 			name TEXT NOT NULL,
 			description TEXT,
+			is_public INTEGER DEFAULT 0,
+			is_featured INTEGER NOT NULL DEFAULT 0,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			version INTEGER NOT NULL DEFAULT 0,
 			UNIQUE(user_id, name),
-			FOREIGN KEY(user_id) REFERENCES users(id)
+			FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
 		)`,
 		`CREATE TABLE playlist_songs (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -95,10 +120,20 @@ func createTables(t *testing.T, db *sql.DB) {
 			song_id INTEGER NOT NULL,
 			queue_number INTEGER DEFAULT 0,
 			added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			FOREIGN KEY(playlist_id) REFERENCES playlists(id),
-			FOREIGN KEY(song_id) REFERENCES songs(id),
+			FOREIGN KEY(playlist_id) REFERENCES playlists(id) ON DELETE CASCADE,
+			FOREIGN KEY(song_id) REFERENCES songs(id) ON DELETE CASCADE,
 			UNIQUE(playlist_id, song_id)
 		)`,
+		`CREATE TABLE playlist_collaborators (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			playlist_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			role TEXT NOT NULL DEFAULT 'editor',
+			added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(playlist_id, user_id),
+			FOREIGN KEY(playlist_id) REFERENCES playlists(id) ON DELETE CASCADE,
+			FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
 		`CREATE TABLE uploads (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			user_id INTEGER NOT NULL,
@@ -106,8 +141,74 @@ func createTables(t *testing.T, db *sql.DB) {
 			stored_path TEXT,
 			file_size_bytes INTEGER,
 			error_message TEXT,
+			transcode_status TEXT,
+			content_hash TEXT,
+			song_id INTEGER,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			FOREIGN KEY(user_id) REFERENCES users(id)
+			FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX idx_uploads_user_hash ON uploads(user_id, content_hash)`,
+		`CREATE TABLE playback_positions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			song_id INTEGER NOT NULL,
+			position_seconds INTEGER NOT NULL DEFAULT 0,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(user_id, song_id),
+			FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY(song_id) REFERENCES songs(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE audit_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			event_type TEXT NOT NULL,
+			user_hash TEXT NOT NULL,
+			masked_ip TEXT,
+			details TEXT,
+			created_at DATETIME NOT NULL
+		)`,
+		`CREATE TABLE waveforms (
+			song_id INTEGER NOT NULL,
+			buckets INTEGER NOT NULL,
+			file_path TEXT NOT NULL,
+			peaks TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY(song_id, buckets),
+			FOREIGN KEY(song_id) REFERENCES songs(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE idempotency_keys (
+			user_id INTEGER NOT NULL,
+			idempotency_key TEXT NOT NULL,
+			method TEXT NOT NULL,
+			path TEXT NOT NULL,
+			status INTEGER,
+			content_type TEXT,
+			body BLOB,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY(user_id, idempotency_key),
+			FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE plays (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			song_id INTEGER NOT NULL,
+			played_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY(song_id) REFERENCES songs(id) ON DELETE CASCADE
+		)`,
+		`CREATE VIRTUAL TABLE songs_fts USING fts4(
+			song_id, title, artist_name, album_title, category_name,
+			notindexed=song_id
+		)`,
+		`CREATE TABLE sessions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			jti TEXT NOT NULL UNIQUE,
+			ip_masked TEXT,
+			user_agent TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			last_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME NOT NULL,
+			FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
 		)`,
 	}
 
@@ -148,4 +249,97 @@ func seedTestData(t *testing.T, db *sql.DB) {
 			VALUES (?, ?, ?, ?, ?, ?, ?)`,
 			"Test Song "+string(rune(i+'0')), artistID, albumID, 1, 180, "/test/song.mp3", "mp3")
 	}
-}
\ No newline at end of file
+}
+
+// newTestFileHeader builds a multipart file header as a handler would receive it
+func newTestFileHeader(t *testing.T, filename string, content []byte) *multipart.FileHeader {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatalf("Failed to create form file: %v", err)
+	}
+	part.Write(content)
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if err := req.ParseMultipartForm(int64(len(content)) + 1024); err != nil {
+		t.Fatalf("Failed to parse multipart form: %v", err)
+	}
+
+	return req.MultipartForm.File["file"][0]
+}
+
+// failSongInserts makes every INSERT into songs fail, to exercise rollback paths
+func failSongInserts(t *testing.T, db *sql.DB) {
+	_, err := db.Exec(`CREATE TRIGGER fail_song_insert BEFORE INSERT ON songs
+		BEGIN SELECT RAISE(ABORT, 'injected failure'); END`)
+	if err != nil {
+		t.Fatalf("Failed to create failure trigger: %v", err)
+	}
+}
+
+// countRows returns the number of rows in a table
+func countRows(t *testing.T, db *sql.DB, table string) int {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+		t.Fatalf("Failed to count %s: %v", table, err)
+	}
+	return count
+}
+
+// listStoredFiles returns every regular file under dir
+func listStoredFiles(t *testing.T, dir string) []string {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("Failed to walk %s: %v", dir, err)
+	}
+	return files
+}
+
+// newTestPNG encodes a blank PNG of the given size
+func newTestPNG(t *testing.T, width, height int) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("Failed to encode test PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// newTestWebP builds an extended-format WebP header for an image of the
+// given size, followed by an empty image chunk
+func newTestWebP(width, height int) []byte {
+	vp8x := make([]byte, 10)
+	vp8x[4], vp8x[5], vp8x[6] = byte(width-1), byte((width-1)>>8), byte((width-1)>>16)
+	vp8x[7], vp8x[8], vp8x[9] = byte(height-1), byte((height-1)>>8), byte((height-1)>>16)
+
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	for _, chunk := range []struct {
+		kind string
+		data []byte
+	}{{"VP8X", vp8x}, {"VP8L", []byte{0x2F, 0, 0, 0, 0}}} {
+		body.WriteString(chunk.kind)
+		binary.Write(&body, binary.LittleEndian, uint32(len(chunk.data)))
+		body.Write(chunk.data)
+		if len(chunk.data)%2 == 1 {
+			body.WriteByte(0)
+		}
+	}
+
+	var file bytes.Buffer
+	file.WriteString("RIFF")
+	binary.Write(&file, binary.LittleEndian, uint32(body.Len()))
+	file.Write(body.Bytes())
+	return file.Bytes()
+}
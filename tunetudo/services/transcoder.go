@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"tunetudo/logger"
+)
+
+// Transcode states stored in uploads.transcode_status. Uploads that need no
+// conversion keep a NULL status
+const (
+	TranscodePending    = "pending"
+	TranscodeProcessing = "processing"
+	TranscodeDone       = "done"
+	TranscodeFailed     = "failed"
+)
+
+// Transcoder converts an audio file into the format streamed to browsers
+type Transcoder interface {
+	// Format is the extension (without the dot) of the files it writes
+	Format() string
+	Transcode(ctx context.Context, srcPath, destPath string) error
+}
+
+// transcodeCodecs maps supported target formats to ffmpeg's audio encoder
+var transcodeCodecs = map[string]string{
+	"mp3": "libmp3lame",
+	"m4a": "aac",
+}
+
+// FFmpegTranscoder shells out to ffmpeg, dropping any video stream
+type FFmpegTranscoder struct {
+	binary  string
+	format  string
+	bitrate string
+	timeout time.Duration
+}
+
+// NewFFmpegTranscoder returns a transcoder writing format ("mp3" or "m4a")
+// at bitrate (e.g. "192k"). Each run is killed after timeout
+func NewFFmpegTranscoder(binary, format, bitrate string, timeout time.Duration) (*FFmpegTranscoder, error) {
+	format = strings.ToLower(strings.TrimPrefix(format, "."))
+	if _, ok := transcodeCodecs[format]; !ok {
+		return nil, fmt.Errorf("unsupported transcode format %q", format)
+	}
+	return &FFmpegTranscoder{binary: binary, format: format, bitrate: bitrate, timeout: timeout}, nil
+}
+
+func (t *FFmpegTranscoder) Format() string {
+	return t.format
+}
+
+func (t *FFmpegTranscoder) Transcode(ctx context.Context, srcPath, destPath string) error {
+	if t.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, t.binary,
+		"-nostdin", "-y", "-loglevel", "error",
+		"-i", srcPath,
+		"-vn", "-c:a", transcodeCodecs[t.format], "-b:a", t.bitrate,
+		destPath,
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("ffmpeg: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// transcodeUpload converts an upload's original file and, once the new file
+// exists, points its song at it. The original stays where it is, referenced
+// by uploads.stored_path. Runs in the background after the upload returns
+func (s *UserService) transcodeUpload(uploadID, songID int, srcPath string) {
+	defer s.transcodes.Done()
+
+	if _, err := s.db.Exec(`UPDATE uploads SET transcode_status = ? WHERE id = ?`, TranscodeProcessing, uploadID); err != nil {
+		logger.Error(logger.CategoryDB, "Failed to mark upload as transcoding", err)
+		return
+	}
+
+	destPath := strings.TrimSuffix(srcPath, filepath.Ext(srcPath)) + "." + s.transcoder.Format()
+	if err := s.applyTranscode(uploadID, songID, srcPath, destPath); err != nil {
+		os.Remove(destPath)
+		logger.Error(logger.CategoryUpload, "Failed to transcode upload", err)
+
+		// The details stay in the log; they can include server paths
+		if _, err := s.db.Exec(
+			`UPDATE uploads SET transcode_status = ?, error_message = ? WHERE id = ?`,
+			TranscodeFailed, "transcoding failed", uploadID,
+		); err != nil {
+			logger.Error(logger.CategoryDB, "Failed to record transcode failure", err)
+		}
+	}
+}
+
+func (s *UserService) applyTranscode(uploadID, songID int, srcPath, destPath string) error {
+	if err := s.transcoder.Transcode(context.Background(), srcPath, destPath); err != nil {
+		return err
+	}
+
+	relativePath, err := filepath.Rel(s.storagePath, destPath)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`UPDATE songs SET file_path = ?, format = ? WHERE id = ?`,
+		relativePath, s.transcoder.Format(), songID,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		`UPDATE uploads SET transcode_status = ?, error_message = NULL WHERE id = ?`,
+		TranscodeDone, uploadID,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
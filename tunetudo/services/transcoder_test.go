@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTranscoder records the upload's status at the time it runs and writes
+// a placeholder output file, or fails with err after a partial write
+type fakeTranscoder struct {
+	db         *sql.DB
+	err        error
+	calls      int
+	seenStatus string
+}
+
+func (f *fakeTranscoder) Format() string { return "mp3" }
+
+func (f *fakeTranscoder) Transcode(ctx context.Context, srcPath, destPath string) error {
+	f.calls++
+	f.db.QueryRow(`SELECT transcode_status FROM uploads ORDER BY id DESC LIMIT 1`).Scan(&f.seenStatus)
+	if f.err != nil {
+		os.WriteFile(destPath, []byte("partial"), 0644)
+		return f.err
+	}
+	return os.WriteFile(destPath, []byte("transcoded"), 0644)
+}
+
+type uploadTranscodeRow struct {
+	status       sql.NullString
+	errorMessage sql.NullString
+	songPath     string
+	songFormat   string
+}
+
+func loadTranscodeRow(t *testing.T, db *sql.DB, uploadID, songID int) uploadTranscodeRow {
+	var row uploadTranscodeRow
+	require.NoError(t, db.QueryRow(`SELECT transcode_status, error_message FROM uploads WHERE id = ?`, uploadID).
+		Scan(&row.status, &row.errorMessage))
+	require.NoError(t, db.QueryRow(`SELECT file_path, format FROM songs WHERE id = ?`, songID).
+		Scan(&row.songPath, &row.songFormat))
+	return row
+}
+
+func TestUploadTranscodeRepointsSong(t *testing.T) {
+	service, storageDir, userID, cleanup := setupTestUserService(t)
+	defer cleanup()
+	transcoder := &fakeTranscoder{db: service.db}
+	service.SetTranscoder(transcoder)
+
+	upload, err := service.UploadSong(userID, newTestFileHeader(t, "Live Take.wav", []byte("fake wav data")), 0)
+	require.NoError(t, err)
+	require.NotNil(t, upload.TranscodeStatus)
+	assert.Equal(t, TranscodePending, *upload.TranscodeStatus)
+
+	service.transcodes.Wait()
+
+	assert.Equal(t, 1, transcoder.calls)
+	assert.Equal(t, TranscodeProcessing, transcoder.seenStatus)
+
+	row := loadTranscodeRow(t, service.db, upload.ID, upload.SongID)
+	assert.Equal(t, TranscodeDone, row.status.String)
+	assert.False(t, row.errorMessage.Valid)
+	assert.Equal(t, "mp3", row.songFormat)
+	assert.Equal(t, strings.TrimSuffix(upload.StoredPath, ".wav")+".mp3", row.songPath)
+
+	// The original is kept alongside the transcoded file
+	assert.FileExists(t, filepath.Join(storageDir, upload.StoredPath))
+	assert.FileExists(t, filepath.Join(storageDir, row.songPath))
+}
+
+func TestUploadTranscodeFailureKeepsOriginal(t *testing.T) {
+	service, storageDir, userID, cleanup := setupTestUserService(t)
+	defer cleanup()
+	service.SetTranscoder(&fakeTranscoder{db: service.db, err: errors.New("ffmpeg: exit status 1")})
+
+	upload, err := service.UploadSong(userID, newTestFileHeader(t, "Live Take.wav", []byte("fake wav data")), 0)
+	require.NoError(t, err)
+	service.transcodes.Wait()
+
+	row := loadTranscodeRow(t, service.db, upload.ID, upload.SongID)
+	assert.Equal(t, TranscodeFailed, row.status.String)
+	assert.Equal(t, "transcoding failed", row.errorMessage.String)
+	assert.Equal(t, "wav", row.songFormat)
+	assert.Equal(t, upload.StoredPath, row.songPath)
+	assert.Equal(t, []string{filepath.Join(storageDir, upload.StoredPath)}, listStoredFiles(t, storageDir),
+		"partial output is removed")
+}
+
+func TestUploadTranscodeSkipsTargetFormat(t *testing.T) {
+	service, _, userID, cleanup := setupTestUserService(t)
+	defer cleanup()
+	transcoder := &fakeTranscoder{db: service.db}
+	service.SetTranscoder(transcoder)
+
+	upload, err := service.UploadSong(userID, newTestFileHeader(t, "Demo.mp3", []byte("fake mp3 data")), 0)
+	require.NoError(t, err)
+	service.transcodes.Wait()
+
+	assert.Nil(t, upload.TranscodeStatus)
+	assert.Equal(t, 0, transcoder.calls)
+	row := loadTranscodeRow(t, service.db, upload.ID, upload.SongID)
+	assert.False(t, row.status.Valid)
+}
+
+func TestNewFFmpegTranscoderRejectsUnknownFormat(t *testing.T) {
+	_, err := NewFFmpegTranscoder("ffmpeg", "ogg", "192k", 0)
+	assert.Error(t, err)
+
+	transcoder, err := NewFFmpegTranscoder("ffmpeg", ".M4A", "128k", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "m4a", transcoder.Format())
+}
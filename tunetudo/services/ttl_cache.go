@@ -0,0 +1,53 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// ttlCache holds a single value for up to ttl after it was stored. It is
+// safe for concurrent use; a zero ttl disables caching
+type ttlCache[T any] struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu        sync.RWMutex
+	value     T
+	valid     bool
+	expiresAt time.Time
+}
+
+func newTTLCache[T any](ttl time.Duration) *ttlCache[T] {
+	return &ttlCache[T]{ttl: ttl, now: time.Now}
+}
+
+// Get returns the cached value if one is stored and still fresh
+func (c *ttlCache[T]) Get() (T, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.valid || !c.now().Before(c.expiresAt) {
+		var zero T
+		return zero, false
+	}
+	return c.value, true
+}
+
+func (c *ttlCache[T]) Set(value T) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.value = value
+	c.valid = true
+	c.expiresAt = c.now().Add(c.ttl)
+}
+
+// Invalidate drops the cached value so the next Get misses
+func (c *ttlCache[T]) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var zero T
+	c.value = zero
+	c.valid = false
+}
@@ -0,0 +1,37 @@
+package services
+
+import "fmt"
+
+// Upload size limits used until the services are given configured ones
+const (
+	defaultMaxAudioUploadBytes int64 = 50 * 1024 * 1024
+	defaultMaxImageUploadBytes int64 = 5 * 1024 * 1024
+)
+
+// fileTooLarge is the error for a file over limit bytes, stated in MB when
+// the limit is a whole number of them
+func fileTooLarge(limit int64) error {
+	if limit%(1024*1024) == 0 {
+		return fmt.Errorf("file too large. Maximum size is %dMB", limit/(1024*1024))
+	}
+	return fmt.Errorf("file too large. Maximum size is %d bytes", limit)
+}
+
+// SetUploadLimits sets the largest track and profile image, in bytes, that
+// users can upload. Non-positive values keep the current limit
+func (s *UserService) SetUploadLimits(audioBytes, imageBytes int64) {
+	if audioBytes > 0 {
+		s.maxAudioBytes = audioBytes
+	}
+	if imageBytes > 0 {
+		s.maxImageBytes = imageBytes
+	}
+}
+
+// SetMaxAudioUploadBytes sets the largest track, in bytes, admins can add
+// to the catalog. Non-positive values keep the current limit
+func (s *AdminService) SetMaxAudioUploadBytes(limit int64) {
+	if limit > 0 {
+		s.maxAudioBytes = limit
+	}
+}
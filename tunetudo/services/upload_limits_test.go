@@ -0,0 +1,53 @@
+package services
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"tunetudo/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserUploadLimitsAreConfigurable(t *testing.T) {
+	service, storageDir, userID, cleanup := setupTestUserService(t)
+	defer cleanup()
+	service.SetUploadLimits(1024, 512)
+
+	_, err := service.UploadSong(userID, newTestFileHeader(t, "big.mp3", bytes.Repeat([]byte("a"), 1025)), 0)
+	require.Error(t, err)
+	assert.Equal(t, "file too large. Maximum size is 1024 bytes", err.Error())
+
+	_, err = service.UploadSong(userID, newTestFileHeader(t, "small.mp3", bytes.Repeat([]byte("a"), 1024)), 0)
+	assert.NoError(t, err)
+
+	err = service.UploadProfileImage(userID, newTestFileHeader(t, "me.png", bytes.Repeat([]byte("a"), 513)))
+	require.Error(t, err)
+	assert.Equal(t, "file too large. Maximum size is 512 bytes", err.Error())
+
+	chunked := NewChunkedUploadService(service, filepath.Join(storageDir, "tmp", "chunks"))
+	_, err = chunked.InitUpload(userID, models.InitUploadRequest{Filename: "big.mp3", TotalSize: 1025, TotalChunks: 1})
+	require.Error(t, err)
+	assert.Equal(t, "file too large. Maximum size is 1024 bytes", err.Error())
+
+	// Non-positive values keep the current limits
+	service.SetUploadLimits(0, -1)
+	assert.Equal(t, int64(1024), service.maxAudioBytes)
+	assert.Equal(t, int64(512), service.maxImageBytes)
+}
+
+func TestAdminUploadLimitIsConfigurable(t *testing.T) {
+	service, storageDir, cleanup := setupTestAdminService(t)
+	defer cleanup()
+	service.SetMaxAudioUploadBytes(2 * 1024 * 1024)
+
+	big := newTestFileHeader(t, "big.mp3", bytes.Repeat([]byte("a"), 2*1024*1024+1))
+	_, err := service.UploadSong(big, "Big", "Artist", "", 0, 0, 0, 0)
+	require.Error(t, err)
+	assert.Equal(t, "file too large. Maximum size is 2MB", err.Error())
+	assert.Empty(t, listStoredFiles(t, storageDir))
+
+	_, err = service.UploadSong(newTestFileHeader(t, "ok.mp3", []byte("fake mp3 data")), "Ok", "Artist", "", 0, 0, 0, 0)
+	assert.NoError(t, err)
+}
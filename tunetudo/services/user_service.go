@@ -1,41 +1,85 @@
 package services
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	apperrors "tunetudo/errors"
+	"tunetudo/logger"
+	"tunetudo/metrics"
 	"tunetudo/models"
 
 	"github.com/google/uuid"
 )
 
 type UserService struct {
-	db          *sql.DB
-	storagePath string
+	db            *sql.DB
+	storagePath   string
+	maxAudioBytes int64
+	maxImageBytes int64
+
+	// transcoder, when set, converts uploads to a web-friendly format in
+	// the background; transcodes tracks the conversions still running
+	transcoder Transcoder
+	transcodes sync.WaitGroup
 }
 
 func NewUserService(db *sql.DB, storagePath string) *UserService {
 	return &UserService{
-		db:          db,
-		storagePath: storagePath,
+		db:            db,
+		storagePath:   storagePath,
+		maxAudioBytes: defaultMaxAudioUploadBytes,
+		maxImageBytes: defaultMaxImageUploadBytes,
 	}
 }
 
+// SetTranscoder enables background conversion of uploads whose format
+// differs from the transcoder's
+func (s *UserService) SetTranscoder(transcoder Transcoder) {
+	s.transcoder = transcoder
+}
+
 // UploadProfileImage uploads a user's profile picture
 func (s *UserService) UploadProfileImage(userID int, file *multipart.FileHeader) error {
-	// Validate file size (5MB limit)
-	if file.Size > 5*1024*1024 {
-		return errors.New("file too large. Maximum size is 5MB")
+	// Validate file size
+	if file.Size > s.maxImageBytes {
+		return fileTooLarge(s.maxImageBytes)
 	}
 
-	// Validate file type
-	ext := filepath.Ext(file.Filename)
-	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" {
-		return errors.New("unsupported file type. Only JPG and PNG allowed")
+	// Validate file type, from the extension and then the content
+	ext := strings.ToLower(filepath.Ext(file.Filename))
+	if _, ok := imageFormats[ext]; !ok {
+		return errors.New("unsupported file type. Only JPG, PNG, WebP and AVIF allowed")
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := checkImage(ext, src); err != nil {
+		return err
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	// Remember the current avatar so it can be removed once replaced
+	var previousPaths [3]sql.NullString
+	if err := s.db.QueryRow(
+		`SELECT profile_image_path, profile_image_medium_path, profile_image_thumb_path FROM users WHERE id = ?`, userID,
+	).Scan(&previousPaths[0], &previousPaths[1], &previousPaths[2]); err != nil {
+		return err
 	}
 
 	// Create storage directory
@@ -49,45 +93,102 @@ func (s *UserService) UploadProfileImage(userID int, file *multipart.FileHeader)
 	filePath := filepath.Join(profileDir, filename)
 
 	// Save file
-	src, err := file.Open()
+	dst, err := os.Create(filePath)
 	if err != nil {
 		return err
 	}
-	defer src.Close()
-
-	dst, err := os.Create(filePath)
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
+		os.Remove(filePath)
 		return err
 	}
-	defer dst.Close()
 
-	if _, err = io.Copy(dst, src); err != nil {
-		return err
+	// Smaller copies for avatars in lists. Without them clients fall back
+	// to the original, so a failure here doesn't fail the upload
+	relativeDir := filepath.Join("images", "profiles", fmt.Sprintf("%d", userID))
+	relativePath := filepath.Join(relativeDir, filename)
+	var mediumPath, thumbPath *string
+	sizes, err := writeProfileImageSizes(filePath)
+	if err != nil {
+		logger.Warning(logger.CategoryFile, "No resized profile images for user_id=%d (%s)", userID, ext)
+	} else {
+		medium, thumb := filepath.Join(relativeDir, sizes.medium), filepath.Join(relativeDir, sizes.thumb)
+		mediumPath, thumbPath = &medium, &thumb
 	}
 
 	// Update database
-	relativePath := filepath.Join("images", "profiles", fmt.Sprintf("%d", userID), filename)
 	_, err = s.db.Exec(
-		`UPDATE users SET profile_image_path = ? WHERE id = ?`,
-		relativePath, userID,
+		`UPDATE users SET profile_image_path = ?, profile_image_medium_path = ?, profile_image_thumb_path = ? WHERE id = ?`,
+		relativePath, mediumPath, thumbPath, userID,
 	)
+	if err != nil {
+		os.Remove(filePath)
+		if sizes != nil {
+			sizes.remove(profileDir)
+		}
+		return err
+	}
+
+	// Best effort: the new avatar is already in place
+	for _, previousPath := range previousPaths {
+		if !previousPath.Valid || previousPath.String == "" {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.storagePath, previousPath.String)); err != nil && !os.IsNotExist(err) {
+			logger.Warning(logger.CategoryFile, "Failed to remove previous profile image for user_id=%d", userID)
+		}
+	}
+
+	return nil
+}
+
+// DuplicateUploadError is returned when a user uploads a file they already
+// have in their library
+type DuplicateUploadError struct {
+	SongID int
+}
+
+func (e *DuplicateUploadError) Error() string {
+	return fmt.Sprintf("you've already uploaded this file (song ID %d)", e.SongID)
+}
 
-	return err
+// UploadSong uploads a song to user's personal library, filed under
+// categoryID unless it is zero
+func (s *UserService) UploadSong(userID int, file *multipart.FileHeader, categoryID int) (*models.Upload, error) {
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	return s.storeUploadedSong(userID, file.Filename, file.Size, src, categoryID)
 }
 
-// UploadSong uploads a song to user's personal library
-func (s *UserService) UploadSong(userID int, file *multipart.FileHeader) (*models.Upload, error) {
-	// Validate file size (50MB limit)
-	if file.Size > 50*1024*1024 {
-		return nil, errors.New("file too large. Maximum size is 50MB")
+// storeUploadedSong validates and saves an uploaded track, creating its
+// uploads and songs rows. Shared by direct and chunked uploads.
+func (s *UserService) storeUploadedSong(userID int, originalFilename string, size int64, src io.Reader, categoryID int) (*models.Upload, error) {
+	// Validate file size
+	if size > s.maxAudioBytes {
+		return nil, fileTooLarge(s.maxAudioBytes)
 	}
 
 	// Validate file type
-	ext := filepath.Ext(file.Filename)
+	ext := filepath.Ext(originalFilename)
 	if ext != ".mp4" && ext != ".wav" && ext != ".mp3" {
 		return nil, errors.New("unsupported file format. Only MP4, WAV, and MP3 allowed")
 	}
 
+	if err := checkCategory(s.db, categoryID); err != nil {
+		return nil, err
+	}
+	var category *int
+	if categoryID > 0 {
+		category = &categoryID
+	}
+
 	// Create storage directory
 	uploadDir := filepath.Join(s.storagePath, "media", "uploads", fmt.Sprintf("%d", userID))
 	if err := os.MkdirAll(uploadDir, 0755); err != nil {
@@ -98,29 +199,57 @@ func (s *UserService) UploadSong(userID int, file *multipart.FileHeader) (*model
 	filename := fmt.Sprintf("%s%s", uuid.New().String(), ext)
 	filePath := filepath.Join(uploadDir, filename)
 
-	// Save file
-	src, err := file.Open()
-	if err != nil {
+	// Save file, hashing it on the way so repeats can be recognized
+	hasher := sha256.New()
+	if _, err := saveFileAtomically(io.TeeReader(src, hasher), filePath); err != nil {
 		return nil, err
 	}
-	defer src.Close()
+	contentHash := hex.EncodeToString(hasher.Sum(nil))
+
+	// The uploads and songs rows are written together so an upload can
+	// never exist without its song
+	committed := false
+	defer func() {
+		if !committed {
+			os.Remove(filePath)
+		}
+	}()
 
-	dst, err := os.Create(filePath)
-	if err != nil {
+	// A file whose song has since been deleted may be uploaded again
+	var existingSongID int
+	err := s.db.QueryRow(`
+		SELECT u.song_id FROM uploads u
+		JOIN songs s ON s.id = u.song_id
+		WHERE u.user_id = ? AND u.content_hash = ? AND s.deleted_at IS NULL
+		LIMIT 1
+	`, userID, contentHash).Scan(&existingSongID)
+	if err == nil {
+		logger.Info(logger.CategoryFile, "Duplicate upload rejected: user_id=%d song_id=%d", userID, existingSongID)
+		return nil, &DuplicateUploadError{SongID: existingSongID}
+	}
+	if err != sql.ErrNoRows {
 		return nil, err
 	}
-	defer dst.Close()
 
-	if _, err = io.Copy(dst, src); err != nil {
+	tx, err := s.db.Begin()
+	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
+
+	// Store upload record, queued for transcoding if it isn't already in
+	// the streamed format
+	var transcodeStatus *string
+	if s.transcoder != nil && !strings.EqualFold(ext[1:], s.transcoder.Format()) {
+		pending := TranscodePending
+		transcodeStatus = &pending
+	}
 
-	// Store upload record
 	relativePath := filepath.Join("media", "uploads", fmt.Sprintf("%d", userID), filename)
-	result, err := s.db.Exec(
-		`INSERT INTO uploads (user_id, original_filename, stored_path, file_size_bytes) 
-		VALUES (?, ?, ?, ?)`,
-		userID, file.Filename, relativePath, file.Size,
+	result, err := tx.Exec(
+		`INSERT INTO uploads (user_id, original_filename, stored_path, file_size_bytes, transcode_status, content_hash) 
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		userID, originalFilename, relativePath, size, transcodeStatus, contentHash,
 	)
 	if err != nil {
 		return nil, err
@@ -130,45 +259,72 @@ func (s *UserService) UploadSong(userID int, file *multipart.FileHeader) (*model
 
 	// Create a song entry for this upload
 	// Extract title from filename (remove extension)
-	title := file.Filename[:len(file.Filename)-len(ext)]
+	title := originalFilename[:len(originalFilename)-len(ext)]
 	
 	// Get or create "Unknown Artist"
 	var artistID int
-	err = s.db.QueryRow(`SELECT id FROM artists WHERE name = ?`, "Unknown Artist").Scan(&artistID)
+	err = tx.QueryRow(`SELECT id FROM artists WHERE name = ?`, "Unknown Artist").Scan(&artistID)
 	if err != nil {
-		result, _ := s.db.Exec(`INSERT INTO artists (name, description) VALUES (?, ?)`, 
-			"Unknown Artist", "User uploaded content")
+		result, err := tx.Exec(`INSERT INTO artists (name, name_key, description) VALUES (?, ?, ?)`,
+			"Unknown Artist", models.ArtistNameKey("Unknown Artist"), "User uploaded content")
+		if err != nil {
+			return nil, err
+		}
 		aid, _ := result.LastInsertId()
 		artistID = int(aid)
 	}
 
-	_, err = s.db.Exec(
-		`INSERT INTO songs (title, artist_id, file_path, format, uploaded_by_user_id, duration_seconds) 
-		VALUES (?, ?, ?, ?, ?, ?)`,
-		title, artistID, relativePath, ext[1:], userID, 0,
+	result, err = tx.Exec(
+		`INSERT INTO songs (title, artist_id, category_id, file_path, format, uploaded_by_user_id, duration_seconds) 
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		title, artistID, category, relativePath, ext[1:], userID, 0,
 	)
+	if err != nil {
+		return nil, err
+	}
+
+	songID, _ := result.LastInsertId()
+	if _, err := tx.Exec(`UPDATE uploads SET song_id = ? WHERE id = ?`, songID, uploadID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	committed = true
+	metrics.RecordUpload(size)
+
+	if transcodeStatus != nil {
+		s.transcodes.Add(1)
+		go s.transcodeUpload(int(uploadID), int(songID), filePath)
+	}
 
 	upload := &models.Upload{
 		ID:               int(uploadID),
 		UserID:           userID,
-		OriginalFilename: file.Filename,
+		SongID:           int(songID),
+		OriginalFilename: originalFilename,
 		StoredPath:       relativePath,
-		FileSizeBytes:    file.Size,
+		FileSizeBytes:    size,
+		TranscodeStatus:  transcodeStatus,
 	}
 
 	return upload, nil
 }
 
-// GetUserUploads retrieves all uploads for a user
-func (s *UserService) GetUserUploads(userID int) ([]models.Song, error) {
+// GetUserUploads retrieves all uploads for a user, only those in
+// categoryID unless it is zero
+func (s *UserService) GetUserUploads(userID, categoryID int) ([]models.Song, error) {
 	rows, err := s.db.Query(`
-		SELECT s.id, s.title, s.artist_id, s.duration_seconds, s.file_path, 
-			   s.format, s.created_at, a.name as artist_name
+		SELECT s.id, s.title, s.artist_id, s.category_id, s.duration_seconds, s.file_path, 
+			   s.format, s.created_at, a.name as artist_name, c.name as category_name
 		FROM songs s
 		LEFT JOIN artists a ON s.artist_id = a.id
-		WHERE s.uploaded_by_user_id = ?
+		LEFT JOIN categories c ON s.category_id = c.id
+		WHERE s.uploaded_by_user_id = ? AND s.deleted_at IS NULL
+		AND (? = 0 OR s.category_id = ?)
 		ORDER BY s.created_at DESC
-	`, userID)
+	`, userID, categoryID, categoryID)
 
 	if err != nil {
 		return nil, err
@@ -178,11 +334,11 @@ func (s *UserService) GetUserUploads(userID int) ([]models.Song, error) {
 	var songs []models.Song
 	for rows.Next() {
 		var song models.Song
-		var artistName sql.NullString
+		var artistName, categoryName sql.NullString
 
 		err := rows.Scan(
-			&song.ID, &song.Title, &song.ArtistID, &song.DurationSeconds,
-			&song.FilePath, &song.Format, &song.CreatedAt, &artistName,
+			&song.ID, &song.Title, &song.ArtistID, &song.CategoryID, &song.DurationSeconds,
+			&song.FilePath, &song.Format, &song.CreatedAt, &artistName, &categoryName,
 		)
 		if err != nil {
 			continue
@@ -191,6 +347,9 @@ func (s *UserService) GetUserUploads(userID int) ([]models.Song, error) {
 		if artistName.Valid {
 			song.Artist = &models.Artist{Name: artistName.String}
 		}
+		if categoryName.Valid {
+			song.Category = &models.Category{Name: categoryName.String}
+		}
 
 		songs = append(songs, song)
 	}
@@ -202,11 +361,15 @@ func (s *UserService) GetUserUploads(userID int) ([]models.Song, error) {
 func (s *UserService) GetProfile(userID int) (*models.User, error) {
 	var user models.User
 	err := s.db.QueryRow(`
-		SELECT id, username, email, is_admin, profile_image_path, created_at, last_login
+		SELECT id, username, email, is_admin, profile_image_path,
+			   COALESCE(profile_image_medium_path, profile_image_path),
+			   COALESCE(profile_image_thumb_path, profile_image_path),
+			   share_now_playing, safe_mode, created_at, last_login
 		FROM users WHERE id = ?
 	`, userID).Scan(
 		&user.ID, &user.Username, &user.Email, &user.IsAdmin,
-		&user.ProfileImagePath, &user.CreatedAt, &user.LastLogin,
+		&user.ProfileImagePath, &user.ProfileImageMediumPath, &user.ProfileImageThumbPath,
+		&user.ShareNowPlaying, &user.SafeMode, &user.CreatedAt, &user.LastLogin,
 	)
 
 	if err != nil {
@@ -214,4 +377,212 @@ func (s *UserService) GetProfile(userID int) (*models.User, error) {
 	}
 
 	return &user, nil
-}
\ No newline at end of file
+}
+
+// UpdateProfile changes the user's username, email, whether others can see
+// what they are playing and/or safe mode. A new address takes effect
+// immediately but loses the verified flag until a provider confirms it
+func (s *UserService) UpdateProfile(userID int, req models.UpdateProfileRequest) (*models.User, error) {
+	var sets []string
+	var args []interface{}
+
+	if req.Username != nil {
+		username, err := NormalizeUsername(*req.Username)
+		if err != nil {
+			return nil, err
+		}
+		if taken, err := s.profileFieldTaken("username", username, userID); err != nil {
+			return nil, err
+		} else if taken {
+			return nil, errors.New("username already taken")
+		}
+		sets = append(sets, "username = ?")
+		args = append(args, username)
+	}
+
+	if req.Email != nil {
+		email, err := NormalizeEmail(*req.Email)
+		if err != nil {
+			return nil, err
+		}
+		if taken, err := s.profileFieldTaken("email", email, userID); err != nil {
+			return nil, err
+		} else if taken {
+			return nil, errors.New("email already in use")
+		}
+		// A new address hasn't been verified by anyone
+		sets = append(sets, "email = ?", "email_verified = CASE WHEN email = ? THEN email_verified ELSE 0 END")
+		args = append(args, email, email)
+	}
+
+	if req.ShareNowPlaying != nil {
+		sets = append(sets, "share_now_playing = ?")
+		args = append(args, *req.ShareNowPlaying)
+	}
+
+	if req.SafeMode != nil {
+		sets = append(sets, "safe_mode = ?")
+		args = append(args, *req.SafeMode)
+	}
+
+	if len(sets) == 0 {
+		return nil, errors.New("nothing to update")
+	}
+
+	args = append(args, userID)
+	result, err := s.db.Exec(`UPDATE users SET `+strings.Join(sets, ", ")+` WHERE id = ?`, args...)
+	if err != nil {
+		// The unique constraints catch a concurrent claim of the same name
+		if isUniqueViolation(err) {
+			logger.Warning(logger.CategoryDB, "Profile update conflicted for user_id=%d", userID)
+			return nil, errors.New("username or email already exists")
+		}
+		logger.Error(logger.CategoryDB, "Profile update failed", err)
+		return nil, internalError("failed to update profile", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, errors.New("user not found")
+	}
+
+	logger.Info(logger.CategoryDB, "Profile updated: user_id=%d", userID)
+	return s.GetProfile(userID)
+}
+
+// profileFieldTaken reports whether another user already uses value for column
+func (s *UserService) profileFieldTaken(column, value string, userID int) (bool, error) {
+	var count int
+	err := s.db.QueryRow(
+		`SELECT COUNT(*) FROM users WHERE LOWER(`+column+`) = LOWER(?) AND id != ?`,
+		value, userID,
+	).Scan(&count)
+	if err != nil {
+		logger.Error(logger.CategoryDB, "Failed to check profile uniqueness", err)
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// ExportUserData gathers the user's own data for download. Playlists they
+// only collaborate on belong to someone else and are left out, as is the
+// password hash
+func (s *UserService) ExportUserData(userID int) (models.UserExport, error) {
+	export := models.UserExport{
+		ExportedAt:        time.Now().UTC(),
+		Playlists:         []models.ExportedPlaylist{},
+		Uploads:           []models.Upload{},
+		PlaybackPositions: []models.PlaybackPosition{},
+	}
+
+	profile, err := s.GetProfile(userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return export, apperrors.NotFoundError("user not found")
+		}
+		return export, apperrors.InternalError(err)
+	}
+	export.Profile = *profile
+
+	if export.Playlists, err = s.exportPlaylists(userID); err != nil {
+		return export, err
+	}
+	if export.Uploads, err = s.exportUploads(userID); err != nil {
+		return export, err
+	}
+	if export.PlaybackPositions, err = s.exportPlaybackPositions(userID); err != nil {
+		return export, err
+	}
+
+	logger.Info(logger.CategoryDB, "User data exported: user_id=%d", userID)
+	return export, nil
+}
+
+func (s *UserService) exportPlaylists(userID int) ([]models.ExportedPlaylist, error) {
+	rows, err := s.db.Query(`
+		SELECT p.id, p.user_id, p.name, p.description, p.is_public, p.created_at,`+playlistTotalsColumns+`
+		FROM playlists p WHERE p.user_id = ?
+		ORDER BY p.created_at, p.id
+	`, userID)
+	if err != nil {
+		return nil, apperrors.InternalError(err)
+	}
+
+	playlists := []models.ExportedPlaylist{}
+	for rows.Next() {
+		var p models.ExportedPlaylist
+		if err := rows.Scan(&p.ID, &p.UserID, &p.Name, &p.Description, &p.IsPublic, &p.CreatedAt,
+			&p.SongCount, &p.TotalDurationSeconds); err != nil {
+			rows.Close()
+			return nil, apperrors.InternalError(err)
+		}
+		playlists = append(playlists, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, apperrors.InternalError(err)
+	}
+
+	playlistService := NewPlaylistService(s.db)
+	for i := range playlists {
+		songs, err := playlistService.GetPlaylistSongs(playlists[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		playlists[i].Songs = songs
+	}
+	return playlists, nil
+}
+
+func (s *UserService) exportUploads(userID int) ([]models.Upload, error) {
+	rows, err := s.db.Query(`
+		SELECT id, user_id, original_filename, stored_path, file_size_bytes, error_message, transcode_status, created_at
+		FROM uploads WHERE user_id = ?
+		ORDER BY created_at, id
+	`, userID)
+	if err != nil {
+		return nil, apperrors.InternalError(err)
+	}
+	defer rows.Close()
+
+	uploads := []models.Upload{}
+	for rows.Next() {
+		var u models.Upload
+		var originalFilename, storedPath sql.NullString
+		var size sql.NullInt64
+		if err := rows.Scan(&u.ID, &u.UserID, &originalFilename, &storedPath, &size, &u.ErrorMessage, &u.TranscodeStatus, &u.CreatedAt); err != nil {
+			return nil, apperrors.InternalError(err)
+		}
+		u.OriginalFilename = originalFilename.String
+		u.StoredPath = storedPath.String
+		u.FileSizeBytes = size.Int64
+		uploads = append(uploads, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperrors.InternalError(err)
+	}
+	return uploads, nil
+}
+
+func (s *UserService) exportPlaybackPositions(userID int) ([]models.PlaybackPosition, error) {
+	rows, err := s.db.Query(`
+		SELECT song_id, position_seconds, updated_at
+		FROM playback_positions WHERE user_id = ?
+		ORDER BY updated_at DESC
+	`, userID)
+	if err != nil {
+		return nil, apperrors.InternalError(err)
+	}
+	defer rows.Close()
+
+	positions := []models.PlaybackPosition{}
+	for rows.Next() {
+		var p models.PlaybackPosition
+		if err := rows.Scan(&p.SongID, &p.PositionSeconds, &p.UpdatedAt); err != nil {
+			return nil, apperrors.InternalError(err)
+		}
+		positions = append(positions, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperrors.InternalError(err)
+	}
+	return positions, nil
+}
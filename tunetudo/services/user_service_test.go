@@ -0,0 +1,423 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	apperrors "tunetudo/errors"
+	"tunetudo/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupTestUserService(t *testing.T) (*UserService, string, int, func()) {
+	db := setupTestDB(t)
+
+	storageDir := "./test_storage_" + t.Name()
+	os.MkdirAll(storageDir, 0755)
+
+	result, err := db.Exec(`INSERT INTO users (username, email, password_hash) VALUES (?, ?, ?)`,
+		"uploaduser", "upload@test.com", "hash")
+	require.NoError(t, err)
+	userID, _ := result.LastInsertId()
+
+	service := NewUserService(db, storageDir)
+
+	cleanup := func() {
+		db.Close()
+		os.RemoveAll(storageDir)
+	}
+
+	return service, storageDir, int(userID), cleanup
+}
+
+func TestUploadSongReturnsSongID(t *testing.T) {
+	service, storageDir, userID, cleanup := setupTestUserService(t)
+	defer cleanup()
+
+	file := newTestFileHeader(t, "My Demo.mp3", []byte("fake mp3 data"))
+
+	upload, err := service.UploadSong(userID, file, 0)
+	require.NoError(t, err)
+	require.Greater(t, upload.SongID, 0)
+
+	playbackService := NewPlaybackService(service.db, storageDir)
+	song, err := playbackService.GetSongByID(upload.SongID)
+	require.NoError(t, err)
+	assert.Equal(t, "My Demo", song.Title)
+	assert.Equal(t, upload.StoredPath, song.FilePath)
+	require.NotNil(t, song.UploadedByUserID)
+	assert.Equal(t, userID, *song.UploadedByUserID)
+}
+
+func TestUploadSongCategory(t *testing.T) {
+	service, storageDir, userID, cleanup := setupTestUserService(t)
+	defer cleanup()
+
+	rock, err := service.UploadSong(userID, newTestFileHeader(t, "Garage Take.mp3", []byte("fake mp3 data")), 2)
+	require.NoError(t, err)
+	plain, err := service.UploadSong(userID, newTestFileHeader(t, "Voice Memo.mp3", []byte("other fake mp3 data")), 0)
+	require.NoError(t, err)
+
+	t.Run("Category is stored on the song", func(t *testing.T) {
+		playback := NewPlaybackService(service.db, storageDir)
+		song, err := playback.GetSongByID(rock.SongID)
+		require.NoError(t, err)
+		require.NotNil(t, song.CategoryID)
+		assert.Equal(t, 2, *song.CategoryID)
+
+		song, err = playback.GetSongByID(plain.SongID)
+		require.NoError(t, err)
+		assert.Nil(t, song.CategoryID, "no category leaves the song uncategorized")
+	})
+
+	t.Run("Uploads can be filtered by category", func(t *testing.T) {
+		all, err := service.GetUserUploads(userID, 0)
+		require.NoError(t, err)
+		assert.Len(t, all, 2)
+
+		inRock, err := service.GetUserUploads(userID, 2)
+		require.NoError(t, err)
+		require.Len(t, inRock, 1)
+		assert.Equal(t, rock.SongID, inRock[0].ID)
+		require.NotNil(t, inRock[0].Category)
+		assert.Equal(t, "Rock", inRock[0].Category.Name)
+
+		inJazz, err := service.GetUserUploads(userID, 3)
+		require.NoError(t, err)
+		assert.Empty(t, inJazz)
+	})
+
+	t.Run("Unknown category is rejected", func(t *testing.T) {
+		_, err := service.UploadSong(userID, newTestFileHeader(t, "Lost.mp3", []byte("third fake mp3 data")), 999)
+		assert.EqualError(t, err, "invalid category")
+		assert.Equal(t, 2, countRows(t, service.db, "uploads"))
+	})
+
+	t.Run("Categorized uploads stay out of the catalog", func(t *testing.T) {
+		search := NewSearchService(service.db)
+		page, err := search.GetSongsByCategory(2, 50, 0, "", false)
+		require.NoError(t, err)
+		assert.Zero(t, page.Meta.Total)
+	})
+}
+
+func TestUploadSongDetectsDuplicates(t *testing.T) {
+	service, storageDir, userID, cleanup := setupTestUserService(t)
+	defer cleanup()
+
+	first, err := service.UploadSong(userID, newTestFileHeader(t, "Demo.mp3", []byte("fake mp3 data")), 0)
+	require.NoError(t, err)
+
+	t.Run("Identical content is rejected", func(t *testing.T) {
+		_, err := service.UploadSong(userID, newTestFileHeader(t, "Demo (copy).mp3", []byte("fake mp3 data")), 0)
+		var duplicate *DuplicateUploadError
+		require.ErrorAs(t, err, &duplicate)
+		assert.Equal(t, first.SongID, duplicate.SongID)
+		assert.Equal(t, fmt.Sprintf("you've already uploaded this file (song ID %d)", first.SongID), err.Error())
+
+		assert.Equal(t, 1, countRows(t, service.db, "uploads"))
+		assert.Len(t, listStoredFiles(t, storageDir), 1, "the repeat is not kept on disk")
+	})
+
+	t.Run("Different content is accepted", func(t *testing.T) {
+		second, err := service.UploadSong(userID, newTestFileHeader(t, "Demo.mp3", []byte("fake mp3 data, take two")), 0)
+		require.NoError(t, err)
+		assert.NotEqual(t, first.SongID, second.SongID)
+	})
+
+	t.Run("Other users may upload the same file", func(t *testing.T) {
+		result, err := service.db.Exec(`INSERT INTO users (username, email, password_hash) VALUES (?, ?, ?)`,
+			"otheruser", "other@test.com", "hash")
+		require.NoError(t, err)
+		otherID, _ := result.LastInsertId()
+
+		_, err = service.UploadSong(int(otherID), newTestFileHeader(t, "Demo.mp3", []byte("fake mp3 data")), 0)
+		assert.NoError(t, err)
+	})
+
+	t.Run("A deleted song can be uploaded again", func(t *testing.T) {
+		_, err := service.db.Exec(`UPDATE songs SET deleted_at = CURRENT_TIMESTAMP WHERE id = ?`, first.SongID)
+		require.NoError(t, err)
+
+		again, err := service.UploadSong(userID, newTestFileHeader(t, "Demo.mp3", []byte("fake mp3 data")), 0)
+		require.NoError(t, err)
+		assert.NotEqual(t, first.SongID, again.SongID)
+	})
+}
+
+func TestUploadSongRollsBackOnFailure(t *testing.T) {
+	service, storageDir, userID, cleanup := setupTestUserService(t)
+	defer cleanup()
+
+	failSongInserts(t, service.db)
+
+	file := newTestFileHeader(t, "My Demo.mp3", []byte("fake mp3 data"))
+
+	upload, err := service.UploadSong(userID, file, 0)
+	assert.Error(t, err)
+	assert.Nil(t, upload)
+
+	assert.Equal(t, 0, countRows(t, service.db, "uploads"))
+	assert.Equal(t, 0, countRows(t, service.db, "artists"))
+	assert.Empty(t, listStoredFiles(t, storageDir))
+}
+
+func TestUpdateProfile(t *testing.T) {
+	service, _, userID, cleanup := setupTestUserService(t)
+	defer cleanup()
+
+	_, err := service.db.Exec(`INSERT INTO users (username, email, password_hash) VALUES (?, ?, ?)`,
+		"otheruser", "other@test.com", "hash")
+	require.NoError(t, err)
+
+	strPtr := func(s string) *string { return &s }
+
+	t.Run("Successful change", func(t *testing.T) {
+		user, err := service.UpdateProfile(userID, models.UpdateProfileRequest{
+			Username: strPtr("  renamed  "),
+			Email:    strPtr("renamed@test.com"),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "renamed", user.Username)
+		assert.Equal(t, "renamed@test.com", user.Email)
+		assert.Empty(t, user.PasswordHash)
+	})
+
+	t.Run("Duplicate username", func(t *testing.T) {
+		_, err := service.UpdateProfile(userID, models.UpdateProfileRequest{Username: strPtr("OtherUser")})
+		require.Error(t, err)
+		assert.Equal(t, "username already taken", err.Error())
+	})
+
+	t.Run("Invalid username", func(t *testing.T) {
+		_, err := service.UpdateProfile(userID, models.UpdateProfileRequest{Username: strPtr("no spaces")})
+		require.Error(t, err)
+		assert.Equal(t, "username may only contain letters, digits, '.', '_' and '-'", err.Error())
+
+		_, err = service.UpdateProfile(userID, models.UpdateProfileRequest{Username: strPtr(strings.Repeat("x", 33))})
+		require.Error(t, err)
+		assert.Equal(t, "username must be at most 32 characters", err.Error())
+	})
+
+	t.Run("Invalid email", func(t *testing.T) {
+		_, err := service.UpdateProfile(userID, models.UpdateProfileRequest{Email: strPtr("not-an-email")})
+		require.Error(t, err)
+		assert.Equal(t, "invalid email address", err.Error())
+
+		user, err := service.GetProfile(userID)
+		require.NoError(t, err)
+		assert.Equal(t, "renamed@test.com", user.Email)
+	})
+
+	t.Run("Concurrent claim of the same name", func(t *testing.T) {
+		// Someone takes the name between the check and the write
+		_, err := service.db.Exec(`CREATE TRIGGER claim_username BEFORE UPDATE OF username ON users
+			BEGIN INSERT INTO users (username, email, password_hash) VALUES (NEW.username, 'racer@test.com', 'hash'); END`)
+		require.NoError(t, err)
+		defer service.db.Exec(`DROP TRIGGER claim_username`)
+
+		_, err = service.UpdateProfile(userID, models.UpdateProfileRequest{Username: strPtr("racer")})
+		require.Error(t, err)
+		assert.Equal(t, "username or email already exists", err.Error())
+	})
+
+	t.Run("Database failure is not a conflict", func(t *testing.T) {
+		_, err := service.db.Exec(`CREATE TRIGGER fail_update BEFORE UPDATE ON users
+			BEGIN SELECT RAISE(ABORT, 'database is locked'); END`)
+		require.NoError(t, err)
+		defer service.db.Exec(`DROP TRIGGER fail_update`)
+
+		_, err = service.UpdateProfile(userID, models.UpdateProfileRequest{Username: strPtr("renamedagain")})
+		require.Error(t, err)
+		appErr := apperrors.GetAppError(err)
+		require.NotNil(t, appErr)
+		assert.Equal(t, apperrors.ErrCodeInternal, appErr.Code)
+	})
+}
+
+func TestExportUserData(t *testing.T) {
+	service, _, userID, cleanup := setupTestUserService(t)
+	defer cleanup()
+	seedTestData(t, service.db)
+
+	result, err := service.db.Exec(`INSERT INTO users (username, email, password_hash) VALUES (?, ?, ?)`,
+		"otheruser", "other@test.com", "hash")
+	require.NoError(t, err)
+	otherID, _ := result.LastInsertId()
+
+	playlists := NewPlaylistService(service.db)
+	workout, err := playlists.CreatePlaylist(userID, models.CreatePlaylistRequest{Name: "Workout"})
+	require.NoError(t, err)
+	require.NoError(t, playlists.AddSong(workout.ID, 1, userID))
+	require.NoError(t, playlists.AddSong(workout.ID, 2, userID))
+	_, err = playlists.CreatePlaylist(userID, models.CreatePlaylistRequest{Name: "Chill"})
+	require.NoError(t, err)
+
+	// A playlist the user can edit but doesn't own is not theirs to export
+	shared, err := playlists.CreatePlaylist(int(otherID), models.CreatePlaylistRequest{Name: "Shared"})
+	require.NoError(t, err)
+	_, err = playlists.AddCollaborator(shared.ID, int(otherID), "uploaduser", models.CollaboratorRoleEditor)
+	require.NoError(t, err)
+
+	_, err = service.UploadSong(userID, newTestFileHeader(t, "demo.mp3", []byte("fake mp3 data")), 0)
+	require.NoError(t, err)
+
+	export, err := service.ExportUserData(userID)
+	require.NoError(t, err)
+
+	assert.Equal(t, "uploaduser", export.Profile.Username)
+	require.Len(t, export.Playlists, 2)
+	var names []string
+	for _, p := range export.Playlists {
+		assert.Equal(t, userID, p.UserID)
+		names = append(names, p.Name)
+	}
+	assert.ElementsMatch(t, []string{"Workout", "Chill"}, names)
+	assert.Len(t, export.Playlists[0].Songs, 2)
+	assert.Len(t, export.Uploads, 1)
+
+	encoded, err := json.Marshal(export)
+	require.NoError(t, err)
+	assert.NotContains(t, string(encoded), "password")
+	assert.NotContains(t, string(encoded), "otheruser")
+	assert.NotContains(t, string(encoded), "Shared")
+
+	t.Run("Unknown user", func(t *testing.T) {
+		_, err := service.ExportUserData(99999)
+		assert.EqualError(t, err, "user not found")
+	})
+}
+
+func TestUploadProfileImageRemovesPrevious(t *testing.T) {
+	service, storageDir, userID, cleanup := setupTestUserService(t)
+	defer cleanup()
+
+	profilePath := func() string {
+		var path string
+		require.NoError(t, service.db.QueryRow(`SELECT profile_image_path FROM users WHERE id = ?`, userID).Scan(&path))
+		return path
+	}
+
+	require.NoError(t, service.UploadProfileImage(userID, newTestFileHeader(t, "first.png", newTestPNG(t, 64, 64))))
+	first := profilePath()
+	assert.FileExists(t, filepath.Join(storageDir, first))
+
+	require.NoError(t, service.UploadProfileImage(userID, newTestFileHeader(t, "second.webp", newTestWebP(64, 64))))
+	second := profilePath()
+	assert.NotEqual(t, first, second)
+
+	assert.NoFileExists(t, filepath.Join(storageDir, first), "the replaced avatar is deleted")
+	assert.FileExists(t, filepath.Join(storageDir, second))
+	assert.Len(t, listStoredFiles(t, storageDir), 1)
+}
+
+func TestUploadProfileImageFormats(t *testing.T) {
+	service, storageDir, userID, cleanup := setupTestUserService(t)
+	defer cleanup()
+
+	t.Run("WebP is accepted", func(t *testing.T) {
+		require.NoError(t, service.UploadProfileImage(userID, newTestFileHeader(t, "me.webp", newTestWebP(800, 600))))
+
+		var path string
+		require.NoError(t, service.db.QueryRow(`SELECT profile_image_path FROM users WHERE id = ?`, userID).Scan(&path))
+		assert.Equal(t, ".webp", filepath.Ext(path))
+		assert.FileExists(t, filepath.Join(storageDir, path))
+	})
+
+	t.Run("Oversized dimensions are rejected", func(t *testing.T) {
+		// Both compress to a few hundred bytes, well under the size cap
+		err := service.UploadProfileImage(userID, newTestFileHeader(t, "wide.png", newTestPNG(t, maxImageDimension+1, 1)))
+		assert.EqualError(t, err, "image too large. Maximum size is 4000x4000 pixels")
+
+		err = service.UploadProfileImage(userID, newTestFileHeader(t, "bomb.webp", newTestWebP(16000, 16000)))
+		assert.EqualError(t, err, "image too large. Maximum size is 4000x4000 pixels")
+	})
+
+	t.Run("Content must match the extension", func(t *testing.T) {
+		err := service.UploadProfileImage(userID, newTestFileHeader(t, "fake.png", []byte("not an image")))
+		assert.EqualError(t, err, "file is not a valid image")
+
+		err = service.UploadProfileImage(userID, newTestFileHeader(t, "renamed.png", newTestWebP(64, 64)))
+		assert.EqualError(t, err, "file content does not match its extension")
+
+		err = service.UploadProfileImage(userID, newTestFileHeader(t, "me.gif", []byte("GIF89a")))
+		assert.Error(t, err)
+	})
+
+	assert.Len(t, listStoredFiles(t, storageDir), 1, "rejected uploads leave nothing behind")
+}
+
+func TestAVIFImageSize(t *testing.T) {
+	ftyp := []byte("\x00\x00\x00\x14ftypavif\x00\x00\x00\x00mif1")
+	ispe := func(width, height uint32) []byte {
+		box := []byte("\x00\x00\x00\x14ispe\x00\x00\x00\x00")
+		box = binary.BigEndian.AppendUint32(box, width)
+		return binary.BigEndian.AppendUint32(box, height)
+	}
+
+	file := append(append(append([]byte{}, ftyp...), ispe(320, 240)...), ispe(64, 48)...)
+	assert.NoError(t, checkImage(".avif", bytes.NewReader(file)))
+
+	file = append(append([]byte{}, ftyp...), ispe(8192, 8192)...)
+	assert.Error(t, checkImage(".avif", bytes.NewReader(file)))
+}
+
+func TestUploadProfileImageResizes(t *testing.T) {
+	service, storageDir, userID, cleanup := setupTestUserService(t)
+	defer cleanup()
+
+	imageSize := func(path string) (string, int, int) {
+		file, err := os.Open(filepath.Join(storageDir, path))
+		require.NoError(t, err)
+		defer file.Close()
+		config, format, err := image.DecodeConfig(file)
+		require.NoError(t, err)
+		return format, config.Width, config.Height
+	}
+
+	require.NoError(t, service.UploadProfileImage(userID, newTestFileHeader(t, "wide.png", newTestPNG(t, 1000, 500))))
+	profile, err := service.GetProfile(userID)
+	require.NoError(t, err)
+	require.NotNil(t, profile.ProfileImageMediumPath)
+	require.NotNil(t, profile.ProfileImageThumbPath)
+
+	format, width, height := imageSize(*profile.ProfileImagePath)
+	assert.Equal(t, []interface{}{"png", 1000, 500}, []interface{}{format, width, height}, "the original is kept as uploaded")
+	format, width, height = imageSize(*profile.ProfileImageMediumPath)
+	assert.Equal(t, []interface{}{"png", 256, 256}, []interface{}{format, width, height})
+	format, width, height = imageSize(*profile.ProfileImageThumbPath)
+	assert.Equal(t, []interface{}{"png", 64, 64}, []interface{}{format, width, height})
+
+	t.Run("Small images are not enlarged", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 100, 120)), nil))
+		require.NoError(t, service.UploadProfileImage(userID, newTestFileHeader(t, "small.jpg", buf.Bytes())))
+
+		profile, err := service.GetProfile(userID)
+		require.NoError(t, err)
+		format, width, height := imageSize(*profile.ProfileImageMediumPath)
+		assert.Equal(t, []interface{}{"jpeg", 100, 100}, []interface{}{format, width, height})
+		format, width, height = imageSize(*profile.ProfileImageThumbPath)
+		assert.Equal(t, []interface{}{"jpeg", 64, 64}, []interface{}{format, width, height})
+		assert.Len(t, listStoredFiles(t, storageDir), 3, "the previous picture's copies are removed too")
+	})
+
+	t.Run("Undecodable images fall back to the original", func(t *testing.T) {
+		require.NoError(t, service.UploadProfileImage(userID, newTestFileHeader(t, "me.webp", newTestWebP(300, 300))))
+
+		profile, err := service.GetProfile(userID)
+		require.NoError(t, err)
+		assert.Equal(t, *profile.ProfileImagePath, *profile.ProfileImageMediumPath)
+		assert.Equal(t, *profile.ProfileImagePath, *profile.ProfileImageThumbPath)
+		assert.Len(t, listStoredFiles(t, storageDir), 1)
+	})
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"database/sql"
+	"tunetudo/logger"
+	"tunetudo/models"
+)
+
+// GetStats summarises userID's plays and library. Each figure is a single
+// grouped aggregate over plays, so the cost doesn't grow with queries per song
+func (s *UserService) GetStats(userID int) (models.UserStats, error) {
+	var stats models.UserStats
+
+	err := s.db.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM plays WHERE user_id = ?),
+			(SELECT COALESCE(SUM(s.duration_seconds), 0)
+			 FROM plays p JOIN songs s ON s.id = p.song_id
+			 WHERE p.user_id = ?),
+			(SELECT COUNT(*) FROM playlists WHERE user_id = ?),
+			(SELECT COUNT(*) FROM uploads WHERE user_id = ?)
+	`, userID, userID, userID, userID).Scan(
+		&stats.TotalPlays, &stats.TotalListeningSeconds, &stats.PlaylistCount, &stats.UploadCount,
+	)
+	if err != nil {
+		logger.Error(logger.CategoryDB, "Failed to compute user stats", err)
+		return stats, internalError("failed to fetch stats", err)
+	}
+
+	// Ties go to whichever was played most recently
+	var artist models.Artist
+	err = s.db.QueryRow(`
+		SELECT a.id, a.name, COUNT(*) AS play_count
+		FROM plays p
+		JOIN songs s ON s.id = p.song_id
+		JOIN artists a ON a.id = s.artist_id
+		WHERE p.user_id = ?
+		GROUP BY a.id
+		ORDER BY play_count DESC, MAX(p.id) DESC
+		LIMIT 1
+	`, userID).Scan(&artist.ID, &artist.Name, &stats.TopArtistPlays)
+	if err == nil {
+		stats.TopArtist = &artist
+	} else if err != sql.ErrNoRows {
+		logger.Error(logger.CategoryDB, "Failed to compute top artist", err)
+		return stats, internalError("failed to fetch stats", err)
+	}
+
+	var category models.Category
+	err = s.db.QueryRow(`
+		SELECT c.id, c.name, c.description, COUNT(*) AS play_count
+		FROM plays p
+		JOIN songs s ON s.id = p.song_id
+		JOIN categories c ON c.id = s.category_id
+		WHERE p.user_id = ?
+		GROUP BY c.id
+		ORDER BY play_count DESC, MAX(p.id) DESC
+		LIMIT 1
+	`, userID).Scan(&category.ID, &category.Name, &category.Description, &stats.TopCategoryPlays)
+	if err == nil {
+		stats.TopCategory = &category
+	} else if err != sql.ErrNoRows {
+		logger.Error(logger.CategoryDB, "Failed to compute top category", err)
+		return stats, internalError("failed to fetch stats", err)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func insertStatsSong(t *testing.T, db *sql.DB, title, artist string, categoryID, duration int) int {
+	result, err := db.Exec(`INSERT INTO artists (name, name_key) VALUES (?, ?)`, artist, artist)
+	require.NoError(t, err)
+	artistID, _ := result.LastInsertId()
+
+	result, err = db.Exec(`INSERT INTO songs (title, artist_id, category_id, duration_seconds, file_path, format)
+		VALUES (?, ?, ?, ?, '/test/song.mp3', 'mp3')`, title, artistID, categoryID, duration)
+	require.NoError(t, err)
+	songID, _ := result.LastInsertId()
+	return int(songID)
+}
+
+func recordPlays(t *testing.T, db *sql.DB, userID, songID, count int) {
+	for i := 0; i < count; i++ {
+		_, err := db.Exec(`INSERT INTO plays (user_id, song_id) VALUES (?, ?)`, userID, songID)
+		require.NoError(t, err)
+	}
+}
+
+func TestGetStats(t *testing.T) {
+	service, _, userID, cleanup := setupTestUserService(t)
+	defer cleanup()
+
+	t.Run("No plays yet", func(t *testing.T) {
+		stats, err := service.GetStats(userID)
+		require.NoError(t, err)
+		assert.Zero(t, stats.TotalPlays)
+		assert.Nil(t, stats.TopArtist)
+		assert.Nil(t, stats.TopCategory)
+	})
+
+	// Rock (2) has one heavily played song; Jazz (3) spreads more plays
+	// across two artists, so top artist and top category disagree
+	rock := insertStatsSong(t, service.db, "Anthem", "Loud Band", 2, 200)
+	jazzA := insertStatsSong(t, service.db, "Blue", "Trio", 3, 100)
+	jazzB := insertStatsSong(t, service.db, "Green", "Quartet", 3, 60)
+	recordPlays(t, service.db, userID, rock, 4)
+	recordPlays(t, service.db, userID, jazzA, 3)
+	recordPlays(t, service.db, userID, jazzB, 2)
+
+	// Another user's plays are not counted
+	result, err := service.db.Exec(`INSERT INTO users (username, email, password_hash) VALUES ('other', 'other@test.com', 'hash')`)
+	require.NoError(t, err)
+	otherID, _ := result.LastInsertId()
+	recordPlays(t, service.db, int(otherID), jazzB, 10)
+
+	_, err = service.db.Exec(`INSERT INTO playlists (user_id, name) VALUES (?, 'Mine'), (?, 'Also Mine')`, userID, userID)
+	require.NoError(t, err)
+	_, err = service.db.Exec(`INSERT INTO uploads (user_id, original_filename) VALUES (?, 'demo.mp3')`, userID)
+	require.NoError(t, err)
+
+	stats, err := service.GetStats(userID)
+	require.NoError(t, err)
+	assert.Equal(t, 9, stats.TotalPlays)
+	assert.Equal(t, 4*200+3*100+2*60, stats.TotalListeningSeconds)
+	require.NotNil(t, stats.TopArtist)
+	assert.Equal(t, "Loud Band", stats.TopArtist.Name)
+	assert.Equal(t, 4, stats.TopArtistPlays)
+	require.NotNil(t, stats.TopCategory)
+	assert.Equal(t, "Jazz", stats.TopCategory.Name)
+	assert.Equal(t, 5, stats.TopCategoryPlays)
+	assert.Equal(t, 2, stats.PlaylistCount)
+	assert.Equal(t, 1, stats.UploadCount)
+}
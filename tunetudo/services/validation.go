@@ -0,0 +1,92 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+const (
+	maxEmailLength      = 254
+	maxEmailLocalLength = 64
+
+	minUsernameLength = 3
+	maxUsernameLength = 32
+)
+
+var (
+	errInvalidEmail  = errors.New("invalid email address")
+	errEmailTooLong  = fmt.Errorf("email address must be at most %d characters", maxEmailLength)
+	errUsernameChars = errors.New("username may only contain letters, digits, '.', '_' and '-'")
+)
+
+// NormalizeUsername trims username and checks it is minUsernameLength to
+// maxUsernameLength characters of ASCII letters, digits, '.', '_' and '-'
+func NormalizeUsername(username string) (string, error) {
+	username = strings.TrimSpace(username)
+	if len(username) < minUsernameLength {
+		return "", fmt.Errorf("username must be at least %d characters", minUsernameLength)
+	}
+	if len(username) > maxUsernameLength {
+		return "", fmt.Errorf("username must be at most %d characters", maxUsernameLength)
+	}
+	for _, r := range username {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-') {
+			return "", errUsernameChars
+		}
+	}
+	return username, nil
+}
+
+// NormalizeEmail validates a bare address such as "user@example.com" and
+// returns it trimmed with a lowercased domain, ready for storage or lookup.
+// Display-name forms ("Bob <bob@example.com>") are rejected
+func NormalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return "", errInvalidEmail
+	}
+	if len(email) > maxEmailLength {
+		return "", errEmailTooLong
+	}
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != email {
+		return "", errInvalidEmail
+	}
+
+	at := strings.LastIndex(email, "@")
+	local, domain := email[:at], email[at+1:]
+	if len(local) > maxEmailLocalLength || !isValidEmailDomain(domain) {
+		return "", errInvalidEmail
+	}
+
+	return local + "@" + strings.ToLower(domain), nil
+}
+
+// IsValidEmail reports whether email is a usable address
+func IsValidEmail(email string) bool {
+	_, err := NormalizeEmail(email)
+	return err == nil
+}
+
+// isValidEmailDomain requires a dotted hostname made of non-empty labels of
+// letters, digits and inner hyphens; mail.ParseAddress alone accepts "a@localhost"
+func isValidEmailDomain(domain string) bool {
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		valid    bool
+	}{
+		{"simple address", "user@example.com", "user@example.com", true},
+		{"subdomain", "user@mail.example.co.uk", "user@mail.example.co.uk", true},
+		{"plus tag", "user+music@example.com", "user+music@example.com", true},
+		{"surrounding whitespace", "  user@example.com\t", "user@example.com", true},
+		{"domain lowercased", "User@Example.COM", "User@example.com", true},
+		{"hyphenated domain", "user@my-site.example", "user@my-site.example", true},
+		{"empty", "", "", false},
+		{"missing at", "user.example.com", "", false},
+		{"missing local part", "@example.com", "", false},
+		{"dot-only domain", "a@.", "", false},
+		{"undotted domain", "user@localhost", "", false},
+		{"empty domain label", "user@example..com", "", false},
+		{"trailing dot", "user@example.com.", "", false},
+		{"leading hyphen label", "user@-example.com", "", false},
+		{"two at signs", "user@@example.com", "", false},
+		{"display name", "Bob <bob@example.com>", "", false},
+		{"embedded space", "us er@example.com", "", false},
+		{"local part too long", strings.Repeat("a", 65) + "@example.com", "", false},
+		{"address too long", "user@" + strings.Repeat("a", 250) + ".com", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeEmail(tt.input)
+			if !tt.valid {
+				assert.Error(t, err)
+				assert.False(t, IsValidEmail(tt.input))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+			assert.True(t, IsValidEmail(tt.input))
+		})
+	}
+}
+
+func TestNormalizeUsername(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		errorMsg string
+	}{
+		{"simple", "listener", "listener", ""},
+		{"allowed symbols", "dj.night_owl-7", "dj.night_owl-7", ""},
+		{"surrounding whitespace", "  listener ", "listener", ""},
+		{"minimum length", "abc", "abc", ""},
+		{"maximum length", strings.Repeat("a", 32), strings.Repeat("a", 32), ""},
+		{"empty", "", "", "username must be at least 3 characters"},
+		{"too short", "ab", "", "username must be at least 3 characters"},
+		{"too short after trimming", "  ab  ", "", "username must be at least 3 characters"},
+		{"too long", strings.Repeat("a", 33), "", "username must be at most 32 characters"},
+		{"inner space", "night owl", "", "username may only contain letters, digits, '.', '_' and '-'"},
+		{"at sign", "fan@home", "", "username may only contain letters, digits, '.', '_' and '-'"},
+		{"markup", "<b>bold</b>", "", "username may only contain letters, digits, '.', '_' and '-'"},
+		{"non-ASCII letters", "müller", "", "username may only contain letters, digits, '.', '_' and '-'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeUsername(tt.input)
+			if tt.errorMsg != "" {
+				assert.EqualError(t, err, tt.errorMsg)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
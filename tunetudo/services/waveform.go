@@ -0,0 +1,259 @@
+package services
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	apperrors "tunetudo/errors"
+	"tunetudo/logger"
+)
+
+// MaxWaveformBuckets bounds how finely a waveform can be requested, which
+// also bounds how many cached variants a song can accumulate
+const MaxWaveformBuckets = 2000
+
+// GenerateWaveform returns buckets peak values in [0,1] for a song, scaled
+// so the loudest bucket is 1. Peaks are computed on first request and
+// cached per bucket count until the song's file changes
+func (s *PlaybackService) GenerateWaveform(songID int, buckets int) ([]float32, error) {
+	if buckets < 1 || buckets > MaxWaveformBuckets {
+		return nil, apperrors.ValidationError(fmt.Sprintf("buckets must be between 1 and %d", MaxWaveformBuckets), nil)
+	}
+
+	var filePath string
+	err := s.db.QueryRow(`SELECT file_path FROM songs WHERE id = ? AND deleted_at IS NULL`, songID).Scan(&filePath)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.Error(logger.CategoryDB, "Failed to look up song for waveform", err)
+		}
+		return nil, apperrors.NotFoundError("track not found")
+	}
+
+	if peaks, ok := s.cachedWaveform(songID, buckets, filePath); ok {
+		return peaks, nil
+	}
+
+	if !strings.EqualFold(filepath.Ext(filePath), ".wav") {
+		return nil, apperrors.ValidationError("waveforms are only available for WAV tracks", nil)
+	}
+
+	file, err := os.Open(filepath.Join(s.storagePath, filePath))
+	if err != nil {
+		logger.Warning(logger.CategoryFile, "Song file not found on disk: song_id=%d", songID)
+		return nil, apperrors.NotFoundError("track not found")
+	}
+	defer file.Close()
+
+	peaks, err := readWAVPeaks(bufio.NewReader(file), buckets)
+	if err != nil {
+		logger.Warning(logger.CategoryFile, "Failed to decode WAV for waveform: song_id=%d", songID)
+		return nil, apperrors.ValidationError("track audio could not be decoded", err)
+	}
+
+	// A failed cache write only costs a recomputation next time
+	if encoded, err := json.Marshal(peaks); err == nil {
+		if _, err := s.db.Exec(`
+			INSERT INTO waveforms (song_id, buckets, file_path, peaks)
+			VALUES (?, ?, ?, ?)
+			ON CONFLICT(song_id, buckets) DO UPDATE SET
+				file_path = excluded.file_path,
+				peaks = excluded.peaks,
+				created_at = CURRENT_TIMESTAMP
+		`, songID, buckets, filePath, string(encoded)); err != nil {
+			logger.Error(logger.CategoryDB, "Failed to cache waveform", err)
+		}
+	}
+
+	return peaks, nil
+}
+
+// cachedWaveform returns stored peaks computed from the song's current file
+func (s *PlaybackService) cachedWaveform(songID, buckets int, filePath string) ([]float32, bool) {
+	var encoded string
+	err := s.db.QueryRow(
+		`SELECT peaks FROM waveforms WHERE song_id = ? AND buckets = ? AND file_path = ?`,
+		songID, buckets, filePath,
+	).Scan(&encoded)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.Error(logger.CategoryDB, "Failed to load cached waveform", err)
+		}
+		return nil, false
+	}
+
+	var peaks []float32
+	if err := json.Unmarshal([]byte(encoded), &peaks); err != nil || len(peaks) != buckets {
+		return nil, false
+	}
+	return peaks, true
+}
+
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xFFFE
+)
+
+var errUnsupportedWAV = errors.New("unsupported WAV encoding")
+
+type wavFormat struct {
+	encoding      uint16
+	channels      int
+	bitsPerSample int
+	blockAlign    int
+}
+
+// readWAVPeaks streams the samples of a RIFF/WAVE file, keeping the largest
+// absolute sample of any channel per bucket
+func readWAVPeaks(r io.Reader, buckets int) ([]float32, error) {
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return nil, errors.New("not a WAV file")
+	}
+
+	var format *wavFormat
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return nil, errors.New("WAV file has no data chunk")
+		}
+		id := string(chunk[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+
+		switch id {
+		case "fmt ":
+			parsed, err := readWAVFormat(r, size)
+			if err != nil {
+				return nil, err
+			}
+			format = parsed
+		case "data":
+			if format == nil {
+				return nil, errors.New("WAV data chunk precedes its format")
+			}
+			return readWAVSamples(r, *format, size, buckets)
+		default:
+			// Chunks are padded to an even size
+			if _, err := io.CopyN(io.Discard, r, size+size%2); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func readWAVFormat(r io.Reader, size int64) (*wavFormat, error) {
+	if size < 16 || size > 1024 {
+		return nil, errors.New("invalid WAV format chunk")
+	}
+	raw := make([]byte, size+size%2)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return nil, err
+	}
+
+	format := &wavFormat{
+		encoding:      binary.LittleEndian.Uint16(raw[0:2]),
+		channels:      int(binary.LittleEndian.Uint16(raw[2:4])),
+		blockAlign:    int(binary.LittleEndian.Uint16(raw[12:14])),
+		bitsPerSample: int(binary.LittleEndian.Uint16(raw[14:16])),
+	}
+	// Extensible files carry the real encoding in their sub-format GUID
+	if format.encoding == wavFormatExtensible && size >= 26 {
+		format.encoding = binary.LittleEndian.Uint16(raw[24:26])
+	}
+
+	switch {
+	case format.channels < 1:
+		return nil, errUnsupportedWAV
+	case format.encoding == wavFormatPCM && (format.bitsPerSample == 8 || format.bitsPerSample == 16 ||
+		format.bitsPerSample == 24 || format.bitsPerSample == 32):
+	case format.encoding == wavFormatFloat && format.bitsPerSample == 32:
+	default:
+		return nil, errUnsupportedWAV
+	}
+	if format.blockAlign != format.channels*format.bitsPerSample/8 {
+		return nil, errors.New("invalid WAV block alignment")
+	}
+	return format, nil
+}
+
+func readWAVSamples(r io.Reader, format wavFormat, size int64, buckets int) ([]float32, error) {
+	frames := size / int64(format.blockAlign)
+	if frames == 0 {
+		return nil, errors.New("WAV file has no samples")
+	}
+
+	peaks := make([]float32, buckets)
+	sampleBytes := format.bitsPerSample / 8
+	buf := make([]byte, format.blockAlign*4096)
+
+	var frame int64
+	for frame < frames {
+		n, err := io.ReadFull(r, buf)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// Tolerate a truncated final block; most writers get the size right
+			err = nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n < format.blockAlign {
+			break
+		}
+
+		for offset := 0; offset+format.blockAlign <= n && frame < frames; offset += format.blockAlign {
+			bucket := int(frame * int64(buckets) / frames)
+			for ch := 0; ch < format.channels; ch++ {
+				start := offset + ch*sampleBytes
+				if amplitude := wavSample(buf[start:start+sampleBytes], format); amplitude > peaks[bucket] {
+					peaks[bucket] = amplitude
+				}
+			}
+			frame++
+		}
+	}
+
+	var loudest float32
+	for _, peak := range peaks {
+		if peak > loudest {
+			loudest = peak
+		}
+	}
+	if loudest > 0 {
+		for i := range peaks {
+			peaks[i] = float32(math.Min(float64(peaks[i]/loudest), 1))
+		}
+	}
+	return peaks, nil
+}
+
+// wavSample decodes one sample as an absolute amplitude relative to full scale
+func wavSample(b []byte, format wavFormat) float32 {
+	var value float64
+	switch {
+	case format.encoding == wavFormatFloat:
+		value = float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+		if math.IsNaN(value) {
+			return 0
+		}
+	case format.bitsPerSample == 8:
+		value = (float64(b[0]) - 128) / 128
+	case format.bitsPerSample == 16:
+		value = float64(int16(binary.LittleEndian.Uint16(b))) / 32768
+	case format.bitsPerSample == 24:
+		value = float64(int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24)>>8) / 8388608
+	default:
+		value = float64(int32(binary.LittleEndian.Uint32(b))) / 2147483648
+	}
+	return float32(math.Min(math.Abs(value), 1))
+}
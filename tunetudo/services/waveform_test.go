@@ -0,0 +1,137 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestWAV writes a 16-bit stereo PCM fixture whose amplitude ramps up
+// from silence to full scale over frames samples
+func writeTestWAV(t *testing.T, path string, frames int) {
+	var data bytes.Buffer
+	for i := 0; i < frames; i++ {
+		amplitude := float64(i) / float64(frames-1)
+		sample := int16(amplitude * 32767 * math.Sin(float64(i)*0.3))
+		binary.Write(&data, binary.LittleEndian, sample)
+		binary.Write(&data, binary.LittleEndian, -sample)
+	}
+
+	var wav bytes.Buffer
+	wav.WriteString("RIFF")
+	binary.Write(&wav, binary.LittleEndian, uint32(36+data.Len()))
+	wav.WriteString("WAVEfmt ")
+	binary.Write(&wav, binary.LittleEndian, struct {
+		Size                      uint32
+		Encoding, Channels        uint16
+		SampleRate, ByteRate      uint32
+		BlockAlign, BitsPerSample uint16
+	}{16, wavFormatPCM, 2, 8000, 8000 * 4, 4, 16})
+	wav.WriteString("data")
+	binary.Write(&wav, binary.LittleEndian, uint32(data.Len()))
+	wav.Write(data.Bytes())
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, wav.Bytes(), 0644))
+}
+
+func insertWaveformSong(t *testing.T, service *PlaybackService, filePath string) int {
+	result, err := service.db.Exec(
+		`INSERT INTO songs (title, artist_id, duration_seconds, file_path, format) VALUES (?, 1, 1, ?, ?)`,
+		"Tone", filePath, filepath.Ext(filePath)[1:],
+	)
+	require.NoError(t, err)
+	id, _ := result.LastInsertId()
+	return int(id)
+}
+
+func TestGenerateWaveform(t *testing.T) {
+	service, cleanup := setupTestPlaybackService(t)
+	defer cleanup()
+
+	wavPath := filepath.Join(service.storagePath, "test", "tone.wav")
+	writeTestWAV(t, wavPath, 8000)
+	songID := insertWaveformSong(t, service, "test/tone.wav")
+
+	for _, buckets := range []int{1, 50, 1500} {
+		peaks, err := service.GenerateWaveform(songID, buckets)
+		require.NoError(t, err)
+		require.Len(t, peaks, buckets)
+
+		var loudest float32
+		for _, peak := range peaks {
+			assert.GreaterOrEqual(t, peak, float32(0))
+			assert.LessOrEqual(t, peak, float32(1))
+			if peak > loudest {
+				loudest = peak
+			}
+		}
+		assert.Equal(t, float32(1), loudest, "peaks are scaled to the loudest bucket")
+		if buckets > 1 {
+			assert.Less(t, peaks[0], peaks[buckets-1], "the fixture ramps up")
+		}
+	}
+}
+
+func TestGenerateWaveformIsCached(t *testing.T) {
+	service, cleanup := setupTestPlaybackService(t)
+	defer cleanup()
+
+	wavPath := filepath.Join(service.storagePath, "test", "tone.wav")
+	writeTestWAV(t, wavPath, 8000)
+	songID := insertWaveformSong(t, service, "test/tone.wav")
+
+	first, err := service.GenerateWaveform(songID, 20)
+	require.NoError(t, err)
+	assert.Equal(t, 1, countRows(t, service.db, "waveforms"))
+
+	// Later requests are served from the cache without reading the file
+	require.NoError(t, os.Remove(wavPath))
+	second, err := service.GenerateWaveform(songID, 20)
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+
+	// Repointing the song at another file invalidates the cached peaks
+	_, err = service.db.Exec(`UPDATE songs SET file_path = ? WHERE id = ?`, "test/missing.wav", songID)
+	require.NoError(t, err)
+	_, err = service.GenerateWaveform(songID, 20)
+	assert.Error(t, err)
+}
+
+func TestGenerateWaveformRejectsBadInput(t *testing.T) {
+	service, cleanup := setupTestPlaybackService(t)
+	defer cleanup()
+
+	writeTestWAV(t, filepath.Join(service.storagePath, "test", "tone.wav"), 100)
+	wavID := insertWaveformSong(t, service, "test/tone.wav")
+	mp3ID := insertWaveformSong(t, service, "test/song.mp3")
+
+	tests := []struct {
+		name    string
+		songID  int
+		buckets int
+	}{
+		{"zero buckets", wavID, 0},
+		{"too many buckets", wavID, MaxWaveformBuckets + 1},
+		{"non-WAV track", mp3ID, 10},
+		{"unknown song", 99999, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.GenerateWaveform(tt.songID, tt.buckets)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestReadWAVPeaksRejectsNonWAV(t *testing.T) {
+	_, err := readWAVPeaks(bytes.NewReader([]byte("ID3 this is an mp3")), 10)
+	assert.Error(t, err)
+}
@@ -52,13 +52,13 @@ async function loadCategories() {
 async function loadSongs() {
     try {
         const response = await AdminAPI.getAllSongs(pageSize, currentPage * pageSize);
-        displaySongs(response.data);
+        displaySongs(response.data.items, response.data.meta);
     } catch (error) {
         showAlert('Failed to load songs', 'error');
     }
 }
 
-function displaySongs(songs) {
+function displaySongs(songs, meta) {
     const tbody = document.getElementById('songsTableBody');
     
     if (!songs || songs.length === 0) {
@@ -85,7 +85,7 @@ function displaySongs(songs) {
     }).join('');
     
     updatePagination();
-    document.getElementById('nextBtn').disabled = songs.length < pageSize;
+    document.getElementById('nextBtn').disabled = !meta.has_more;
 }
 
 function formatDuration(seconds) {
@@ -116,7 +116,7 @@ function loadPreviousPage() {
 async function loadUsers() {
     try {
         const response = await AdminAPI.getAllUsers();
-        displayUsers(response.data);
+        displayUsers(response.data.items);
     } catch (error) {
         showAlert('Failed to load users', 'error');
     }
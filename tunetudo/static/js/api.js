@@ -51,7 +51,10 @@ async function apiRequest(url, options = {}) {
     const data = await response.json();
 
     if (!response.ok) {
-        throw new Error(data.message || 'Request failed');
+        // Validation failures list every invalid field under data.fields
+        const fields = data.data && data.data.fields;
+        const message = fields ? Object.values(fields).join('. ') : data.message;
+        throw new Error(message || 'Request failed');
     }
 
     return data;
@@ -109,8 +112,10 @@ const SongsAPI = {
         return apiRequest(`/songs/recent?limit=${limit}`);
     },
 
-    getStreamUrl(songId) {
-        return `${API_BASE_URL}/songs/${songId}/stream`;
+    // Streams need a short-lived signed URL from the server
+    async getStreamUrl(songId) {
+        const response = await apiRequest(`/songs/${songId}/stream-url`);
+        return new URL(response.data.url, API_BASE_URL).href;
     },
 };
 
@@ -176,6 +181,23 @@ const UserAPI = {
     async getUserUploads() {
         return apiRequest('/uploads');
     },
+
+    async changePassword(currentPassword, newPassword) {
+        return apiRequest('/profile/password', {
+            method: 'PUT',
+            body: JSON.stringify({
+                current_password: currentPassword,
+                new_password: newPassword,
+            }),
+        });
+    },
+
+    async deleteAccount(password) {
+        return apiRequest('/profile', {
+            method: 'DELETE',
+            body: JSON.stringify({ password }),
+        });
+    },
 };
 
 // Admin API
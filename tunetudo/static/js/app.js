@@ -92,16 +92,18 @@ async function performSearch() {
 function displaySearchResults(results) {
     const resultsDiv = document.getElementById('searchResults');
     
-    if (!results.songs.length && !results.artists.length && !results.albums.length) {
+    const songs = results.songs ? results.songs.items : [];
+    
+    if (!songs.length && !results.artists.length && !results.albums.length) {
         resultsDiv.innerHTML = '<p class="empty-state">No results found</p>';
         return;
     }
     
     let html = '<h3>Search Results</h3>';
     
-    if (results.songs && results.songs.length > 0) {
+    if (songs.length > 0) {
         html += '<h4>Songs</h4><div class="songs-grid">';
-        results.songs.forEach(song => {
+        songs.forEach(song => {
             html += createSongCard(song);
         });
         html += '</div>';
@@ -195,7 +197,7 @@ async function viewCategory(categoryId, categoryName) {
     try {
         const response = await SearchAPI.getSongsByCategory(categoryId);
         
-        if (response.data.length === 0) {
+        if (response.data.items.length === 0) {
             showAlert('No tracks available in this category');
             return;
         }
@@ -204,7 +206,7 @@ async function viewCategory(categoryId, categoryName) {
         resultsDiv.innerHTML = `
             <h3>${categoryName}</h3>
             <div class="songs-grid">
-                ${response.data.map(song => createSongCard(song)).join('')}
+                ${response.data.items.map(song => createSongCard(song)).join('')}
             </div>
         `;
         
@@ -236,7 +238,7 @@ function displayRecentSongs(songs) {
 }
 
 // Audio player functions
-function playSong(songId, title, artist) {
+async function playSong(songId, title, artist) {
     const audioPlayer = document.getElementById('audioPlayer');
     const audioElement = document.getElementById('audioElement');
     const titleElement = document.getElementById('playerSongTitle');
@@ -246,7 +248,7 @@ function playSong(songId, title, artist) {
     titleElement.textContent = title;
     artistElement.textContent = artist;
     
-    audioElement.src = SongsAPI.getStreamUrl(songId);
+    audioElement.src = await SongsAPI.getStreamUrl(songId);
     audioElement.play();
     
     audioPlayer.style.display = 'block';
@@ -297,7 +299,7 @@ async function showAddToPlaylistModal(songId) {
     
     try {
         const response = await PlaylistAPI.getUserPlaylists();
-        const playlists = response.data;
+        const playlists = response.data.items;
         
         if (!playlists || playlists.length === 0) {
             showAlert('No playlists found. Create a playlist first!', 'error');
@@ -11,7 +11,7 @@ let currentPlaylistId = null;
 async function loadPlaylists() {
     try {
         const response = await PlaylistAPI.getUserPlaylists();
-        displayPlaylists(response.data);
+        displayPlaylists(response.data.items);
     } catch (error) {
         showAlert('Failed to load playlists', 'error');
     }
@@ -151,7 +151,7 @@ async function deleteCurrentPlaylist() {
 }
 
 // Audio player functions
-function playSong(songId, title, artist) {
+async function playSong(songId, title, artist) {
     const audioPlayer = document.getElementById('audioPlayer');
     const audioElement = document.getElementById('audioElement');
     const titleElement = document.getElementById('playerSongTitle');
@@ -160,7 +160,7 @@ function playSong(songId, title, artist) {
     titleElement.textContent = title;
     artistElement.textContent = artist;
     
-    audioElement.src = SongsAPI.getStreamUrl(songId);
+    audioElement.src = await SongsAPI.getStreamUrl(songId);
     audioElement.play();
     
     audioPlayer.style.display = 'block';
@@ -41,8 +41,8 @@ async function loadStatistics() {
     try {
         // Load playlists count
         const playlistsResponse = await PlaylistAPI.getUserPlaylists();
-        const playlists = playlistsResponse.data;
-        document.getElementById('playlistCount').textContent = playlists.length;
+        const playlists = playlistsResponse.data.items;
+        document.getElementById('playlistCount').textContent = playlistsResponse.data.meta.total;
         
         // Calculate total songs in playlists
         let totalSongs = 0;
@@ -183,9 +183,13 @@ async function changePassword(event) {
         return;
     }
     
-    showAlert('Password change feature coming soon!', 'error');
-    // TODO: Implement password change API endpoint
-    closeChangePasswordModal();
+    try {
+        await UserAPI.changePassword(currentPassword, newPassword);
+        showAlert('Password changed successfully', 'success');
+        closeChangePasswordModal();
+    } catch (error) {
+        showAlert(error.message || 'Failed to change password', 'error');
+    }
 }
 
 // Delete account
@@ -198,8 +202,18 @@ function confirmDeleteAccount() {
 }
 
 async function deleteAccount() {
-    showAlert('Account deletion feature coming soon!', 'error');
-    // TODO: Implement account deletion API endpoint
+    const password = prompt('Enter your password to confirm account deletion');
+    if (!password) {
+        return;
+    }
+
+    try {
+        await UserAPI.deleteAccount(password);
+        removeAuthToken();
+        window.location.href = '/';
+    } catch (error) {
+        showAlert(error.message || 'Failed to delete account', 'error');
+    }
 }
 
 // Initialize
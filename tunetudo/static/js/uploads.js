@@ -129,7 +129,7 @@ async function uploadTrack(event) {
 }
 
 // Audio player functions
-function playSong(songId, title, artist) {
+async function playSong(songId, title, artist) {
     const audioPlayer = document.getElementById('audioPlayer');
     const audioElement = document.getElementById('audioElement');
     const titleElement = document.getElementById('playerSongTitle');
@@ -138,7 +138,7 @@ function playSong(songId, title, artist) {
     titleElement.textContent = title;
     artistElement.textContent = artist;
     
-    audioElement.src = SongsAPI.getStreamUrl(songId);
+    audioElement.src = await SongsAPI.getStreamUrl(songId);
     audioElement.play();
     
     audioPlayer.style.display = 'block';